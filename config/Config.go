@@ -2,12 +2,14 @@ package config
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"time"
 
 	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
 
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
@@ -79,7 +81,21 @@ func migrateDB(db *gorm.DB) {
 	log.Printf("🔄 Starting database migration...")
 	
 	start := time.Now()
-	err := db.AutoMigrate(
+	err := Migrasi(db)
+	
+	if err != nil {
+		log.Printf("⚠️ Migration warning: %v", err)
+		// Jangan fatal, biarkan aplikasi tetap running
+	} else {
+		log.Printf("✅ Migration completed in %v", time.Since(start))
+		migrasiBayarSyahriah(db)
+		migrasiKontenHTML(db)
+	}
+}
+
+// Migrasi membuat dan memperbarui semua tabel aplikasi, dipakai saat startup dan oleh test database
+func Migrasi(db *gorm.DB) error {
+	return db.AutoMigrate(
 		&models.User{},
 		&models.Keluarga{},
 		&models.Santri{},
@@ -95,13 +111,77 @@ func migrateDB(db *gorm.DB) {
 		&models.SosialMedia{},
 		&models.ProgramUnggulan{},
 		&models.LogAktivitas{},
+		&models.Jurnal{},
+		&models.JurnalEntri{},
+		&models.KunciAkun{},
+		&models.RefreshToken{},
+		&models.PasswordReset{},
+		&models.UrutanID{},
+		&models.PercobaanLogin{},
+		&models.Pembayaran{},
+		&models.PembayaranItem{},
+		&models.SyahriahBayar{},
+		&models.TarifDasar{},
+		&models.AturanTarif{},
+		&models.JobRun{},
+		&models.KunciJob{},
+		&models.PengingatTunggakan{},
+		&models.PengaturanPengingat{},
+		&models.Kwitansi{},
+		&models.KoreksiSaldo{},
+		&models.Media{},
+		&models.BeritaRevisi{},
+		&models.IndeksPencarian{},
+		&models.MigrasiData{},
 	)
-	
+}
+
+// migrasiKontenHTML merender konten berita dan pengumuman yang dibuat sebelum ada HTML hasil render
+func migrasiKontenHTML(db *gorm.DB) {
+	jumlah, err := services.MigrasiKontenHTML(db)
 	if err != nil {
-		log.Printf("⚠️ Migration warning: %v", err)
-		// Jangan fatal, biarkan aplikasi tetap running
-	} else {
-		log.Printf("✅ Migration completed in %v", time.Since(start))
+		log.Printf("⚠️ Migrasi konten HTML gagal: %v", err)
+		return
+	}
+	if jumlah > 0 {
+		log.Printf("✅ %d berita dan pengumuman dirender ke HTML", jumlah)
+	}
+}
+
+// migrasiBayarSyahriah memindahkan syahriah yang sudah lunas sebelum ada pencatatan cicilan ke tabel pembayaran,
+// lalu menghitung ulang rekap periode yang masih terbuka karena pemasukan kini diakui pada bulan uang diterima
+func migrasiBayarSyahriah(db *gorm.DB) {
+	jumlah, err := services.NewSyahriahBayarService(db).MigrasiBayarLama()
+	if err != nil {
+		log.Printf("⚠️ Migrasi pembayaran syahriah gagal: %v", err)
+		return
+	}
+	if jumlah == 0 {
+		return
+	}
+	log.Printf("✅ %d syahriah lunas dipindahkan ke tabel pembayaran", jumlah)
+
+	ledger := services.NewLedgerService(db)
+	periods, err := ledger.PeriodeJurnal()
+	if err != nil || len(periods) == 0 {
+		return
+	}
+	start, err := time.Parse("2006-01", periods[0])
+	if err != nil {
+		return
+	}
+	for bulan := start; bulan.Format("2006-01") <= periods[len(periods)-1]; bulan = bulan.AddDate(0, 1, 0) {
+		periode := bulan.Format("2006-01")
+		// Rekap periode yang sudah tutup buku adalah angka final dan tidak dihitung ulang
+		if err := services.CekPeriodeTerbuka(db, periode); err != nil {
+			if !errors.Is(err, services.ErrPeriodeDitutup) {
+				log.Printf("⚠️ Gagal memeriksa tutup buku %s: %v", periode, err)
+			}
+			continue
+		}
+		if _, err := ledger.MaterialisasiRekap(periode); err != nil {
+			log.Printf("⚠️ Gagal menghitung ulang rekap %s: %v", periode, err)
+		}
 	}
 }
 
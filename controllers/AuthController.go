@@ -1,61 +1,24 @@
 package controllers
 
 import (
+	"errors"
+	"math"
+	"strconv"
 	"net/http"
 	"time"
 	"fmt"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 	"tpq_asysyafii/config" 
 	"tpq_asysyafii/models"
-	"tpq_asysyafii/utils"
+	"tpq_asysyafii/services"
 )
 
+// generateCustomID mengambil ID user berikutnya (SA01, A001, W001, ...) dari tabel counter
 func generateCustomID(role models.UserRole) (string, error) {
-	var prefix string
-	switch role {
-	case models.RoleAdmin:
-		prefix = "A"
-	case models.RoleSuperAdmin:
-		prefix = "SA"
-	case models.RoleWali:
-		prefix = "W"
-	default:
-		return "", fmt.Errorf("role tidak valid")
-	}
-
-	// Cari ID terakhir untuk role tersebut
-	var lastUser models.User
-	err := config.DB.Where("id_user LIKE ?", prefix + "%").Order("id_user DESC").First(&lastUser).Error
-	
-	var nextNumber int
-	if err != nil {
-		// Jika tidak ada data sebelumnya, mulai dari 1
-		nextNumber = 1
-	} else {
-		// Ekstrak angka dari ID terakhir dan increment
-		var lastNumber int
-		if role == models.RoleSuperAdmin {
-			fmt.Sscanf(lastUser.IDUser, "SA%d", &lastNumber)
-		} else {
-			fmt.Sscanf(lastUser.IDUser, prefix + "%d", &lastNumber)
-		}
-		nextNumber = lastNumber + 1
-	}
-
-	// Format ID berdasarkan role
-	var customID string
-	switch role {
-	case models.RoleSuperAdmin:
-		customID = fmt.Sprintf("SA%02d", nextNumber)
-	case models.RoleAdmin:
-		customID = fmt.Sprintf("A%03d", nextNumber)
-	case models.RoleWali:
-		customID = fmt.Sprintf("W%03d", nextNumber)
-	}
-
-	return customID, nil
+	return services.NewUrutanIDService(config.DB).AlokasiIDUser(role)
 }
 
 func RegisterUser(c *gin.Context) {
@@ -78,9 +41,19 @@ func RegisterUser(c *gin.Context) {
 		return
 	}
 
-	// Default role = wali
+	// Registrasi mandiri (tanpa login) selalu sebagai wali; role lain hanya bisa diberikan
+	// lewat endpoint admin, dan hanya role di bawah role pembuatnya
 	role := models.RoleWali
-	if input.Role == string(models.RoleAdmin) || input.Role == string(models.RoleSuperAdmin) {
+	pembuatRole := c.GetString("role")
+	if pembuatRole != "" && input.Role != "" && input.Role != string(role) {
+		if !services.PeranDikenal(input.Role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "role tidak valid"})
+			return
+		}
+		if !services.BolehBeriPeran(pembuatRole, input.Role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "tidak boleh membuat user dengan role setara atau di atas role sendiri"})
+			return
+		}
 		role = models.UserRole(input.Role)
 	}
 
@@ -99,6 +72,7 @@ func RegisterUser(c *gin.Context) {
 		Password:      string(hashedPass),
 		Role:          role,
 		StatusAktif:   false,
+		StatusRegistrasi: models.RegistrasiMenunggu,
 		DibuatPada:    time.Now(),
 		DiperbaruiPada: time.Now(),
 	}
@@ -108,9 +82,22 @@ func RegisterUser(c *gin.Context) {
 		return
 	}
 
+	// Registrasi mandiri dicatat atas nama user baru itu sendiri
+	actorID := c.GetString("user_id")
+	if actorID == "" {
+		actorID = user.IDUser
+	}
+	catatLogOleh(config.DB, actorID, services.AksiCreate, services.TargetUser, user.IDUser, nil, user)
+
 	c.JSON(http.StatusCreated, gin.H{"message": "registrasi berhasil", "user": user})
 }
 
+// Pesan yang sama untuk user tidak ditemukan dan password salah, agar keberadaan akun tidak bocor
+const pesanLoginGagal = "kombinasi akun dan password salah"
+
+// hashPasswordSamaran dipakai untuk bcrypt saat user tidak ditemukan
+var hashPasswordSamaran, _ = bcrypt.GenerateFromPassword([]byte("bukan-password-siapa-pun"), bcrypt.DefaultCost)
+
 func LoginUser(c *gin.Context) {
 	var input struct {
 		Email       *string `json:"email"`
@@ -129,44 +116,92 @@ func LoginUser(c *gin.Context) {
 
 	// Cari user berdasarkan email, nama lengkap, atau no telp
 	query := config.DB
+	var kunciAkun string
 	if input.Email != nil && *input.Email != "" {
 		query = query.Where("email = ?", *input.Email)
+		kunciAkun = services.KunciIdentitasLogin(services.IdentitasEmail, *input.Email)
 	} else if input.NamaLengkap != "" {
 		query = query.Where("nama_lengkap = ?", input.NamaLengkap)
+		kunciAkun = services.KunciIdentitasLogin(services.IdentitasNama, input.NamaLengkap)
 	} else if input.NoTelp != "" {
 		query = query.Where("no_telp = ?", input.NoTelp)
+		kunciAkun = services.KunciIdentitasLogin(services.IdentitasTelp, input.NoTelp)
 	} else {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "masukkan email, nama_lengkap, atau no_telp"})
 		return
 	}
 
-	err = query.First(&user).Error
+	ip := c.ClientIP()
+	guard := services.NewLoginGuard(config.DB)
 
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "user tidak ditemukan"})
+	if err = query.First(&user).Error; err != nil {
+		user = models.User{}
+	}
+
+	// Tolak dulu jika identitas atau IP sedang dikunci / masih dalam jeda.
+	// Identitas yang tidak terdaftar dikunci dengan cara yang sama agar tidak membocorkan akun yang ada.
+	if err := guard.Periksa(kunciAkun, ip); err != nil {
+		var ditahan *services.ErrLoginDitahan
+		if errors.As(err, &ditahan) {
+			detik := int(math.Ceil(ditahan.Tunggu.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(detik))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": ditahan.Error(), "retry_after": detik})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "gagal memeriksa percobaan login"})
 		return
 	}
 
-	// Periksa status aktif user
-	if !user.StatusAktif {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "akun anda tidak aktif, hubungi pengurus TPQ untuk aktivasi akun"})
+	// User tidak ditemukan tetap menjalankan bcrypt agar waktu respon tidak membedakan keduanya
+	hashPassword := hashPasswordSamaran
+	if user.IDUser != "" {
+		hashPassword = []byte(user.Password)
+	}
+	if err := bcrypt.CompareHashAndPassword(hashPassword, []byte(input.Password)); err != nil || user.IDUser == "" {
+		if err := guard.CatatGagal(kunciAkun, ip); err != nil {
+			fmt.Printf("Gagal mencatat percobaan login: %v\n", err)
+		}
+		// Keterangan netral dengan hash identitas: penyebab gagal (akun tidak ada atau password salah) tidak dicatat
+		catatLogKeterangan(config.DB, user.IDUser, services.AksiLogin, services.TargetUser, user.IDUser, "Login gagal untuk identitas "+kunciAkun+" dari IP "+ip)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": pesanLoginGagal})
 		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "password salah"})
+	if err := guard.CatatBerhasil(user); err != nil {
+		fmt.Printf("Gagal mereset percobaan login: %v\n", err)
+	}
+
+	// Status akun baru diberitahukan setelah password terbukti benar
+	switch user.StatusRegistrasi {
+	case models.RegistrasiMenunggu:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "pendaftaran anda masih menunggu persetujuan pengurus TPQ"})
+		return
+	case models.RegistrasiDitolak:
+		pesan := "pendaftaran anda ditolak oleh pengurus TPQ"
+		if user.AlasanPenolakan != nil && *user.AlasanPenolakan != "" {
+			pesan += ": " + *user.AlasanPenolakan
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": pesan})
+		return
+	}
+	if !user.StatusAktif {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "akun anda tidak aktif, hubungi pengurus TPQ untuk aktivasi akun"})
 		return
 	}
 
-	token, err := utils.GenerateJWT(user.IDUser, string(user.Role))
+	tokens, err := services.NewTokenService(config.DB).BuatSesi(user, c.Request.UserAgent(), ip)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "gagal generate token"})
 		return
 	}
 
+	catatLogKeterangan(config.DB, user.IDUser, services.AksiLogin, services.TargetUser, user.IDUser, "Login berhasil dari IP "+ip)
+
 	c.JSON(http.StatusOK, gin.H{
-		"message": "login berhasil",
-		"token":   token,
+		"message":       "login berhasil",
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
 		"user": gin.H{
 			"id_user":      user.IDUser,
 			"nama_lengkap": user.NamaLengkap,
@@ -177,9 +212,243 @@ func LoginUser(c *gin.Context) {
 	})
 }
 
+// RefreshToken menukar refresh token dengan access token baru (refresh token ikut dirotasi)
+func RefreshToken(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := services.NewTokenService(config.DB).Rotasi(input.RefreshToken, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrRefreshTokenTidakValid),
+			errors.Is(err, services.ErrRefreshTokenKadaluarsa),
+			errors.Is(err, services.ErrRefreshTokenDipakaiUlang),
+			errors.Is(err, services.ErrUserTidakAktif):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "gagal refresh token"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "token berhasil diperbarui",
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+	})
+}
+
+// Logout mencabut sesi yang sedang dipakai (refresh token perangkat ini dan access token-nya)
+func Logout(c *gin.Context) {
+	sesiID := c.GetString("session_id")
+	if sesiID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token tidak terikat ke sesi, gunakan logout-all"})
+		return
+	}
+
+	if err := services.NewTokenService(config.DB).CabutSesi(sesiID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "gagal logout"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "logout berhasil"})
+}
+
+// LogoutAll mencabut semua sesi user di semua perangkat
+func LogoutAll(c *gin.Context) {
+	if err := services.NewTokenService(config.DB).CabutSemua(c.GetString("user_id")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "gagal logout dari semua perangkat"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "logout dari semua perangkat berhasil"})
+}
+
+// ChangePassword mengganti password user yang sedang login setelah password lama diverifikasi
+func ChangePassword(c *gin.Context) {
+	var input struct {
+		PasswordLama string `json:"password_lama" binding:"required"`
+		PasswordBaru string `json:"password_baru" binding:"required,min=6"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, "id_user = ?", c.GetString("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user tidak ditemukan"})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.PasswordLama)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "password lama salah"})
+		return
+	}
+
+	if err := services.NewPasswordService(config.DB, services.DefaultNotifier()).GantiPassword(user, input.PasswordBaru); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "gagal mengganti password"})
+		return
+	}
+
+	catatLogKeterangan(config.DB, user.IDUser, services.AksiUbahPassword, services.TargetUser, user.IDUser, "Password diganti oleh user, semua sesi dicabut")
+
+	c.JSON(http.StatusOK, gin.H{"message": "password berhasil diganti, silakan login ulang"})
+}
+
+// cariUserReset mencari user untuk reset password berdasarkan email atau no telp
+func cariUserReset(email *string, noTelp string) (models.User, error) {
+	var user models.User
+	query := config.DB
+	if email != nil && *email != "" {
+		query = query.Where("email = ?", *email)
+	} else {
+		query = query.Where("no_telp = ?", noTelp)
+	}
+	err := query.First(&user).Error
+	return user, err
+}
+
+// ForgotPassword mengirim kode reset sekali pakai ke email atau WhatsApp user.
+// Respon selalu sama agar tidak bisa dipakai untuk menebak akun yang terdaftar,
+// termasuk saat permintaan ditolak karena terlalu sering.
+func ForgotPassword(c *gin.Context) {
+	var input struct {
+		Email  *string `json:"email"`
+		NoTelp string  `json:"no_telp"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if (input.Email == nil || *input.Email == "") && input.NoTelp == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "masukkan email atau no_telp"})
+		return
+	}
+
+	respon := gin.H{"message": "jika akun terdaftar dan aktif, kode reset password telah dikirim"}
+
+	user, err := cariUserReset(input.Email, input.NoTelp)
+	if err != nil || !user.StatusAktif {
+		c.JSON(http.StatusOK, respon)
+		return
+	}
+
+	kanal, err := services.NewPasswordService(config.DB, services.DefaultNotifier()).MintaReset(user, c.ClientIP())
+	if errors.Is(err, services.ErrResetTerlaluSering) {
+		c.JSON(http.StatusOK, respon)
+		return
+	}
+	if err != nil {
+		fmt.Printf("Gagal membuat kode reset password: %v\n", err)
+		c.JSON(http.StatusOK, respon)
+		return
+	}
+
+	catatLogKeterangan(config.DB, user.IDUser, services.AksiMintaResetPassword, services.TargetUser, user.IDUser,
+		fmt.Sprintf("Kode reset password dikirim via %s dari IP %s", kanal, c.ClientIP()))
+
+	c.JSON(http.StatusOK, respon)
+}
+
+// ResetPassword mengganti password memakai kode reset yang dikirim lewat ForgotPassword
+func ResetPassword(c *gin.Context) {
+	var input struct {
+		Email        *string `json:"email"`
+		NoTelp       string  `json:"no_telp"`
+		Kode         string  `json:"kode" binding:"required"`
+		PasswordBaru string  `json:"password_baru" binding:"required,min=6"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if (input.Email == nil || *input.Email == "") && input.NoTelp == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "masukkan email atau no_telp"})
+		return
+	}
+
+	user, err := cariUserReset(input.Email, input.NoTelp)
+	if err != nil || !user.StatusAktif {
+		c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrKodeResetTidakValid.Error()})
+		return
+	}
+
+	if err := services.NewPasswordService(config.DB, services.DefaultNotifier()).ResetDenganKode(user, input.Kode, input.PasswordBaru); err != nil {
+		if errors.Is(err, services.ErrKodeResetTidakValid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "gagal reset password"})
+		return
+	}
+
+	catatLogKeterangan(config.DB, user.IDUser, services.AksiResetPassword, services.TargetUser, user.IDUser,
+		fmt.Sprintf("Password direset memakai kode dari IP %s, semua sesi dicabut", c.ClientIP()))
+
+	c.JSON(http.StatusOK, gin.H{"message": "password berhasil direset, silakan login dengan password baru"})
+}
+
+// UnlockUser membuka penguncian login sebuah akun (dan opsional alamat IP tertentu)
+func UnlockUser(c *gin.Context) {
+	id := c.Param("id")
+
+	var input struct {
+		IP string `json:"ip"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, "id_user = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user tidak ditemukan"})
+		return
+	}
+
+	guard := services.NewLoginGuard(config.DB)
+	if err := guard.BukaKunci(user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "gagal membuka kunci akun"})
+		return
+	}
+	keterangan := "Kunci login akun dibuka"
+	if input.IP != "" {
+		if err := guard.BukaKunciIP(input.IP); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "gagal membuka kunci IP"})
+			return
+		}
+		keterangan += " beserta IP " + input.IP
+	}
+
+	catatLogKeterangan(config.DB, c.GetString("user_id"), services.AksiBukaKunciLogin, services.TargetUser, user.IDUser, keterangan)
+	c.JSON(http.StatusOK, gin.H{"message": "kunci login berhasil dibuka"})
+}
+
+// GetMyPermissions mengembalikan role dan daftar izin user yang sedang login
+func GetMyPermissions(c *gin.Context) {
+	role := c.GetString("role")
+	c.JSON(http.StatusOK, gin.H{
+		"role": role,
+		"izin": services.DefaultRegistryIzin().DaftarIzin(role),
+	})
+}
+
 func GetUsers(c *gin.Context) {
 	var users []models.User
-	if err := config.DB.Find(&users).Error; err != nil {
+	// Tanpa izin user:read, daftar hanya berisi akun sendiri
+	query := lingkupMilik(c, config.DB, "id_user", services.IzinUserRead)
+	if err := query.Find(&users).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "gagal mengambil data"})
 		return
 	}
@@ -188,6 +457,11 @@ func GetUsers(c *gin.Context) {
 
 func GetUserByID(c *gin.Context) {
 	id := c.Param("id")
+	if !bolehAksesMilik(c, id, services.IzinUserRead) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: Anda tidak memiliki akses ke data user ini"})
+		return
+	}
+
 	var user models.User
 	if err := config.DB.First(&user, "id_user = ?", id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "user tidak ditemukan"})
@@ -198,6 +472,11 @@ func GetUserByID(c *gin.Context) {
 
 func UpdateUser(c *gin.Context) {
 	id := c.Param("id")
+	if !bolehAksesMilik(c, id, services.IzinUserWrite) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: Anda tidak memiliki akses untuk mengupdate user ini"})
+		return
+	}
+
 	var user models.User
 
 	if err := config.DB.First(&user, "id_user = ?", id).Error; err != nil {
@@ -219,8 +498,37 @@ func UpdateUser(c *gin.Context) {
 		return
 	}
 
+	// Tanpa izin user:write, user hanya boleh mengubah profilnya sendiri
+	if !punyaIzin(c, services.IzinUserWrite) {
+		if input.Role != "" || input.StatusAktif != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: Anda tidak dapat mengubah role atau status akun"})
+			return
+		}
+		if input.Password != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "gunakan /api/password/change untuk mengganti password"})
+			return
+		}
+	}
+
+	// User lain hanya boleh diubah oleh user yang role-nya di atas role user tersebut
+	pengubahRole := c.GetString("role")
+	if id != c.GetString("user_id") && !services.BolehBeriPeran(pengubahRole, string(user.Role)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "tidak boleh mengubah user dengan role setara atau di atas role sendiri"})
+		return
+	}
+
+	sebelum := user
+
 	// Jika role diubah, generate ID baru
 	if input.Role != "" && input.Role != string(user.Role) {
+		if !services.PeranDikenal(input.Role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "role tidak valid"})
+			return
+		}
+		if !services.BolehBeriPeran(pengubahRole, string(user.Role)) || !services.BolehBeriPeran(pengubahRole, input.Role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "tidak boleh memberi role setara atau di atas role sendiri"})
+			return
+		}
 		newRole := models.UserRole(input.Role)
 		newID, err := generateCustomID(newRole)
 		if err != nil {
@@ -246,6 +554,14 @@ func UpdateUser(c *gin.Context) {
 	}
 	if input.StatusAktif != nil {
 		user.StatusAktif = *input.StatusAktif
+		// Mengaktifkan akun yang masih di antrean sama dengan menyetujui registrasinya
+		if user.StatusAktif && user.StatusRegistrasi == models.RegistrasiMenunggu {
+			now := time.Now()
+			adminID := c.GetString("user_id")
+			user.StatusRegistrasi = models.RegistrasiDisetujui
+			user.DiverifikasiOleh = &adminID
+			user.DiverifikasiPada = &now
+		}
 	}
 
 	user.DiperbaruiPada = time.Now()
@@ -255,15 +571,42 @@ func UpdateUser(c *gin.Context) {
 		return
 	}
 
+	// Nonaktif, ganti role, atau ganti password: semua token lama harus berhenti berlaku
+	if (sebelum.StatusAktif && !user.StatusAktif) || sebelum.Role != user.Role || sebelum.Password != user.Password {
+		if err := services.NewTokenService(config.DB).CabutSemua(sebelum.IDUser); err != nil {
+			fmt.Printf("Gagal mencabut token user: %v\n", err)
+		}
+	}
+
+	catatLog(config.DB, c, services.AksiUpdate, services.TargetUser, user.IDUser, sebelum, user)
+
 	c.JSON(http.StatusOK, gin.H{"message": "user berhasil diperbarui", "user": user})
 }
 
 func DeleteUser(c *gin.Context) {
 	id := c.Param("id")
-	if err := config.DB.Delete(&models.User{}, "id_user = ?", id).Error; err != nil {
+
+	var user models.User
+	if err := config.DB.First(&user, "id_user = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user tidak ditemukan"})
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id_user = ?", id).Delete(&models.RefreshToken{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id_user = ?", id).Delete(&models.PasswordReset{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.User{}, "id_user = ?", id).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "gagal hapus user"})
 		return
 	}
+
+	catatLog(config.DB, c, services.AksiDelete, services.TargetUser, user.IDUser, user, nil)
 	c.JSON(http.StatusOK, gin.H{"message": "user berhasil dihapus"})
 }
 
@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
+	"tpq_asysyafii/ujidb"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Registrasi paralel harus mendapat ID user yang berbeda-beda dari tabel urutan_id
+func TestRegisterUserParalelMendapatIDUnik(t *testing.T) {
+	ujidb.Buka(t)
+	ujidb.ButuhKunciBaris(t)
+
+	const jumlah = 20
+	awalan := time.Now().Format("150405.000")
+
+	ids := make([]string, jumlah)
+	var wg sync.WaitGroup
+	for i := 0; i < jumlah; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c, w := konteksUji(http.MethodPost, "/api/register", gin.H{
+				"nama_lengkap": fmt.Sprintf("Wali Paralel %s-%d", awalan, i),
+				"no_telp":      fmt.Sprintf("08%s%02d", awalan, i),
+				"password":     "rahasia123",
+			}, nil)
+			RegisterUser(c)
+			if w.Code != http.StatusCreated {
+				t.Errorf("registrasi %d: status %d: %s", i, w.Code, w.Body.String())
+				return
+			}
+			var balasan struct {
+				User models.User `json:"user"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &balasan); err != nil {
+				t.Errorf("registrasi %d: balasan tidak valid: %v", i, err)
+				return
+			}
+			ids[i] = balasan.User.IDUser
+		}(i)
+	}
+	wg.Wait()
+
+	dipakai := make(map[string]int, jumlah)
+	for i, id := range ids {
+		if id == "" {
+			continue
+		}
+		if j, ada := dipakai[id]; ada {
+			t.Errorf("registrasi %d dan %d mendapat ID yang sama: %s", j, i, id)
+		}
+		dipakai[id] = i
+	}
+}
+
+// Pengelola user hanya boleh mengubah user dengan role di bawahnya, dan hanya memberi role di bawah role-nya
+// sendiri; super admin pun tidak bisa mengubah super admin lain atau mengangkat super admin baru
+func TestUpdateUserTidakBisaMemberiAtauMengubahRoleSetara(t *testing.T) {
+	db := ujidb.Buka(t)
+	superAdmin := ujidb.BuatUser(t, db, models.RoleSuperAdmin)
+
+	kasus := []struct {
+		nama   string
+		target models.UserRole
+		body   gin.H
+		status int
+	}{
+		{"wali menjadi admin", models.RoleWali, gin.H{"role": "admin"}, http.StatusOK},
+		{"wali menjadi super admin", models.RoleWali, gin.H{"role": "super_admin"}, http.StatusForbidden},
+		{"super admin lain menjadi wali", models.RoleSuperAdmin, gin.H{"role": "wali"}, http.StatusForbidden},
+		{"nama super admin lain", models.RoleSuperAdmin, gin.H{"nama_lengkap": "Diubah Super Admin Lain"}, http.StatusForbidden},
+		{"status super admin lain", models.RoleSuperAdmin, gin.H{"status_aktif": false}, http.StatusForbidden},
+		{"nama admin", models.RoleAdmin, gin.H{"nama_lengkap": "Admin Diubah"}, http.StatusOK},
+	}
+	for _, tc := range kasus {
+		t.Run(tc.nama, func(t *testing.T) {
+			target := ujidb.BuatUser(t, db, tc.target)
+			c, w := konteksUji(http.MethodPut, "/api/users/"+target.IDUser, tc.body, &superAdmin)
+			c.Params = gin.Params{{Key: "id", Value: target.IDUser}}
+			UpdateUser(c)
+			if w.Code != tc.status {
+				t.Fatalf("status %d, harapan %d: %s", w.Code, tc.status, w.Body.String())
+			}
+			if tc.status != http.StatusForbidden {
+				return
+			}
+			var tersimpan models.User
+			if err := db.First(&tersimpan, "id_user = ?", target.IDUser).Error; err != nil {
+				t.Fatalf("user target hilang: %v", err)
+			}
+			if tersimpan.Role != target.Role || tersimpan.NamaLengkap != target.NamaLengkap || tersimpan.StatusAktif != target.StatusAktif {
+				t.Errorf("user target berubah walaupun ditolak: %+v", tersimpan)
+			}
+		})
+	}
+}
+
+// Login gagal dicatat dengan keterangan netral berisi hash identitas, tanpa menyebut penyebabnya
+func TestLoginGagalDicatatTanpaPenyebab(t *testing.T) {
+	db := ujidb.Buka(t)
+	user := ujidb.BuatUser(t, db, models.RoleWali)
+	email := user.IDUser + "@tpq.test"
+	if err := db.Model(&user).Update("email", email).Error; err != nil {
+		t.Fatalf("gagal mengisi email: %v", err)
+	}
+
+	c, w := konteksUji(http.MethodPost, "/api/login", gin.H{"email": email, "password": "salah"}, nil)
+	LoginUser(c)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status %d, harapan 401: %s", w.Code, w.Body.String())
+	}
+
+	var log models.LogAktivitas
+	if err := db.Where("id_admin = ? AND aksi = ?", user.IDUser, services.AksiLogin).First(&log).Error; err != nil {
+		t.Fatalf("log login gagal tidak tercatat: %v", err)
+	}
+	harapan := "Login gagal untuk identitas " + services.KunciIdentitasLogin(services.IdentitasEmail, email)
+	if !strings.HasPrefix(log.Keterangan, harapan) || strings.Contains(log.Keterangan, "password") {
+		t.Errorf("keterangan %q, harapan diawali %q tanpa penyebab", log.Keterangan, harapan)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 	"time"
 	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -24,28 +25,38 @@ func NewBeritaController(db *gorm.DB) *BeritaController {
 type CreateBeritaRequest struct {
 	Judul       string  `json:"judul" binding:"required"`
 	Konten      string  `json:"konten" binding:"required"`
+	Format      string  `json:"format"` // "markdown" (default) atau "html"
 	Kategori    string  `json:"kategori" binding:"required"`
 	Status      string  `json:"status"`
-	GambarCover *string `json:"gambar_cover,omitempty"` // URL string dari Cloudinary
+	IDGambarCover *string `json:"id_gambar_cover,omitempty"` // ID media dari media library
+	JadwalTerbit *time.Time `json:"jadwal_terbit,omitempty"` // wajib untuk status scheduled, format RFC3339
 }
 
 // UpdateBeritaRequest struct untuk JSON
 type UpdateBeritaRequest struct {
 	Judul       string  `json:"judul"`
 	Konten      string  `json:"konten"`
+	Format      string  `json:"format"` // "markdown" atau "html"; konten dirender ulang jika berubah
 	Kategori    string  `json:"kategori"`
 	Status      string  `json:"status"`
-	GambarCover *string `json:"gambar_cover,omitempty"` // URL string dari Cloudinary
+	IDGambarCover *string `json:"id_gambar_cover,omitempty"` // ID media; string kosong menghapus gambar
+	JadwalTerbit *time.Time `json:"jadwal_terbit,omitempty"` // wajib untuk status scheduled, format RFC3339
 }
 
-// Helper function untuk check role admin
-func (ctrl *BeritaController) isAdmin(c *gin.Context) bool {
-	userRole, exists := c.Get("role")
-	if !exists {
-		return false
-	}
-	role := userRole.(string)
-	return role == "admin" || role == "super_admin"
+// BeritaSunting adalah berita beserta sumber kontennya untuk admin. Model Berita tidak
+// menyertakan Konten di JSON, jadi endpoint publik hanya mengirim KontenHTML yang sudah disaring.
+type BeritaSunting struct {
+	models.Berita
+	Konten string `json:"konten"`
+}
+
+func beritaSunting(berita models.Berita) BeritaSunting {
+	return BeritaSunting{Berita: berita, Konten: berita.Konten}
+}
+
+// PublishBeritaRequest opsional; tanpa jadwal_terbit berita langsung terbit
+type PublishBeritaRequest struct {
+	JadwalTerbit *time.Time `json:"jadwal_terbit,omitempty"`
 }
 
 // Helper function untuk get user ID dari context
@@ -73,20 +84,29 @@ func generateSlug(judul string) string {
 	return result.String()
 }
 
-// Helper function untuk validasi URL Cloudinary
-func isValidCloudinaryURL(url string) bool {
-	if url == "" {
-		return true // URL kosong diperbolehkan (tidak ada gambar)
+// validasiJadwalTerbit memastikan berita terjadwal punya waktu terbit di masa depan dan pengirimnya
+// boleh menerbitkan berita, karena berita akan terbit otomatis tanpa persetujuan lagi.
+// Mengembalikan false jika request sudah dibalas.
+func validasiJadwalTerbit(c *gin.Context, jadwal *time.Time) bool {
+	if !punyaIzin(c, services.IzinBeritaPublish) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: Anda tidak memiliki izin untuk menjadwalkan terbit berita"})
+		return false
 	}
-	
-	// Validasi dasar: harus string dan mengandung cloudinary.com
-	return strings.Contains(url, "cloudinary.com") && strings.Contains(url, "upload")
+	if jadwal == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "jadwal_terbit wajib diisi untuk status scheduled"})
+		return false
+	}
+	if !jadwal.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "jadwal_terbit harus di masa depan"})
+		return false
+	}
+	return true
 }
 
 // CreateBerita membuat berita baru (JSON input)
 func (ctrl *BeritaController) CreateBerita(c *gin.Context) {
 	// Hanya admin yang bisa create berita
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinBeritaWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat membuat berita"})
 		return
 	}
@@ -119,10 +139,20 @@ func (ctrl *BeritaController) CreateBerita(c *gin.Context) {
 		return
 	}
 
-	// Validasi URL gambar jika ada
-	if req.GambarCover != nil && *req.GambarCover != "" {
-		if !isValidCloudinaryURL(*req.GambarCover) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "URL gambar tidak valid. Harus dari Cloudinary"})
+	// Render konten menjadi HTML yang aman
+	format, ok := formatKonten(c, req.Format, models.FormatMarkdown)
+	if !ok {
+		return
+	}
+	render, ok := renderKonten(c, req.Konten, format)
+	if !ok {
+		return
+	}
+
+	// Ambil gambar cover dari media library jika ada
+	var cover *models.Media
+	if req.IDGambarCover != nil && *req.IDGambarCover != "" {
+		if cover, ok = mediaDariID(c, ctrl.db, *req.IDGambarCover); !ok {
 			return
 		}
 	}
@@ -152,10 +182,15 @@ func (ctrl *BeritaController) CreateBerita(c *gin.Context) {
 			statusEnum = models.StatusDraft
 		case "published":
 			statusEnum = models.StatusPublished
+		case "scheduled":
+			if !validasiJadwalTerbit(c, req.JadwalTerbit) {
+				return
+			}
+			statusEnum = models.StatusScheduled
 		case "arsip":
 			statusEnum = models.StatusArsip
 		default:
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Status tidak valid. Gunakan 'draft', 'published', atau 'arsip'"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Status tidak valid. Gunakan 'draft', 'published', 'scheduled', atau 'arsip'"})
 			return
 		}
 	} else {
@@ -175,15 +210,31 @@ func (ctrl *BeritaController) CreateBerita(c *gin.Context) {
 		Judul:           req.Judul,
 		Slug:            slug,
 		Konten:          req.Konten,
+		FormatKonten:    format,
+		KontenHTML:      render.HTML,
+		Ringkasan:       render.Ringkasan,
+		WaktuBaca:       render.WaktuBaca,
 		Kategori:        kategoriEnum,
 		Status:          statusEnum,
-		GambarCover:     req.GambarCover, // URL string dari Cloudinary
 		PenulisID:       adminID,
 		TanggalPublikasi: tanggalPublikasi,
 	}
+	if statusEnum == models.StatusScheduled {
+		berita.JadwalTerbit = req.JadwalTerbit
+	}
+	if cover != nil {
+		berita.IDGambarCover, berita.GambarCover, berita.GambarCoverVarian = &cover.IDMedia, &cover.URL, cover.Varian()
+	}
 
-	// Simpan ke database
-	if err := ctrl.db.Create(&berita).Error; err != nil {
+	// Simpan ke database beserta revisi pertamanya
+	err := ctrl.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&berita).Error; err != nil {
+			return err
+		}
+		_, err := services.CatatRevisiBerita(tx, nil, berita, adminID, "Berita dibuat")
+		return err
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat berita: " + err.Error()})
 		return
 	}
@@ -191,9 +242,12 @@ func (ctrl *BeritaController) CreateBerita(c *gin.Context) {
 	// Preload relations untuk response
 	ctrl.db.Preload("Penulis").First(&berita, "id_berita = ?", berita.IDBerita)
 
+	perbaruiIndeksPencarian(ctrl.db, models.PencarianBerita, berita.IDBerita)
+	catatLog(ctrl.db, c, services.AksiCreate, services.TargetBerita, berita.IDBerita, nil, beritaSunting(berita))
+
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Berita berhasil dibuat",
-		"data":    berita,
+		"data":    beritaSunting(berita),
 	})
 }
 
@@ -247,7 +301,7 @@ func (ctrl *BeritaController) GetBeritaBySlug(c *gin.Context) {
 	}
 
 	// Untuk user non-admin, hanya bisa lihat yang published
-	if !ctrl.isAdmin(c) && berita.Status != models.StatusPublished {
+	if !punyaIzin(c, services.IzinBeritaWrite) && berita.Status != models.StatusPublished {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: Anda tidak memiliki akses ke berita ini"})
 		return
 	}
@@ -260,7 +314,7 @@ func (ctrl *BeritaController) GetBeritaBySlug(c *gin.Context) {
 // UpdateBerita mengupdate berita (hanya admin) - JSON input
 func (ctrl *BeritaController) UpdateBerita(c *gin.Context) {
 	// Hanya admin yang bisa update
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinBeritaWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat mengupdate berita"})
 		return
 	}
@@ -290,22 +344,37 @@ func (ctrl *BeritaController) UpdateBerita(c *gin.Context) {
 		return
 	}
 
-	// Validasi URL gambar jika ada
-	if req.GambarCover != nil && *req.GambarCover != "" {
-		if !isValidCloudinaryURL(*req.GambarCover) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "URL gambar tidak valid. Harus dari Cloudinary"})
+	// Ambil gambar cover baru dari media library jika diganti
+	var cover *models.Media
+	if req.IDGambarCover != nil && *req.IDGambarCover != "" {
+		var ok bool
+		if cover, ok = mediaDariID(c, ctrl.db, *req.IDGambarCover); !ok {
 			return
 		}
 	}
 
+	sebelum := existingBerita
+
 	// Update fields
 	if req.Judul != "" {
 		existingBerita.Judul = req.Judul
 		// Generate slug baru jika judul berubah
 		existingBerita.Slug = generateSlug(req.Judul)
 	}
-	if req.Konten != "" {
-		existingBerita.Konten = req.Konten
+	if req.Konten != "" || req.Format != "" {
+		format, ok := formatKonten(c, req.Format, existingBerita.FormatKonten)
+		if !ok {
+			return
+		}
+		if req.Konten != "" {
+			existingBerita.Konten = req.Konten
+		}
+		render, ok := renderKonten(c, existingBerita.Konten, format)
+		if !ok {
+			return
+		}
+		existingBerita.FormatKonten = format
+		existingBerita.KontenHTML, existingBerita.Ringkasan, existingBerita.WaktuBaca = render.HTML, render.Ringkasan, render.WaktuBaca
 	}
 	if req.Kategori != "" {
 		// Convert dan validasi kategori
@@ -335,22 +404,52 @@ func (ctrl *BeritaController) UpdateBerita(c *gin.Context) {
 				now := time.Now()
 				existingBerita.TanggalPublikasi = &now
 			}
+		case "scheduled":
+			jadwal := req.JadwalTerbit
+			if jadwal == nil {
+				jadwal = existingBerita.JadwalTerbit
+			}
+			if !validasiJadwalTerbit(c, jadwal) {
+				return
+			}
+			existingBerita.Status = models.StatusScheduled
+			existingBerita.JadwalTerbit = jadwal
+			existingBerita.TanggalPublikasi = nil
 		case "arsip":
 			existingBerita.Status = models.StatusArsip
 		default:
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Status tidak valid. Gunakan 'draft', 'published', atau 'arsip'"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Status tidak valid. Gunakan 'draft', 'published', 'scheduled', atau 'arsip'"})
 			return
 		}
-	}
-	if req.GambarCover != nil {
-		// Hanya update jika ada perubahan
-		if existingBerita.GambarCover == nil || *existingBerita.GambarCover != *req.GambarCover {
-			existingBerita.GambarCover = req.GambarCover
+	} else if req.JadwalTerbit != nil && existingBerita.Status == models.StatusScheduled {
+		// Ubah jadwal terbit tanpa mengubah status
+		if !validasiJadwalTerbit(c, req.JadwalTerbit) {
+			return
+		}
+		existingBerita.JadwalTerbit = req.JadwalTerbit
+	}
+	if existingBerita.Status != models.StatusScheduled {
+		existingBerita.JadwalTerbit = nil
+	}
+	if req.IDGambarCover != nil {
+		if cover != nil {
+			existingBerita.IDGambarCover, existingBerita.GambarCover = &cover.IDMedia, &cover.URL
+			existingBerita.GambarCoverVarian = cover.Varian()
+		} else {
+			existingBerita.IDGambarCover, existingBerita.GambarCover = nil, nil
+			existingBerita.GambarCoverVarian = models.VarianGambar{}
 		}
 	}
 
-	// Simpan perubahan
-	if err := ctrl.db.Save(&existingBerita).Error; err != nil {
+	// Simpan perubahan; isi berita sesudah diubah dicatat sebagai revisi baru
+	err = ctrl.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&existingBerita).Error; err != nil {
+			return err
+		}
+		_, err := services.CatatRevisiBerita(tx, &sebelum, existingBerita, c.GetString("user_id"), "")
+		return err
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengupdate berita: " + err.Error()})
 		return
 	}
@@ -358,16 +457,19 @@ func (ctrl *BeritaController) UpdateBerita(c *gin.Context) {
 	// Preload relations untuk response
 	ctrl.db.Preload("Penulis").First(&existingBerita, "id_berita = ?", existingBerita.IDBerita)
 
+	perbaruiIndeksPencarian(ctrl.db, models.PencarianBerita, existingBerita.IDBerita)
+	catatLog(ctrl.db, c, services.AksiUpdate, services.TargetBerita, existingBerita.IDBerita, beritaSunting(sebelum), beritaSunting(existingBerita))
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Berita berhasil diupdate",
-		"data":    existingBerita,
+		"data":    beritaSunting(existingBerita),
 	})
 }
 
 // DeleteBerita menghapus berita (hanya admin)
 func (ctrl *BeritaController) DeleteBerita(c *gin.Context) {
 	// Hanya admin yang bisa delete
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinBeritaWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat menghapus berita"})
 		return
 	}
@@ -390,12 +492,21 @@ func (ctrl *BeritaController) DeleteBerita(c *gin.Context) {
 		return
 	}
 
-	// Hapus berita
-	if err := ctrl.db.Where("id_berita = ?", id).Delete(&models.Berita{}).Error; err != nil {
+	// Hapus berita beserta riwayat revisinya
+	err = ctrl.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id_berita = ?", id).Delete(&models.BeritaRevisi{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id_berita = ?", id).Delete(&models.Berita{}).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghapus berita: " + err.Error()})
 		return
 	}
 
+	perbaruiIndeksPencarian(ctrl.db, models.PencarianBerita, berita.IDBerita)
+	catatLog(ctrl.db, c, services.AksiDelete, services.TargetBerita, berita.IDBerita, beritaSunting(berita), nil)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Berita berhasil dihapus",
 	})
@@ -404,7 +515,7 @@ func (ctrl *BeritaController) DeleteBerita(c *gin.Context) {
 // PublishBerita mengubah status berita menjadi published (hanya admin)
 func (ctrl *BeritaController) PublishBerita(c *gin.Context) {
 	// Hanya admin yang bisa publish
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinBeritaPublish) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat mempublish berita"})
 		return
 	}
@@ -427,10 +538,31 @@ func (ctrl *BeritaController) PublishBerita(c *gin.Context) {
 		return
 	}
 
-	// Update status menjadi published
-	berita.Status = models.StatusPublished
-	now := time.Now()
-	berita.TanggalPublikasi = &now
+	// Body opsional: jadwal_terbit menjadwalkan berita terbit otomatis
+	var req PublishBeritaRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Request tidak valid: " + err.Error()})
+			return
+		}
+	}
+
+	sebelum := berita
+
+	if req.JadwalTerbit != nil {
+		if !validasiJadwalTerbit(c, req.JadwalTerbit) {
+			return
+		}
+		berita.Status = models.StatusScheduled
+		berita.JadwalTerbit = req.JadwalTerbit
+		berita.TanggalPublikasi = nil
+	} else {
+		// Update status menjadi published
+		berita.Status = models.StatusPublished
+		now := time.Now()
+		berita.TanggalPublikasi = &now
+		berita.JadwalTerbit = nil
+	}
 
 	// Simpan perubahan
 	if err := ctrl.db.Save(&berita).Error; err != nil {
@@ -441,16 +573,22 @@ func (ctrl *BeritaController) PublishBerita(c *gin.Context) {
 	// Preload relations untuk response
 	ctrl.db.Preload("Penulis").First(&berita, "id_berita = ?", berita.IDBerita)
 
+	catatLog(ctrl.db, c, services.AksiUpdate, services.TargetBerita, berita.IDBerita, beritaSunting(sebelum), beritaSunting(berita))
+
+	pesan := "Berita berhasil dipublish"
+	if berita.Status == models.StatusScheduled {
+		pesan = "Berita dijadwalkan terbit pada " + berita.JadwalTerbit.Format("02-01-2006 15:04")
+	}
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Berita berhasil dipublish",
-		"data":    berita,
+		"message": pesan,
+		"data":    beritaSunting(berita),
 	})
 }
 
 // GetAllBerita mendapatkan semua berita dengan filter (untuk super-admin)
 func (ctrl *BeritaController) GetAllBerita(c *gin.Context) {
 	// Hanya super-admin yang bisa akses
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinBeritaWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat mengakses semua berita"})
 		return
 	}
@@ -505,8 +643,14 @@ func (ctrl *BeritaController) GetAllBerita(c *gin.Context) {
 		return
 	}
 
+	// Daftar ini dipakai form edit admin, jadi sumber konten ikut dikirim
+	beritaAdmin := make([]BeritaSunting, len(berita))
+	for i, b := range berita {
+		beritaAdmin[i] = beritaSunting(b)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"data": berita,
+		"data": beritaAdmin,
 		"meta": gin.H{
 			"page":       page,
 			"limit":      limit,
@@ -0,0 +1,202 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type BeritaRevisiController struct {
+	db *gorm.DB
+}
+
+func NewBeritaRevisiController(db *gorm.DB) *BeritaRevisiController {
+	return &BeritaRevisiController{db: db}
+}
+
+// ambilRevisi membaca revisi dari parameter :id dan :nomor. Mengembalikan false jika request sudah dibalas.
+func (ctrl *BeritaRevisiController) ambilRevisi(c *gin.Context) (*models.BeritaRevisi, bool) {
+	nomor, err := strconv.Atoi(c.Param("nomor"))
+	if err != nil || nomor < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nomor revisi tidak valid"})
+		return nil, false
+	}
+	revisi, err := services.AmbilRevisiBerita(ctrl.db, c.Param("id"), nomor)
+	if err != nil {
+		if errors.Is(err, services.ErrRevisiTidakDitemukan) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil revisi berita: " + err.Error()})
+		return nil, false
+	}
+	return revisi, true
+}
+
+// GetRevisiBerita menampilkan riwayat revisi berita tanpa konten, terbaru lebih dulu
+func (ctrl *BeritaRevisiController) GetRevisiBerita(c *gin.Context) {
+	id := c.Param("id")
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	var berita models.Berita
+	if err := ctrl.db.Select("id_berita").Where("id_berita = ?", id).First(&berita).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Berita tidak ditemukan"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data berita: " + err.Error()})
+		return
+	}
+
+	query := ctrl.db.Model(&models.BeritaRevisi{}).Where("id_berita = ?", id)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghitung total data: " + err.Error()})
+		return
+	}
+
+	var revisiList []models.BeritaRevisi
+	offset := (page - 1) * limit
+	if err := query.Omit("konten").Preload("Pengubah").Order("nomor DESC").Offset(offset).Limit(limit).Find(&revisiList).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil revisi berita: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": revisiList,
+		"meta": gin.H{
+			"page":       page,
+			"limit":      limit,
+			"total":      total,
+			"total_page": (int(total) + limit - 1) / limit,
+		},
+	})
+}
+
+// GetRevisiBeritaByNomor menampilkan isi lengkap satu revisi
+func (ctrl *BeritaRevisiController) GetRevisiBeritaByNomor(c *gin.Context) {
+	revisi, ok := ctrl.ambilRevisi(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": revisi})
+}
+
+// DiffRevisiBerita membandingkan revisi :nomor dengan revisi ?banding=N (default revisi sebelumnya).
+// Revisi pertama dibandingkan dengan berita kosong.
+func (ctrl *BeritaRevisiController) DiffRevisiBerita(c *gin.Context) {
+	revisi, ok := ctrl.ambilRevisi(c)
+	if !ok {
+		return
+	}
+
+	nomorBanding := revisi.Nomor - 1
+	if banding := c.Query("banding"); banding != "" {
+		var err error
+		if nomorBanding, err = strconv.Atoi(banding); err != nil || nomorBanding < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Nomor revisi pembanding tidak valid"})
+			return
+		}
+	}
+
+	pembanding := &models.BeritaRevisi{}
+	if nomorBanding > 0 {
+		var err error
+		if pembanding, err = services.AmbilRevisiBerita(ctrl.db, revisi.IDBerita, nomorBanding); err != nil {
+			if errors.Is(err, services.ErrRevisiTidakDitemukan) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil revisi berita: " + err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": services.BandingkanRevisi(*pembanding, *revisi)})
+}
+
+// RestoreRevisiBerita mengembalikan judul, konten, kategori, dan gambar cover berita ke isi revisi :nomor.
+// Konten dirender ulang dengan allowlist HTML yang berlaku saat ini.
+// Status publikasi tidak berubah; pemulihan dicatat sebagai revisi baru sehingga bisa dibatalkan lagi.
+func (ctrl *BeritaRevisiController) RestoreRevisiBerita(c *gin.Context) {
+	revisi, ok := ctrl.ambilRevisi(c)
+	if !ok {
+		return
+	}
+
+	var berita models.Berita
+	if err := ctrl.db.Where("id_berita = ?", revisi.IDBerita).First(&berita).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Berita tidak ditemukan"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data berita: " + err.Error()})
+		return
+	}
+	sebelum := berita
+
+	berita.Judul = revisi.Judul
+	berita.Slug = generateSlug(revisi.Judul)
+	format, _ := formatKonten(c, "", revisi.FormatKonten)
+	render, ok := renderKonten(c, revisi.Konten, format)
+	if !ok {
+		return
+	}
+	berita.Konten, berita.FormatKonten = revisi.Konten, format
+	berita.KontenHTML, berita.Ringkasan, berita.WaktuBaca = render.HTML, render.Ringkasan, render.WaktuBaca
+	berita.Kategori = revisi.Kategori
+	berita.IDGambarCover, berita.GambarCover, berita.GambarCoverVarian = revisi.IDGambarCover, revisi.GambarCover, models.VarianGambar{}
+
+	pesan := fmt.Sprintf("Berita dipulihkan ke revisi %d", revisi.Nomor)
+	if revisi.IDGambarCover != nil {
+		cover, err := services.NewMediaService(ctrl.db).Ambil(*revisi.IDGambarCover)
+		switch {
+		case errors.Is(err, services.ErrMediaTidakDitemukan):
+			// Media sudah dihapus dari media library, berita dipulihkan tanpa gambar cover
+			berita.IDGambarCover, berita.GambarCover = nil, nil
+			pesan += ", gambar cover revisi sudah dihapus dari media library"
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data media: " + err.Error()})
+			return
+		default:
+			berita.GambarCover, berita.GambarCoverVarian = &cover.URL, cover.Varian()
+		}
+	}
+
+	err := ctrl.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&berita).Error; err != nil {
+			return err
+		}
+		_, err := services.CatatRevisiBerita(tx, &sebelum, berita, c.GetString("user_id"),
+			fmt.Sprintf("Dipulihkan dari revisi %d", revisi.Nomor))
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memulihkan revisi berita: " + err.Error()})
+		return
+	}
+
+	ctrl.db.Preload("Penulis").First(&berita, "id_berita = ?", berita.IDBerita)
+
+	perbaruiIndeksPencarian(ctrl.db, models.PencarianBerita, berita.IDBerita)
+	catatLog(ctrl.db, c, services.AksiPulihkanRevisi, services.TargetBerita, berita.IDBerita, beritaSunting(sebelum), beritaSunting(berita))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": pesan,
+		"data":    beritaSunting(berita),
+	})
+}
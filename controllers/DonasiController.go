@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -24,15 +26,17 @@ func NewDonasiController(db *gorm.DB) *DonasiController {
 
 // Request structs
 type CreateDonasiRequest struct {
-	NamaDonatur string  `json:"nama_donatur"` // Remove required binding
-	NoTelp      string  `json:"no_telp"`
-	Nominal     float64 `json:"nominal" binding:"required,gt=0"`
+	NamaDonatur  string  `json:"nama_donatur"` // Remove required binding
+	NoTelp       string  `json:"no_telp"`
+	Nominal      float64 `json:"nominal" binding:"required,gt=0"`
+	TampilanNama string  `json:"tampilan_nama" binding:"omitempty,oneof=nama inisial anonim"` // default anonim
 }
 
 type UpdateDonasiRequest struct {
-	NamaDonatur string  `json:"nama_donatur"`
-	NoTelp      string  `json:"no_telp"`
-	Nominal     float64 `json:"nominal" binding:"gt=0"`
+	NamaDonatur  string  `json:"nama_donatur"`
+	NoTelp       string  `json:"no_telp"`
+	Nominal      float64 `json:"nominal" binding:"gt=0"`
+	TampilanNama string  `json:"tampilan_nama" binding:"omitempty,oneof=nama inisial anonim"`
 }
 
 type DonasiSummary struct {
@@ -41,11 +45,10 @@ type DonasiSummary struct {
 	RataRata     float64 `json:"rata_rata"`
 }
 
-// Response struct untuk public
+// Response struct untuk public (nomor telepon donatur tidak pernah ikut)
 type DonasiPublicResponse struct {
 	IDDonasi    string  `json:"id_donasi"`
 	NamaDonatur string  `json:"nama_donatur"`
-	NoTelp      string  `json:"no_telp"`
 	Nominal     float64 `json:"nominal"`
 	WaktuCatat  string  `json:"waktu_catat"`
 }
@@ -56,16 +59,6 @@ type DonasiTerbaruPublicResponse struct {
 	WaktuCatat  string  `json:"waktu_catat"`
 }
 
-// Helper function untuk check role
-func (ctrl *DonasiController) checkAdminRole(c *gin.Context) bool {
-	userRole, exists := c.Get("role")
-	if !exists {
-		return false
-	}
-	role := userRole.(string)
-	return role == "admin" || role == "super_admin"
-}
-
 // Helper function untuk get user ID
 func (ctrl *DonasiController) getUserID(c *gin.Context) (string, bool) {
 	userID, exists := c.Get("user_id")
@@ -75,24 +68,33 @@ func (ctrl *DonasiController) getUserID(c *gin.Context) (string, bool) {
 	return userID.(string), true
 }
 
-// Helper function untuk format response public
-func (ctrl *DonasiController) formatDonasiPublic(donasi models.Donasi) DonasiPublicResponse {
-	// Format nama donatur
-	namaDonatur := donasi.NamaDonatur
-	if namaDonatur == "" {
-		namaDonatur = "Hamba Allah"
-	}
-
-	// Format nomor telepon
-	noTelp := donasi.NoTelp
-	if noTelp == "" {
-		noTelp = "dirahasiakan"
+// namaDonaturPublik menerapkan pilihan privasi donatur untuk tampilan publik
+func namaDonaturPublik(donasi models.Donasi) string {
+	nama := strings.TrimSpace(donasi.NamaDonatur)
+	if nama == "" {
+		return "Hamba Allah"
+	}
+
+	switch donasi.TampilanNama {
+	case models.TampilkanNama:
+		return nama
+	case models.TampilkanInisial:
+		var inisial []string
+		for _, kata := range strings.Fields(nama) {
+			huruf := []rune(kata)
+			inisial = append(inisial, strings.ToUpper(string(huruf[0]))+".")
+		}
+		return strings.Join(inisial, " ")
+	default:
+		return "Hamba Allah"
 	}
+}
 
+// Helper function untuk format response public
+func (ctrl *DonasiController) formatDonasiPublic(donasi models.Donasi) DonasiPublicResponse {
 	return DonasiPublicResponse{
 		IDDonasi:    donasi.IDDonasi,
-		NamaDonatur: namaDonatur,
-		NoTelp:      noTelp,
+		NamaDonatur: namaDonaturPublik(donasi),
 		Nominal:     donasi.Nominal,
 		WaktuCatat:  donasi.WaktuCatat.Format(time.RFC3339),
 	}
@@ -100,14 +102,8 @@ func (ctrl *DonasiController) formatDonasiPublic(donasi models.Donasi) DonasiPub
 
 // Helper function untuk format donasi terbaru public
 func (ctrl *DonasiController) formatDonasiTerbaruPublic(donasi models.Donasi) DonasiTerbaruPublicResponse {
-	// Format nama donatur
-	namaDonatur := donasi.NamaDonatur
-	if namaDonatur == "" {
-		namaDonatur = "Hamba Allah"
-	}
-
 	return DonasiTerbaruPublicResponse{
-		NamaDonatur: namaDonatur,
+		NamaDonatur: namaDonaturPublik(donasi),
 		Nominal:     donasi.Nominal,
 		WaktuCatat:  donasi.WaktuCatat.Format(time.RFC3339),
 	}
@@ -123,7 +119,7 @@ func (ctrl *DonasiController) updateRekapOtomatis(transaksiTime time.Time) {
 
 func (ctrl *DonasiController) CreateDonasi(c *gin.Context) {
 	// Check role
-	if !ctrl.checkAdminRole(c) {
+	if !punyaIzin(c, services.IzinDonasiWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin dan super_admin yang dapat akses"})
 		return
 	}
@@ -152,18 +148,34 @@ func (ctrl *DonasiController) CreateDonasi(c *gin.Context) {
 		req.NamaDonatur = "Hamba Allah"
 	}
 
-	// Buat data donasi
-	donasi := models.Donasi{
-		IDDonasi:    uuid.New().String(),
-		NamaDonatur: req.NamaDonatur,
-		NoTelp:      req.NoTelp,
-		Nominal:     req.Nominal,
-		DicatatOleh: userID,
-		WaktuCatat:  time.Now(),
+	// Nama hanya tampil di publik jika donatur memilihnya
+	tampilanNama := models.TampilkanAnonim
+	if req.TampilanNama != "" {
+		tampilanNama = models.TampilanNama(req.TampilanNama)
 	}
 
-	// Simpan ke database
-	if err := ctrl.db.Create(&donasi).Error; err != nil {
+	// Buat data donasi
+	donasi := models.Donasi{
+		IDDonasi:     uuid.New().String(),
+		NamaDonatur:  req.NamaDonatur,
+		NoTelp:       req.NoTelp,
+		TampilanNama: tampilanNama,
+		Nominal:      req.Nominal,
+		DicatatOleh:  userID,
+		WaktuCatat:   time.Now(),
+	}
+
+	// Simpan ke database dan posting jurnal pemasukan
+	err := ctrl.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&donasi).Error; err != nil {
+			return err
+		}
+		return services.NewLedgerService(tx).CatatDonasi(donasi, userID)
+	})
+	if err != nil {
+		if balasPeriodeDitutup(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat donasi: " + err.Error()})
 		return
 	}
@@ -171,22 +183,20 @@ func (ctrl *DonasiController) CreateDonasi(c *gin.Context) {
 	// Preload admin data untuk response
 	ctrl.db.Preload("Admin").First(&donasi, "id_donasi = ?", donasi.IDDonasi)
 
+	catatLog(ctrl.db, c, services.AksiCreate, services.TargetDonasi, donasi.IDDonasi, nil, donasi)
+
 	ctrl.updateRekapOtomatis(donasi.WaktuCatat)
+	kwitansi := terbitkanKwitansi(ctrl.db, models.KwitansiDonasi, donasi.IDDonasi)
 
 	c.JSON(http.StatusCreated, gin.H{
-		"message": "Donasi berhasil dibuat",
-		"data":    donasi,
+		"message":  "Donasi berhasil dibuat",
+		"data":     donasi,
+		"kwitansi": kwitansi,
 	})
 }
 
 // GetDonasiByID mendapatkan donasi berdasarkan ID
 func (ctrl *DonasiController) GetDonasiByID(c *gin.Context) {
-	// Check role
-	// if !ctrl.checkAdminRole(c) {
-	// 	c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin dan super_admin yang dapat akses"})
-	// 	return
-	// }
-
 	id := c.Param("id")
 	if id == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "ID donasi diperlukan"})
@@ -204,6 +214,13 @@ func (ctrl *DonasiController) GetDonasiByID(c *gin.Context) {
 		return
 	}
 
+	if !punyaIzin(c, services.IzinDonasiRead) {
+		c.JSON(http.StatusOK, gin.H{
+			"data": ctrl.formatDonasiPublic(donasi),
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"data": donasi,
 	})
@@ -211,12 +228,6 @@ func (ctrl *DonasiController) GetDonasiByID(c *gin.Context) {
 
 // GetAllDonasi mendapatkan semua data donasi dengan pagination
 func (ctrl *DonasiController) GetAllDonasi(c *gin.Context) {
-	// Check role
-	// if !ctrl.checkAdminRole(c) {
-	// 	c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin dan super_admin yang dapat akses"})
-	// 	return
-	// }
-
 	// Parse query parameters
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
@@ -235,9 +246,16 @@ func (ctrl *DonasiController) GetAllDonasi(c *gin.Context) {
 	// Build query
 	query := ctrl.db.Preload("Admin")
 
+	// Tanpa izin donasi:read, data mengikuti pilihan privasi donatur seperti di halaman publik
+	lengkap := punyaIzin(c, services.IzinDonasiRead)
+
 	if search != "" {
 		searchPattern := "%" + search + "%"
-		query = query.Where("nama_donatur LIKE ? OR no_telp LIKE ?", searchPattern, searchPattern)
+		if lengkap {
+			query = query.Where("nama_donatur LIKE ? OR no_telp LIKE ?", searchPattern, searchPattern)
+		} else {
+			query = query.Where("tampilan_nama = ? AND nama_donatur LIKE ?", models.TampilkanNama, searchPattern)
+		}
 	}
 
 	// Hitung total records
@@ -258,6 +276,23 @@ func (ctrl *DonasiController) GetAllDonasi(c *gin.Context) {
 		return
 	}
 
+	if !lengkap {
+		donasiPublic := make([]DonasiPublicResponse, len(donasi))
+		for i, d := range donasi {
+			donasiPublic[i] = ctrl.formatDonasiPublic(d)
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"data": donasiPublic,
+			"meta": gin.H{
+				"page":       page,
+				"limit":      limit,
+				"total":      total,
+				"total_page": (int(total) + limit - 1) / limit,
+			},
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"data": donasi,
 		"meta": gin.H{
@@ -272,7 +307,7 @@ func (ctrl *DonasiController) GetAllDonasi(c *gin.Context) {
 // UpdateDonasi mengupdate data donasi
 func (ctrl *DonasiController) UpdateDonasi(c *gin.Context) {
 	// Check role
-	if !ctrl.checkAdminRole(c) {
+	if !punyaIzin(c, services.IzinDonasiWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin dan super_admin yang dapat akses"})
 		return
 	}
@@ -301,6 +336,11 @@ func (ctrl *DonasiController) UpdateDonasi(c *gin.Context) {
 		return
 	}
 
+	sebelum := existingDonasi
+	if tolakPeriodeDitutup(c, ctrl.db, existingDonasi.WaktuCatat.Format("2006-01")) {
+		return
+	}
+
 	// Update fields
 	if req.NamaDonatur != "" {
 		existingDonasi.NamaDonatur = req.NamaDonatur
@@ -312,13 +352,27 @@ func (ctrl *DonasiController) UpdateDonasi(c *gin.Context) {
 	if req.NoTelp != "" {
 		existingDonasi.NoTelp = req.NoTelp
 	}
+
+	if req.TampilanNama != "" {
+		existingDonasi.TampilanNama = models.TampilanNama(req.TampilanNama)
+	}
 	
 	if req.Nominal > 0 {
 		existingDonasi.Nominal = req.Nominal
 	}
 
-	// Simpan perubahan
-	if err := ctrl.db.Save(&existingDonasi).Error; err != nil {
+	// Simpan perubahan dan selaraskan jurnal
+	userID, _ := ctrl.getUserID(c)
+	err = ctrl.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&existingDonasi).Error; err != nil {
+			return err
+		}
+		return services.NewLedgerService(tx).CatatDonasi(existingDonasi, userID)
+	})
+	if err != nil {
+		if balasPeriodeDitutup(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengupdate donasi: " + err.Error()})
 		return
 	}
@@ -326,8 +380,13 @@ func (ctrl *DonasiController) UpdateDonasi(c *gin.Context) {
 	// Preload admin data untuk response
 	ctrl.db.Preload("Admin").First(&existingDonasi, "id_donasi = ?", existingDonasi.IDDonasi)
 
+	catatLog(ctrl.db, c, services.AksiUpdate, services.TargetDonasi, existingDonasi.IDDonasi, sebelum, existingDonasi)
+
 	ctrl.updateRekapOtomatis(existingDonasi.WaktuCatat)
 
+	// Kwitansi diterbitkan ulang dengan nomor baru jika isinya berubah
+	terbitkanKwitansi(ctrl.db, models.KwitansiDonasi, existingDonasi.IDDonasi)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Donasi berhasil diupdate",
 		"data":    existingDonasi,
@@ -337,7 +396,7 @@ func (ctrl *DonasiController) UpdateDonasi(c *gin.Context) {
 // DeleteDonasi menghapus data donasi
 func (ctrl *DonasiController) DeleteDonasi(c *gin.Context) {
 	// Check role
-	if !ctrl.checkAdminRole(c) {
+	if !punyaIzin(c, services.IzinDonasiWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin dan super_admin yang dapat akses"})
 		return
 	}
@@ -361,13 +420,31 @@ func (ctrl *DonasiController) DeleteDonasi(c *gin.Context) {
 	}
 
 	waktuCatat := donasi.WaktuCatat
+	if tolakPeriodeDitutup(c, ctrl.db, waktuCatat.Format("2006-01")) {
+		return
+	}
 
-	// Hapus donasi
-	if err := ctrl.db.Where("id_donasi = ?", id).Delete(&models.Donasi{}).Error; err != nil {
+	// Hapus donasi dan balik jurnalnya
+	userID, _ := ctrl.getUserID(c)
+	err = ctrl.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id_donasi = ?", id).Delete(&models.Donasi{}).Error; err != nil {
+			return err
+		}
+		if _, err := services.NewLedgerService(tx).BatalkanSumber(services.TargetDonasi, donasi.IDDonasi, userID); err != nil {
+			return err
+		}
+		return services.NewKwitansiService(tx).Batalkan(models.KwitansiDonasi, donasi.IDDonasi)
+	})
+	if err != nil {
+		if balasPeriodeDitutup(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghapus donasi: " + err.Error()})
 		return
 	}
 
+	catatLog(ctrl.db, c, services.AksiDelete, services.TargetDonasi, donasi.IDDonasi, donasi, nil)
+
 	ctrl.updateRekapOtomatis(waktuCatat)
 
 	c.JSON(http.StatusOK, gin.H{
@@ -377,12 +454,6 @@ func (ctrl *DonasiController) DeleteDonasi(c *gin.Context) {
 
 // GetDonasiSummary mendapatkan summary donasi
 func (ctrl *DonasiController) GetDonasiSummary(c *gin.Context) {
-	// Check role
-	// if !ctrl.checkAdminRole(c) {
-	// 	c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin dan super_admin yang dapat akses"})
-	// 	return
-	// }
-
 	// Parse date filters
 	startDate := c.Query("start_date")
 	endDate := c.Query("end_date")
@@ -456,12 +527,6 @@ func (ctrl *DonasiController) GetDonasiSummary(c *gin.Context) {
 
 // GetDonasiByDateRange mendapatkan donasi berdasarkan rentang tanggal
 func (ctrl *DonasiController) GetDonasiByDateRange(c *gin.Context) {
-	// Check role
-	// if !ctrl.checkAdminRole(c) {
-	// 	c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin dan super_admin yang dapat akses"})
-	// 	return
-	// }
-
 	startDate := c.Query("start_date")
 	endDate := c.Query("end_date")
 
@@ -494,6 +559,22 @@ func (ctrl *DonasiController) GetDonasiByDateRange(c *gin.Context) {
 		return
 	}
 
+	// Tanpa izin donasi:read, data mengikuti pilihan privasi donatur seperti di halaman publik
+	if !punyaIzin(c, services.IzinDonasiRead) {
+		donasiPublic := make([]DonasiPublicResponse, len(donasi))
+		for i, d := range donasi {
+			donasiPublic[i] = ctrl.formatDonasiPublic(d)
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"data": donasiPublic,
+			"filter": gin.H{
+				"start_date": startDate,
+				"end_date":   endDate,
+			},
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"data": donasi,
 		"filter": gin.H{
@@ -522,7 +603,7 @@ func (ctrl *DonasiController) GetDonasiPublic(c *gin.Context) {
 	var total int64
 
 	// Build query untuk public - hanya field yang diperlukan
-	query := ctrl.db.Select("id_donasi, nama_donatur, no_telp, nominal, waktu_catat")
+	query := ctrl.db.Select("id_donasi, nama_donatur, tampilan_nama, nominal, waktu_catat")
 
 	// Apply date filters jika ada
 	if startDate != "" {
@@ -632,7 +713,7 @@ func (ctrl *DonasiController) GetDonasiSummaryPublic(c *gin.Context) {
 
 	// Data terbaru (5 donasi terbaru untuk preview)
 	var donasiTerbaru []models.Donasi
-	ctrl.db.Select("nama_donatur, nominal, waktu_catat").
+	ctrl.db.Select("nama_donatur, tampilan_nama, nominal, waktu_catat").
 		Order("waktu_catat DESC").
 		Limit(5).
 		Find(&donasiTerbaru)
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"strconv"
 	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -18,16 +19,6 @@ func NewFasilitasController(db *gorm.DB) *FasilitasController {
 	return &FasilitasController{db: db}
 }
 
-// Helper function untuk check role admin
-func (ctrl *FasilitasController) isAdmin(c *gin.Context) bool {
-	userRole, exists := c.Get("role")
-	if !exists {
-		return false
-	}
-	role := userRole.(string)
-	return role == "admin" || role == "super_admin"
-}
-
 // Helper function untuk get user ID dari context
 func (ctrl *FasilitasController) getUserID(c *gin.Context) (string, bool) {
 	userID, exists := c.Get("user_id")
@@ -40,7 +31,7 @@ func (ctrl *FasilitasController) getUserID(c *gin.Context) (string, bool) {
 // CreateFasilitas membuat fasilitas baru
 func (ctrl *FasilitasController) CreateFasilitas(c *gin.Context) {
 	// Hanya admin yang bisa create fasilitas
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinKontenWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat membuat fasilitas"})
 		return
 	}
@@ -121,6 +112,9 @@ func (ctrl *FasilitasController) CreateFasilitas(c *gin.Context) {
 	// Preload relations untuk response
 	ctrl.db.Preload("DiupdateOleh").First(&fasilitas, "id_fasilitas = ?", fasilitas.IDFasilitas)
 
+	perbaruiIndeksPencarian(ctrl.db, models.PencarianFasilitas, fasilitas.IDFasilitas)
+	catatLog(ctrl.db, c, services.AksiCreate, services.TargetFasilitas, fasilitas.IDFasilitas, nil, fasilitas)
+
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Fasilitas berhasil dibuat",
 		"data":    fasilitas,
@@ -147,7 +141,7 @@ func (ctrl *FasilitasController) GetFasilitasByID(c *gin.Context) {
 	}
 
 	// Untuk public access, hanya tampilkan yang aktif
-	if !ctrl.isAdmin(c) && fasilitas.Status != "aktif" {
+	if !punyaIzin(c, services.IzinKontenWrite) && fasilitas.Status != "aktif" {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Fasilitas tidak ditemukan"})
 		return
 	}
@@ -177,7 +171,7 @@ func (ctrl *FasilitasController) GetFasilitasBySlug(c *gin.Context) {
 	}
 
 	// Untuk user non-admin, hanya bisa lihat yang aktif
-	if !ctrl.isAdmin(c) && fasilitas.Status != "aktif" {
+	if !punyaIzin(c, services.IzinKontenWrite) && fasilitas.Status != "aktif" {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: Anda tidak memiliki akses ke fasilitas ini"})
 		return
 	}
@@ -190,7 +184,7 @@ func (ctrl *FasilitasController) GetFasilitasBySlug(c *gin.Context) {
 // UpdateFasilitas mengupdate fasilitas
 func (ctrl *FasilitasController) UpdateFasilitas(c *gin.Context) {
 	// Hanya admin yang bisa update
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinKontenWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat mengupdate fasilitas"})
 		return
 	}
@@ -227,6 +221,8 @@ func (ctrl *FasilitasController) UpdateFasilitas(c *gin.Context) {
 	urutanTampilStr := c.PostForm("urutan_tampil")
 	status := c.PostForm("status")
 
+	sebelum := existingFasilitas
+
 	// Update fields
 	if icon != "" {
 		existingFasilitas.Icon = icon
@@ -271,6 +267,9 @@ func (ctrl *FasilitasController) UpdateFasilitas(c *gin.Context) {
 	// Preload relations untuk response
 	ctrl.db.Preload("DiupdateOleh").First(&existingFasilitas, "id_fasilitas = ?", existingFasilitas.IDFasilitas)
 
+	perbaruiIndeksPencarian(ctrl.db, models.PencarianFasilitas, existingFasilitas.IDFasilitas)
+	catatLog(ctrl.db, c, services.AksiUpdate, services.TargetFasilitas, existingFasilitas.IDFasilitas, sebelum, existingFasilitas)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Fasilitas berhasil diupdate",
 		"data":    existingFasilitas,
@@ -280,7 +279,7 @@ func (ctrl *FasilitasController) UpdateFasilitas(c *gin.Context) {
 // DeleteFasilitas menghapus fasilitas
 func (ctrl *FasilitasController) DeleteFasilitas(c *gin.Context) {
 	// Hanya admin yang bisa delete
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinKontenWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat menghapus fasilitas"})
 		return
 	}
@@ -309,6 +308,9 @@ func (ctrl *FasilitasController) DeleteFasilitas(c *gin.Context) {
 		return
 	}
 
+	perbaruiIndeksPencarian(ctrl.db, models.PencarianFasilitas, fasilitas.IDFasilitas)
+	catatLog(ctrl.db, c, services.AksiDelete, services.TargetFasilitas, fasilitas.IDFasilitas, fasilitas, nil)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Fasilitas berhasil dihapus",
 	})
@@ -317,7 +319,7 @@ func (ctrl *FasilitasController) DeleteFasilitas(c *gin.Context) {
 // AktifkanFasilitas mengubah status fasilitas menjadi aktif
 func (ctrl *FasilitasController) AktifkanFasilitas(c *gin.Context) {
 	// Hanya admin yang bisa mengaktifkan
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinKontenWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat mengaktifkan fasilitas"})
 		return
 	}
@@ -347,6 +349,8 @@ func (ctrl *FasilitasController) AktifkanFasilitas(c *gin.Context) {
 		return
 	}
 
+	sebelum := fasilitas
+
 	// Update status menjadi aktif
 	fasilitas.Status = "aktif"
 	fasilitas.DiupdateOlehID = &adminID
@@ -360,6 +364,8 @@ func (ctrl *FasilitasController) AktifkanFasilitas(c *gin.Context) {
 	// Preload relations untuk response
 	ctrl.db.Preload("DiupdateOleh").First(&fasilitas, "id_fasilitas = ?", fasilitas.IDFasilitas)
 
+	catatLog(ctrl.db, c, services.AksiUpdate, services.TargetFasilitas, fasilitas.IDFasilitas, sebelum, fasilitas)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Fasilitas berhasil diaktifkan",
 		"data":    fasilitas,
@@ -369,7 +375,7 @@ func (ctrl *FasilitasController) AktifkanFasilitas(c *gin.Context) {
 // NonaktifkanFasilitas mengubah status fasilitas menjadi nonaktif
 func (ctrl *FasilitasController) NonaktifkanFasilitas(c *gin.Context) {
 	// Hanya admin yang bisa menonaktifkan
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinKontenWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat menonaktifkan fasilitas"})
 		return
 	}
@@ -399,6 +405,8 @@ func (ctrl *FasilitasController) NonaktifkanFasilitas(c *gin.Context) {
 		return
 	}
 
+	sebelum := fasilitas
+
 	// Update status menjadi nonaktif
 	fasilitas.Status = "nonaktif"
 	fasilitas.DiupdateOlehID = &adminID
@@ -412,6 +420,8 @@ func (ctrl *FasilitasController) NonaktifkanFasilitas(c *gin.Context) {
 	// Preload relations untuk response
 	ctrl.db.Preload("DiupdateOleh").First(&fasilitas, "id_fasilitas = ?", fasilitas.IDFasilitas)
 
+	catatLog(ctrl.db, c, services.AksiUpdate, services.TargetFasilitas, fasilitas.IDFasilitas, sebelum, fasilitas)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Fasilitas berhasil dinonaktifkan",
 		"data":    fasilitas,
@@ -421,7 +431,7 @@ func (ctrl *FasilitasController) NonaktifkanFasilitas(c *gin.Context) {
 // GetAllFasilitas mendapatkan semua fasilitas dengan filter (untuk admin)
 func (ctrl *FasilitasController) GetAllFasilitas(c *gin.Context) {
 	// Hanya admin yang bisa akses semua data
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinKontenWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat mengakses semua fasilitas"})
 		return
 	}
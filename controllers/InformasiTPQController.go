@@ -1,8 +1,10 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -29,7 +31,7 @@ type CreateInformasiTPQRequest struct {
 	Alamat         *string `json:"alamat,omitempty"`
 	LinkAlamat     *string `json:"link_alamat,omitempty"`
 	HariJamBelajar *string `json:"hari_jam_belajar,omitempty"`
-	Logo           *string `json:"logo,omitempty"` // URL string dari Cloudinary
+	IDLogo         *string `json:"id_logo,omitempty"` // ID media dari media library
 }
 
 type UpdateInformasiTPQRequest struct {
@@ -43,17 +45,7 @@ type UpdateInformasiTPQRequest struct {
 	Alamat         *string `json:"alamat,omitempty"`
 	LinkAlamat     *string `json:"link_alamat,omitempty"`
 	HariJamBelajar *string `json:"hari_jam_belajar,omitempty"`
-	Logo           *string `json:"logo,omitempty"` // URL string dari Cloudinary
-}
-
-// Helper function untuk check role admin
-func (ctrl *InformasiTPQController) isAdmin(c *gin.Context) bool {
-	userRole, exists := c.Get("role")
-	if !exists {
-		return false
-	}
-	role := userRole.(string)
-	return role == "admin" || role == "super_admin"
+	IDLogo         *string `json:"id_logo,omitempty"` // ID media; string kosong menghapus logo
 }
 
 // Helper function untuk get user ID dari context
@@ -65,21 +57,23 @@ func (ctrl *InformasiTPQController) getUserID(c *gin.Context) (string, bool) {
 	return userID.(string), true
 }
 
-// Helper function untuk validasi URL Cloudinary
-func isValidCloudinaryURLlogo(url string) bool {
-	if url == "" {
-		return true // URL kosong diperbolehkan (tidak ada logo)
+// informasiTPQCetak mengambil informasi TPQ untuk kop dokumen cetak (kwitansi, laporan).
+// Nama bawaan dipakai jika informasi TPQ belum diisi.
+func informasiTPQCetak(db *gorm.DB) (models.InformasiTPQ, error) {
+	var info models.InformasiTPQ
+	if err := db.First(&info).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return info, err
 	}
-	
-	// Validasi dasar: harus string dan mengandung cloudinary.com
-	return len(url) > 0 && len(url) < 1000 && 
-	       (url == "" || (url[:4] == "http" && (url[:5] == "https" || url[:4] == "http")))
+	if info.NamaTPQ == "" {
+		info.NamaTPQ = "TPQ Asy-Syafii"
+	}
+	return info, nil
 }
 
 // CreateInformasiTPQ membuat informasi TPQ baru (JSON input)
 func (ctrl *InformasiTPQController) CreateInformasiTPQ(c *gin.Context) {
 	// Hanya admin yang bisa create
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinKontenWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat membuat informasi TPQ"})
 		return
 	}
@@ -104,10 +98,11 @@ func (ctrl *InformasiTPQController) CreateInformasiTPQ(c *gin.Context) {
 		return
 	}
 
-	// Validasi URL logo jika ada
-	if req.Logo != nil && *req.Logo != "" {
-		if !isValidCloudinaryURLlogo(*req.Logo) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "URL logo tidak valid"})
+	// Ambil logo dari media library jika ada
+	var logo *models.Media
+	if req.IDLogo != nil && *req.IDLogo != "" {
+		var ok bool
+		if logo, ok = mediaDariID(c, ctrl.db, *req.IDLogo); !ok {
 			return
 		}
 	}
@@ -117,7 +112,6 @@ func (ctrl *InformasiTPQController) CreateInformasiTPQ(c *gin.Context) {
 		IDTPQ:          uuid.New().String(),
 		NamaTPQ:        req.NamaTPQ,
 		Tempat:         req.Tempat,
-		Logo:           req.Logo, // URL string dari Cloudinary
 		Visi:           req.Visi,
 		Misi:           req.Misi,
 		Deskripsi:      req.Deskripsi,
@@ -128,6 +122,9 @@ func (ctrl *InformasiTPQController) CreateInformasiTPQ(c *gin.Context) {
 		HariJamBelajar: req.HariJamBelajar,
 		DiupdateOlehID: &adminID,
 	}
+	if logo != nil {
+		informasiTPQ.IDLogo, informasiTPQ.Logo = &logo.IDMedia, &logo.URL
+	}
 
 	// Simpan ke database
 	if err := ctrl.db.Create(&informasiTPQ).Error; err != nil {
@@ -138,6 +135,8 @@ func (ctrl *InformasiTPQController) CreateInformasiTPQ(c *gin.Context) {
 	// Preload relations untuk response
 	ctrl.db.Preload("DiupdateOleh").First(&informasiTPQ, "id_tpq = ?", informasiTPQ.IDTPQ)
 
+	catatLog(ctrl.db, c, services.AksiCreate, services.TargetInformasiTPQ, informasiTPQ.IDTPQ, nil, informasiTPQ)
+
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Informasi TPQ berhasil dibuat",
 		"data":    informasiTPQ,
@@ -167,7 +166,7 @@ func (ctrl *InformasiTPQController) GetInformasiTPQ(c *gin.Context) {
 // UpdateInformasiTPQ mengupdate informasi TPQ (JSON input)
 func (ctrl *InformasiTPQController) UpdateInformasiTPQ(c *gin.Context) {
 	// Hanya admin yang bisa update
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinKontenWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat mengupdate informasi TPQ"})
 		return
 	}
@@ -204,14 +203,17 @@ func (ctrl *InformasiTPQController) UpdateInformasiTPQ(c *gin.Context) {
 		return
 	}
 
-	// Validasi URL logo jika ada
-	if req.Logo != nil && *req.Logo != "" {
-		if !isValidCloudinaryURLlogo(*req.Logo) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "URL logo tidak valid"})
+	// Ambil logo baru dari media library jika diganti
+	var logo *models.Media
+	if req.IDLogo != nil && *req.IDLogo != "" {
+		var ok bool
+		if logo, ok = mediaDariID(c, ctrl.db, *req.IDLogo); !ok {
 			return
 		}
 	}
 
+	sebelum := existingTPQ
+
 	// Update fields
 	if req.NamaTPQ != "" {
 		existingTPQ.NamaTPQ = req.NamaTPQ
@@ -243,10 +245,11 @@ func (ctrl *InformasiTPQController) UpdateInformasiTPQ(c *gin.Context) {
 	if req.HariJamBelajar != nil {
 		existingTPQ.HariJamBelajar = req.HariJamBelajar
 	}
-	if req.Logo != nil {
-		// Hanya update jika ada perubahan
-		if existingTPQ.Logo == nil || (req.Logo != nil && *existingTPQ.Logo != *req.Logo) {
-			existingTPQ.Logo = req.Logo
+	if req.IDLogo != nil {
+		if logo != nil {
+			existingTPQ.IDLogo, existingTPQ.Logo = &logo.IDMedia, &logo.URL
+		} else {
+			existingTPQ.IDLogo, existingTPQ.Logo = nil, nil
 		}
 	}
 
@@ -262,6 +265,8 @@ func (ctrl *InformasiTPQController) UpdateInformasiTPQ(c *gin.Context) {
 	// Preload relations untuk response
 	ctrl.db.Preload("DiupdateOleh").First(&existingTPQ, "id_tpq = ?", existingTPQ.IDTPQ)
 
+	catatLog(ctrl.db, c, services.AksiUpdate, services.TargetInformasiTPQ, existingTPQ.IDTPQ, sebelum, existingTPQ)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Informasi TPQ berhasil diupdate",
 		"data":    existingTPQ,
@@ -271,7 +276,7 @@ func (ctrl *InformasiTPQController) UpdateInformasiTPQ(c *gin.Context) {
 // DeleteInformasiTPQ menghapus informasi TPQ
 func (ctrl *InformasiTPQController) DeleteInformasiTPQ(c *gin.Context) {
 	// Hanya admin yang bisa delete
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinKontenWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat menghapus informasi TPQ"})
 		return
 	}
@@ -300,6 +305,8 @@ func (ctrl *InformasiTPQController) DeleteInformasiTPQ(c *gin.Context) {
 		return
 	}
 
+	catatLog(ctrl.db, c, services.AksiDelete, services.TargetInformasiTPQ, tpq.IDTPQ, tpq, nil)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Informasi TPQ berhasil dihapus",
 	})
@@ -0,0 +1,12 @@
+package controllers
+
+import (
+	"tpq_asysyafii/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// punyaIzin memeriksa izin user yang sedang login berdasarkan registry izin
+func punyaIzin(c *gin.Context, izin services.Izin) bool {
+	return services.PunyaIzin(c.GetString("role"), izin)
+}
@@ -0,0 +1,285 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type JobController struct {
+	db        *gorm.DB
+	scheduler *services.Scheduler
+}
+
+func NewJobController(db *gorm.DB, scheduler *services.Scheduler) *JobController {
+	return &JobController{db: db, scheduler: scheduler}
+}
+
+// penggunaSistem adalah user yang dicatat sebagai pembuat data oleh job terjadwal:
+// SCHEDULER_USER_ID jika diisi, selain itu super_admin aktif yang paling lama terdaftar
+func penggunaSistem(db *gorm.DB) (string, error) {
+	if id := os.Getenv("SCHEDULER_USER_ID"); id != "" {
+		return id, nil
+	}
+	var user models.User
+	err := db.Where("role = ? AND status_aktif = ?", models.RoleSuperAdmin, true).
+		Order("dibuat_pada ASC").First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", errors.New("tidak ada super_admin aktif untuk mencatat data job, isi SCHEDULER_USER_ID")
+	}
+	return user.IDUser, err
+}
+
+// DaftarkanJobBawaan mendaftarkan job rutin: syahriah bulanan, sinkron rekap, pengumuman kadaluarsa,
+// pengingat tunggakan, berita terjadwal, dan indeks pencarian
+func DaftarkanJobBawaan(scheduler *services.Scheduler, db *gorm.DB) {
+	scheduler.Daftarkan(services.Job{
+		Nama:      "syahriah_bulanan",
+		Deskripsi: "Membuat syahriah bulan berjalan untuk semua santri aktif sesuai tarif",
+		Jadwal:    services.JadwalBulanan{Tanggal: 1, Jam: 0, Menit: 5},
+		Jalankan: func(ctx context.Context, jadwal time.Time) (string, error) {
+			return jobSyahriahBulanan(db.WithContext(ctx), jadwal.Format("2006-01"))
+		},
+	})
+	scheduler.Daftarkan(services.Job{
+		Nama:      "sinkron_rekap",
+		Deskripsi: "Memperbarui rekap saldo bulan lalu dan bulan berjalan dari jurnal",
+		Jadwal:    services.JadwalHarian{Jam: 0, Menit: 30},
+		Jalankan: func(ctx context.Context, jadwal time.Time) (string, error) {
+			return jobSinkronRekap(db.WithContext(ctx), jadwal)
+		},
+	})
+	scheduler.Daftarkan(services.Job{
+		Nama:      "pengumuman_kadaluarsa",
+		Deskripsi: "Menonaktifkan pengumuman yang sudah melewati tanggal selesai",
+		Jadwal:    services.JadwalInterval{Setiap: time.Hour},
+		Jalankan: func(ctx context.Context, jadwal time.Time) (string, error) {
+			return jobPengumumanKadaluarsa(db.WithContext(ctx), jadwal)
+		},
+	})
+	scheduler.Daftarkan(services.Job{
+		Nama:      "pengingat_tunggakan",
+		Deskripsi: "Mengirim pengingat tunggakan syahriah ke wali di luar masa tenangnya",
+		Jadwal:    services.JadwalHarian{Jam: 8, Menit: 0},
+		Jalankan: func(ctx context.Context, jadwal time.Time) (string, error) {
+			return jobPengingatTunggakan(db.WithContext(ctx))
+		},
+	})
+	scheduler.Daftarkan(services.Job{
+		Nama:      "berita_terjadwal",
+		Deskripsi: "Menerbitkan berita berstatus scheduled yang jadwal terbitnya sudah tiba",
+		Jadwal:    services.JadwalInterval{Setiap: 5 * time.Minute},
+		Jalankan: func(ctx context.Context, jadwal time.Time) (string, error) {
+			return jobBeritaTerjadwal(db.WithContext(ctx), time.Now())
+		},
+	})
+	scheduler.Daftarkan(services.Job{
+		Nama:      "indeks_pencarian",
+		Deskripsi: "Membangun ulang indeks pencarian konten publik agar tidak tertinggal dari tabel konten",
+		Jadwal:    services.JadwalHarian{Jam: 1, Menit: 0},
+		Jalankan: func(ctx context.Context, jadwal time.Time) (string, error) {
+			jumlah, err := services.BangunUlangIndeksPencarian(db.WithContext(ctx))
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d konten diindeks", jumlah), nil
+		},
+	})
+}
+
+func jobSyahriahBulanan(db *gorm.DB, bulan string) (string, error) {
+	adminID, err := penggunaSistem(db)
+	if err != nil {
+		return "", err
+	}
+
+	hasil, err := buatSyahriahBulanan(db, bulan, nil, false, adminID)
+	if errors.Is(err, errTidakAdaSantriAktif) {
+		return err.Error(), nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	for _, syahriah := range hasil.Dibuat {
+		catatLogOleh(db, adminID, services.AksiCreate, services.TargetSyahriah, syahriah.IDSyahriah, nil, syahriah)
+	}
+	if len(hasil.Dibuat) > 0 {
+		updateRekapMulai(db, periodeSyahriahBayar(append(hasil.Terdampak, models.Syahriah{Bulan: bulan}), hasil.Bayar...)...)
+		terbitkanKwitansiBayar(db, hasil.Bayar...)
+	}
+
+	return fmt.Sprintf("Syahriah %s dibuat untuk %d dari %d santri aktif (%d dibebaskan, %d mendapat potongan)",
+		bulan, len(hasil.Dibuat), hasil.SantriAktif, hasil.Dibebaskan, hasil.Dipotong), nil
+}
+
+func jobSinkronRekap(db *gorm.DB, jadwal time.Time) (string, error) {
+	// Mulai dari bulan lalu agar transaksi yang masuk di akhir bulan ikut terbawa ke saldo awal bulan ini
+	mulai := time.Date(jadwal.Year(), jadwal.Month()-1, 1, 0, 0, 0, 0, jadwal.Location()).Format("2006-01")
+	if err := NewRekapController(db).UpdateRekapBerantai(mulai); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Rekap diperbarui mulai periode %s", mulai), nil
+}
+
+func jobPengumumanKadaluarsa(db *gorm.DB, jadwal time.Time) (string, error) {
+	hasil := db.Model(&models.Pengumuman{}).
+		Where("status = ? AND tanggal_selesai IS NOT NULL AND tanggal_selesai < ?", models.StatusAktif, jadwal).
+		Update("status", models.StatusNonaktif)
+	if hasil.Error != nil {
+		return "", hasil.Error
+	}
+	return fmt.Sprintf("%d pengumuman dinonaktifkan", hasil.RowsAffected), nil
+}
+
+func jobBeritaTerjadwal(db *gorm.DB, sekarang time.Time) (string, error) {
+	var beritaList []models.Berita
+	if err := db.Where("status = ? AND jadwal_terbit <= ?", models.StatusScheduled, sekarang).
+		Order("jadwal_terbit ASC").Find(&beritaList).Error; err != nil {
+		return "", err
+	}
+	if len(beritaList) == 0 {
+		return "Tidak ada berita terjadwal yang jatuh tempo", nil
+	}
+
+	adminID, err := penggunaSistem(db)
+	if err != nil {
+		fmt.Printf("Gagal menentukan user sistem untuk log berita terjadwal: %v\n", err)
+	}
+
+	terbit := 0
+	for _, berita := range beritaList {
+		// Status ikut di WHERE agar berita yang baru saja diubah manual tidak ikut diterbitkan
+		hasil := db.Model(&models.Berita{}).
+			Where("id_berita = ? AND status = ?", berita.IDBerita, models.StatusScheduled).
+			Updates(map[string]interface{}{
+				"status":            models.StatusPublished,
+				"tanggal_publikasi": *berita.JadwalTerbit,
+				"jadwal_terbit":     nil,
+			})
+		if hasil.Error != nil {
+			return "", hasil.Error
+		}
+		if hasil.RowsAffected == 0 {
+			continue
+		}
+		terbit++
+		catatLogKeterangan(db, adminID, services.AksiTerbitkanBerita, services.TargetBerita, berita.IDBerita,
+			fmt.Sprintf("Berita terjadwal \"%s\" diterbitkan (jadwal %s)", berita.Judul, berita.JadwalTerbit.Format("02-01-2006 15:04")))
+	}
+	return fmt.Sprintf("%d berita terjadwal diterbitkan", terbit), nil
+}
+
+func jobPengingatTunggakan(db *gorm.DB) (string, error) {
+	hasil, err := services.NewPengingatService(db, services.DefaultNotifier()).Kirim(services.OpsiPengingat{})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Pengingat tunggakan per %s: %d terkirim, %d gagal, %d dilewati",
+		hasil.Per, len(hasil.Terkirim), len(hasil.Gagal), len(hasil.Dilewati)), nil
+}
+
+// GetAllJobs menampilkan job terdaftar beserta jadwal dan run terakhirnya
+func (ctrl *JobController) GetAllJobs(c *gin.Context) {
+	sekarang := time.Now()
+	data := make([]gin.H, 0)
+	for _, job := range ctrl.scheduler.Jobs() {
+		var runTerakhir *models.JobRun
+		if ctrl.db != nil {
+			var run models.JobRun
+			err := ctrl.db.Where("nama = ?", job.Nama).Order("mulai_pada DESC").First(&run).Error
+			if err == nil {
+				runTerakhir = &run
+			} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil riwayat job: " + err.Error()})
+				return
+			}
+		}
+		data = append(data, gin.H{
+			"nama":         job.Nama,
+			"deskripsi":    job.Deskripsi,
+			"jadwal":       job.Jadwal.String(),
+			"berikutnya":   job.Jadwal.Berikutnya(sekarang),
+			"run_terakhir": runTerakhir,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":     data,
+		"instance": ctrl.scheduler.Instance(),
+		"pemimpin": ctrl.scheduler.Pemimpin(),
+	})
+}
+
+// GetJobRuns menampilkan riwayat eksekusi job dengan filter nama dan status
+func (ctrl *JobController) GetJobRuns(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	query := ctrl.db.Model(&models.JobRun{})
+	if nama := c.Query("nama"); nama != "" {
+		query = query.Where("nama = ?", nama)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghitung total data: " + err.Error()})
+		return
+	}
+
+	var runs []models.JobRun
+	offset := (page - 1) * limit
+	if err := query.Order("mulai_pada DESC").Offset(offset).Limit(limit).Find(&runs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil riwayat job: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": runs,
+		"meta": gin.H{
+			"page":       page,
+			"limit":      limit,
+			"total":      total,
+			"total_page": (int(total) + limit - 1) / limit,
+		},
+	})
+}
+
+// RunJob menjalankan job di luar jadwal; hasilnya dapat dipantau di riwayat job
+func (ctrl *JobController) RunJob(c *gin.Context) {
+	run, err := ctrl.scheduler.JalankanSekarang(c.Param("nama"), c.GetString("user_id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrJobTidakDikenal):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrJobSedangDijalankan):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "data": run})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menjalankan job: " + err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Job " + run.Nama + " sedang dijalankan",
+		"data":    run,
+	})
+}
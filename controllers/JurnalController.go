@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type JurnalController struct {
+	db *gorm.DB
+}
+
+func NewJurnalController(db *gorm.DB) *JurnalController {
+	return &JurnalController{db: db}
+}
+
+// GetAllJurnal mendapatkan daftar jurnal beserta entrinya (read-only)
+func (ctrl *JurnalController) GetAllJurnal(c *gin.Context) {
+	if !punyaIzin(c, services.IzinJurnalRead) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat melihat jurnal"})
+		return
+	}
+
+	// Parse query parameters
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	periode := c.Query("periode")
+	sumberTipe := c.Query("sumber_tipe")
+	sumberID := c.Query("sumber_id")
+	akun := c.Query("akun")
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	var jurnal []models.Jurnal
+	var total int64
+
+	// Build query
+	query := ctrl.db.Model(&models.Jurnal{})
+
+	// Apply filters
+	if periode != "" {
+		query = query.Where("periode = ?", periode)
+	}
+	if sumberTipe != "" {
+		query = query.Where("sumber_tipe = ?", sumberTipe)
+	}
+	if sumberID != "" {
+		query = query.Where("sumber_id = ?", sumberID)
+	}
+	if akun != "" {
+		query = query.Where("id_jurnal IN (?)", ctrl.db.Model(&models.JurnalEntri{}).Select("id_jurnal").Where("akun = ?", akun))
+	}
+
+	// Hitung total records
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghitung total data: " + err.Error()})
+		return
+	}
+
+	// Apply pagination
+	offset := (page - 1) * limit
+	err := query.Preload("Entri").Preload("Admin").
+		Order("created_at DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&jurnal).Error
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data jurnal: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": jurnal,
+		"meta": gin.H{
+			"page":       page,
+			"limit":      limit,
+			"total":      total,
+			"total_page": (int(total) + limit - 1) / limit,
+		},
+	})
+}
+
+// GetSaldoAkun mendapatkan saldo bersih (debit - kredit) semua akun
+func (ctrl *JurnalController) GetSaldoAkun(c *gin.Context) {
+	if !punyaIzin(c, services.IzinJurnalRead) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat melihat saldo akun"})
+		return
+	}
+
+	daftarAkun := []models.Akun{
+		models.AkunKasSyahriah,
+		models.AkunKasDonasi,
+		models.AkunPendapatanSyahriah,
+		models.AkunPendapatanDonasi,
+		models.AkunBebanOperasional,
+		models.AkunBebanInvestasi,
+		models.AkunBebanLainnya,
+		models.AkunPenyesuaianSaldo,
+	}
+
+	ledger := services.NewLedgerService(ctrl.db)
+	saldo := make(map[models.Akun]float64)
+	for _, akun := range daftarAkun {
+		nilai, err := ledger.SaldoAkun(akun)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghitung saldo akun: " + err.Error()})
+			return
+		}
+		saldo[akun] = nilai
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": saldo,
+	})
+}
@@ -3,6 +3,7 @@ package controllers
 import (
 	"net/http"
 	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -68,6 +69,12 @@ func (ctrl *KeluargaController) CreateKeluarga(c *gin.Context) {
 		req.IDWali = userID
 	}
 
+	// Wali hanya boleh membuat data keluarga untuk dirinya sendiri
+	if !bolehAksesMilik(c, req.IDWali, services.IzinKeluargaWrite) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: Anda tidak dapat membuat data keluarga untuk wali lain"})
+		return
+	}
+
 	// Cek apakah wali exists
 	var wali models.User
 	if err := ctrl.db.Where("id_user = ?", req.IDWali).First(&wali).Error; err != nil {
@@ -97,6 +104,8 @@ func (ctrl *KeluargaController) CreateKeluarga(c *gin.Context) {
 	// // Preload relations untuk response
 	ctrl.db.Preload("Wali").First(&keluarga, "id_keluarga = ?", keluarga.IDKeluarga)
 
+	catatLog(ctrl.db, c, services.AksiCreate, services.TargetKeluarga, keluarga.IDKeluarga, nil, keluarga)
+
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Data keluarga berhasil dibuat",
 		"data":    keluarga,
@@ -122,6 +131,11 @@ func (ctrl *KeluargaController) GetKeluargaByID(c *gin.Context) {
 		return
 	}
 
+	if !bolehAksesMilik(c, keluarga.IDWali, services.IzinKeluargaRead) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: Anda tidak memiliki akses ke data keluarga ini"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"data": keluarga,
 	})
@@ -135,6 +149,11 @@ func (ctrl *KeluargaController) GetKeluargaByWali(c *gin.Context) {
 		return
 	}
 
+	if !bolehAksesMilik(c, idWali, services.IzinKeluargaRead) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: Anda tidak memiliki akses ke data keluarga wali ini"})
+		return
+	}
+
 	var keluarga models.Keluarga
 	err := ctrl.db.Preload("Wali").
 		Where("id_wali = ?", idWali).
@@ -186,7 +205,8 @@ func (ctrl *KeluargaController) GetMyKeluarga(c *gin.Context) {
 func (ctrl *KeluargaController) GetAllKeluarga(c *gin.Context) {
 	var keluarga []models.Keluarga
 
-	err := ctrl.db.Preload("Wali").
+	// Wali hanya melihat data keluarganya sendiri
+	err := lingkupMilik(c, ctrl.db.Preload("Wali"), "id_wali", services.IzinKeluargaRead).
 		Find(&keluarga).Error
 
 	if err != nil {
@@ -233,15 +253,14 @@ func (ctrl *KeluargaController) UpdateKeluarga(c *gin.Context) {
 	}
 
 	// Authorization check: hanya wali yang bersangkutan atau admin yang bisa update
-	userRole, _ := c.Get("role")
-	role := userRole.(string)
-	
-	if existingKeluarga.IDWali != userID && role != "admin" && role != "super_admin" {
+	if existingKeluarga.IDWali != userID && !punyaIzin(c, services.IzinKeluargaWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: Anda tidak memiliki akses untuk mengupdate data keluarga ini"})
 		return
 	}
 
 
+	sebelum := existingKeluarga
+
 	// Update fields
 	if req.Alamat != "" {
 		existingKeluarga.Alamat = req.Alamat
@@ -274,6 +293,8 @@ func (ctrl *KeluargaController) UpdateKeluarga(c *gin.Context) {
 	// Preload relations untuk response
 	ctrl.db.Preload("Wali").First(&existingKeluarga, "id_keluarga = ?", existingKeluarga.IDKeluarga)
 
+	catatLog(ctrl.db, c, services.AksiUpdate, services.TargetKeluarga, existingKeluarga.IDKeluarga, sebelum, existingKeluarga)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Data keluarga berhasil diupdate",
 		"data":    existingKeluarga,
@@ -308,10 +329,7 @@ func (ctrl *KeluargaController) DeleteKeluarga(c *gin.Context) {
 	}
 
 	// Authorization check: hanya wali yang bersangkutan atau admin yang bisa delete
-	userRole, _ := c.Get("role")
-	role := userRole.(string)
-	
-	if keluarga.IDWali != userID && role != "admin" && role != "super_admin" {
+	if keluarga.IDWali != userID && !punyaIzin(c, services.IzinKeluargaWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: Anda tidak memiliki akses untuk menghapus data keluarga ini"})
 		return
 	}
@@ -322,6 +340,8 @@ func (ctrl *KeluargaController) DeleteKeluarga(c *gin.Context) {
 		return
 	}
 
+	catatLog(ctrl.db, c, services.AksiDelete, services.TargetKeluarga, keluarga.IDKeluarga, keluarga, nil)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Data keluarga berhasil dihapus",
 	})
@@ -330,7 +350,7 @@ func (ctrl *KeluargaController) DeleteKeluarga(c *gin.Context) {
 // SearchKeluarga mencari keluarga berdasarkan filter
 func (ctrl *KeluargaController) SearchKeluarga(c *gin.Context) {
 
-	query := ctrl.db.Preload("Wali")
+	query := lingkupMilik(c, ctrl.db.Preload("Wali"), "id_wali", services.IzinKeluargaRead)
 
 	var keluarga []models.Keluarga
 	if err := query.Find(&keluarga).Error; err != nil {
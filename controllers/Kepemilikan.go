@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// bolehAksesMilik: user boleh mengakses data jika punya izin untuk semua data
+// atau data tersebut miliknya sendiri (idPemilik = user yang login)
+func bolehAksesMilik(c *gin.Context, idPemilik string, izin services.Izin) bool {
+	if punyaIzin(c, izin) {
+		return true
+	}
+	userID := c.GetString("user_id")
+	return userID != "" && userID == idPemilik
+}
+
+// lingkupMilik membatasi query ke data milik user yang login jika user tidak punya izin untuk semua data
+func lingkupMilik(c *gin.Context, query *gorm.DB, kolomPemilik string, izin services.Izin) *gorm.DB {
+	if punyaIzin(c, izin) {
+		return query
+	}
+	return query.Where(kolomPemilik+" = ?", c.GetString("user_id"))
+}
+
+// subquerySantriWali menghasilkan subquery id_santri milik seorang wali
+func subquerySantriWali(db *gorm.DB, idWali string) *gorm.DB {
+	return db.Model(&models.Santri{}).Select("id_santri").Where("id_wali = ?", idWali)
+}
+
+// bolehAksesSantri memeriksa akses ke data turunan santri (misalnya syahriah) lewat wali santri tersebut
+func bolehAksesSantri(c *gin.Context, db *gorm.DB, idSantri string, izin services.Izin) (bool, error) {
+	if punyaIzin(c, izin) {
+		return true, nil
+	}
+	var jumlah int64
+	err := db.Model(&models.Santri{}).
+		Where("id_santri = ? AND id_wali = ?", idSantri, c.GetString("user_id")).
+		Count(&jumlah).Error
+	return jumlah > 0, err
+}
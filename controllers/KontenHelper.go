@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"net/http"
+	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// formatKonten membaca format dari request; kosong berarti bawaan (Markdown jika bawaan juga kosong).
+// Mengembalikan false jika request sudah dibalas.
+func formatKonten(c *gin.Context, format string, bawaan models.FormatKonten) (models.FormatKonten, bool) {
+	if format == "" {
+		if bawaan == "" {
+			return models.FormatMarkdown, true
+		}
+		return bawaan, true
+	}
+	f := models.FormatKonten(format)
+	if !services.FormatKontenValid(f) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format tidak valid. Gunakan 'markdown' atau 'html'"})
+		return "", false
+	}
+	return f, true
+}
+
+// renderKonten merender sumber konten menjadi HTML yang aman. Konten yang kosong setelah disaring
+// (misalnya hanya berisi script) ditolak. Mengembalikan false jika request sudah dibalas.
+func renderKonten(c *gin.Context, sumber string, format models.FormatKonten) (services.KontenTerender, bool) {
+	hasil, err := services.RenderKonten(sumber, format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Konten tidak valid: " + err.Error()})
+		return hasil, false
+	}
+	if hasil.HTML == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Konten kosong setelah HTML yang tidak diizinkan dibuang"})
+		return hasil, false
+	}
+	return hasil, true
+}
@@ -0,0 +1,222 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type KwitansiController struct {
+	db *gorm.DB
+}
+
+func NewKwitansiController(db *gorm.DB) *KwitansiController {
+	return &KwitansiController{db: db}
+}
+
+// terbitkanKwitansi menerbitkan kwitansi setelah pembayaran tercatat. Kegagalan tidak membatalkan
+// pembayaran karena kwitansi tetap diterbitkan saat pertama kali diunduh.
+func terbitkanKwitansi(db *gorm.DB, jenis models.JenisKwitansi, idSumber string) *models.Kwitansi {
+	kwitansi, err := services.NewKwitansiService(db).Terbitkan(jenis, idSumber)
+	if err != nil {
+		fmt.Printf("Gagal menerbitkan kwitansi %s %s: %v\n", jenis, idSumber, err)
+		return nil
+	}
+	return kwitansi
+}
+
+// terbitkanKwitansiBayar menerbitkan kwitansi untuk setiap pembayaran syahriah (bukan baris kredit)
+func terbitkanKwitansiBayar(db *gorm.DB, bayar ...models.SyahriahBayar) {
+	for _, b := range bayar {
+		if b.Metode != models.BayarKredit {
+			terbitkanKwitansi(db, models.KwitansiSyahriah, b.IDBayar)
+		}
+	}
+}
+
+// urlVerifikasi menyusun alamat verifikasi publik dari APP_URL, atau dari host request jika kosong
+func urlVerifikasi(c *gin.Context, kode string) string {
+	dasar := strings.TrimRight(os.Getenv("APP_URL"), "/")
+	if dasar == "" {
+		skema := "http"
+		if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+			skema = "https"
+		}
+		dasar = skema + "://" + c.Request.Host
+	}
+	return dasar + "/api/kwitansi/verifikasi/" + kode
+}
+
+// kirimPDF mencetak kwitansi sebagai file PDF untuk diunduh
+func (ctrl *KwitansiController) kirimPDF(c *gin.Context, kwitansi *models.Kwitansi) {
+	info, err := informasiTPQCetak(ctrl.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil informasi TPQ: " + err.Error()})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := services.TulisPDFKwitansi(&buf, *kwitansi, info, urlVerifikasi(c, kwitansi.KodeVerifikasi)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat PDF kwitansi: " + err.Error()})
+		return
+	}
+
+	namaFile := "kwitansi-" + strings.ReplaceAll(kwitansi.Nomor, "/", "-") + ".pdf"
+	c.Header("Content-Disposition", `attachment; filename="`+namaFile+`"`)
+	c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+}
+
+// balasGagalTerbit menerjemahkan error penerbitan kwitansi ke status HTTP
+func balasGagalTerbit(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrSumberKwitansiTidakDitemukan):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrKwitansiKredit):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menerbitkan kwitansi: " + err.Error()})
+	}
+}
+
+// DownloadKwitansiSyahriah mengunduh kwitansi satu pembayaran syahriah (admin atau wali santri)
+func (ctrl *KwitansiController) DownloadKwitansiSyahriah(c *gin.Context) {
+	var bayar models.SyahriahBayar
+	if err := ctrl.db.First(&bayar, "id_bayar = ?", c.Param("id_bayar")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": services.ErrSumberKwitansiTidakDitemukan.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data pembayaran: " + err.Error()})
+		return
+	}
+
+	var syahriah models.Syahriah
+	if err := ctrl.db.Select("id_syahriah", "id_santri").First(&syahriah, "id_syahriah = ?", bayar.IDSyahriah).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data syahriah: " + err.Error()})
+		return
+	}
+	boleh, err := bolehAksesSantri(c, ctrl.db, syahriah.ID_Santri, services.IzinSyahriahRead)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memeriksa akses: " + err.Error()})
+		return
+	}
+	if !boleh {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: Anda tidak memiliki akses ke kwitansi ini"})
+		return
+	}
+
+	kwitansi, err := services.NewKwitansiService(ctrl.db).Terbitkan(models.KwitansiSyahriah, bayar.IDBayar)
+	if err != nil {
+		balasGagalTerbit(c, err)
+		return
+	}
+	ctrl.kirimPDF(c, kwitansi)
+}
+
+// DownloadKwitansiDonasi mengunduh kwitansi donasi untuk diberikan ke donatur (admin)
+func (ctrl *KwitansiController) DownloadKwitansiDonasi(c *gin.Context) {
+	kwitansi, err := services.NewKwitansiService(ctrl.db).Terbitkan(models.KwitansiDonasi, c.Param("id"))
+	if err != nil {
+		balasGagalTerbit(c, err)
+		return
+	}
+	ctrl.kirimPDF(c, kwitansi)
+}
+
+// GetMyKwitansi menampilkan kwitansi pembayaran syahriah santri milik wali yang login
+func (ctrl *KwitansiController) GetMyKwitansi(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	query := ctrl.db.Model(&models.Kwitansi{}).Where("id_wali = ?", c.GetString("user_id"))
+	if idSantri := c.Query("id_santri"); idSantri != "" {
+		query = query.Where("id_santri = ?", idSantri)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghitung total data: " + err.Error()})
+		return
+	}
+
+	var kwitansiList []models.Kwitansi
+	offset := (page - 1) * limit
+	if err := query.Order("dibuat_pada DESC").Offset(offset).Limit(limit).Find(&kwitansiList).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data kwitansi: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": kwitansiList,
+		"meta": gin.H{
+			"page":       page,
+			"limit":      limit,
+			"total":      total,
+			"total_page": (int(total) + limit - 1) / limit,
+		},
+	})
+}
+
+// VerifikasiKwitansi memeriksa keaslian kwitansi dari kode verifikasinya (publik).
+// Nama donatur mengikuti pilihan privasinya.
+func (ctrl *KwitansiController) VerifikasiKwitansi(c *gin.Context) {
+	kwitansi, err := services.NewKwitansiService(ctrl.db).Verifikasi(c.Param("kode"))
+	if err != nil {
+		if errors.Is(err, services.ErrKwitansiTidakDitemukan) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Kwitansi tidak ditemukan, periksa kembali kode verifikasi"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memeriksa kwitansi: " + err.Error()})
+		return
+	}
+
+	pembayar := kwitansi.NamaPembayar
+	if kwitansi.Jenis == models.KwitansiDonasi {
+		var donasi models.Donasi
+		if err := ctrl.db.Select("nama_donatur", "tampilan_nama").First(&donasi, "id_donasi = ?", kwitansi.IDSumber).Error; err == nil {
+			donasi.NamaDonatur = kwitansi.NamaPembayar
+			pembayar = namaDonaturPublik(donasi)
+		} else {
+			pembayar = namaDonaturPublik(models.Donasi{})
+		}
+	}
+
+	message := "Kwitansi asli dan masih berlaku"
+	if kwitansi.Status == models.KwitansiBatal {
+		message = "Kwitansi asli tetapi sudah dibatalkan"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"data": gin.H{
+			"nomor":           kwitansi.Nomor,
+			"jenis":           kwitansi.Jenis,
+			"nama_pembayar":   pembayar,
+			"nominal":         kwitansi.Nominal,
+			"terbilang":       services.Terbilang(kwitansi.Nominal),
+			"keterangan":      kwitansi.Keterangan,
+			"nama_penerima":   kwitansi.NamaPenerima,
+			"tanggal_bayar":   kwitansi.TanggalBayar,
+			"status":          kwitansi.Status,
+			"dibatalkan_pada": kwitansi.DibatalkanPada,
+			"diterbitkan":     kwitansi.DibuatPada,
+		},
+	})
+}
@@ -1,10 +1,12 @@
 package controllers
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
 	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -29,20 +31,38 @@ type LogAktivitasFilter struct {
 	EndDate   string `form:"end_date"`
 }
 
-// Helper function untuk check role admin
-func (ctrl *LogAktivitasController) checkAdminRole(c *gin.Context) bool {
-	userRole, exists := c.Get("role")
-	if !exists {
-		return false
+// catatLog mencatat audit trail atas nama user yang sedang login.
+// Kegagalan pencatatan hanya di-log agar tidak menggagalkan operasi utama.
+func catatLog(db *gorm.DB, c *gin.Context, aksi, tipeTarget, idTarget string, sebelum, sesudah interface{}) {
+	userID, _ := c.Get("user_id")
+	actorID, _ := userID.(string)
+	catatLogOleh(db, actorID, aksi, tipeTarget, idTarget, sebelum, sesudah)
+}
+
+// catatLogOleh mencatat audit trail dengan actor yang ditentukan secara eksplisit
+func catatLogOleh(db *gorm.DB, actorID, aksi, tipeTarget, idTarget string, sebelum, sesudah interface{}) {
+	if db == nil || actorID == "" {
+		return
+	}
+	if err := services.NewLogService(db).LogPerubahan(actorID, aksi, tipeTarget, idTarget, sebelum, sesudah); err != nil {
+		fmt.Printf("Gagal mencatat log aktivitas: %v\n", err)
+	}
+}
+
+// catatLogKeterangan mencatat audit trail dengan keterangan bebas (untuk aksi yang tidak punya diff data)
+func catatLogKeterangan(db *gorm.DB, actorID, aksi, tipeTarget, idTarget, keterangan string) {
+	if db == nil || actorID == "" {
+		return
+	}
+	if err := services.NewLogService(db).LogAktivitas(actorID, aksi, tipeTarget, idTarget, keterangan); err != nil {
+		fmt.Printf("Gagal mencatat log aktivitas: %v\n", err)
 	}
-	role := userRole.(string)
-	return role == "admin" || role == "super_admin"
 }
 
 // GetAllLogAktivitas mendapatkan semua log aktivitas dengan filter
 func (ctrl *LogAktivitasController) GetAllLogAktivitas(c *gin.Context) {
 	// Check role
-	if !ctrl.checkAdminRole(c) {
+	if !punyaIzin(c, services.IzinLogRead) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin dan super_admin yang dapat akses"})
 		return
 	}
@@ -135,7 +155,7 @@ func (ctrl *LogAktivitasController) GetAllLogAktivitas(c *gin.Context) {
 // GetLogAktivitasByID mendapatkan log aktivitas berdasarkan ID
 func (ctrl *LogAktivitasController) GetLogAktivitasByID(c *gin.Context) {
 	// Check role
-	if !ctrl.checkAdminRole(c) {
+	if !punyaIzin(c, services.IzinLogRead) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin dan super_admin yang dapat akses"})
 		return
 	}
@@ -165,7 +185,7 @@ func (ctrl *LogAktivitasController) GetLogAktivitasByID(c *gin.Context) {
 // GetLogSummary mendapatkan summary log aktivitas
 func (ctrl *LogAktivitasController) GetLogSummary(c *gin.Context) {
 	// Check role
-	if !ctrl.checkAdminRole(c) {
+	if !punyaIzin(c, services.IzinLogRead) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin dan super_admin yang dapat akses"})
 		return
 	}
@@ -266,7 +286,7 @@ func (ctrl *LogAktivitasController) GetLogSummary(c *gin.Context) {
 // GetLogAktivitasByAdmin mendapatkan log aktivitas oleh admin tertentu
 func (ctrl *LogAktivitasController) GetLogAktivitasByAdmin(c *gin.Context) {
 	// Check role
-	if !ctrl.checkAdminRole(c) {
+	if !punyaIzin(c, services.IzinLogRead) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin dan super_admin yang dapat akses"})
 		return
 	}
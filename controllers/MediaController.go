@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type MediaController struct {
+	db *gorm.DB
+}
+
+func NewMediaController(db *gorm.DB) *MediaController {
+	return &MediaController{db: db}
+}
+
+// mediaDariID mengambil media yang akan dipasang di konten. Membalas 400 jika media tidak ada,
+// ok bernilai false jika request sudah dibalas.
+func mediaDariID(c *gin.Context, db *gorm.DB, idMedia string) (*models.Media, bool) {
+	media, err := services.NewMediaService(db).Ambil(idMedia)
+	if err != nil {
+		if errors.Is(err, services.ErrMediaTidakDitemukan) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Media " + idMedia + " tidak ditemukan, unggah gambar lewat media library"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data media: " + err.Error()})
+		return nil, false
+	}
+	return media, true
+}
+
+// UploadMedia menerima multipart form dengan field "file" dan "kategori"
+// (berita, logo, santri, sosmed, umum)
+func (ctrl *MediaController) UploadMedia(c *gin.Context) {
+	batas := services.BatasUkuranMedia()
+	// Sisakan ruang untuk field form lain di luar berkas
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, batas+1<<20)
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": services.ErrMediaTerlaluBesar.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Field file wajib diisi: " + err.Error()})
+		return
+	}
+	if fileHeader.Size > batas {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": services.ErrMediaTerlaluBesar.Error()})
+		return
+	}
+
+	kategori := models.KategoriMedia(c.DefaultPostForm("kategori", string(models.KategoriMediaUmum)))
+	if !services.KategoriMediaValid(kategori) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Kategori tidak valid. Gunakan 'berita', 'logo', 'santri', 'sosmed', atau 'umum'"})
+		return
+	}
+
+	berkas, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Gagal membaca berkas: " + err.Error()})
+		return
+	}
+	defer berkas.Close()
+
+	media, err := services.NewMediaService(ctrl.db).Unggah(c.Request.Context(), fileHeader.Filename, berkas, kategori, c.GetString("user_id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrMediaTerlaluBesar):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrTipeMediaTidakDidukung):
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrGambarTidakValid):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengunggah media: " + err.Error()})
+		}
+		return
+	}
+
+	catatLog(ctrl.db, c, services.AksiCreate, services.TargetMedia, media.IDMedia, nil, media)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Media berhasil diunggah",
+		"data":    media,
+	})
+}
+
+// GetAllMedia menampilkan media library, bisa difilter per kategori
+func (ctrl *MediaController) GetAllMedia(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	query := ctrl.db.Model(&models.Media{})
+	if kategori := c.Query("kategori"); kategori != "" {
+		query = query.Where("kategori = ?", kategori)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghitung total data: " + err.Error()})
+		return
+	}
+
+	var mediaList []models.Media
+	offset := (page - 1) * limit
+	if err := query.Preload("Pengunggah").Order("dibuat_pada DESC").Offset(offset).Limit(limit).Find(&mediaList).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data media: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": mediaList,
+		"meta": gin.H{
+			"page":       page,
+			"limit":      limit,
+			"total":      total,
+			"total_page": (int(total) + limit - 1) / limit,
+		},
+	})
+}
+
+// GetMediaByID menampilkan satu media
+func (ctrl *MediaController) GetMediaByID(c *gin.Context) {
+	media, err := services.NewMediaService(ctrl.db).Ambil(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, services.ErrMediaTidakDitemukan) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data media: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": media})
+}
+
+// DeleteMedia menghapus media yang tidak lagi dipakai konten
+func (ctrl *MediaController) DeleteMedia(c *gin.Context) {
+	media, err := services.NewMediaService(ctrl.db).Hapus(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrMediaTidakDitemukan):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrMediaDipakai):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghapus media: " + err.Error()})
+		}
+		return
+	}
+
+	catatLog(ctrl.db, c, services.AksiDelete, services.TargetMedia, media.IDMedia, media, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Media berhasil dihapus"})
+}
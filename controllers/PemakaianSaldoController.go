@@ -2,15 +2,16 @@ package controllers
 
 import (
 	"errors"
-	"fmt"
 	"net/http"
 	"strconv"
 	"time"
 	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type PemakaianSaldoController struct {
@@ -49,16 +50,6 @@ type PemakaianSummary struct {
 	PemakaianTerbanyak float64 `json:"pemakaian_terbanyak"`
 }
 
-// Helper function untuk check role admin
-func (ctrl *PemakaianSaldoController) isAdmin(c *gin.Context) bool {
-	userRole, exists := c.Get("role")
-	if !exists {
-		return false
-	}
-	role := userRole.(string)
-	return role == "admin" || role == "super_admin"
-}
-
 // Helper function untuk get user ID dari context
 func (ctrl *PemakaianSaldoController) getUserID(c *gin.Context) (string, bool) {
 	userID, exists := c.Get("user_id")
@@ -71,7 +62,7 @@ func (ctrl *PemakaianSaldoController) getUserID(c *gin.Context) (string, bool) {
 // CreatePemakaian membuat data pemakaian saldo baru
 func (ctrl *PemakaianSaldoController) CreatePemakaian(c *gin.Context) {
 	// Hanya admin yang bisa create
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinPemakaianWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat membuat data pemakaian saldo"})
 		return
 	}
@@ -128,12 +119,6 @@ func (ctrl *PemakaianSaldoController) CreatePemakaian(c *gin.Context) {
 		tanggalPemakaian = &today
 	}
 
-	// Cek saldo tersedia
-	if !ctrl.cekSaldoTersedia(req.NominalSyahriah, req.NominalDonasi) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Saldo tidak mencukupi"})
-		return
-	}
-
 	// Buat data pemakaian
 	pemakaian := models.PemakaianSaldo{
 		IDPemakaian:      uuid.New().String(),
@@ -148,8 +133,22 @@ func (ctrl *PemakaianSaldoController) CreatePemakaian(c *gin.Context) {
 		Keterangan:       req.Keterangan,
 	}
 
-	// Simpan ke database
-	if err := ctrl.db.Create(&pemakaian).Error; err != nil {
+	// Cek saldo, simpan, posting jurnal pengeluaran dan update rekap dalam satu transaksi terkunci
+	err := ctrl.prosesDenganKunciSaldo(req.NominalSyahriah, req.NominalDonasi, []string{periodePemakaian(pemakaian)},
+		func(tx *gorm.DB, ledger *services.LedgerService) error {
+			if err := tx.Create(&pemakaian).Error; err != nil {
+				return err
+			}
+			return ledger.CatatPemakaian(pemakaian, adminID)
+		})
+	if err != nil {
+		if errors.Is(err, errSaldoTidakCukup) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Saldo tidak mencukupi"})
+			return
+		}
+		if balasPeriodeDitutup(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat data pemakaian saldo: " + err.Error()})
 		return
 	}
@@ -157,11 +156,7 @@ func (ctrl *PemakaianSaldoController) CreatePemakaian(c *gin.Context) {
 	// Preload relations untuk response
 	ctrl.db.Preload("Pengaju").First(&pemakaian, "id_pemakaian = ?", pemakaian.IDPemakaian)
 
-	// Update rekap saldo (kurangi saldo)
-	if err := ctrl.updateRekapSaldoSetelahPemakaian(pemakaian); err != nil {
-		// Log error tapi jangan gagalkan create
-		fmt.Printf("Gagal update rekap saldo: %v\n", err)
-	}
+	catatLog(ctrl.db, c, services.AksiCreate, services.TargetPemakaianSaldo, pemakaian.IDPemakaian, nil, pemakaian)
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Data pemakaian saldo berhasil dibuat",
@@ -292,7 +287,7 @@ func (ctrl *PemakaianSaldoController) GetPemakaianByID(c *gin.Context) {
 // UpdatePemakaian mengupdate data pemakaian saldo
 func (ctrl *PemakaianSaldoController) UpdatePemakaian(c *gin.Context) {
 	// Hanya admin yang bisa update
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinPemakaianWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat mengupdate data pemakaian saldo"})
 		return
 	}
@@ -309,52 +304,15 @@ func (ctrl *PemakaianSaldoController) UpdatePemakaian(c *gin.Context) {
 		return
 	}
 
-	// Cek apakah pemakaian exists
-	var existingPemakaian models.PemakaianSaldo
-	err := ctrl.db.Where("id_pemakaian = ?", id).First(&existingPemakaian).Error
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Data pemakaian saldo tidak ditemukan"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data pemakaian saldo: " + err.Error()})
+	// Validasi input sebelum transaksi; perubahan diterapkan ke data yang dibaca ulang di dalam kunci
+	if req.NominalSyahriah != nil && *req.NominalSyahriah < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nominal syahriah tidak boleh negatif"})
 		return
 	}
-
-	// Simpan nominal lama untuk update rekap
-	nominalSyahriahLama := existingPemakaian.NominalSyahriah
-	nominalDonasiLama := existingPemakaian.NominalDonasi
-
-	// Update fields
-	if req.JudulPemakaian != nil {
-		existingPemakaian.JudulPemakaian = *req.JudulPemakaian
-	}
-	if req.Deskripsi != nil {
-		existingPemakaian.Deskripsi = *req.Deskripsi
-	}
-	if req.NominalSyahriah != nil {
-		if *req.NominalSyahriah < 0 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Nominal syahriah tidak boleh negatif"})
-			return
-		}
-		existingPemakaian.NominalSyahriah = *req.NominalSyahriah
-	}
-	if req.NominalDonasi != nil {
-		if *req.NominalDonasi < 0 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Nominal donasi tidak boleh negatif"})
-			return
-		}
-		existingPemakaian.NominalDonasi = *req.NominalDonasi
-	}
-	
-	// Hitung ulang total
-	existingPemakaian.NominalTotal = existingPemakaian.NominalSyahriah + existingPemakaian.NominalDonasi
-	
-	if existingPemakaian.NominalTotal <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Total nominal harus lebih besar dari 0"})
+	if req.NominalDonasi != nil && *req.NominalDonasi < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nominal donasi tidak boleh negatif"})
 		return
 	}
-
 	if req.TipePemakaian != nil {
 		// Validasi tipe pemakaian
 		if *req.TipePemakaian != models.PemakaianOperasional && 
@@ -363,31 +321,102 @@ func (ctrl *PemakaianSaldoController) UpdatePemakaian(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Tipe pemakaian tidak valid"})
 			return
 		}
-		existingPemakaian.TipePemakaian = *req.TipePemakaian
 	}
+	var tanggalPemakaian *time.Time
 	if req.TanggalPemakaian != nil {
 		parsedDate, err := time.Parse("2006-01-02", *req.TanggalPemakaian)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Format tanggal_pemakaian tidak valid. Gunakan format YYYY-MM-DD"})
 			return
 		}
-		existingPemakaian.TanggalPemakaian = &parsedDate
-	}
-	if req.Keterangan != nil {
-		existingPemakaian.Keterangan = req.Keterangan
+		tanggalPemakaian = &parsedDate
 	}
 
-	// Cek saldo tersedia jika nominal berubah
-	if (req.NominalSyahriah != nil && *req.NominalSyahriah != nominalSyahriahLama) || 
-	   (req.NominalDonasi != nil && *req.NominalDonasi != nominalDonasiLama) {
-		if !ctrl.cekSaldoTersedia(existingPemakaian.NominalSyahriah, existingPemakaian.NominalDonasi) {
+	// Baca ulang pemakaian setelah kas terkunci, supaya selisih nominal dihitung dari data terbaru
+	// dan pemakaian yang baru dihapus request lain tidak tersimpan kembali
+	adminID, _ := ctrl.getUserID(c)
+	var sebelum, existingPemakaian models.PemakaianSaldo
+	err := ctrl.db.Transaction(func(tx *gorm.DB) error {
+		ledger := services.NewLedgerService(tx)
+		if err := ledger.KunciAkun(models.AkunKasSyahriah, models.AkunKasDonasi); err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&existingPemakaian, "id_pemakaian = ?", id).Error; err != nil {
+			return err
+		}
+		sebelum = existingPemakaian
+
+		// Update fields
+		if req.JudulPemakaian != nil {
+			existingPemakaian.JudulPemakaian = *req.JudulPemakaian
+		}
+		if req.Deskripsi != nil {
+			existingPemakaian.Deskripsi = *req.Deskripsi
+		}
+		if req.NominalSyahriah != nil {
+			existingPemakaian.NominalSyahriah = *req.NominalSyahriah
+		}
+		if req.NominalDonasi != nil {
+			existingPemakaian.NominalDonasi = *req.NominalDonasi
+		}
+		if req.TipePemakaian != nil {
+			existingPemakaian.TipePemakaian = *req.TipePemakaian
+		}
+		if tanggalPemakaian != nil {
+			existingPemakaian.TanggalPemakaian = tanggalPemakaian
+		}
+		if req.Keterangan != nil {
+			existingPemakaian.Keterangan = req.Keterangan
+		}
+
+		// Hitung ulang total
+		existingPemakaian.NominalTotal = existingPemakaian.NominalSyahriah + existingPemakaian.NominalDonasi
+		if existingPemakaian.NominalTotal <= 0 {
+			return errNominalTotalKosong
+		}
+
+		// Nominal lama masih tercatat di jurnal, jadi saldo hanya perlu menutup selisih kenaikannya
+		periodeList := []string{periodePemakaian(sebelum), periodePemakaian(existingPemakaian)}
+		if err := ctrl.cekPerubahanSaldo(tx, ledger,
+			existingPemakaian.NominalSyahriah-sebelum.NominalSyahriah,
+			existingPemakaian.NominalDonasi-sebelum.NominalDonasi,
+			periodeList...); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&existingPemakaian).Updates(map[string]interface{}{
+			"judul_pemakaian":   existingPemakaian.JudulPemakaian,
+			"deskripsi":         existingPemakaian.Deskripsi,
+			"nominal_syahriah":  existingPemakaian.NominalSyahriah,
+			"nominal_donasi":    existingPemakaian.NominalDonasi,
+			"nominal_total":     existingPemakaian.NominalTotal,
+			"tipe_pemakaian":    existingPemakaian.TipePemakaian,
+			"tanggal_pemakaian": existingPemakaian.TanggalPemakaian,
+			"keterangan":        existingPemakaian.Keterangan,
+		}).Error; err != nil {
+			return err
+		}
+		if err := ledger.CatatPemakaian(existingPemakaian, adminID); err != nil {
+			return err
+		}
+		return updateRekapSetelahPemakaian(tx, periodeList...)
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Data pemakaian saldo tidak ditemukan"})
+			return
+		}
+		if errors.Is(err, errNominalTotalKosong) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Total nominal harus lebih besar dari 0"})
+			return
+		}
+		if errors.Is(err, errSaldoTidakCukup) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Saldo tidak mencukupi"})
 			return
 		}
-	}
-
-	// Simpan perubahan
-	if err := ctrl.db.Save(&existingPemakaian).Error; err != nil {
+		if balasPeriodeDitutup(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengupdate data pemakaian saldo: " + err.Error()})
 		return
 	}
@@ -395,13 +424,7 @@ func (ctrl *PemakaianSaldoController) UpdatePemakaian(c *gin.Context) {
 	// Preload relations untuk response
 	ctrl.db.Preload("Pengaju").First(&existingPemakaian, "id_pemakaian = ?", existingPemakaian.IDPemakaian)
 
-	// Update rekap saldo jika nominal berubah
-	if (req.NominalSyahriah != nil && *req.NominalSyahriah != nominalSyahriahLama) || 
-	   (req.NominalDonasi != nil && *req.NominalDonasi != nominalDonasiLama) {
-		if err := ctrl.updateRekapSaldoSetelahUpdate(existingPemakaian, nominalSyahriahLama, nominalDonasiLama); err != nil {
-			fmt.Printf("Gagal update rekap saldo: %v\n", err)
-		}
-	}
+	catatLog(ctrl.db, c, services.AksiUpdate, services.TargetPemakaianSaldo, existingPemakaian.IDPemakaian, sebelum, existingPemakaian)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Data pemakaian saldo berhasil diupdate",
@@ -412,7 +435,7 @@ func (ctrl *PemakaianSaldoController) UpdatePemakaian(c *gin.Context) {
 // DeletePemakaian menghapus data pemakaian saldo
 func (ctrl *PemakaianSaldoController) DeletePemakaian(c *gin.Context) {
 	// Hanya admin yang bisa delete
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinPemakaianWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat menghapus data pemakaian saldo"})
 		return
 	}
@@ -423,28 +446,44 @@ func (ctrl *PemakaianSaldoController) DeletePemakaian(c *gin.Context) {
 		return
 	}
 
-	// Cek apakah pemakaian exists
+	// Baca ulang pemakaian setelah kas terkunci, lalu hapus, balik jurnalnya dan update rekap
+	// dalam transaksi yang sama
+	adminID, _ := ctrl.getUserID(c)
 	var pemakaian models.PemakaianSaldo
-	err := ctrl.db.Where("id_pemakaian = ?", id).First(&pemakaian).Error
+	err := ctrl.db.Transaction(func(tx *gorm.DB) error {
+		ledger := services.NewLedgerService(tx)
+		if err := ledger.KunciAkun(models.AkunKasSyahriah, models.AkunKasDonasi); err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&pemakaian, "id_pemakaian = ?", id).Error; err != nil {
+			return err
+		}
+
+		periode := periodePemakaian(pemakaian)
+		if err := ctrl.cekPerubahanSaldo(tx, ledger, 0, 0, periode); err != nil {
+			return err
+		}
+		if err := tx.Where("id_pemakaian = ?", id).Delete(&models.PemakaianSaldo{}).Error; err != nil {
+			return err
+		}
+		if _, err := ledger.BatalkanSumber(services.TargetPemakaianSaldo, pemakaian.IDPemakaian, adminID); err != nil {
+			return err
+		}
+		return updateRekapSetelahPemakaian(tx, periode)
+	})
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Data pemakaian saldo tidak ditemukan"})
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data pemakaian saldo: " + err.Error()})
-		return
-	}
-
-	// Hapus pemakaian
-	if err := ctrl.db.Where("id_pemakaian = ?", id).Delete(&models.PemakaianSaldo{}).Error; err != nil {
+		if balasPeriodeDitutup(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghapus data pemakaian saldo: " + err.Error()})
 		return
 	}
 
-	// Update rekap saldo (tambahkan kembali saldo yang dihapus)
-	if err := ctrl.updateRekapSaldoSetelahHapus(pemakaian); err != nil {
-		fmt.Printf("Gagal update rekap saldo: %v\n", err)
-	}
+	catatLog(ctrl.db, c, services.AksiDelete, services.TargetPemakaianSaldo, pemakaian.IDPemakaian, pemakaian, nil)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Data pemakaian saldo berhasil dihapus",
@@ -517,100 +556,91 @@ func (ctrl *PemakaianSaldoController) GetPemakaianSummary(c *gin.Context) {
 
 // ========== HELPER FUNCTIONS ==========
 
-// cekSaldoTersedia - Cek apakah saldo mencukupi untuk pemakaian
-func (ctrl *PemakaianSaldoController) cekSaldoTersedia(nominalSyahriah, nominalDonasi float64) bool {
-    // Get latest rekap saldo
-    var rekap models.RekapSaldo
-    err := ctrl.db.Order("periode DESC").First(&rekap).Error
-    
+// errSaldoTidakCukup dikembalikan dari dalam transaksi jika saldo kas tidak mencukupi
+var errSaldoTidakCukup = errors.New("saldo tidak mencukupi")
+
+var errNominalTotalKosong = errors.New("total nominal harus lebih besar dari 0")
+
+// cekSaldoTersedia - Cek apakah saldo kas di jurnal mencukupi untuk tambahan pengeluaran.
+// Panggil setelah ledger.KunciAkun agar saldo yang dibaca tidak berubah sampai transaksi selesai.
+func (ctrl *PemakaianSaldoController) cekSaldoTersedia(ledger *services.LedgerService, nominalSyahriah, nominalDonasi float64) (bool, error) {
+    saldoSyahriah, err := ledger.SaldoAkun(models.AkunKasSyahriah)
     if err != nil {
-        fmt.Printf("Gagal mendapatkan saldo: %v\n", err)
-        return false
+        return false, err
+    }
+    saldoDonasi, err := ledger.SaldoAkun(models.AkunKasDonasi)
+    if err != nil {
+        return false, err
     }
     
     // Cek masing-masing saldo
-    if nominalSyahriah > 0 && nominalSyahriah > rekap.SaldoAkhirSyahriah {
-        return false
+    if nominalSyahriah > 0 && nominalSyahriah > saldoSyahriah {
+        return false, nil
     }
     
-    if nominalDonasi > 0 && nominalDonasi > rekap.SaldoAkhirDonasi {
-        return false
+    if nominalDonasi > 0 && nominalDonasi > saldoDonasi {
+        return false, nil
     }
     
-    return true
+    return true, nil
 }
 
-// updateRekapSaldoSetelahPemakaian - Update rekap saldo setelah pemakaian (SANGAT SEDERHANA SEKARANG)
-func (ctrl *PemakaianSaldoController) updateRekapSaldoSetelahPemakaian(pemakaian models.PemakaianSaldo) error {
-    rekapController := NewRekapController(ctrl.db)
-    
-    // Get periode from tanggal pemakaian
-    var periode string
-    if pemakaian.TanggalPemakaian != nil {
-        periode = pemakaian.TanggalPemakaian.Format("2006-01")
-    } else {
-        periode = time.Now().Format("2006-01")
-    }
-    
-    // Langsung gunakan nominal yang sudah ditentukan
-    return rekapController.updateRekapSaldoDenganPengeluaran(
-        periode, 
-        pemakaian.NominalSyahriah, 
-        pemakaian.NominalDonasi, 
-        pemakaian.NominalTotal,
-    )
+// prosesDenganKunciSaldo - Jalankan perubahan pemakaian secara atomik: kunci akun kas, cek saldo
+// untuk tambahan pengeluaran, simpan perubahan lewat fn, lalu hitung ulang rekap periode terkait.
+func (ctrl *PemakaianSaldoController) prosesDenganKunciSaldo(tambahSyahriah, tambahDonasi float64, periodeList []string, fn func(tx *gorm.DB, ledger *services.LedgerService) error) error {
+    return ctrl.db.Transaction(func(tx *gorm.DB) error {
+        ledger := services.NewLedgerService(tx)
+        if err := ledger.KunciAkun(models.AkunKasSyahriah, models.AkunKasDonasi); err != nil {
+            return err
+        }
+        if err := ctrl.cekPerubahanSaldo(tx, ledger, tambahSyahriah, tambahDonasi, periodeList...); err != nil {
+            return err
+        }
+        if err := fn(tx, ledger); err != nil {
+            return err
+        }
+        return updateRekapSetelahPemakaian(tx, periodeList...)
+    })
 }
 
-// updateRekapSaldoSetelahUpdate - Update rekap saldo setelah update pemakaian (SANGAT SEDERHANA SEKARANG)
-func (ctrl *PemakaianSaldoController) updateRekapSaldoSetelahUpdate(pemakaian models.PemakaianSaldo, nominalSyahriahLama, nominalDonasiLama float64) error {
-    rekapController := NewRekapController(ctrl.db)
-    
-    // Get periode from tanggal pemakaian
-    var periode string
-    if pemakaian.TanggalPemakaian != nil {
-        periode = pemakaian.TanggalPemakaian.Format("2006-01")
-    } else {
-        periode = time.Now().Format("2006-01")
+// cekPerubahanSaldo - Tolak perubahan pemakaian di periode tutup buku atau yang tambahan pengeluarannya
+// tidak tertutup saldo kas. Panggil di dalam transaksi setelah ledger.KunciAkun.
+func (ctrl *PemakaianSaldoController) cekPerubahanSaldo(tx *gorm.DB, ledger *services.LedgerService, tambahSyahriah, tambahDonasi float64, periodeList ...string) error {
+    // Pemakaian yang bertanggal di periode tutup buku tidak boleh dibuat, diubah, atau dihapus
+    if err := services.CekPeriodeTerbuka(tx, periodeList...); err != nil {
+        return err
     }
-    
-    // 1. Kembalikan saldo lama
-    if err := rekapController.updateRekapSaldoDenganPemasukan(
-        periode,
-        nominalSyahriahLama,
-        nominalDonasiLama,
-        nominalSyahriahLama + nominalDonasiLama,
-    ); err != nil {
+
+    cukup, err := ctrl.cekSaldoTersedia(ledger, tambahSyahriah, tambahDonasi)
+    if err != nil {
         return err
     }
-    
-    // 2. Kurangi saldo baru
-    return rekapController.updateRekapSaldoDenganPengeluaran(
-        periode,
-        pemakaian.NominalSyahriah,
-        pemakaian.NominalDonasi,
-        pemakaian.NominalTotal,
-    )
+    if !cukup {
+        return errSaldoTidakCukup
+    }
+    return nil
 }
 
-// updateRekapSaldoSetelahHapus - Update rekap saldo setelah hapus pemakaian (SANGAT SEDERHANA SEKARANG)
-func (ctrl *PemakaianSaldoController) updateRekapSaldoSetelahHapus(pemakaian models.PemakaianSaldo) error {
-    rekapController := NewRekapController(ctrl.db)
-    
-    // Get periode from tanggal pemakaian
-    var periode string
+// periodePemakaian - Periode rekap (YYYY-MM) dari tanggal pemakaian
+func periodePemakaian(pemakaian models.PemakaianSaldo) string {
     if pemakaian.TanggalPemakaian != nil {
-        periode = pemakaian.TanggalPemakaian.Format("2006-01")
-    } else {
-        periode = time.Now().Format("2006-01")
+        return pemakaian.TanggalPemakaian.Format("2006-01")
     }
-    
-    // Kembalikan saldo yang dihapus
-    return rekapController.updateRekapSaldoDenganPemasukan(
-        periode,
-        pemakaian.NominalSyahriah,
-        pemakaian.NominalDonasi,
-        pemakaian.NominalTotal,
-    )
+    return time.Now().Format("2006-01")
+}
+
+// updateRekapSetelahPemakaian - Hitung ulang rekap dari jurnal mulai periode paling awal yang terpengaruh
+func updateRekapSetelahPemakaian(db *gorm.DB, periodeList ...string) error {
+    if len(periodeList) == 0 {
+        return nil
+    }
+    awal := periodeList[0]
+    for _, periode := range periodeList[1:] {
+        if periode < awal {
+            awal = periode
+        }
+    }
+    return NewRekapController(db).UpdateRekapBerantai(awal)
 }
 
 func (ctrl *PemakaianSaldoController) GetAllPemakaianPublic(c *gin.Context) {
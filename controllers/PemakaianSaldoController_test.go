@@ -0,0 +1,230 @@
+package controllers
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
+	"tpq_asysyafii/ujidb"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Banyak pemakaian paralel dari kas yang sama tidak boleh lolos cek saldo bersamaan:
+// yang berhasil tepat sebanyak yang tertutup saldo dan saldo akhir tidak pernah negatif.
+func TestCreatePemakaianParalelTidakMembuatSaldoNegatif(t *testing.T) {
+	db := ujidb.Buka(t)
+	ujidb.ButuhKunciBaris(t)
+	admin := ujidb.BuatUser(t, db, models.RoleAdmin)
+	ledger := services.NewLedgerService(db)
+
+	const nominal = 10000.0
+	const jumlahRequest = 10
+
+	isiKasDonasiUji(t, db, admin, 3*nominal)
+	saldoAwal := saldoKasDonasiUji(t, ledger)
+	harapanSukses := int(math.Floor(saldoAwal / nominal))
+	if harapanSukses >= jumlahRequest {
+		t.Fatalf("saldo kas donasi di database test terlalu besar (%.2f), gunakan database kosong", saldoAwal)
+	}
+
+	ctrl := NewPemakaianSaldoController(db)
+	status := make([]int, jumlahRequest)
+	balasan := make([]string, jumlahRequest)
+	var wg sync.WaitGroup
+	for i := 0; i < jumlahRequest; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c, w := konteksUji(http.MethodPost, "/api/pemakaian-saldo", CreatePemakaianRequest{
+				JudulPemakaian: "Pemakaian paralel",
+				Deskripsi:      "Test kunci saldo",
+				NominalDonasi:  nominal,
+				TipePemakaian:  models.PemakaianOperasional,
+			}, &admin)
+			ctrl.CreatePemakaian(c)
+			status[i], balasan[i] = w.Code, w.Body.String()
+		}(i)
+	}
+	wg.Wait()
+
+	sukses := 0
+	for i, kode := range status {
+		switch kode {
+		case http.StatusCreated:
+			sukses++
+		case http.StatusBadRequest:
+		default:
+			t.Errorf("request %d: status %d, harapan 201 atau 400: %s", i, kode, balasan[i])
+		}
+	}
+	if sukses != harapanSukses {
+		t.Errorf("pemakaian berhasil %d, harapan %d dari saldo %.2f", sukses, harapanSukses, saldoAwal)
+	}
+
+	if saldoAkhir := saldoKasDonasiUji(t, ledger); saldoAkhir < 0 {
+		t.Errorf("saldo kas donasi negatif: %.2f", saldoAkhir)
+	}
+}
+
+// Update paralel pada pemakaian yang sama harus dihitung berurutan dari nominal terbaru:
+// setelah semuanya selesai, jurnal kas donasi sama persis dengan nominal yang tersimpan.
+func TestUpdatePemakaianParalelMengikutiNominalTerbaru(t *testing.T) {
+	db := ujidb.Buka(t)
+	ujidb.ButuhKunciBaris(t)
+	admin := ujidb.BuatUser(t, db, models.RoleAdmin)
+	ledger := services.NewLedgerService(db)
+
+	const nominal = 10000.0
+	const jumlahRequest = 8
+
+	isiKasDonasiUji(t, db, admin, (jumlahRequest+1)*nominal)
+	ctrl := NewPemakaianSaldoController(db)
+	saldoAwal := saldoKasDonasiUji(t, ledger)
+	pemakaian := buatPemakaianUji(t, ctrl, &admin, nominal)
+
+	status := make([]int, jumlahRequest)
+	balasan := make([]string, jumlahRequest)
+	var wg sync.WaitGroup
+	for i := 0; i < jumlahRequest; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			nominalBaru := float64(i+1) * nominal
+			c, w := konteksUji(http.MethodPut, "/api/pemakaian-saldo/"+pemakaian.IDPemakaian, UpdatePemakaianRequest{
+				NominalDonasi: &nominalBaru,
+			}, &admin)
+			c.Params = gin.Params{{Key: "id", Value: pemakaian.IDPemakaian}}
+			ctrl.UpdatePemakaian(c)
+			status[i], balasan[i] = w.Code, w.Body.String()
+		}(i)
+	}
+	wg.Wait()
+
+	for i, kode := range status {
+		if kode != http.StatusOK {
+			t.Errorf("request %d: status %d, harapan 200: %s", i, kode, balasan[i])
+		}
+	}
+
+	var tersimpan models.PemakaianSaldo
+	if err := db.First(&tersimpan, "id_pemakaian = ?", pemakaian.IDPemakaian).Error; err != nil {
+		t.Fatalf("gagal membaca pemakaian: %v", err)
+	}
+	if saldoAkhir := saldoKasDonasiUji(t, ledger); math.Abs(saldoAwal-tersimpan.NominalDonasi-saldoAkhir) > 0.001 {
+		t.Errorf("saldo kas donasi %.2f, harapan %.2f dikurangi nominal tersimpan %.2f", saldoAkhir, saldoAwal, tersimpan.NominalDonasi)
+	}
+}
+
+// Update yang berjalan bersamaan dengan delete tidak boleh memunculkan kembali pemakaian yang sudah dihapus,
+// dan saldo kas kembali utuh setelah semua pemakaian terhapus.
+func TestUpdateDanDeletePemakaianParalelTidakMenghidupkanDataTerhapus(t *testing.T) {
+	db := ujidb.Buka(t)
+	ujidb.ButuhKunciBaris(t)
+	admin := ujidb.BuatUser(t, db, models.RoleAdmin)
+	ledger := services.NewLedgerService(db)
+
+	const nominal = 10000.0
+	const jumlahPemakaian = 5
+
+	isiKasDonasiUji(t, db, admin, 2*jumlahPemakaian*nominal)
+	ctrl := NewPemakaianSaldoController(db)
+	saldoAwal := saldoKasDonasiUji(t, ledger)
+
+	for i := 0; i < jumlahPemakaian; i++ {
+		pemakaian := buatPemakaianUji(t, ctrl, &admin, nominal)
+		nominalBaru := 2 * nominal
+
+		var wg sync.WaitGroup
+		var kodeUpdate, kodeDelete int
+		var balasanUpdate, balasanDelete string
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			c, w := konteksUji(http.MethodPut, "/api/pemakaian-saldo/"+pemakaian.IDPemakaian, UpdatePemakaianRequest{
+				NominalDonasi: &nominalBaru,
+			}, &admin)
+			c.Params = gin.Params{{Key: "id", Value: pemakaian.IDPemakaian}}
+			ctrl.UpdatePemakaian(c)
+			kodeUpdate, balasanUpdate = w.Code, w.Body.String()
+		}()
+		go func() {
+			defer wg.Done()
+			c, w := konteksUji(http.MethodDelete, "/api/pemakaian-saldo/"+pemakaian.IDPemakaian, nil, &admin)
+			c.Params = gin.Params{{Key: "id", Value: pemakaian.IDPemakaian}}
+			ctrl.DeletePemakaian(c)
+			kodeDelete, balasanDelete = w.Code, w.Body.String()
+		}()
+		wg.Wait()
+
+		if kodeUpdate != http.StatusOK && kodeUpdate != http.StatusNotFound {
+			t.Errorf("update %d: status %d, harapan 200 atau 404: %s", i, kodeUpdate, balasanUpdate)
+		}
+		if kodeDelete != http.StatusOK {
+			t.Errorf("delete %d: status %d, harapan 200: %s", i, kodeDelete, balasanDelete)
+		}
+		var jumlah int64
+		db.Model(&models.PemakaianSaldo{}).Where("id_pemakaian = ?", pemakaian.IDPemakaian).Count(&jumlah)
+		if jumlah != 0 {
+			t.Errorf("pemakaian %d muncul kembali setelah dihapus", i)
+		}
+	}
+
+	if saldoAkhir := saldoKasDonasiUji(t, ledger); math.Abs(saldoAkhir-saldoAwal) > 0.001 {
+		t.Errorf("saldo kas donasi %.2f setelah semua pemakaian dihapus, harapan %.2f", saldoAkhir, saldoAwal)
+	}
+}
+
+// isiKasDonasiUji mencatat donasi anonim beserta jurnalnya supaya kas donasi bertambah sebesar nominal
+func isiKasDonasiUji(t *testing.T, db *gorm.DB, admin models.User, nominal float64) {
+	t.Helper()
+	donasi := models.Donasi{
+		IDDonasi:     uuid.New().String(),
+		NamaDonatur:  "Donatur Test",
+		TampilanNama: models.TampilkanAnonim,
+		Nominal:      nominal,
+		DicatatOleh:  admin.IDUser,
+		WaktuCatat:   time.Now(),
+	}
+	ujidb.Buat(t, db, &donasi)
+	if err := services.NewLedgerService(db).CatatDonasi(donasi, admin.IDUser); err != nil {
+		t.Fatalf("gagal mencatat jurnal donasi: %v", err)
+	}
+}
+
+func saldoKasDonasiUji(t *testing.T, ledger *services.LedgerService) float64 {
+	t.Helper()
+	saldo, err := ledger.SaldoAkun(models.AkunKasDonasi)
+	if err != nil {
+		t.Fatalf("gagal membaca saldo: %v", err)
+	}
+	return saldo
+}
+
+// buatPemakaianUji membuat pemakaian dari kas donasi lewat handler
+func buatPemakaianUji(t *testing.T, ctrl *PemakaianSaldoController, admin *models.User, nominal float64) models.PemakaianSaldo {
+	t.Helper()
+	c, w := konteksUji(http.MethodPost, "/api/pemakaian-saldo", CreatePemakaianRequest{
+		JudulPemakaian: "Pemakaian test",
+		Deskripsi:      "Test kunci saldo",
+		NominalDonasi:  nominal,
+		TipePemakaian:  models.PemakaianOperasional,
+	}, admin)
+	ctrl.CreatePemakaian(c)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("gagal membuat pemakaian: status %d: %s", w.Code, w.Body.String())
+	}
+	var balasan struct {
+		Data models.PemakaianSaldo `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &balasan); err != nil {
+		t.Fatalf("balasan pemakaian tidak valid: %v", err)
+	}
+	return balasan.Data
+}
@@ -0,0 +1,250 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type PembayaranController struct {
+	db *gorm.DB
+}
+
+func NewPembayaranController(db *gorm.DB) *PembayaranController {
+	return &PembayaranController{db: db}
+}
+
+// Request structs
+type CreatePembayaranRequest struct {
+	IDSyahriah []string `json:"id_syahriah" binding:"required,min=1"`
+	Metode     string   `json:"metode" binding:"required,oneof=qris va"`
+}
+
+// setelahNotifikasi mencatat log dan memperbarui rekap untuk pembayaran syahriah yang baru dicatat
+func (ctrl *PembayaranController) setelahNotifikasi(hasil *services.HasilNotifikasi) {
+	pembayaran := hasil.Pembayaran
+	for _, bayar := range hasil.Bayar {
+		catatLogKeterangan(ctrl.db, pembayaran.IDWali, services.AksiBayarOnline, services.TargetSyahriah, bayar.IDSyahriah,
+			fmt.Sprintf("Syahriah dibayar online Rp%.0f lewat %s (referensi %s)", bayar.Nominal, pembayaran.Provider, pembayaran.Referensi))
+	}
+	if pembayaran.Status == models.PembayaranDobel {
+		fmt.Printf("Pembayaran %s dobel: %s\n", pembayaran.IDPembayaran, pembayaran.Catatan)
+	}
+	updateRekapMulai(ctrl.db, periodeSyahriahBayar(hasil.Terdampak, hasil.Bayar...)...)
+	terbitkanKwitansiBayar(ctrl.db, hasil.Bayar...)
+}
+
+// terimaCallback memverifikasi dan memproses callback dari provider
+func (ctrl *PembayaranController) terimaCallback(c *gin.Context, provider services.PaymentProvider, body []byte, header http.Header) {
+	notif, err := provider.VerifikasiCallback(body, header)
+	if err != nil {
+		if errors.Is(err, services.ErrTandaTanganTidakValid) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hasil, err := services.NewPembayaranService(ctrl.db, provider).ProsesNotifikasi(provider.Nama(), notif)
+	if err != nil {
+		if errors.Is(err, services.ErrPembayaranTidakDitemukan) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memproses callback: " + err.Error()})
+		return
+	}
+	ctrl.setelahNotifikasi(hasil)
+
+	message := "Callback diproses"
+	if hasil.Duplikat {
+		message = "Callback sudah pernah diproses"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"status":  hasil.Pembayaran.Status,
+	})
+}
+
+// CreatePembayaran membuat intent pembayaran online untuk syahriah santri milik wali
+func (ctrl *PembayaranController) CreatePembayaran(c *gin.Context) {
+	var req CreatePembayaranRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	service := services.NewPembayaranService(ctrl.db, services.DefaultPaymentProvider())
+	pembayaran, err := service.BuatPembayaran(c.GetString("user_id"), req.IDSyahriah, models.MetodePembayaran(req.Metode))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrSyahriahTidakDapatDibayar):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrSyahriahSudahLunas), errors.Is(err, services.ErrSyahriahSedangDibayar):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat pembayaran: " + err.Error()})
+		}
+		return
+	}
+
+	catatLog(ctrl.db, c, services.AksiCreate, services.TargetPembayaran, pembayaran.IDPembayaran, nil, pembayaran)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Pembayaran berhasil dibuat, silakan bayar sebelum " + pembayaran.KadaluarsaPada.Format("02-01-2006 15:04"),
+		"data":    pembayaran,
+	})
+}
+
+// listPembayaran menampilkan daftar pembayaran dengan filter status dan pagination
+func (ctrl *PembayaranController) listPembayaran(c *gin.Context, query *gorm.DB) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghitung total data: " + err.Error()})
+		return
+	}
+
+	var daftar []models.Pembayaran
+	offset := (page - 1) * limit
+	if err := query.Preload("Items").Preload("Items.Syahriah").Preload("Items.Syahriah.Santri").
+		Order("dibuat_pada DESC").Offset(offset).Limit(limit).Find(&daftar).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data pembayaran: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": daftar,
+		"meta": gin.H{
+			"page":       page,
+			"limit":      limit,
+			"total":      total,
+			"total_page": (int(total) + limit - 1) / limit,
+		},
+	})
+}
+
+// GetMyPembayaran menampilkan pembayaran milik wali yang login
+func (ctrl *PembayaranController) GetMyPembayaran(c *gin.Context) {
+	ctrl.listPembayaran(c, ctrl.db.Model(&models.Pembayaran{}).Where("id_wali = ?", c.GetString("user_id")))
+}
+
+// GetAllPembayaran menampilkan semua pembayaran (admin)
+func (ctrl *PembayaranController) GetAllPembayaran(c *gin.Context) {
+	ctrl.listPembayaran(c, ctrl.db.Model(&models.Pembayaran{}))
+}
+
+// GetPembayaranByID menampilkan detail pembayaran untuk pemiliknya atau admin
+func (ctrl *PembayaranController) GetPembayaranByID(c *gin.Context) {
+	var pembayaran models.Pembayaran
+	err := ctrl.db.Preload("Items").Preload("Items.Syahriah").Preload("Items.Syahriah.Santri").
+		First(&pembayaran, "id_pembayaran = ?", c.Param("id")).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Data pembayaran tidak ditemukan"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data pembayaran: " + err.Error()})
+		return
+	}
+
+	if !bolehAksesMilik(c, pembayaran.IDWali, services.IzinSyahriahRead) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: Anda tidak memiliki akses ke pembayaran ini"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": pembayaran})
+}
+
+// CallbackPembayaran menerima webhook bertanda tangan dari payment provider
+func (ctrl *PembayaranController) CallbackPembayaran(c *gin.Context) {
+	provider, err := services.PaymentProviderByNama(c.Param("provider"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Gagal membaca body callback: " + err.Error()})
+		return
+	}
+
+	ctrl.terimaCallback(c, provider, body, c.Request.Header)
+}
+
+// SimulasiPembayaran menandai pembayaran dibayar lewat provider lokal (hanya untuk provider yang mendukung simulasi)
+func (ctrl *PembayaranController) SimulasiPembayaran(c *gin.Context) {
+	var pembayaran models.Pembayaran
+	if err := ctrl.db.First(&pembayaran, "id_pembayaran = ?", c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Data pembayaran tidak ditemukan"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data pembayaran: " + err.Error()})
+		return
+	}
+
+	provider, err := services.PaymentProviderByNama(pembayaran.Provider)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	simulator, ok := provider.(services.SimulatorPembayaran)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provider " + provider.Nama() + " tidak mendukung simulasi pembayaran"})
+		return
+	}
+
+	body, header, err := simulator.SimulasikanBayar(pembayaran.Referensi, pembayaran.Nominal)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal simulasi pembayaran: " + err.Error()})
+		return
+	}
+
+	ctrl.terimaCallback(c, provider, body, header)
+}
+
+// RekonsiliasiPembayaran menutup intent yang kadaluarsa dan melaporkan pembayaran dobel
+func (ctrl *PembayaranController) RekonsiliasiPembayaran(c *gin.Context) {
+	hasil, err := services.NewPembayaranService(ctrl.db, services.DefaultPaymentProvider()).Rekonsiliasi()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal rekonsiliasi pembayaran: " + err.Error()})
+		return
+	}
+	adminID := c.GetString("user_id")
+	for _, syahriah := range hasil.Terdampak {
+		catatLogKeterangan(ctrl.db, adminID, services.AksiBayarOnline, services.TargetSyahriah, syahriah.IDSyahriah,
+			fmt.Sprintf("Status syahriah bulan %s menjadi %s lewat rekonsiliasi pembayaran online", syahriah.Bulan, syahriah.Status))
+	}
+	updateRekapMulai(ctrl.db, periodeSyahriahBayar(hasil.Terdampak, hasil.Bayar...)...)
+	terbitkanKwitansiBayar(ctrl.db, hasil.Bayar...)
+
+	catatLogKeterangan(ctrl.db, adminID, services.AksiRekonsiliasiPembayaran, services.TargetPembayaran, "",
+		fmt.Sprintf("Rekonsiliasi %s: %d diperiksa, %d kadaluarsa, %d ternyata dibayar, %d dobel",
+			time.Now().Format("2006-01-02 15:04"), hasil.Diperiksa, len(hasil.Kadaluarsa), len(hasil.Dibayar), len(hasil.Dobel)))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Rekonsiliasi pembayaran selesai",
+		"data":    hasil,
+	})
+}
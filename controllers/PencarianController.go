@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type PencarianController struct {
+	db *gorm.DB
+}
+
+func NewPencarianController(db *gorm.DB) *PencarianController {
+	return &PencarianController{db: db}
+}
+
+// perbaruiIndeksPencarian mengindeks ulang konten setelah dibuat, diubah, atau dihapus.
+// Kegagalan hanya di-log; job indeks_pencarian membangun ulang indeks setiap malam.
+func perbaruiIndeksPencarian(db *gorm.DB, tipe models.TipeKontenPencarian, id string) {
+	if err := services.PerbaruiIndeksPencarian(db, tipe, id); err != nil {
+		fmt.Printf("Gagal memperbarui indeks pencarian %s %s: %v\n", tipe, id, err)
+	}
+}
+
+// Cari mencari berita, pengumuman, program unggulan, dan fasilitas yang tampil di situs publik.
+// Query: q (wajib), tipe (opsional, dipisah koma), page, limit.
+func (ctrl *PencarianController) Cari(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Parameter q wajib diisi"})
+		return
+	}
+	if len(q) > 200 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Kata kunci maksimal 200 karakter"})
+		return
+	}
+
+	var tipe []models.TipeKontenPencarian
+	if t := c.Query("tipe"); t != "" {
+		for _, s := range strings.Split(t, ",") {
+			tp := models.TipeKontenPencarian(strings.TrimSpace(s))
+			if !services.TipePencarianValid(tp) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Tipe tidak valid. Gunakan 'berita', 'pengumuman', 'program_unggulan', atau 'fasilitas'"})
+				return
+			}
+			tipe = append(tipe, tp)
+		}
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 50 {
+		limit = 10
+	}
+
+	hasil, err := services.CariKonten(ctrl.db, q, tipe, page, limit)
+	if err != nil {
+		if errors.Is(err, services.ErrKataKunciKosong) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Kata kunci terlalu umum, gunakan kata yang lebih spesifik"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal melakukan pencarian: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": hasil.Item,
+		"meta": gin.H{
+			"page":       page,
+			"limit":      limit,
+			"total":      hasil.Total,
+			"total_page": (hasil.Total + limit - 1) / limit,
+			"per_tipe":   hasil.PerTipe,
+		},
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"strconv"
 	"time"
 	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -23,6 +24,7 @@ func NewPengumumanController(db *gorm.DB) *PengumumanController {
 type CreatePengumumanRequest struct {
 	Judul         string     `json:"judul" binding:"required"`
 	Isi           string     `json:"isi" binding:"required"`
+	Format        string     `json:"format"` // "markdown" (default) atau "html"
 	Tipe          string     `json:"tipe"`
 	TanggalMulai  *time.Time `json:"tanggal_mulai"`
 	TanggalSelesai *time.Time `json:"tanggal_selesai"`
@@ -32,6 +34,7 @@ type CreatePengumumanRequest struct {
 type UpdatePengumumanRequest struct {
 	Judul         string     `json:"judul"`
 	Isi           string     `json:"isi"`
+	Format        string     `json:"format"` // "markdown" atau "html"; isi dirender ulang jika berubah
 	Tipe          string     `json:"tipe"`
 	TanggalMulai  *time.Time `json:"tanggal_mulai"`
 	TanggalSelesai *time.Time `json:"tanggal_selesai"`
@@ -49,14 +52,15 @@ type PengumumanFilter struct {
 	TanggalSelesai string `form:"tanggal_selesai"`
 }
 
-// Helper function untuk check role admin
-func (ctrl *PengumumanController) isAdmin(c *gin.Context) bool {
-	userRole, exists := c.Get("role")
-	if !exists {
-		return false
-	}
-	role := userRole.(string)
-	return role == "admin" || role == "super_admin"
+// PengumumanSunting adalah pengumuman beserta sumber isinya untuk admin. Model Pengumuman
+// tidak menyertakan Isi di JSON, jadi pembaca biasa hanya menerima IsiHTML yang sudah disaring.
+type PengumumanSunting struct {
+	models.Pengumuman
+	Isi string `json:"isi"`
+}
+
+func pengumumanSunting(pengumuman models.Pengumuman) PengumumanSunting {
+	return PengumumanSunting{Pengumuman: pengumuman, Isi: pengumuman.Isi}
 }
 
 // Helper function untuk get user ID dari context
@@ -71,7 +75,7 @@ func (ctrl *PengumumanController) getUserID(c *gin.Context) (string, bool) {
 // CreatePengumuman membuat pengumuman baru (hanya admin)
 func (ctrl *PengumumanController) CreatePengumuman(c *gin.Context) {
 	// Hanya admin yang bisa create
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinPengumumanWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat membuat pengumuman"})
 		return
 	}
@@ -89,6 +93,16 @@ func (ctrl *PengumumanController) CreatePengumuman(c *gin.Context) {
 		return
 	}
 
+	// Render isi menjadi HTML yang aman
+	format, ok := formatKonten(c, req.Format, models.FormatMarkdown)
+	if !ok {
+		return
+	}
+	render, ok := renderKonten(c, req.Isi, format)
+	if !ok {
+		return
+	}
+
 	// Validasi tipe
 	var tipe models.TipePengumuman
 	if req.Tipe != "" {
@@ -126,6 +140,10 @@ func (ctrl *PengumumanController) CreatePengumuman(c *gin.Context) {
 		IDPengumuman:  uuid.New().String(),
 		Judul:         req.Judul,
 		Isi:           req.Isi,
+		FormatIsi:     format,
+		IsiHTML:       render.HTML,
+		Ringkasan:     render.Ringkasan,
+		WaktuBaca:     render.WaktuBaca,
 		Tipe:          tipe,
 		DibuatOleh:    adminID,
 		TanggalDibuat: time.Now(),
@@ -143,9 +161,12 @@ func (ctrl *PengumumanController) CreatePengumuman(c *gin.Context) {
 	// Preload author untuk response
 	ctrl.db.Preload("Author").First(&pengumuman, "id_pengumuman = ?", pengumuman.IDPengumuman)
 
+	perbaruiIndeksPencarian(ctrl.db, models.PencarianPengumuman, pengumuman.IDPengumuman)
+	catatLog(ctrl.db, c, services.AksiCreate, services.TargetPengumuman, pengumuman.IDPengumuman, nil, pengumumanSunting(pengumuman))
+
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Pengumuman berhasil dibuat",
-		"data":    pengumuman,
+		"data":    pengumumanSunting(pengumuman),
 	})
 }
 
@@ -173,7 +194,7 @@ func (ctrl *PengumumanController) GetAllPengumuman(c *gin.Context) {
 	query := ctrl.db.Preload("Author")
 
 	// Jika user bukan admin, hanya tampilkan pengumuman publik dan aktif
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinPengumumanWrite) {
 		query = query.Where("tipe = ? AND status = ?", models.PengumumanPublik, models.StatusAktif)
 		
 		// Filter by tanggal aktif untuk non-admin
@@ -263,24 +284,29 @@ func (ctrl *PengumumanController) GetPengumumanByID(c *gin.Context) {
 		return
 	}
 
-	// Authorization check untuk non-admin
-	if !ctrl.isAdmin(c) {
-		// Cek jika pengumuman internal atau nonaktif
-		if pengumuman.Tipe == models.PengumumanInternal || pengumuman.Status == models.StatusNonaktif {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: Anda tidak memiliki akses ke pengumuman ini"})
-			return
-		}
+	// Admin mendapat sumber isi untuk form edit
+	if punyaIzin(c, services.IzinPengumumanWrite) {
+		c.JSON(http.StatusOK, gin.H{
+			"data": pengumumanSunting(pengumuman),
+		})
+		return
+	}
 
-		// Cek tanggal aktif
-		now := time.Now()
-		if pengumuman.TanggalMulai != nil && pengumuman.TanggalMulai.After(now) {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: Pengumuman belum aktif"})
-			return
-		}
-		if pengumuman.TanggalSelesai != nil && pengumuman.TanggalSelesai.Before(now) {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: Pengumuman sudah tidak aktif"})
-			return
-		}
+	// Non-admin: cek jika pengumuman internal atau nonaktif
+	if pengumuman.Tipe == models.PengumumanInternal || pengumuman.Status == models.StatusNonaktif {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: Anda tidak memiliki akses ke pengumuman ini"})
+		return
+	}
+
+	// Cek tanggal aktif
+	now := time.Now()
+	if pengumuman.TanggalMulai != nil && pengumuman.TanggalMulai.After(now) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: Pengumuman belum aktif"})
+		return
+	}
+	if pengumuman.TanggalSelesai != nil && pengumuman.TanggalSelesai.Before(now) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: Pengumuman sudah tidak aktif"})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -349,7 +375,7 @@ func (ctrl *PengumumanController) GetPengumumanAktif(c *gin.Context) {
 // UpdatePengumuman mengupdate pengumuman (hanya admin)
 func (ctrl *PengumumanController) UpdatePengumuman(c *gin.Context) {
 	// Hanya admin yang bisa update
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinPengumumanWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat mengupdate pengumuman"})
 		return
 	}
@@ -378,12 +404,26 @@ func (ctrl *PengumumanController) UpdatePengumuman(c *gin.Context) {
 		return
 	}
 
+	sebelum := existingPengumuman
+
 	// Update fields
 	if req.Judul != "" {
 		existingPengumuman.Judul = req.Judul
 	}
-	if req.Isi != "" {
-		existingPengumuman.Isi = req.Isi
+	if req.Isi != "" || req.Format != "" {
+		format, ok := formatKonten(c, req.Format, existingPengumuman.FormatIsi)
+		if !ok {
+			return
+		}
+		if req.Isi != "" {
+			existingPengumuman.Isi = req.Isi
+		}
+		render, ok := renderKonten(c, existingPengumuman.Isi, format)
+		if !ok {
+			return
+		}
+		existingPengumuman.FormatIsi = format
+		existingPengumuman.IsiHTML, existingPengumuman.Ringkasan, existingPengumuman.WaktuBaca = render.HTML, render.Ringkasan, render.WaktuBaca
 	}
 	if req.Tipe != "" {
 		tipe := models.TipePengumuman(req.Tipe)
@@ -425,16 +465,19 @@ func (ctrl *PengumumanController) UpdatePengumuman(c *gin.Context) {
 	// Preload author untuk response
 	ctrl.db.Preload("Author").First(&existingPengumuman, "id_pengumuman = ?", existingPengumuman.IDPengumuman)
 
+	perbaruiIndeksPencarian(ctrl.db, models.PencarianPengumuman, existingPengumuman.IDPengumuman)
+	catatLog(ctrl.db, c, services.AksiUpdate, services.TargetPengumuman, existingPengumuman.IDPengumuman, pengumumanSunting(sebelum), pengumumanSunting(existingPengumuman))
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Pengumuman berhasil diupdate",
-		"data":    existingPengumuman,
+		"data":    pengumumanSunting(existingPengumuman),
 	})
 }
 
 // DeletePengumuman menghapus pengumuman (hanya admin)
 func (ctrl *PengumumanController) DeletePengumuman(c *gin.Context) {
 	// Hanya admin yang bisa delete
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinPengumumanWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat menghapus pengumuman"})
 		return
 	}
@@ -463,6 +506,9 @@ func (ctrl *PengumumanController) DeletePengumuman(c *gin.Context) {
 		return
 	}
 
+	perbaruiIndeksPencarian(ctrl.db, models.PencarianPengumuman, pengumuman.IDPengumuman)
+	catatLog(ctrl.db, c, services.AksiDelete, services.TargetPengumuman, pengumuman.IDPengumuman, pengumumanSunting(pengumuman), nil)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Pengumuman berhasil dihapus",
 	})
@@ -471,7 +517,7 @@ func (ctrl *PengumumanController) DeletePengumuman(c *gin.Context) {
 // GetPengumumanSummary mendapatkan summary pengumuman (hanya admin)
 func (ctrl *PengumumanController) GetPengumumanSummary(c *gin.Context) {
 	// Hanya admin yang bisa akses summary
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinPengumumanWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat mengakses summary"})
 		return
 	}
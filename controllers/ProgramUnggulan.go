@@ -5,6 +5,7 @@ import (
 	"strconv"
 	"strings"
 	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -19,16 +20,6 @@ func NewProgramUnggulanController(db *gorm.DB) *ProgramUnggulanController {
 	return &ProgramUnggulanController{db: db}
 }
 
-// Helper function untuk check role admin
-func (ctrl *ProgramUnggulanController) isAdmin(c *gin.Context) bool {
-	userRole, exists := c.Get("role")
-	if !exists {
-		return false
-	}
-	role := userRole.(string)
-	return role == "admin" || role == "super_admin"
-}
-
 // Helper function untuk get user ID dari context
 func (ctrl *ProgramUnggulanController) getUserID(c *gin.Context) (string, bool) {
 	userID, exists := c.Get("user_id")
@@ -57,7 +48,7 @@ func generateProgramSlug(namaProgram string) string {
 // CreateProgramUnggulan membuat program unggulan baru
 func (ctrl *ProgramUnggulanController) CreateProgramUnggulan(c *gin.Context) {
 	// Hanya admin yang bisa create program unggulan
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinKontenWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat membuat program unggulan"})
 		return
 	}
@@ -124,6 +115,9 @@ func (ctrl *ProgramUnggulanController) CreateProgramUnggulan(c *gin.Context) {
 	// Preload relations untuk response
 	ctrl.db.Preload("DiupdateOleh").First(&program, "id_program = ?", program.IDProgram)
 
+	perbaruiIndeksPencarian(ctrl.db, models.PencarianProgram, program.IDProgram)
+	catatLog(ctrl.db, c, services.AksiCreate, services.TargetProgramUnggulan, program.IDProgram, nil, program)
+
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Program unggulan berhasil dibuat",
 		"data":    program,
@@ -150,7 +144,7 @@ func (ctrl *ProgramUnggulanController) GetProgramUnggulanByID(c *gin.Context) {
 	}
 
 	// Untuk public access, hanya tampilkan yang aktif
-	if !ctrl.isAdmin(c) && program.Status != "aktif" {
+	if !punyaIzin(c, services.IzinKontenWrite) && program.Status != "aktif" {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Program unggulan tidak ditemukan"})
 		return
 	}
@@ -180,7 +174,7 @@ func (ctrl *ProgramUnggulanController) GetProgramUnggulanBySlug(c *gin.Context)
 	}
 
 	// Untuk user non-admin, hanya bisa lihat yang aktif
-	if !ctrl.isAdmin(c) && program.Status != "aktif" {
+	if !punyaIzin(c, services.IzinKontenWrite) && program.Status != "aktif" {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: Anda tidak memiliki akses ke program unggulan ini"})
 		return
 	}
@@ -193,7 +187,7 @@ func (ctrl *ProgramUnggulanController) GetProgramUnggulanBySlug(c *gin.Context)
 // UpdateProgramUnggulan mengupdate program unggulan
 func (ctrl *ProgramUnggulanController) UpdateProgramUnggulan(c *gin.Context) {
 	// Hanya admin yang bisa update
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinKontenWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat mengupdate program unggulan"})
 		return
 	}
@@ -229,6 +223,8 @@ func (ctrl *ProgramUnggulanController) UpdateProgramUnggulan(c *gin.Context) {
 	fitur := c.PostForm("fitur")
 	status := c.PostForm("status")
 
+	sebelum := existingProgram
+
 	// Update fields
 	if namaProgram != "" {
 		existingProgram.NamaProgram = namaProgram
@@ -266,6 +262,9 @@ func (ctrl *ProgramUnggulanController) UpdateProgramUnggulan(c *gin.Context) {
 	// Preload relations untuk response
 	ctrl.db.Preload("DiupdateOleh").First(&existingProgram, "id_program = ?", existingProgram.IDProgram)
 
+	perbaruiIndeksPencarian(ctrl.db, models.PencarianProgram, existingProgram.IDProgram)
+	catatLog(ctrl.db, c, services.AksiUpdate, services.TargetProgramUnggulan, existingProgram.IDProgram, sebelum, existingProgram)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Program unggulan berhasil diupdate",
 		"data":    existingProgram,
@@ -275,7 +274,7 @@ func (ctrl *ProgramUnggulanController) UpdateProgramUnggulan(c *gin.Context) {
 // DeleteProgramUnggulan menghapus program unggulan
 func (ctrl *ProgramUnggulanController) DeleteProgramUnggulan(c *gin.Context) {
 	// Hanya admin yang bisa delete
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinKontenWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat menghapus program unggulan"})
 		return
 	}
@@ -304,6 +303,9 @@ func (ctrl *ProgramUnggulanController) DeleteProgramUnggulan(c *gin.Context) {
 		return
 	}
 
+	perbaruiIndeksPencarian(ctrl.db, models.PencarianProgram, program.IDProgram)
+	catatLog(ctrl.db, c, services.AksiDelete, services.TargetProgramUnggulan, program.IDProgram, program, nil)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Program unggulan berhasil dihapus",
 	})
@@ -312,7 +314,7 @@ func (ctrl *ProgramUnggulanController) DeleteProgramUnggulan(c *gin.Context) {
 // AktifkanProgramUnggulan mengubah status program menjadi aktif
 func (ctrl *ProgramUnggulanController) AktifkanProgramUnggulan(c *gin.Context) {
 	// Hanya admin yang bisa mengaktifkan
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinKontenWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat mengaktifkan program unggulan"})
 		return
 	}
@@ -342,6 +344,8 @@ func (ctrl *ProgramUnggulanController) AktifkanProgramUnggulan(c *gin.Context) {
 		return
 	}
 
+	sebelum := program
+
 	// Update status menjadi aktif
 	program.Status = "aktif"
 	program.DiupdateOlehID = &adminID
@@ -355,6 +359,8 @@ func (ctrl *ProgramUnggulanController) AktifkanProgramUnggulan(c *gin.Context) {
 	// Preload relations untuk response
 	ctrl.db.Preload("DiupdateOleh").First(&program, "id_program = ?", program.IDProgram)
 
+	catatLog(ctrl.db, c, services.AksiUpdate, services.TargetProgramUnggulan, program.IDProgram, sebelum, program)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Program unggulan berhasil diaktifkan",
 		"data":    program,
@@ -364,7 +370,7 @@ func (ctrl *ProgramUnggulanController) AktifkanProgramUnggulan(c *gin.Context) {
 // NonaktifkanProgramUnggulan mengubah status program menjadi nonaktif
 func (ctrl *ProgramUnggulanController) NonaktifkanProgramUnggulan(c *gin.Context) {
 	// Hanya admin yang bisa menonaktifkan
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinKontenWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat menonaktifkan program unggulan"})
 		return
 	}
@@ -394,6 +400,8 @@ func (ctrl *ProgramUnggulanController) NonaktifkanProgramUnggulan(c *gin.Context
 		return
 	}
 
+	sebelum := program
+
 	// Update status menjadi nonaktif
 	program.Status = "nonaktif"
 	program.DiupdateOlehID = &adminID
@@ -407,6 +415,8 @@ func (ctrl *ProgramUnggulanController) NonaktifkanProgramUnggulan(c *gin.Context
 	// Preload relations untuk response
 	ctrl.db.Preload("DiupdateOleh").First(&program, "id_program = ?", program.IDProgram)
 
+	catatLog(ctrl.db, c, services.AksiUpdate, services.TargetProgramUnggulan, program.IDProgram, sebelum, program)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Program unggulan berhasil dinonaktifkan",
 		"data":    program,
@@ -416,7 +426,7 @@ func (ctrl *ProgramUnggulanController) NonaktifkanProgramUnggulan(c *gin.Context
 // GetAllProgramUnggulan mendapatkan semua program unggulan dengan filter (untuk admin)
 func (ctrl *ProgramUnggulanController) GetAllProgramUnggulan(c *gin.Context) {
 	// Hanya admin yang bisa akses semua data
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinKontenWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat mengakses semua program unggulan"})
 		return
 	}
@@ -0,0 +1,251 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RegistrasiController struct {
+	db *gorm.DB
+}
+
+func NewRegistrasiController(db *gorm.DB) *RegistrasiController {
+	return &RegistrasiController{db: db}
+}
+
+// Request structs
+type ApproveRegistrasiRequest struct {
+	IDSantri []string `json:"id_santri"` // Opsional, santri yang langsung dihubungkan ke wali ini
+}
+
+type RejectRegistrasiRequest struct {
+	Alasan string `json:"alasan"`
+}
+
+var (
+	errRegistrasiSudahDiproses = errors.New("registrasi ini sudah diproses")
+	errPeranTerlaluTinggi      = errors.New("tidak boleh menyetujui user dengan role setara atau di atas role sendiri")
+)
+
+// GetPendingUsers mendapatkan antrean registrasi yang menunggu persetujuan
+func (ctrl *RegistrasiController) GetPendingUsers(c *gin.Context) {
+	// Parse query parameters
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	search := c.Query("search")
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	var users []models.User
+	var total int64
+
+	query := ctrl.db.Model(&models.User{}).Where("status_registrasi = ?", models.RegistrasiMenunggu)
+	if search != "" {
+		like := "%" + search + "%"
+		query = query.Where("nama_lengkap LIKE ? OR email LIKE ? OR no_telp LIKE ?", like, like, like)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghitung total data: " + err.Error()})
+		return
+	}
+
+	offset := (page - 1) * limit
+	if err := query.Order("dibuat_pada ASC").Offset(offset).Limit(limit).Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data registrasi: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": users,
+		"meta": gin.H{
+			"page":       page,
+			"limit":      limit,
+			"total":      total,
+			"total_page": (int(total) + limit - 1) / limit,
+		},
+	})
+}
+
+// ApproveUser menyetujui registrasi, mengaktifkan akun, dan (opsional) menghubungkan santri ke wali baru
+func (ctrl *RegistrasiController) ApproveUser(c *gin.Context) {
+	id := c.Param("id")
+	adminID := c.GetString("user_id")
+
+	var req ApproveRegistrasiRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var sebelum, user models.User
+	var santriSebelum, santriSesudah []models.Santri
+
+	err := ctrl.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, "id_user = ?", id).Error; err != nil {
+			return err
+		}
+		if user.StatusRegistrasi != models.RegistrasiMenunggu {
+			return errRegistrasiSudahDiproses
+		}
+		sebelum = user
+
+		// Pendaftar tidak boleh diaktifkan dengan role setara atau di atas role yang menyetujui
+		if !services.BolehBeriPeran(c.GetString("role"), string(user.Role)) {
+			return errPeranTerlaluTinggi
+		}
+
+		if len(req.IDSantri) > 0 {
+			if user.Role != models.RoleWali {
+				return fmt.Errorf("santri hanya bisa dihubungkan ke akun wali")
+			}
+			if err := tx.Where("id_santri IN ?", req.IDSantri).Find(&santriSebelum).Error; err != nil {
+				return err
+			}
+			if len(santriSebelum) != len(req.IDSantri) {
+				return fmt.Errorf("sebagian santri tidak ditemukan")
+			}
+			if err := tx.Model(&models.Santri{}).
+				Where("id_santri IN ?", req.IDSantri).
+				Update("id_wali", user.IDUser).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("id_santri IN ?", req.IDSantri).Find(&santriSesudah).Error; err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		user.StatusAktif = true
+		user.StatusRegistrasi = models.RegistrasiDisetujui
+		user.AlasanPenolakan = nil
+		user.DiverifikasiOleh = &adminID
+		user.DiverifikasiPada = &now
+		user.DiperbaruiPada = now
+		return tx.Save(&user).Error
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User tidak ditemukan"})
+		case errors.Is(err, errRegistrasiSudahDiproses):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, errPeranTerlaluTinggi):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Gagal menyetujui registrasi: " + err.Error()})
+		}
+		return
+	}
+
+	catatLog(ctrl.db, c, services.AksiSetujuiRegistrasi, services.TargetUser, user.IDUser, sebelum, user)
+	santriLama := make(map[string]models.Santri, len(santriSebelum))
+	for _, s := range santriSebelum {
+		santriLama[s.IDSantri] = s
+	}
+	for _, s := range santriSesudah {
+		catatLog(ctrl.db, c, services.AksiUpdate, services.TargetSantri, s.IDSantri, santriLama[s.IDSantri], s)
+	}
+
+	isi := fmt.Sprintf("Assalamu'alaikum %s,\n\nPendaftaran akun Anda di TPQ Asy-Syafii telah disetujui. Silakan login menggunakan akun yang sudah didaftarkan.", user.NamaLengkap)
+	terkirim := ctrl.kirimNotifikasi(user, "Pendaftaran akun disetujui", isi)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":             "Registrasi berhasil disetujui",
+		"data":                user,
+		"santri":              santriSesudah,
+		"notifikasi_terkirim": terkirim,
+	})
+}
+
+// RejectUser menolak registrasi dengan alasan opsional dan memberi tahu pendaftar
+func (ctrl *RegistrasiController) RejectUser(c *gin.Context) {
+	id := c.Param("id")
+	adminID := c.GetString("user_id")
+
+	var req RejectRegistrasiRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var sebelum, user models.User
+	err := ctrl.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, "id_user = ?", id).Error; err != nil {
+			return err
+		}
+		if user.StatusRegistrasi != models.RegistrasiMenunggu {
+			return errRegistrasiSudahDiproses
+		}
+		sebelum = user
+
+		now := time.Now()
+		user.StatusAktif = false
+		user.StatusRegistrasi = models.RegistrasiDitolak
+		user.AlasanPenolakan = nil
+		if req.Alasan != "" {
+			user.AlasanPenolakan = &req.Alasan
+		}
+		user.DiverifikasiOleh = &adminID
+		user.DiverifikasiPada = &now
+		user.DiperbaruiPada = now
+		return tx.Save(&user).Error
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User tidak ditemukan"})
+		case errors.Is(err, errRegistrasiSudahDiproses):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menolak registrasi: " + err.Error()})
+		}
+		return
+	}
+
+	catatLog(ctrl.db, c, services.AksiTolakRegistrasi, services.TargetUser, user.IDUser, sebelum, user)
+
+	isi := fmt.Sprintf("Assalamu'alaikum %s,\n\nMohon maaf, pendaftaran akun Anda di TPQ Asy-Syafii belum dapat disetujui.", user.NamaLengkap)
+	if req.Alasan != "" {
+		isi += "\nAlasan: " + req.Alasan
+	}
+	isi += "\nSilakan hubungi pengurus TPQ untuk informasi lebih lanjut."
+	terkirim := ctrl.kirimNotifikasi(user, "Pendaftaran akun ditolak", isi)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":             "Registrasi berhasil ditolak",
+		"data":                user,
+		"notifikasi_terkirim": terkirim,
+	})
+}
+
+// kirimNotifikasi memberi tahu pendaftar; kegagalan kirim tidak membatalkan keputusan admin
+func (ctrl *RegistrasiController) kirimNotifikasi(user models.User, subjek, isi string) bool {
+	pesan, err := services.PesanUntukUser(user, subjek, isi)
+	if err == nil {
+		err = services.DefaultNotifier().Kirim(pesan)
+	}
+	if err != nil {
+		fmt.Printf("Gagal mengirim notifikasi registrasi ke %s: %v\n", user.IDUser, err)
+		return false
+	}
+	return true
+}
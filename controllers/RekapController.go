@@ -1,12 +1,14 @@
 package controllers
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 	"time"
 	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -59,211 +61,49 @@ type RekapSummary struct {
 	SaldoAkhir               float64 `json:"saldo_akhir"`
 }
 
-// Helper function untuk check role admin
-func (ctrl *RekapController) isAdmin(c *gin.Context) bool {
-	userRole, exists := c.Get("role")
-	if !exists {
-		return false
-	}
-	role := userRole.(string)
-	return role == "admin" || role == "super_admin"
-}
-
-// getSaldoAwalBulan - Mendapatkan saldo awal bulan dari saldo akhir bulan sebelumnya
-func (ctrl *RekapController) getSaldoAwalBulan(periode string) (float64, float64, float64, error) {
-	// Parse periode current
-	currentPeriod, err := time.Parse("2006-01", periode)
-	if err != nil {
-		return 0, 0, 0, err
-	}
-
-	// Hitung periode sebelumnya
-	previousPeriod := currentPeriod.AddDate(0, -1, 0).Format("2006-01")
-
-	// Cari rekap bulan sebelumnya
-	var previousRekap models.RekapSaldo
-	err = ctrl.db.Where("periode = ?", previousPeriod).First(&previousRekap).Error
-	
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			// Jika tidak ada data bulan sebelumnya, mulai dari 0
-			fmt.Printf("DEBUG: Tidak ditemukan rekap untuk periode sebelumnya %s, menggunakan saldo awal 0\n", previousPeriod)
-			return 0, 0, 0, nil
-		}
-		return 0, 0, 0, err
-	}
-
-	fmt.Printf("DEBUG: Saldo awal periode %s - Syahriah: %.2f, Donasi: %.2f, Total: %.2f\n", 
-		periode, previousRekap.SaldoAkhirSyahriah, previousRekap.SaldoAkhirDonasi, previousRekap.SaldoAkhirTotal)
-	
-	return previousRekap.SaldoAkhirSyahriah, previousRekap.SaldoAkhirDonasi, previousRekap.SaldoAkhirTotal, nil
+// ledger - LedgerService yang menjadi sumber kebenaran untuk semua angka rekap
+func (ctrl *RekapController) ledger() *services.LedgerService {
+	return services.NewLedgerService(ctrl.db)
 }
 
-// updateRekapSaldo - Internal function untuk update rekap otomatis dengan saldo berjalan
+// updateRekapSaldo - Materialisasi rekap satu periode dari jurnal (saldo awal otomatis terbawa dari jurnal periode sebelumnya)
 func (ctrl *RekapController) updateRekapSaldo(periode string) error {
-	// Dapatkan saldo awal dari bulan sebelumnya
-	saldoAwalSyahriah, saldoAwalDonasi, saldoAwalTotal, err := ctrl.getSaldoAwalBulan(periode)
-	if err != nil {
-		return err
-	}
-
-	// Hitung pemasukan syahriah bulan ini
-	var pemasukanSyahriah float64
-	err = ctrl.db.Model(&models.Syahriah{}).
-		Where("bulan = ? AND status = ?", periode, models.StatusLunas).
-		Select("COALESCE(SUM(nominal), 0)").
-		Scan(&pemasukanSyahriah).Error
-	if err != nil {
-		return err
-	}
-
-	// Hitung pengeluaran syahriah bulan ini (jika ada log pengeluaran)
-	var pengeluaranSyahriah float64
-	// TODO: Tambahkan logika untuk menghitung pengeluaran syahriah jika diperlukan
-	// Untuk sekarang di-set 0, bisa disesuaikan dengan kebutuhan
-
-	// Hitung pemasukan donasi bulan ini
-	var pemasukanDonasi float64
-	startDate, _ := time.Parse("2006-01", periode)
-	endDate := startDate.AddDate(0, 1, 0)
-	
-	err = ctrl.db.Model(&models.Donasi{}).
-		Where("waktu_catat >= ? AND waktu_catat < ?", startDate, endDate).
-		Select("COALESCE(SUM(nominal), 0)").
-		Scan(&pemasukanDonasi).Error
-	if err != nil {
-		return err
-	}
-
-	// Hitung pengeluaran donasi bulan ini (jika ada log pengeluaran)
-	var pengeluaranDonasi float64
-	// TODO: Tambahkan logika untuk menghitung pengeluaran donasi jika diperlukan
+	_, err := ctrl.ledger().MaterialisasiRekap(periode)
+	return err
+}
 
-	// Hitung saldo akhir dengan rumus: Saldo Awal + Pemasukan - Pengeluaran
-	saldoAkhirSyahriah := saldoAwalSyahriah + pemasukanSyahriah - pengeluaranSyahriah
-	saldoAkhirDonasi := saldoAwalDonasi + pemasukanDonasi - pengeluaranDonasi
-	
-	// Total
-	pemasukanTotal := pemasukanSyahriah + pemasukanDonasi
-	pengeluaranTotal := pengeluaranSyahriah + pengeluaranDonasi
-	saldoAkhirTotal := saldoAwalTotal + pemasukanTotal - pengeluaranTotal
-
-	// Debug log untuk troubleshooting
-	fmt.Printf("DEBUG: Rekap periode %s\n", periode)
-	fmt.Printf("DEBUG: Saldo Awal - Syahriah: %.2f, Donasi: %.2f, Total: %.2f\n", 
-		saldoAwalSyahriah, saldoAwalDonasi, saldoAwalTotal)
-	fmt.Printf("DEBUG: Pemasukan - Syahriah: %.2f, Donasi: %.2f, Total: %.2f\n", 
-		pemasukanSyahriah, pemasukanDonasi, pemasukanTotal)
-	fmt.Printf("DEBUG: Pengeluaran - Syahriah: %.2f, Donasi: %.2f, Total: %.2f\n", 
-		pengeluaranSyahriah, pengeluaranDonasi, pengeluaranTotal)
-	fmt.Printf("DEBUG: Saldo Akhir - Syahriah: %.2f, Donasi: %.2f, Total: %.2f\n", 
-		saldoAkhirSyahriah, saldoAkhirDonasi, saldoAkhirTotal)
-
-	// Cek apakah sudah ada rekap untuk periode ini
-	var existingRekap models.RekapSaldo
-	if err := ctrl.db.Where("periode = ?", periode).First(&existingRekap).Error; err == nil {
-		// Update existing rekap
-		existingRekap.PemasukanSyahriah = pemasukanSyahriah
-		existingRekap.PengeluaranSyahriah = pengeluaranSyahriah
-		existingRekap.SaldoAkhirSyahriah = saldoAkhirSyahriah
-		existingRekap.PemasukanDonasi = pemasukanDonasi
-		existingRekap.PengeluaranDonasi = pengeluaranDonasi
-		existingRekap.SaldoAkhirDonasi = saldoAkhirDonasi
-		existingRekap.PemasukanTotal = pemasukanTotal
-		existingRekap.PengeluaranTotal = pengeluaranTotal
-		existingRekap.SaldoAkhirTotal = saldoAkhirTotal
-		existingRekap.TerakhirUpdate = time.Now()
-
-		return ctrl.db.Save(&existingRekap).Error
-	} else {
-		// Buat rekap baru
-		rekap := models.RekapSaldo{
-			IDSaldo:            uuid.New().String(),
-			Periode:            periode,
-			PemasukanSyahriah:  pemasukanSyahriah,
-			PengeluaranSyahriah: pengeluaranSyahriah,
-			SaldoAkhirSyahriah: saldoAkhirSyahriah,
-			PemasukanDonasi:    pemasukanDonasi,
-			PengeluaranDonasi:  pengeluaranDonasi,
-			SaldoAkhirDonasi:   saldoAkhirDonasi,
-			PemasukanTotal:     pemasukanTotal,
-			PengeluaranTotal:   pengeluaranTotal,
-			SaldoAkhirTotal:    saldoAkhirTotal,
-			TerakhirUpdate:     time.Now(),
-		}
-		return ctrl.db.Create(&rekap).Error
-	}
+// UpdateRekapOtomatis - Dipanggil setelah ada transaksi donasi/syahriah/pemakaian
+func (ctrl *RekapController) UpdateRekapOtomatis(transaksiTime time.Time) error {
+	periode := transaksiTime.Format("2006-01")
+	return ctrl.UpdateRekapBerantai(periode)
 }
 
-// updateRekapPemasukan - Update hanya bagian pemasukan saja dengan saldo berjalan
-func (ctrl *RekapController) updateRekapPemasukan(periode string) error {
-	// Dapatkan saldo awal dari bulan sebelumnya
-	saldoAwalSyahriah, saldoAwalDonasi, saldoAwalTotal, err := ctrl.getSaldoAwalBulan(periode)
-	if err != nil {
-		return err
+// updateRekapMulai - Update rekap berantai mulai dari periode paling awal di daftar (error hanya dicatat)
+func updateRekapMulai(db *gorm.DB, periode ...string) {
+	awal := ""
+	for _, p := range periode {
+		if p != "" && (awal == "" || p < awal) {
+			awal = p
+		}
 	}
-
-	// Hitung pemasukan syahriah
-	var pemasukanSyahriah float64
-	err = ctrl.db.Model(&models.Syahriah{}).
-		Where("bulan = ? AND status = ?", periode, models.StatusLunas).
-		Select("COALESCE(SUM(nominal), 0)").
-		Scan(&pemasukanSyahriah).Error
-	if err != nil {
-		return err
+	if awal == "" {
+		return
 	}
-
-	// Hitung pemasukan donasi
-	var pemasukanDonasi float64
-	startDate, _ := time.Parse("2006-01", periode)
-	endDate := startDate.AddDate(0, 1, 0)
-	
-	err = ctrl.db.Model(&models.Donasi{}).
-		Where("waktu_catat >= ? AND waktu_catat < ?", startDate, endDate).
-		Select("COALESCE(SUM(nominal), 0)").
-		Scan(&pemasukanDonasi).Error
-	if err != nil {
-		return err
+	if err := NewRekapController(db).UpdateRekapBerantai(awal); err != nil {
+		fmt.Printf("Gagal update rekap: %v\n", err)
 	}
+}
 
-	// Hitung total
-	pemasukanTotal := pemasukanSyahriah + pemasukanDonasi
-
-	// Update HANYA pemasukan dan saldo akhir dengan memperhitungkan saldo awal
-	var existingRekap models.RekapSaldo
-	if err := ctrl.db.Where("periode = ?", periode).First(&existingRekap).Error; err == nil {
-		existingRekap.PemasukanSyahriah = pemasukanSyahriah
-		existingRekap.SaldoAkhirSyahriah = saldoAwalSyahriah + pemasukanSyahriah - existingRekap.PengeluaranSyahriah
-		existingRekap.PemasukanDonasi = pemasukanDonasi
-		existingRekap.SaldoAkhirDonasi = saldoAwalDonasi + pemasukanDonasi - existingRekap.PengeluaranDonasi
-		existingRekap.PemasukanTotal = pemasukanTotal
-		existingRekap.SaldoAkhirTotal = saldoAwalTotal + pemasukanTotal - existingRekap.PengeluaranTotal
-		existingRekap.TerakhirUpdate = time.Now()
-		return ctrl.db.Save(&existingRekap).Error
+// periodeSyahriahBayar - Periode yang terdampak pembayaran syahriah: bulan syahriah dan bulan uang diterima
+func periodeSyahriahBayar(terdampak []models.Syahriah, bayar ...models.SyahriahBayar) []string {
+	var periode []string
+	for _, syahriah := range terdampak {
+		periode = append(periode, syahriah.Bulan)
 	}
-	
-	// Jika tidak ada rekap, buat baru dengan pengeluaran 0
-	rekap := models.RekapSaldo{
-		IDSaldo:            uuid.New().String(),
-		Periode:            periode,
-		PemasukanSyahriah:  pemasukanSyahriah,
-		PengeluaranSyahriah: 0,
-		SaldoAkhirSyahriah: saldoAwalSyahriah + pemasukanSyahriah,
-		PemasukanDonasi:    pemasukanDonasi,
-		PengeluaranDonasi:  0,
-		SaldoAkhirDonasi:   saldoAwalDonasi + pemasukanDonasi,
-		PemasukanTotal:     pemasukanTotal,
-		PengeluaranTotal:   0,
-		SaldoAkhirTotal:    saldoAwalTotal + pemasukanTotal,
-		TerakhirUpdate:     time.Now(),
+	for _, b := range bayar {
+		periode = append(periode, b.WaktuBayar.Format("2006-01"))
 	}
-	return ctrl.db.Create(&rekap).Error
-}
-
-// UpdateRekapOtomatis - Dipanggil setelah ada transaksi donasi/syahriah
-func (ctrl *RekapController) UpdateRekapOtomatis(transaksiTime time.Time) error {
-	periode := transaksiTime.Format("2006-01")
-	return ctrl.updateRekapPemasukan(periode)
+	return periode
 }
 
 // UpdateRekapBerantai - Update rekap untuk periode tertentu dan semua periode setelahnya
@@ -274,15 +114,21 @@ func (ctrl *RekapController) UpdateRekapBerantai(startPeriode string) error {
 		return err
 	}
 
-	// Dapatkan semua periode dari start periode hingga sekarang
-	currentTime := time.Now()
-	currentPeriod := currentTime.Format("2006-01")
-	
+	// Periode terakhir adalah bulan ini atau periode jurnal terakhir jika lebih baru
+	lastPeriod := time.Now().Format("2006-01")
+	periodeJurnal, err := ctrl.ledger().PeriodeJurnal()
+	if err != nil {
+		return err
+	}
+	if len(periodeJurnal) > 0 && periodeJurnal[len(periodeJurnal)-1] > lastPeriod {
+		lastPeriod = periodeJurnal[len(periodeJurnal)-1]
+	}
+
 	periods := []string{startPeriode}
-	
-	// Generate periode berikutnya sampai current period
+
+	// Generate periode berikutnya sampai periode terakhir
 	next := start.AddDate(0, 1, 0)
-	for next.Format("2006-01") <= currentPeriod {
+	for next.Format("2006-01") <= lastPeriod {
 		periods = append(periods, next.Format("2006-01"))
 		next = next.AddDate(0, 1, 0)
 	}
@@ -297,10 +143,11 @@ func (ctrl *RekapController) UpdateRekapBerantai(startPeriode string) error {
 	return nil
 }
 
-// CreateRekap membuat data rekap saldo baru (MANUAL - Admin Only)
+// CreateRekap membuat data rekap saldo baru (MANUAL - Admin Only).
+// Rekap diturunkan dari jurnal, sehingga saldo akhir yang diminta dicatat sebagai jurnal penyesuaian.
 func (ctrl *RekapController) CreateRekap(c *gin.Context) {
 	// Hanya admin yang bisa create manual
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinRekapWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat membuat data rekap"})
 		return
 	}
@@ -318,6 +165,10 @@ func (ctrl *RekapController) CreateRekap(c *gin.Context) {
 		return
 	}
 
+	if tolakPeriodeDitutup(c, ctrl.db, req.Periode) {
+		return
+	}
+
 	// Cek apakah sudah ada rekap untuk periode yang sama
 	var existingRekap models.RekapSaldo
 	if err := ctrl.db.Where("periode = ?", req.Periode).First(&existingRekap).Error; err == nil {
@@ -325,57 +176,40 @@ func (ctrl *RekapController) CreateRekap(c *gin.Context) {
 		return
 	}
 
-	// Set default values jika tidak diisi
-	if req.PemasukanSyahriah < 0 {
-		req.PemasukanSyahriah = 0
-	}
-	if req.PengeluaranSyahriah < 0 {
-		req.PengeluaranSyahriah = 0
-	}
-	if req.SaldoAkhirSyahriah < 0 {
-		req.SaldoAkhirSyahriah = 0
-	}
-	if req.PemasukanDonasi < 0 {
-		req.PemasukanDonasi = 0
-	}
-	if req.PengeluaranDonasi < 0 {
-		req.PengeluaranDonasi = 0
-	}
-	if req.SaldoAkhirDonasi < 0 {
-		req.SaldoAkhirDonasi = 0
-	}
-	if req.PemasukanTotal < 0 {
-		req.PemasukanTotal = 0
-	}
-	if req.PengeluaranTotal < 0 {
-		req.PengeluaranTotal = 0
-	}
-	if req.SaldoAkhirTotal < 0 {
-		req.SaldoAkhirTotal = 0
+	if req.SaldoAkhirSyahriah < 0 || req.SaldoAkhirDonasi < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Saldo akhir tidak boleh negatif"})
+		return
 	}
 
-	// Buat data rekap
+	// Buat data rekap, angkanya akan dihitung ulang dari jurnal
 	rekap := models.RekapSaldo{
-		IDSaldo:            uuid.New().String(),
-		Periode:            req.Periode,
-		PemasukanSyahriah:  req.PemasukanSyahriah,
-		PengeluaranSyahriah: req.PengeluaranSyahriah,
-		SaldoAkhirSyahriah: req.SaldoAkhirSyahriah,
-		PemasukanDonasi:    req.PemasukanDonasi,
-		PengeluaranDonasi:  req.PengeluaranDonasi,
-		SaldoAkhirDonasi:   req.SaldoAkhirDonasi,
-		PemasukanTotal:     req.PemasukanTotal,
-		PengeluaranTotal:   req.PengeluaranTotal,
-		SaldoAkhirTotal:    req.SaldoAkhirTotal,
-		TerakhirUpdate:     time.Now(),
+		IDSaldo:        uuid.New().String(),
+		Periode:        req.Periode,
+		TerakhirUpdate: time.Now(),
 	}
 
-	// Simpan ke database
-	if err := ctrl.db.Create(&rekap).Error; err != nil {
+	err = ctrl.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&rekap).Error; err != nil {
+			return err
+		}
+		ledger := services.NewLedgerService(tx)
+		if err := ledger.CatatPenyesuaian(req.Periode, rekap.IDSaldo, req.SaldoAkhirSyahriah, req.SaldoAkhirDonasi, c.GetString("user_id")); err != nil {
+			return err
+		}
+		hasil, err := ledger.MaterialisasiRekap(req.Periode)
+		if err != nil {
+			return err
+		}
+		rekap = *hasil
+		return nil
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat data rekap: " + err.Error()})
 		return
 	}
 
+	catatLog(ctrl.db, c, services.AksiCreate, services.TargetRekapSaldo, rekap.IDSaldo, nil, rekap)
+
 	// Update rekap berantai untuk periode setelahnya
 	go func() {
 		if err := ctrl.UpdateRekapBerantai(req.Periode); err != nil {
@@ -400,10 +234,11 @@ func (ctrl *RekapController) UpdateRekapByBulan(bulan string) error {
 	return ctrl.UpdateRekapOtomatis(bulanTime)
 }
 
-// UpdateRekap mengupdate data rekap saldo (MANUAL - Admin Only)
+// UpdateRekap mengupdate data rekap saldo (MANUAL - Admin Only).
+// Saldo akhir yang diminta dicatat sebagai jurnal penyesuaian yang menggantikan penyesuaian sebelumnya.
 func (ctrl *RekapController) UpdateRekap(c *gin.Context) {
 	// Hanya admin yang bisa update manual
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinRekapWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat mengupdate data rekap"})
 		return
 	}
@@ -432,43 +267,36 @@ func (ctrl *RekapController) UpdateRekap(c *gin.Context) {
 		return
 	}
 
-	// Update fields (hanya jika nilainya >= 0)
-	if req.PemasukanSyahriah >= 0 {
-		existingRekap.PemasukanSyahriah = req.PemasukanSyahriah
-	}
-	if req.PengeluaranSyahriah >= 0 {
-		existingRekap.PengeluaranSyahriah = req.PengeluaranSyahriah
-	}
-	if req.SaldoAkhirSyahriah >= 0 {
-		existingRekap.SaldoAkhirSyahriah = req.SaldoAkhirSyahriah
-	}
-	if req.PemasukanDonasi >= 0 {
-		existingRekap.PemasukanDonasi = req.PemasukanDonasi
-	}
-	if req.PengeluaranDonasi >= 0 {
-		existingRekap.PengeluaranDonasi = req.PengeluaranDonasi
-	}
-	if req.SaldoAkhirDonasi >= 0 {
-		existingRekap.SaldoAkhirDonasi = req.SaldoAkhirDonasi
-	}
-	if req.PemasukanTotal >= 0 {
-		existingRekap.PemasukanTotal = req.PemasukanTotal
-	}
-	if req.PengeluaranTotal >= 0 {
-		existingRekap.PengeluaranTotal = req.PengeluaranTotal
+	if req.SaldoAkhirSyahriah < 0 || req.SaldoAkhirDonasi < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Saldo akhir tidak boleh negatif"})
+		return
 	}
-	if req.SaldoAkhirTotal >= 0 {
-		existingRekap.SaldoAkhirTotal = req.SaldoAkhirTotal
+	if tolakPeriodeDitutup(c, ctrl.db, existingRekap.Periode) {
+		return
 	}
 
-	existingRekap.TerakhirUpdate = time.Now()
+	sebelum := existingRekap
 
-	// Simpan perubahan
-	if err := ctrl.db.Save(&existingRekap).Error; err != nil {
+	// Simpan penyesuaian dan hitung ulang rekap dari jurnal
+	err = ctrl.db.Transaction(func(tx *gorm.DB) error {
+		ledger := services.NewLedgerService(tx)
+		if err := ledger.CatatPenyesuaian(existingRekap.Periode, existingRekap.IDSaldo, req.SaldoAkhirSyahriah, req.SaldoAkhirDonasi, c.GetString("user_id")); err != nil {
+			return err
+		}
+		hasil, err := ledger.MaterialisasiRekap(existingRekap.Periode)
+		if err != nil {
+			return err
+		}
+		existingRekap = *hasil
+		return nil
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengupdate data rekap: " + err.Error()})
 		return
 	}
 
+	catatLog(ctrl.db, c, services.AksiUpdate, services.TargetRekapSaldo, existingRekap.IDSaldo, sebelum, existingRekap)
+
 	// Update rekap berantai untuk periode setelahnya
 	go func() {
 		if err := ctrl.UpdateRekapBerantai(existingRekap.Periode); err != nil {
@@ -482,10 +310,11 @@ func (ctrl *RekapController) UpdateRekap(c *gin.Context) {
 	})
 }
 
-// DeleteRekap menghapus data rekap saldo (MANUAL - Admin Only)
+// DeleteRekap menghapus data rekap saldo (MANUAL - Admin Only).
+// Penyesuaian manual milik rekap ini dibalik, lalu rekap dihitung ulang dari jurnal.
 func (ctrl *RekapController) DeleteRekap(c *gin.Context) {
 	// Hanya admin yang bisa delete manual
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinRekapWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat menghapus data rekap"})
 		return
 	}
@@ -510,13 +339,24 @@ func (ctrl *RekapController) DeleteRekap(c *gin.Context) {
 
 	// Simpan periode sebelum menghapus (untuk update berantai)
 	periode := rekap.Periode
+	if tolakPeriodeDitutup(c, ctrl.db, periode) {
+		return
+	}
 
-	// Hapus rekap
-	if err := ctrl.db.Where("id_saldo = ?", id).Delete(&models.RekapSaldo{}).Error; err != nil {
+	// Balik penyesuaian lalu hapus rekap
+	err = ctrl.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := services.NewLedgerService(tx).BatalkanSumber(services.TargetRekapSaldo, rekap.IDSaldo, c.GetString("user_id")); err != nil {
+			return err
+		}
+		return tx.Where("id_saldo = ?", id).Delete(&models.RekapSaldo{}).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghapus data rekap: " + err.Error()})
 		return
 	}
 
+	catatLog(ctrl.db, c, services.AksiDelete, services.TargetRekapSaldo, rekap.IDSaldo, rekap, nil)
+
 	// Update rekap berantai untuk periode setelahnya
 	go func() {
 		if err := ctrl.UpdateRekapBerantai(periode); err != nil {
@@ -532,7 +372,7 @@ func (ctrl *RekapController) DeleteRekap(c *gin.Context) {
 // GenerateRekapOtomatis menghasilkan rekap saldo secara otomatis berdasarkan data syahriah dan donasi
 func (ctrl *RekapController) GenerateRekapOtomatis(c *gin.Context) {
 	// Hanya admin yang bisa generate otomatis
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinRekapWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat generate rekap otomatis"})
 		return
 	}
@@ -551,6 +391,13 @@ func (ctrl *RekapController) GenerateRekapOtomatis(c *gin.Context) {
 		return
 	}
 
+	// Simpan kondisi sebelum generate untuk audit
+	var sebelum *models.RekapSaldo
+	var rekapLama models.RekapSaldo
+	if err := ctrl.db.Where("periode = ?", periode).First(&rekapLama).Error; err == nil {
+		sebelum = &rekapLama
+	}
+
 	// Generate rekap
 	if err := ctrl.updateRekapSaldo(periode); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal generate rekap: " + err.Error()})
@@ -564,6 +411,12 @@ func (ctrl *RekapController) GenerateRekapOtomatis(c *gin.Context) {
 		return
 	}
 
+	if sebelum == nil {
+		catatLog(ctrl.db, c, services.AksiCreate, services.TargetRekapSaldo, rekap.IDSaldo, nil, rekap)
+	} else {
+		catatLog(ctrl.db, c, services.AksiUpdate, services.TargetRekapSaldo, rekap.IDSaldo, sebelum, rekap)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Rekap berhasil digenerate otomatis",
 		"data":    rekap,
@@ -788,60 +641,36 @@ func (ctrl *RekapController) GetLatestRekap(c *gin.Context) {
 // SyncAllRekap - Sync semua rekap (admin only, untuk maintenance)
 func (ctrl *RekapController) SyncAllRekap(c *gin.Context) {
 	// Hanya admin yang bisa sync
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinRekapWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat sync rekap"})
 		return
 	}
 
-	// Ambil semua periode unik dari syahriah dan donasi
-	var periods []string
-	
-	// Dari syahriah
-	ctrl.db.Model(&models.Syahriah{}).
-		Distinct("bulan").
-		Pluck("bulan", &periods)
-	
-	// Dari donasi (convert waktu_catat ke periode YYYY-MM)
-	var donasiPeriods []string
-	ctrl.db.Model(&models.Donasi{}).
-		Select("DISTINCT DATE_FORMAT(waktu_catat, '%Y-%m') as periode").
-		Pluck("periode", &donasiPeriods)
-	
-	// Gabungkan periods
-	periodMap := make(map[string]bool)
-	for _, p := range periods {
-		periodMap[p] = true
-	}
-	for _, p := range donasiPeriods {
-		periodMap[p] = true
-	}
-	
-	// Update rekap untuk setiap periode (dalam urutan kronologis)
-	var sortedPeriods []string
-	for periode := range periodMap {
-		sortedPeriods = append(sortedPeriods, periode)
+	// Posting ulang semua transaksi yang belum tercatat di jurnal (idempoten)
+	ledger := ctrl.ledger()
+	if err := ledger.SinkronSemuaSumber(c.GetString("user_id")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal sinkron jurnal: " + err.Error()})
+		return
 	}
-	
-	// Sort periods chronologically
-	for i := 0; i < len(sortedPeriods)-1; i++ {
-		for j := i + 1; j < len(sortedPeriods); j++ {
-			if sortedPeriods[i] > sortedPeriods[j] {
-				sortedPeriods[i], sortedPeriods[j] = sortedPeriods[j], sortedPeriods[i]
-			}
-		}
+
+	// Ambil semua periode yang memiliki jurnal (sudah terurut kronologis)
+	sortedPeriods, err := ledger.PeriodeJurnal()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil periode jurnal: " + err.Error()})
+		return
 	}
-	
-	// Update rekap untuk setiap periode secara berurutan
-	for _, periode := range sortedPeriods {
-		if err := ctrl.updateRekapSaldo(periode); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal sync rekap untuk periode " + periode + ": " + err.Error()})
+
+	// Update rekap mulai periode paling awal secara berantai
+	if len(sortedPeriods) > 0 {
+		if err := ctrl.UpdateRekapBerantai(sortedPeriods[0]); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal sync rekap: " + err.Error()})
 			return
 		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Sync rekap berhasil",
-		"total_periode": len(periodMap),
+		"total_periode": len(sortedPeriods),
 		"periods": sortedPeriods,
 	})
 }
@@ -849,7 +678,7 @@ func (ctrl *RekapController) SyncAllRekap(c *gin.Context) {
 // InitializeFirstRekap - Inisialisasi rekap pertama (untuk setup awal)
 func (ctrl *RekapController) InitializeFirstRekap(c *gin.Context) {
 	// Hanya admin yang bisa inisialisasi
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinRekapWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat inisialisasi rekap"})
 		return
 	}
@@ -892,54 +721,6 @@ func (ctrl *RekapController) InitializeFirstRekap(c *gin.Context) {
 	})
 }
 
-// updateRekapSaldoDenganPengeluaran - Update rekap dengan tambahan pengeluaran
-func (ctrl *RekapController) updateRekapSaldoDenganPengeluaran(periode string, pengeluaranSyahriah, pengeluaranDonasi, pengeluaranTotal float64) error {
-    var existingRekap models.RekapSaldo
-    if err := ctrl.db.Where("periode = ?", periode).First(&existingRekap).Error; err != nil {
-        // Jika tidak ada rekap, buat baru dengan data dari transaksi
-        return ctrl.updateRekapSaldo(periode)
-    }
-    
-    // PERBAIKAN: Update HANYA pengeluaran dan saldo akhir, jangan sentuh pemasukan
-    existingRekap.PengeluaranSyahriah += pengeluaranSyahriah
-    existingRekap.SaldoAkhirSyahriah -= pengeluaranSyahriah
-    existingRekap.PengeluaranDonasi += pengeluaranDonasi
-    existingRekap.SaldoAkhirDonasi -= pengeluaranDonasi
-    existingRekap.PengeluaranTotal += pengeluaranTotal
-    existingRekap.SaldoAkhirTotal -= pengeluaranTotal
-    existingRekap.TerakhirUpdate = time.Now()
-    
-    // Debug log
-    fmt.Printf("DEBUG: Update Pengeluaran - Periode: %s, Syahriah: %.0f, Donasi: %.0f, Total: %.0f\n",
-        periode, pengeluaranSyahriah, pengeluaranDonasi, pengeluaranTotal)
-    
-    return ctrl.db.Save(&existingRekap).Error
-}
-
-// updateRekapSaldoDenganPemasukan - Update rekap saldo dengan tambahan pemasukan (untuk koreksi) (PERBAIKAN)
-func (ctrl *RekapController) updateRekapSaldoDenganPemasukan(periode string, pemasukanSyahriah, pemasukanDonasi, pemasukanTotal float64) error {
-    var existingRekap models.RekapSaldo
-    if err := ctrl.db.Where("periode = ?", periode).First(&existingRekap).Error; err != nil {
-        // Jika tidak ada rekap, buat baru dengan data dari transaksi
-        return ctrl.updateRekapSaldo(periode)
-    }
-    
-    // PERBAIKAN: Untuk pemasukan (koreksi), kita KURANGI pengeluaran dan TAMBAH saldo
-    existingRekap.PengeluaranSyahriah -= pemasukanSyahriah
-    existingRekap.SaldoAkhirSyahriah += pemasukanSyahriah
-    existingRekap.PengeluaranDonasi -= pemasukanDonasi
-    existingRekap.SaldoAkhirDonasi += pemasukanDonasi
-    existingRekap.PengeluaranTotal -= pemasukanTotal
-    existingRekap.SaldoAkhirTotal += pemasukanTotal
-    existingRekap.TerakhirUpdate = time.Now()
-    
-    // Debug log
-    fmt.Printf("DEBUG: Update Pemasukan (Koreksi) - Periode: %s, Syahriah: %.0f, Donasi: %.0f, Total: %.0f\n",
-        periode, pemasukanSyahriah, pemasukanDonasi, pemasukanTotal)
-    
-    return ctrl.db.Save(&existingRekap).Error
-}
-
 // GetRekapPublic mendapatkan data rekap saldo untuk public (tanpa auth)
 func (ctrl *RekapController) GetRekapPublic(c *gin.Context) {
 	// Parse query parameters
@@ -1202,4 +983,92 @@ func (ctrl *RekapController) GetRekapPeriodsPublic(c *gin.Context) {
 			"total_periods": len(periods),
 		},
 	})
-}
\ No newline at end of file
+}
+// ExportRekap mengunduh laporan keuangan untuk pengurus dalam format pdf, xlsx, atau csv.
+// Periode YYYY-MM menghasilkan laporan bulanan, YYYY laporan tahunan.
+func (ctrl *RekapController) ExportRekap(c *gin.Context) {
+	// Parameter berbagi wildcard dengan /rekap/:id, isinya periode
+	periode := c.Param("id")
+	format := c.DefaultQuery("format", "pdf")
+	tipeKonten := map[string]string{
+		"pdf":  "application/pdf",
+		"xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		"csv":  "text/csv; charset=utf-8",
+	}
+	if tipeKonten[format] == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format tidak valid. Gunakan 'pdf', 'xlsx', atau 'csv'"})
+		return
+	}
+
+	laporan, err := services.NewLaporanKeuanganService(ctrl.db).Susun(periode)
+	if err != nil {
+		if errors.Is(err, services.ErrPeriodeLaporanTidakValid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menyusun laporan keuangan: " + err.Error()})
+		return
+	}
+
+	info, err := informasiTPQCetak(ctrl.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil informasi TPQ: " + err.Error()})
+		return
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case "pdf":
+		err = services.TulisPDFLaporan(&buf, laporan, info)
+	case "xlsx":
+		err = services.TulisXLSXLaporan(&buf, laporan, info.NamaTPQ)
+	case "csv":
+		err = services.TulisCSVLaporan(&buf, laporan, info.NamaTPQ)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat file laporan: " + err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="laporan-keuangan-%s.%s"`, laporan.Periode, format))
+	c.Data(http.StatusOK, tipeKonten[format], buf.Bytes())
+}
+
+// PeriksaIntegritasRekap menghitung ulang semua periode dari transaksi sumber dan melaporkan selisih
+// dengan rekap_saldo tanpa mengubah data
+func (ctrl *RekapController) PeriksaIntegritasRekap(c *gin.Context) {
+	hasil, err := services.NewIntegritasService(ctrl.db).Periksa()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memeriksa integritas rekap: " + err.Error()})
+		return
+	}
+
+	message := "Rekap saldo sesuai dengan transaksi sumber"
+	if !hasil.Sehat {
+		message = fmt.Sprintf("Ditemukan %d ketidaksesuaian pada rekap saldo", len(hasil.Temuan))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"data":    hasil,
+	})
+}
+
+// PerbaikiIntegritasRekap menyelaraskan jurnal dan menulis ulang rekap saldo dari transaksi sumber
+// dalam satu transaksi, lalu mencatatnya di log aktivitas
+func (ctrl *RekapController) PerbaikiIntegritasRekap(c *gin.Context) {
+	sebelum, sesudah, err := services.NewIntegritasService(ctrl.db).Perbaiki(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memperbaiki rekap: " + err.Error()})
+		return
+	}
+
+	message := "Tidak ada yang perlu diperbaiki"
+	if !sebelum.Sehat {
+		message = fmt.Sprintf("%d ketidaksesuaian berhasil diperbaiki", len(sebelum.Temuan))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"sebelum": sebelum,
+		"sesudah": sesudah,
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"strconv"
 	"time"
 	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -27,7 +28,7 @@ type CreateSantriRequest struct {
 	TempatLahir  string        `json:"tempat_lahir"`
 	TanggalLahir string        `json:"tanggal_lahir"` // Format: YYYY-MM-DD
 	Alamat       string        `json:"alamat"`
-	Foto         string        `json:"foto"`
+	IDFoto       string        `json:"id_foto"` // ID media dari media library
 	Status       models.StatusSantri `json:"status"`
 	TanggalMasuk string        `json:"tanggal_masuk"` // Format: YYYY-MM-DD
 }
@@ -38,7 +39,7 @@ type UpdateSantriRequest struct {
 	TempatLahir  string        `json:"tempat_lahir"`
 	TanggalLahir string        `json:"tanggal_lahir"` // Format: YYYY-MM-DD
 	Alamat       string        `json:"alamat"`
-	Foto         string        `json:"foto"`
+	IDFoto       *string       `json:"id_foto"` // ID media, string kosong menghapus foto
 	Status       models.StatusSantri `json:"status"`
 	TanggalMasuk string        `json:"tanggal_masuk"` // Format: YYYY-MM-DD
 	TanggalKeluar *string      `json:"tanggal_keluar"` // Format: YYYY-MM-DD, bisa null
@@ -117,10 +118,16 @@ func (ctrl *SantriController) CreateSantri(c *gin.Context) {
 		TempatLahir:  req.TempatLahir,
 		TanggalLahir: tanggalLahir,
 		Alamat:       req.Alamat,
-		Foto:         req.Foto,
 		Status:       req.Status,
 		TanggalMasuk: tanggalMasuk,
 	}
+	if req.IDFoto != "" {
+		foto, ok := mediaDariID(c, ctrl.db, req.IDFoto)
+		if !ok {
+			return
+		}
+		santri.IDFoto, santri.Foto, santri.FotoVarian = &foto.IDMedia, foto.URL, foto.Varian()
+	}
 
 	// Jika status tidak aktif, set default ke aktif
 	if santri.Status == "" {
@@ -136,6 +143,8 @@ func (ctrl *SantriController) CreateSantri(c *gin.Context) {
 	// Preload relations untuk response
 	ctrl.db.Preload("Wali").First(&santri, "id_santri = ?", santri.IDSantri)
 
+	catatLog(ctrl.db, c, services.AksiCreate, services.TargetSantri, santri.IDSantri, nil, santri)
+
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Data santri berhasil dibuat",
 		"data":    santri,
@@ -161,6 +170,11 @@ func (ctrl *SantriController) GetSantriByID(c *gin.Context) {
 		return
 	}
 
+	if !bolehAksesMilik(c, santri.IDWali, services.IzinSantriRead) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: Anda tidak memiliki akses ke data santri ini"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"data": santri,
 	})
@@ -333,16 +347,16 @@ func (ctrl *SantriController) UpdateSantri(c *gin.Context) {
 	}
 
 	// Authorization check: hanya wali yang bersangkutan atau admin yang bisa update
-	userRole, _ := c.Get("role")
-	role := userRole.(string)
 	
 	// Untuk perubahan wali, hanya super_admin atau admin yang bisa
 	// Wali biasa tidak bisa mengubah wali santri
-	if role != "admin" && role != "super_admin" && existingSantri.IDWali != userID {
+	if !punyaIzin(c, services.IzinSantriWrite) && existingSantri.IDWali != userID {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: Anda tidak memiliki akses untuk mengupdate data santri ini"})
 		return
 	}
 
+	sebelum := existingSantri
+
 	// Update fields
 	if req.NamaLengkap != "" {
 		existingSantri.NamaLengkap = req.NamaLengkap
@@ -364,8 +378,16 @@ func (ctrl *SantriController) UpdateSantri(c *gin.Context) {
 	if req.Alamat != "" {
 		existingSantri.Alamat = req.Alamat
 	}
-	if req.Foto != "" {
-		existingSantri.Foto = req.Foto
+	if req.IDFoto != nil {
+		if *req.IDFoto == "" {
+			existingSantri.IDFoto, existingSantri.Foto, existingSantri.FotoVarian = nil, "", models.VarianGambar{}
+		} else {
+			foto, ok := mediaDariID(c, ctrl.db, *req.IDFoto)
+			if !ok {
+				return
+			}
+			existingSantri.IDFoto, existingSantri.Foto, existingSantri.FotoVarian = &foto.IDMedia, foto.URL, foto.Varian()
+		}
 	}
 	if req.Status != "" {
 		existingSantri.Status = req.Status
@@ -392,7 +414,7 @@ func (ctrl *SantriController) UpdateSantri(c *gin.Context) {
 	}
 
 	// Update IDWali jika ada dan user adalah admin/super_admin
-	if req.IDWali != nil && (role == "admin" || role == "super_admin") {
+	if req.IDWali != nil && punyaIzin(c, services.IzinSantriWrite) {
 		newWaliID := *req.IDWali
 		
 		// Cek apakah wali baru exists
@@ -409,7 +431,7 @@ func (ctrl *SantriController) UpdateSantri(c *gin.Context) {
 		}
 		
 		existingSantri.IDWali = newWaliID
-	} else if req.IDWali != nil && (role != "admin" && role != "super_admin") {
+	} else if req.IDWali != nil && !punyaIzin(c, services.IzinSantriWrite) {
 		// Jika bukan admin tapi mencoba mengubah wali
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: Hanya admin yang dapat mengubah wali santri"})
 		return
@@ -424,6 +446,8 @@ func (ctrl *SantriController) UpdateSantri(c *gin.Context) {
 	// Preload relations untuk response
 	ctrl.db.Preload("Wali").First(&existingSantri, "id_santri = ?", existingSantri.IDSantri)
 
+	catatLog(ctrl.db, c, services.AksiUpdate, services.TargetSantri, existingSantri.IDSantri, sebelum, existingSantri)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Data santri berhasil diupdate",
 		"data":    existingSantri,
@@ -458,10 +482,7 @@ func (ctrl *SantriController) DeleteSantri(c *gin.Context) {
 	}
 
 	// Authorization check: hanya wali yang bersangkutan atau admin yang bisa delete
-	userRole, _ := c.Get("role")
-	role := userRole.(string)
-	
-	if santri.IDWali != userID && role != "admin" && role != "super_admin" {
+	if santri.IDWali != userID && !punyaIzin(c, services.IzinSantriWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: Anda tidak memiliki akses untuk menghapus data santri ini"})
 		return
 	}
@@ -472,6 +493,8 @@ func (ctrl *SantriController) DeleteSantri(c *gin.Context) {
 		return
 	}
 
+	catatLog(ctrl.db, c, services.AksiDelete, services.TargetSantri, santri.IDSantri, santri, nil)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Data santri berhasil dihapus",
 	})
@@ -539,6 +562,8 @@ func (ctrl *SantriController) UpdateStatusSantri(c *gin.Context) {
 		return
 	}
 
+	sebelum := santri
+
 	// Update status
 	santri.Status = req.Status
 
@@ -564,6 +589,8 @@ func (ctrl *SantriController) UpdateStatusSantri(c *gin.Context) {
 	// Preload relations untuk response
 	ctrl.db.Preload("Wali").First(&santri, "id_santri = ?", santri.IDSantri)
 
+	catatLog(ctrl.db, c, services.AksiUpdate, services.TargetSantri, santri.IDSantri, sebelum, santri)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Status santri berhasil diupdate",
 		"data":    santri,
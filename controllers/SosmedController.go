@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"strconv"
 	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -18,16 +19,6 @@ func NewSosialMediaController(db *gorm.DB) *SosialMediaController {
 	return &SosialMediaController{db: db}
 }
 
-// Helper function untuk check role admin
-func (ctrl *SosialMediaController) isAdmin(c *gin.Context) bool {
-	userRole, exists := c.Get("role")
-	if !exists {
-		return false
-	}
-	role := userRole.(string)
-	return role == "admin" || role == "super_admin"
-}
-
 // Helper function untuk get user ID dari context
 func (ctrl *SosialMediaController) getUserID(c *gin.Context) (string, bool) {
 	userID, exists := c.Get("user_id")
@@ -40,7 +31,7 @@ func (ctrl *SosialMediaController) getUserID(c *gin.Context) (string, bool) {
 // CreateSosialMedia membuat sosial media baru
 func (ctrl *SosialMediaController) CreateSosialMedia(c *gin.Context) {
 	// Hanya admin yang bisa create
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinKontenWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat membuat sosial media"})
 		return
 	}
@@ -56,7 +47,7 @@ func (ctrl *SosialMediaController) CreateSosialMedia(c *gin.Context) {
 	var request struct {
 		NamaSosmed string  `json:"nama_sosmed" binding:"required"`
 		Username string  `json:"username" binding:"required"`
-		IconSosmed *string `json:"icon_sosmed,omitempty"`
+		IDIcon     *string `json:"id_icon,omitempty"` // ID media dari media library
 		LinkSosmed *string `json:"link_sosmed,omitempty"`
 	}
 
@@ -70,10 +61,16 @@ func (ctrl *SosialMediaController) CreateSosialMedia(c *gin.Context) {
 		IDSosmed:       uuid.New().String(),
 		NamaSosmed:     request.NamaSosmed,
 		Username:       request.Username,
-		IconSosmed:     request.IconSosmed,
 		LinkSosmed:     request.LinkSosmed,
 		DiupdateOlehID: &adminID,
 	}
+	if request.IDIcon != nil && *request.IDIcon != "" {
+		icon, ok := mediaDariID(c, ctrl.db, *request.IDIcon)
+		if !ok {
+			return
+		}
+		sosialMedia.IDIcon, sosialMedia.IconSosmed = &icon.IDMedia, &icon.URL
+	}
 
 	// Simpan ke database
 	if err := ctrl.db.Create(&sosialMedia).Error; err != nil {
@@ -84,6 +81,8 @@ func (ctrl *SosialMediaController) CreateSosialMedia(c *gin.Context) {
 	// Preload relations untuk response
 	ctrl.db.Preload("DiupdateOleh").First(&sosialMedia, "id_sosmed = ?", sosialMedia.IDSosmed)
 
+	catatLog(ctrl.db, c, services.AksiCreate, services.TargetSosialMedia, sosialMedia.IDSosmed, nil, sosialMedia)
+
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Sosial media berhasil dibuat",
 		"data":    sosialMedia,
@@ -164,7 +163,7 @@ func (ctrl *SosialMediaController) GetSosialMediaByID(c *gin.Context) {
 // UpdateSosialMedia mengupdate sosial media
 func (ctrl *SosialMediaController) UpdateSosialMedia(c *gin.Context) {
 	// Hanya admin yang bisa update
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinKontenWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat mengupdate sosial media"})
 		return
 	}
@@ -198,7 +197,7 @@ func (ctrl *SosialMediaController) UpdateSosialMedia(c *gin.Context) {
 	var request struct {
 		NamaSosmed string  `json:"nama_sosmed"`
 		Username string  `json:"username"`
-		IconSosmed *string `json:"icon_sosmed,omitempty"`
+		IDIcon     *string `json:"id_icon,omitempty"` // ID media, string kosong menghapus icon
 		LinkSosmed *string `json:"link_sosmed,omitempty"`
 	}
 
@@ -207,6 +206,8 @@ func (ctrl *SosialMediaController) UpdateSosialMedia(c *gin.Context) {
 		return
 	}
 
+	sebelum := existingSosmed
+
 	// Update fields
 	if request.NamaSosmed != "" {
 		existingSosmed.NamaSosmed = request.NamaSosmed
@@ -214,8 +215,16 @@ func (ctrl *SosialMediaController) UpdateSosialMedia(c *gin.Context) {
 	if request.Username != "" {
 		existingSosmed.Username = request.Username
 	}
-	if request.IconSosmed != nil {
-		existingSosmed.IconSosmed = request.IconSosmed
+	if request.IDIcon != nil {
+		if *request.IDIcon == "" {
+			existingSosmed.IDIcon, existingSosmed.IconSosmed = nil, nil
+		} else {
+			icon, ok := mediaDariID(c, ctrl.db, *request.IDIcon)
+			if !ok {
+				return
+			}
+			existingSosmed.IDIcon, existingSosmed.IconSosmed = &icon.IDMedia, &icon.URL
+		}
 	}
 	if request.LinkSosmed != nil {
 		existingSosmed.LinkSosmed = request.LinkSosmed
@@ -233,6 +242,8 @@ func (ctrl *SosialMediaController) UpdateSosialMedia(c *gin.Context) {
 	// Preload relations untuk response
 	ctrl.db.Preload("DiupdateOleh").First(&existingSosmed, "id_sosmed = ?", existingSosmed.IDSosmed)
 
+	catatLog(ctrl.db, c, services.AksiUpdate, services.TargetSosialMedia, existingSosmed.IDSosmed, sebelum, existingSosmed)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Sosial media berhasil diupdate",
 		"data":    existingSosmed,
@@ -242,7 +253,7 @@ func (ctrl *SosialMediaController) UpdateSosialMedia(c *gin.Context) {
 // DeleteSosialMedia menghapus sosial media
 func (ctrl *SosialMediaController) DeleteSosialMedia(c *gin.Context) {
 	// Hanya admin yang bisa delete
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinKontenWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat menghapus sosial media"})
 		return
 	}
@@ -271,6 +282,8 @@ func (ctrl *SosialMediaController) DeleteSosialMedia(c *gin.Context) {
 		return
 	}
 
+	catatLog(ctrl.db, c, services.AksiDelete, services.TargetSosialMedia, sosmed.IDSosmed, sosmed, nil)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Sosial media berhasil dihapus",
 	})
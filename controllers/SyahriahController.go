@@ -1,11 +1,13 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 	"time"
 	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -37,14 +39,11 @@ type BayarSyahriahRequest struct {
 	Status string `json:"status" binding:"required"` // hanya untuk update status menjadi lunas
 }
 
-// Helper function untuk check role admin
-func (ctrl *SyahriahController) isAdmin(c *gin.Context) bool {
-	userRole, exists := c.Get("role")
-	if !exists {
-		return false
-	}
-	role := userRole.(string)
-	return role == "admin" || role == "super_admin"
+type CatatBayarSyahriahRequest struct {
+	Nominal    float64 `json:"nominal" binding:"required,gt=0"`
+	Metode     string  `json:"metode" binding:"omitempty,oneof=tunai transfer"` // default tunai
+	WaktuBayar string  `json:"waktu_bayar"`                                     // format YYYY-MM-DD, default hari ini
+	Keterangan string  `json:"keterangan"`
 }
 
 // Helper function untuk get user ID dari context
@@ -56,26 +55,56 @@ func (ctrl *SyahriahController) getUserID(c *gin.Context) (string, bool) {
 	return userID.(string), true
 }
 
-func (ctrl *SyahriahController) updateRekapOtomatis(syahriah models.Syahriah) {
-	rekapController := NewRekapController(ctrl.db)
-	
-	// Parse bulan untuk dapat time.Time
-	bulanTime, err := time.Parse("2006-01", syahriah.Bulan)
-	if err != nil {
-		fmt.Printf("Gagal parse bulan: %v\n", err)
-		return
+// updateRekapBayar memperbarui rekap untuk bulan syahriah dan bulan pembayaran yang terdampak
+func (ctrl *SyahriahController) updateRekapBayar(terdampak []models.Syahriah, bayar ...models.SyahriahBayar) {
+	updateRekapMulai(ctrl.db, periodeSyahriahBayar(terdampak, bayar...)...)
+}
+
+// validasiStatusInput memastikan status yang diisi manual hanya 'belum' atau 'lunas'.
+// Status lain (sebagian, lebih) diturunkan dari riwayat pembayaran.
+func validasiStatusInput(status string) (models.StatusSyahriah, bool) {
+	if status == "" {
+		return models.StatusBelum, true
 	}
-	
-	if err := rekapController.UpdateRekapOtomatis(bulanTime); err != nil {
-		// Log error tapi jangan gagalkan operasi utama
-		fmt.Printf("Gagal update rekap: %v\n", err)
+	s := models.StatusSyahriah(status)
+	return s, s == models.StatusBelum || s == models.StatusLunas
+}
+
+// buatSyahriah menyimpan syahriah baru, menerapkan kredit lebih bayar bulan sebelumnya,
+// dan melunasi sisanya jika diminta lunas
+func buatSyahriah(tx *gorm.DB, syahriah *models.Syahriah, lunas bool, adminID string) ([]models.Syahriah, []models.SyahriahBayar, error) {
+	syahriah.Status = services.StatusDariBayar(syahriah.Nominal, 0)
+	if err := tx.Create(syahriah).Error; err != nil {
+		return nil, nil, err
 	}
+	bayarService := services.NewSyahriahBayarService(tx)
+	terdampak, err := bayarService.TerapkanKreditTertunda(syahriah.ID_Santri)
+	if err != nil {
+		return nil, nil, err
+	}
+	terdampak = append(terdampak, *syahriah)
+
+	var bayar []models.SyahriahBayar
+	if lunas {
+		hasil, err := bayarService.LunasiSisa(syahriah.IDSyahriah, services.BayarBaru{
+			Metode:       models.BayarTunai,
+			DiterimaOleh: adminID,
+		}, adminID)
+		switch {
+		case err == nil:
+			terdampak = append(terdampak, hasil.Terdampak...)
+			bayar = append(bayar, hasil.Bayar)
+		case !errors.Is(err, services.ErrSyahriahSudahLunas): // sudah tertutup kredit bulan sebelumnya
+			return nil, nil, err
+		}
+	}
+	return terdampak, bayar, nil
 }
 
 // CreateSyahriah membuat data syahriah baru (hanya admin)
 func (ctrl *SyahriahController) CreateSyahriah(c *gin.Context) {
 	// Hanya admin yang bisa create
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinSyahriahWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat membuat data syahriah"})
 		return
 	}
@@ -99,6 +128,9 @@ func (ctrl *SyahriahController) CreateSyahriah(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Format bulan tidak valid. Gunakan format YYYY-MM"})
 		return
 	}
+	if tolakPeriodeDitutup(c, ctrl.db, req.Bulan) {
+		return
+	}
 
 	// Cek apakah santri exists
 	var santri models.Santri
@@ -114,36 +146,52 @@ func (ctrl *SyahriahController) CreateSyahriah(c *gin.Context) {
 		return
 	}
 
-	// Set default nominal jika tidak diisi
-	if req.Nominal == 0 {
-		req.Nominal = 10000 // default value
+	// Nominal dihitung dari tarif dasar dan aturan potongan jika tidak diisi manual
+	var tarif services.HasilTarif
+	if req.Nominal > 0 {
+		tarif = services.HasilTarif{
+			NominalDasar: req.Nominal,
+			Nominal:      req.Nominal,
+			Rincian:      fmt.Sprintf("Nominal Rp%.0f diisi manual", req.Nominal),
+		}
+	} else {
+		tarif, err = services.NewTarifService(ctrl.db).Hitung(santri, req.Bulan)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghitung tarif syahriah: " + err.Error()})
+			return
+		}
 	}
 
 	// Validasi status
-	var status models.StatusSyahriah
-	if req.Status != "" {
-		status = models.StatusSyahriah(req.Status)
-		if status != models.StatusBelum && status != models.StatusLunas {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Status tidak valid. Gunakan 'belum' atau 'lunas'"})
-			return
-		}
-	} else {
-		status = models.StatusBelum // default
+	status, ok := validasiStatusInput(req.Status)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Status tidak valid. Gunakan 'belum' atau 'lunas'"})
+		return
 	}
 
-	// Buat data syahriah
+	// Buat data syahriah, status akhirnya diturunkan dari pembayaran
 	syahriah := models.Syahriah{
 		IDSyahriah:  uuid.New().String(),
 		ID_Santri:    req.ID_Santri,
 		Bulan:       req.Bulan,
-		Nominal:     req.Nominal,
-		Status:      status,
+		Status:      models.StatusBelum,
 		DicatatOleh: adminID,
 		WaktuCatat:  time.Now(),
 	}
+	tarif.Terapkan(&syahriah)
 
-	// Simpan ke database
-	if err := ctrl.db.Create(&syahriah).Error; err != nil {
+	// Simpan ke database, catat pembayaran (dan jurnalnya) jika langsung lunas
+	var terdampak []models.Syahriah
+	var bayar []models.SyahriahBayar
+	err = ctrl.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		terdampak, bayar, err = buatSyahriah(tx, &syahriah, status == models.StatusLunas, adminID)
+		return err
+	})
+	if err != nil {
+		if balasPeriodeDitutup(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat data syahriah: " + err.Error()})
 		return
 	}
@@ -151,7 +199,10 @@ func (ctrl *SyahriahController) CreateSyahriah(c *gin.Context) {
 	// Preload relations untuk response
 	ctrl.db.Preload("Santri").Preload("Santri.Wali").Preload("Admin").First(&syahriah, "id_syahriah = ?", syahriah.IDSyahriah)
 
-	ctrl.updateRekapOtomatis(syahriah)
+	catatLog(ctrl.db, c, services.AksiCreate, services.TargetSyahriah, syahriah.IDSyahriah, nil, syahriah)
+
+	ctrl.updateRekapBayar(terdampak, bayar...)
+	terbitkanKwitansiBayar(ctrl.db, bayar...)
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Data syahriah berhasil dibuat",
@@ -180,7 +231,7 @@ func (ctrl *SyahriahController) GetAllSyahriah(c *gin.Context) {
 	query := ctrl.db.Preload("Santri").Preload("Santri.Wali").Preload("Admin")
 
 	// Jika user adalah santri, hanya tampilkan data miliknya
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinSyahriahRead) {
 		query = query.Where("id_santri = ?", userID)
 	} else if idSantri != "" {
 		// Jika admin dan filter by id_santri
@@ -223,12 +274,6 @@ func (ctrl *SyahriahController) GetSyahriahByID(c *gin.Context) {
 		return
 	}
 
-	userID, exists := ctrl.getUserID(c)
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: user ID tidak ditemukan"})
-		return
-	}
-
 	var syahriah models.Syahriah
 	err := ctrl.db.Preload("Santri").Preload("Santri.Wali").Preload("Admin").Where("id_syahriah = ?", id).First(&syahriah).Error
 	if err != nil {
@@ -240,8 +285,8 @@ func (ctrl *SyahriahController) GetSyahriahByID(c *gin.Context) {
 		return
 	}
 
-	// Authorization: hanya admin atau santri yang bersangkutan yang bisa lihat
-	if !ctrl.isAdmin(c) && syahriah.ID_Santri != userID {
+	// Authorization: hanya admin atau wali dari santri yang bersangkutan yang bisa lihat
+	if !bolehAksesMilik(c, syahriah.Santri.IDWali, services.IzinSyahriahRead) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: Anda tidak memiliki akses ke data ini"})
 		return
 	}
@@ -275,8 +320,9 @@ func (ctrl *SyahriahController) GetMySyahriah(c *gin.Context) {
 	var syahriah []models.Syahriah
 	var total int64
 
-	// Build query hanya untuk user yang login
-	query := ctrl.db.Preload("Santri").Preload("Santri.Wali").Preload("Admin").Where("id_santri = ?", userID)
+	// Build query hanya untuk santri milik user yang login
+	query := ctrl.db.Preload("Santri").Preload("Santri.Wali").Preload("Admin").
+		Where("id_santri IN (?)", subquerySantriWali(ctrl.db, userID))
 
 	// Apply filters
 	if bulan != "" {
@@ -318,7 +364,7 @@ func (ctrl *SyahriahController) GetMySyahriah(c *gin.Context) {
 // UpdateSyahriah mengupdate data syahriah (hanya admin)
 func (ctrl *SyahriahController) UpdateSyahriah(c *gin.Context) {
 	// Hanya admin yang bisa update
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinSyahriahWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat mengupdate data syahriah"})
 		return
 	}
@@ -347,21 +393,60 @@ func (ctrl *SyahriahController) UpdateSyahriah(c *gin.Context) {
 		return
 	}
 
+	sebelum := existingSyahriah
+	if tolakPeriodeDitutup(c, ctrl.db, existingSyahriah.Bulan) {
+		return
+	}
+
+	// Validasi status
+	if _, ok := validasiStatusInput(req.Status); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Status tidak valid. Gunakan 'belum' atau 'lunas'"})
+		return
+	}
+	if req.Status == string(models.StatusBelum) && existingSyahriah.TotalBayar != 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Syahriah sudah memiliki pembayaran, hapus pembayarannya terlebih dahulu"})
+		return
+	}
+
 	// Update fields
 	if req.Nominal > 0 {
 		existingSyahriah.Nominal = req.Nominal
 	}
-	if req.Status != "" {
-		status := models.StatusSyahriah(req.Status)
-		if status != models.StatusBelum && status != models.StatusLunas {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Status tidak valid. Gunakan 'belum' atau 'lunas'"})
+
+	// Simpan perubahan lalu hitung ulang status dari pembayaran
+	adminID, _ := ctrl.getUserID(c)
+	var terdampak []models.Syahriah
+	var bayar []models.SyahriahBayar
+	err = ctrl.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&existingSyahriah).Update("nominal", existingSyahriah.Nominal).Error; err != nil {
+			return err
+		}
+		bayarService := services.NewSyahriahBayarService(tx)
+		var err error
+		if terdampak, err = bayarService.Selaraskan(existingSyahriah.IDSyahriah); err != nil {
+			return err
+		}
+		if req.Status != string(models.StatusLunas) {
+			return nil
+		}
+		hasil, err := bayarService.LunasiSisa(existingSyahriah.IDSyahriah, services.BayarBaru{
+			Metode:       models.BayarTunai,
+			DiterimaOleh: adminID,
+		}, adminID)
+		if errors.Is(err, services.ErrSyahriahSudahLunas) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		terdampak = append(terdampak, hasil.Terdampak...)
+		bayar = append(bayar, hasil.Bayar)
+		return nil
+	})
+	if err != nil {
+		if balasPeriodeDitutup(c, err) {
 			return
 		}
-		existingSyahriah.Status = status
-	}
-
-	// Simpan perubahan
-	if err := ctrl.db.Save(&existingSyahriah).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengupdate data syahriah: " + err.Error()})
 		return
 	}
@@ -369,7 +454,10 @@ func (ctrl *SyahriahController) UpdateSyahriah(c *gin.Context) {
 	// Preload relations untuk response
 	ctrl.db.Preload("Santri").Preload("Santri.Wali").Preload("Admin").First(&existingSyahriah, "id_syahriah = ?", existingSyahriah.IDSyahriah)
 
-	ctrl.updateRekapOtomatis(existingSyahriah)
+	catatLog(ctrl.db, c, services.AksiUpdate, services.TargetSyahriah, existingSyahriah.IDSyahriah, sebelum, existingSyahriah)
+
+	ctrl.updateRekapBayar(terdampak, bayar...)
+	terbitkanKwitansiBayar(ctrl.db, bayar...)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Data syahriah berhasil diupdate",
@@ -377,7 +465,7 @@ func (ctrl *SyahriahController) UpdateSyahriah(c *gin.Context) {
 	})
 }
 
-// BayarSyahriah update status menjadi lunas (bisa oleh santri untuk bayar)
+// BayarSyahriah melunasi sisa tagihan syahriah secara tunai
 func (ctrl *SyahriahController) BayarSyahriah(c *gin.Context) {
 	id := c.Param("id")
 	if id == "" {
@@ -415,18 +503,37 @@ func (ctrl *SyahriahController) BayarSyahriah(c *gin.Context) {
 		return
 	}
 
-	// Authorization: hanya admin atau santri yang bersangkutan yang bisa bayar
-	if !ctrl.isAdmin(c) && existingSyahriah.ID_Santri != userID {
+	// Authorization: hanya admin atau wali dari santri yang bersangkutan yang bisa bayar
+	boleh, err := bolehAksesSantri(c, ctrl.db, existingSyahriah.ID_Santri, services.IzinSyahriahWrite)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memeriksa akses: " + err.Error()})
+		return
+	}
+	if !boleh {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: Anda tidak memiliki akses untuk melakukan pembayaran ini"})
 		return
 	}
 
-	// Update status menjadi lunas
-	existingSyahriah.Status = models.StatusLunas
-	existingSyahriah.WaktuCatat = time.Now() // Update waktu catat saat pembayaran
+	sebelum := existingSyahriah
 
-	// Simpan perubahan
-	if err := ctrl.db.Save(&existingSyahriah).Error; err != nil {
+	// Catat pembayaran sebesar sisa tagihan beserta jurnal pemasukannya
+	var hasil *services.HasilBayar
+	err = ctrl.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		hasil, err = services.NewSyahriahBayarService(tx).LunasiSisa(existingSyahriah.IDSyahriah, services.BayarBaru{
+			Metode:       models.BayarTunai,
+			DiterimaOleh: userID,
+		}, userID)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrSyahriahSudahLunas) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Syahriah sudah lunas"})
+			return
+		}
+		if balasPeriodeDitutup(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal melakukan pembayaran: " + err.Error()})
 		return
 	}
@@ -434,18 +541,171 @@ func (ctrl *SyahriahController) BayarSyahriah(c *gin.Context) {
 	// Preload relations untuk response
 	ctrl.db.Preload("Santri").Preload("Santri.Wali").Preload("Admin").First(&existingSyahriah, "id_syahriah = ?", existingSyahriah.IDSyahriah)
 
-	ctrl.updateRekapOtomatis(existingSyahriah)
+	catatLog(ctrl.db, c, services.AksiUpdate, services.TargetSyahriah, existingSyahriah.IDSyahriah, sebelum, existingSyahriah)
+
+	ctrl.updateRekapBayar(hasil.Terdampak, hasil.Bayar)
+	kwitansi := terbitkanKwitansi(ctrl.db, models.KwitansiSyahriah, hasil.Bayar.IDBayar)
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Pembayaran syahriah berhasil",
-		"data":    existingSyahriah,
+		"message":  "Pembayaran syahriah berhasil",
+		"data":     existingSyahriah,
+		"kwitansi": kwitansi,
+	})
+}
+
+// CatatPembayaranSyahriah mencatat satu pembayaran (boleh sebagian) untuk syahriah
+func (ctrl *SyahriahController) CatatPembayaranSyahriah(c *gin.Context) {
+	adminID, exists := ctrl.getUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: user ID tidak ditemukan"})
+		return
+	}
+
+	var req CatatBayarSyahriahRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	baru := services.BayarBaru{
+		Nominal:      req.Nominal,
+		Metode:       models.BayarTunai,
+		DiterimaOleh: adminID,
+		Keterangan:   req.Keterangan,
+	}
+	if req.Metode != "" {
+		baru.Metode = models.MetodeBayar(req.Metode)
+	}
+	if req.WaktuBayar != "" {
+		waktu, err := time.ParseInLocation("2006-01-02", req.WaktuBayar, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Format waktu_bayar tidak valid. Gunakan format YYYY-MM-DD"})
+			return
+		}
+		if waktu.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "waktu_bayar tidak boleh di masa depan"})
+			return
+		}
+		baru.WaktuBayar = waktu
+	}
+
+	var hasil *services.HasilBayar
+	err := ctrl.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		hasil, err = services.NewSyahriahBayarService(tx).Bayar(c.Param("id"), baru, adminID)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrSyahriahTidakDitemukan) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Data syahriah tidak ditemukan"})
+			return
+		}
+		if balasPeriodeDitutup(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mencatat pembayaran: " + err.Error()})
+		return
+	}
+
+	catatLog(ctrl.db, c, services.AksiCreate, services.TargetSyahriahBayar, hasil.Bayar.IDBayar, nil, hasil.Bayar)
+
+	ctrl.updateRekapBayar(hasil.Terdampak, hasil.Bayar)
+	kwitansi := terbitkanKwitansi(ctrl.db, models.KwitansiSyahriah, hasil.Bayar.IDBayar)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Pembayaran syahriah berhasil dicatat",
+		"data": gin.H{
+			"pembayaran": hasil.Bayar,
+			"syahriah":   hasil.Syahriah,
+			"sisa":       services.SisaTagihan(hasil.Syahriah),
+			"kwitansi":   kwitansi,
+		},
+	})
+}
+
+// GetRiwayatPembayaranSyahriah menampilkan riwayat cicilan sebuah syahriah (admin atau wali santri)
+func (ctrl *SyahriahController) GetRiwayatPembayaranSyahriah(c *gin.Context) {
+	var syahriah models.Syahriah
+	if err := ctrl.db.Where("id_syahriah = ?", c.Param("id")).First(&syahriah).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Data syahriah tidak ditemukan"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data syahriah: " + err.Error()})
+		return
+	}
+
+	boleh, err := bolehAksesSantri(c, ctrl.db, syahriah.ID_Santri, services.IzinSyahriahRead)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memeriksa akses: " + err.Error()})
+		return
+	}
+	if !boleh {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: Anda tidak memiliki akses ke data ini"})
+		return
+	}
+
+	var riwayat []models.SyahriahBayar
+	if err := ctrl.db.Preload("Penerima").
+		Where("id_syahriah = ?", syahriah.IDSyahriah).
+		Order("waktu_bayar ASC, dibuat_pada ASC").
+		Find(&riwayat).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil riwayat pembayaran: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": riwayat,
+		"meta": gin.H{
+			"nominal":     syahriah.Nominal,
+			"total_bayar": syahriah.TotalBayar,
+			"sisa":        services.SisaTagihan(syahriah),
+			"status":      syahriah.Status,
+		},
+	})
+}
+
+// DeletePembayaranSyahriah membatalkan satu pembayaran syahriah yang salah input
+func (ctrl *SyahriahController) DeletePembayaranSyahriah(c *gin.Context) {
+	adminID, _ := ctrl.getUserID(c)
+
+	var hasil *services.HasilBayar
+	err := ctrl.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		hasil, err = services.NewSyahriahBayarService(tx).HapusBayar(c.Param("id_bayar"), adminID)
+		if err != nil {
+			return err
+		}
+		return services.NewKwitansiService(tx).Batalkan(models.KwitansiSyahriah, hasil.Bayar.IDBayar)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrBayarTidakDitemukan):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrBayarKreditTidakDapatDiubah):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrPeriodeDitutup):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghapus pembayaran: " + err.Error()})
+		}
+		return
+	}
+
+	catatLog(ctrl.db, c, services.AksiDelete, services.TargetSyahriahBayar, hasil.Bayar.IDBayar, hasil.Bayar, nil)
+
+	ctrl.updateRekapBayar(hasil.Terdampak, hasil.Bayar)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Pembayaran syahriah berhasil dihapus",
+		"data":    hasil.Syahriah,
 	})
 }
 
 // DeleteSyahriah menghapus data syahriah (hanya admin)
 func (ctrl *SyahriahController) DeleteSyahriah(c *gin.Context) {
 	// Hanya admin yang bisa delete
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinSyahriahWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat menghapus data syahriah"})
 		return
 	}
@@ -469,23 +729,122 @@ func (ctrl *SyahriahController) DeleteSyahriah(c *gin.Context) {
 	}
 
 	bulan := syahriah.Bulan
+	if tolakPeriodeDitutup(c, ctrl.db, bulan) {
+		return
+	}
 
-	// Hapus syahriah
-	if err := ctrl.db.Where("id_syahriah = ?", id).Delete(&models.Syahriah{}).Error; err != nil {
+	// Hapus syahriah beserta pembayarannya dan balik jurnalnya
+	adminID, _ := ctrl.getUserID(c)
+	var bayarList []models.SyahriahBayar
+	var terdampak []models.Syahriah
+	err = ctrl.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id_syahriah = ?", id).Find(&bayarList).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id_syahriah = ?", id).Delete(&models.SyahriahBayar{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id_syahriah = ?", id).Delete(&models.Syahriah{}).Error; err != nil {
+			return err
+		}
+		ledger := services.NewLedgerService(tx)
+		kwitansiService := services.NewKwitansiService(tx)
+		for _, bayar := range bayarList {
+			if _, err := ledger.BatalkanSumber(services.TargetSyahriahBayar, bayar.IDBayar, adminID); err != nil {
+				return err
+			}
+			if err := kwitansiService.Batalkan(models.KwitansiSyahriah, bayar.IDBayar); err != nil {
+				return err
+			}
+		}
+		if _, err := ledger.BatalkanSumber(services.TargetSyahriah, syahriah.IDSyahriah, adminID); err != nil {
+			return err
+		}
+
+		// Kredit lebih bayar yang melibatkan syahriah ini dihitung ulang di bulan pasangannya
+		var terkait []string
+		if err := tx.Model(&models.SyahriahBayar{}).
+			Where("id_syahriah_terkait = ? AND metode = ?", id, models.BayarKredit).
+			Distinct("id_syahriah").
+			Pluck("id_syahriah", &terkait).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id_syahriah_terkait = ? AND metode = ?", id, models.BayarKredit).
+			Delete(&models.SyahriahBayar{}).Error; err != nil {
+			return err
+		}
+		bayarService := services.NewSyahriahBayarService(tx)
+		for _, idTerkait := range terkait {
+			hasil, err := bayarService.Selaraskan(idTerkait)
+			if err != nil {
+				return err
+			}
+			terdampak = append(terdampak, hasil...)
+		}
+		return nil
+	})
+	if err != nil {
+		if balasPeriodeDitutup(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghapus data syahriah: " + err.Error()})
 		return
 	}
 
-	rekapController := NewRekapController(ctrl.db)
-	if err := rekapController.UpdateRekapByBulan(bulan); err != nil {
-		fmt.Printf("Gagal update rekap: %v\n", err)
-	}
+	catatLog(ctrl.db, c, services.AksiDelete, services.TargetSyahriah, syahriah.IDSyahriah, syahriah, nil)
+
+	ctrl.updateRekapBayar(append(terdampak, models.Syahriah{Bulan: bulan}), bayarList...)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Data syahriah berhasil dihapus",
 	})
 }
 
+// ringkasanSyahriah menghitung jumlah syahriah per status dan total yang benar-benar sudah diterima
+func ringkasanSyahriah(query *gorm.DB) (gin.H, error) {
+	var baris []struct {
+		Status     models.StatusSyahriah
+		Jumlah     int64
+		TotalBayar float64
+		Tagihan    float64
+		Sisa       float64
+	}
+	if err := query.
+		Select("status, COUNT(*) AS jumlah, COALESCE(SUM(total_bayar), 0) AS total_bayar, " +
+			"COALESCE(SUM(nominal), 0) AS tagihan, COALESCE(SUM(GREATEST(nominal - total_bayar, 0)), 0) AS sisa").
+		Group("status").
+		Scan(&baris).Error; err != nil {
+		return nil, err
+	}
+
+	var total, lunas, sebagian, belum int64
+	var dibayar, tagihan, sisa float64
+	for _, b := range baris {
+		total += b.Jumlah
+		dibayar += b.TotalBayar
+		tagihan += b.Tagihan
+		sisa += b.Sisa
+		switch b.Status {
+		case models.StatusLunas, models.StatusLebih:
+			lunas += b.Jumlah
+		case models.StatusSebagian:
+			sebagian += b.Jumlah
+		default:
+			belum += b.Jumlah
+		}
+	}
+
+	return gin.H{
+		"total":         total,
+		"lunas":         lunas,
+		"sebagian":      sebagian,
+		"belum_lunas":   belum,
+		"total_nominal": dibayar, // total yang sudah diterima, termasuk cicilan
+		"total_tagihan": tagihan,
+		"sisa_tagihan":  sisa,
+	}, nil
+}
+
 // GetSyahriahSummary mendapatkan summary syahriah
 func (ctrl *SyahriahController) GetSyahriahSummary(c *gin.Context) {
 	userID, exists := ctrl.getUserID(c)
@@ -496,54 +855,122 @@ func (ctrl *SyahriahController) GetSyahriahSummary(c *gin.Context) {
 
 	// Build query berdasarkan role
 	query := ctrl.db.Model(&models.Syahriah{})
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinSyahriahRead) {
 		query = query.Where("id_santri = ?", userID)
 	}
 
-	// Hitung total
-	var total int64
-	if err := query.Count(&total).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghitung total syahriah: " + err.Error()})
+	ringkasan, err := ringkasanSyahriah(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghitung summary syahriah: " + err.Error()})
 		return
 	}
 
-	// Hitung lunas
-	var lunas int64
-	if err := query.Where("status = ?", models.StatusLunas).Count(&lunas).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghitung syahriah lunas: " + err.Error()})
-		return
+	c.JSON(http.StatusOK, gin.H{
+		"data": ringkasan,
+	})
+}
+
+// errTidakAdaSantriAktif dikembalikan batch syahriah jika belum ada santri aktif
+var errTidakAdaSantriAktif = errors.New("Tidak ada data santri aktif yang tersedia")
+
+// hasilBatchSyahriah adalah ringkasan pembuatan syahriah satu bulan untuk semua santri aktif
+type hasilBatchSyahriah struct {
+	Dibuat      []models.Syahriah
+	Terdampak   []models.Syahriah
+	Bayar       []models.SyahriahBayar
+	SantriAktif int
+	Dibebaskan  int
+	Dipotong    int
+}
+
+// buatSyahriahBulanan membuat syahriah bulan tertentu untuk santri aktif yang belum memilikinya.
+// Dipakai oleh endpoint batch dan job bulanan; log dan rekap diurus pemanggil.
+func buatSyahriahBulanan(db *gorm.DB, bulan string, nominalDasar *float64, lunas bool, adminID string) (*hasilBatchSyahriah, error) {
+	// Dapatkan hanya santri dengan status aktif
+	var santriList []models.Santri
+	if err := db.Where("status = ?", "aktif").Find(&santriList).Error; err != nil {
+		return nil, fmt.Errorf("gagal mengambil data santri aktif: %v", err)
 	}
 
-	// Hitung belum lunas
-	var belum int64
-	if err := query.Where("status = ?", models.StatusBelum).Count(&belum).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghitung syahriah belum lunas: " + err.Error()})
-		return
+	if len(santriList) == 0 {
+		return nil, errTidakAdaSantriAktif
 	}
 
-	// Total nominal yang sudah dibayar (hanya yang status lunas)
-	var totalNominal float64
-	if err := query.Where("status = ?", models.StatusLunas).
-		Select("COALESCE(SUM(nominal), 0)").
-		Scan(&totalNominal).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghitung total nominal: " + err.Error()})
-		return
+	// Dapatkan santri aktif yang sudah memiliki syahriah di bulan ini
+	var existingSantri []string
+	if err := db.Model(&models.Syahriah{}).
+		Joins("JOIN santri ON syahriah.id_santri = santri.id_santri").
+		Where("syahriah.bulan = ? AND santri.status = ?", bulan, "aktif").
+		Pluck("syahriah.id_santri", &existingSantri).Error; err != nil {
+		return nil, fmt.Errorf("gagal memeriksa data syahriah yang sudah ada: %v", err)
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"data": gin.H{
-			"total":         total,
-			"lunas":         lunas,
-			"belum_lunas":   belum,
-			"total_nominal": totalNominal,
-		},
+	// Buat map untuk pengecekan cepat
+	existingMap := make(map[string]bool)
+	for _, id := range existingSantri {
+		existingMap[id] = true
+	}
+
+	// Hitung nominal tiap santri dari tarif dasar periode (atau nominal yang diisi) dan aturan potongan
+	tarifList, err := services.NewTarifService(db).HitungBanyak(santriList, bulan, nominalDasar)
+	if err != nil {
+		return nil, fmt.Errorf("gagal menghitung tarif syahriah: %v", err)
+	}
+
+	hasil := &hasilBatchSyahriah{SantriAktif: len(santriList)}
+	for _, santri := range santriList {
+		// Skip jika santri sudah memiliki data syahriah untuk bulan ini
+		if existingMap[santri.IDSantri] {
+			continue
+		}
+
+		// Santri yang dibebaskan tetap dibuatkan syahriah bernominal 0 agar tercatat aturan yang membebaskannya
+		syahriah := models.Syahriah{
+			IDSyahriah:  uuid.New().String(),
+			ID_Santri:    santri.IDSantri,
+			Bulan:       bulan,
+			Status:      models.StatusBelum,
+			DicatatOleh: adminID,
+			WaktuCatat:  time.Now(),
+		}
+		tarif := tarifList[santri.IDSantri]
+		tarif.Terapkan(&syahriah)
+		switch {
+		case tarif.Nominal == 0:
+			hasil.Dibebaskan++
+		case tarif.IDAturan != nil:
+			hasil.Dipotong++
+		}
+		hasil.Dibuat = append(hasil.Dibuat, syahriah)
+	}
+
+	if len(hasil.Dibuat) == 0 {
+		return hasil, nil
+	}
+
+	// Simpan ke database; kredit lebih bayar bulan sebelumnya diterapkan per santri,
+	// syahriah yang langsung lunas dicatat pembayarannya
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for i := range hasil.Dibuat {
+			t, b, err := buatSyahriah(tx, &hasil.Dibuat[i], lunas, adminID)
+			if err != nil {
+				return err
+			}
+			hasil.Terdampak = append(hasil.Terdampak, t...)
+			hasil.Bayar = append(hasil.Bayar, b...)
+		}
+		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	return hasil, nil
 }
 
 // BatchCreateSyahriah membuat data syahriah untuk semua santri yang belum memiliki data di bulan tertentu
 func (ctrl *SyahriahController) BatchCreateSyahriah(c *gin.Context) {
 	// Hanya admin yang bisa create batch
-	if !ctrl.isAdmin(c) {
+	if !punyaIzin(c, services.IzinSyahriahWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat membuat data syahriah batch"})
 		return
 	}
@@ -557,7 +984,7 @@ func (ctrl *SyahriahController) BatchCreateSyahriah(c *gin.Context) {
 
 	var req struct {
 		Bulan   string  `json:"bulan" binding:"required"` // format YYYY-MM
-		Nominal float64 `json:"nominal"`
+		Nominal float64 `json:"nominal"`                  // menggantikan tarif dasar periode jika diisi
 		Status  string  `json:"status"`
 	}
 
@@ -572,104 +999,62 @@ func (ctrl *SyahriahController) BatchCreateSyahriah(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Format bulan tidak valid. Gunakan format YYYY-MM"})
 		return
 	}
-
-	// Set default nominal jika tidak diisi
-	if req.Nominal == 0 {
-		req.Nominal = 110000 // default value
-	}
-
-	// Validasi status
-	var status models.StatusSyahriah
-	if req.Status != "" {
-		status = models.StatusSyahriah(req.Status)
-		if status != models.StatusBelum && status != models.StatusLunas {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Status tidak valid. Gunakan 'belum' atau 'lunas'"})
-			return
-		}
-	} else {
-		status = models.StatusBelum // default
-	}
-
-	// Dapatkan hanya santri dengan status aktif
-	var santriList []models.Santri
-	if err := ctrl.db.Where("status = ?", "aktif").Find(&santriList).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data santri aktif: " + err.Error()})
-		return
-	}
-
-	if len(santriList) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Tidak ada data santri aktif yang tersedia"})
+	if tolakPeriodeDitutup(c, ctrl.db, req.Bulan) {
 		return
 	}
 
-	// Dapatkan santri aktif yang sudah memiliki syahriah di bulan ini
-	var existingSantri []string
-	if err := ctrl.db.Model(&models.Syahriah{}).
-		Joins("JOIN santri ON syahriah.id_santri = santri.id_santri").
-		Where("syahriah.bulan = ? AND santri.status = ?", req.Bulan, "aktif").
-		Pluck("syahriah.id_santri", &existingSantri).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memeriksa data syahriah yang sudah ada: " + err.Error()})
+	// Validasi status
+	status, ok := validasiStatusInput(req.Status)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Status tidak valid. Gunakan 'belum' atau 'lunas'"})
 		return
 	}
 
-	// Buat map untuk pengecekan cepat
-	existingMap := make(map[string]bool)
-	for _, id := range existingSantri {
-		existingMap[id] = true
+	var nominalDasar *float64
+	if req.Nominal > 0 {
+		nominalDasar = &req.Nominal
 	}
-
-	var syahriahList []models.Syahriah
-	var createdCount int
-
-	for _, santri := range santriList {
-		// Skip jika santri sudah memiliki data syahriah untuk bulan ini
-		if existingMap[santri.IDSantri] {
-			continue
+	hasil, err := buatSyahriahBulanan(ctrl.db, req.Bulan, nominalDasar, status == models.StatusLunas, adminID)
+	if err != nil {
+		if errors.Is(err, errTidakAdaSantriAktif) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
-
-		syahriah := models.Syahriah{
-			IDSyahriah:  uuid.New().String(),
-			ID_Santri:    santri.IDSantri,
-			Bulan:       req.Bulan,
-			Nominal:     req.Nominal,
-			Status:      status,
-			DicatatOleh: adminID,
-			WaktuCatat:  time.Now(),
+		if balasPeriodeDitutup(c, err) {
+			return
 		}
-		syahriahList = append(syahriahList, syahriah)
-		createdCount++
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat data syahriah batch: " + err.Error()})
+		return
 	}
 
-	if len(syahriahList) == 0 {
+	if len(hasil.Dibuat) == 0 {
 		c.JSON(http.StatusOK, gin.H{
 			"message": "Semua santri aktif sudah memiliki data syahriah untuk bulan ini",
 			"data": gin.H{
 				"created":      0,
-				"total_santri_aktif": len(santriList),
+				"total_santri_aktif": hasil.SantriAktif,
 			},
 		})
 		return
 	}
 
-	// Simpan ke database dalam batch
-	if err := ctrl.db.CreateInBatches(&syahriahList, 100).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat data syahriah batch: " + err.Error()})
-		return
+	for _, syahriah := range hasil.Dibuat {
+		catatLog(ctrl.db, c, services.AksiCreate, services.TargetSyahriah, syahriah.IDSyahriah, nil, syahriah)
 	}
 
-	// Update rekap untuk bulan ini
-	rekapController := NewRekapController(ctrl.db)
-	bulanTime, _ := time.Parse("2006-01", req.Bulan)
-	if err := rekapController.UpdateRekapOtomatis(bulanTime); err != nil {
-		fmt.Printf("Gagal update rekap: %v\n", err)
-	}
+	// Update rekap untuk bulan ini dan bulan pembayaran yang terdampak
+	ctrl.updateRekapBayar(append(hasil.Terdampak, models.Syahriah{Bulan: req.Bulan}), hasil.Bayar...)
+	terbitkanKwitansiBayar(ctrl.db, hasil.Bayar...)
 
+	createdCount := len(hasil.Dibuat)
 	c.JSON(http.StatusCreated, gin.H{
 		"message": fmt.Sprintf("Berhasil membuat data syahriah untuk %d santri aktif", createdCount),
 		"data": gin.H{
 			"created":      createdCount,
-			"total_santri_aktif": len(santriList),
-			"skipped":      len(santriList) - createdCount,
+			"total_santri_aktif": hasil.SantriAktif,
+			"skipped":      hasil.SantriAktif - createdCount,
+			"dibebaskan":   hasil.Dibebaskan,
+			"dipotong":     hasil.Dipotong,
 			"bulan":        req.Bulan,
 		},
 	})
@@ -786,8 +1171,11 @@ func (ctrl *SyahriahController) GetSyahriahSummaryForWali(c *gin.Context) {
             "data": gin.H{
                 "total":         0,
                 "lunas":         0,
+                "sebagian":      0,
                 "belum_lunas":   0,
                 "total_nominal": 0,
+                "total_tagihan": 0,
+                "sisa_tagihan":  0,
             },
         })
         return
@@ -802,42 +1190,13 @@ func (ctrl *SyahriahController) GetSyahriahSummaryForWali(c *gin.Context) {
     // Build query
     query := ctrl.db.Model(&models.Syahriah{}).Where("id_santri IN ?", santriIDs)
 
-    // Hitung total
-    var total int64
-    if err := query.Count(&total).Error; err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghitung total syahriah: " + err.Error()})
-        return
-    }
-
-    // Hitung lunas
-    var lunas int64
-    if err := query.Where("status = ?", models.StatusLunas).Count(&lunas).Error; err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghitung syahriah lunas: " + err.Error()})
-        return
-    }
-
-    // Hitung belum lunas
-    var belum int64
-    if err := query.Where("status = ?", models.StatusBelum).Count(&belum).Error; err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghitung syahriah belum lunas: " + err.Error()})
-        return
-    }
-
-    // Total nominal yang sudah dibayar (hanya yang status lunas)
-    var totalNominal float64
-    if err := query.Where("status = ?", models.StatusLunas).
-        Select("COALESCE(SUM(nominal), 0)").
-        Scan(&totalNominal).Error; err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghitung total nominal: " + err.Error()})
+    ringkasan, err := ringkasanSyahriah(query)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghitung summary syahriah: " + err.Error()})
         return
     }
 
     c.JSON(http.StatusOK, gin.H{
-        "data": gin.H{
-            "total":         total,
-            "lunas":         lunas,
-            "belum_lunas":   belum,
-            "total_nominal": totalNominal,
-        },
+        "data": ringkasan,
     })
 }
\ No newline at end of file
@@ -0,0 +1,473 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type TarifController struct {
+	db *gorm.DB
+}
+
+func NewTarifController(db *gorm.DB) *TarifController {
+	return &TarifController{db: db}
+}
+
+// Request structs
+type TarifDasarRequest struct {
+	BerlakuMulai string  `json:"berlaku_mulai" binding:"required"` // format YYYY-MM
+	Nominal      float64 `json:"nominal" binding:"required,gt=0"`
+	Keterangan   string  `json:"keterangan"`
+}
+
+type CreateAturanTarifRequest struct {
+	Nama          string  `json:"nama" binding:"required"`
+	Jenis         string  `json:"jenis" binding:"required,oneof=potongan_persen potongan_nominal bebas"`
+	Nilai         float64 `json:"nilai"`
+	Cakupan       string  `json:"cakupan" binding:"required,oneof=santri keluarga"`
+	IDSantri      *string `json:"id_santri"`
+	IDKeluarga    *string `json:"id_keluarga"`
+	MulaiAnakKe   int     `json:"mulai_anak_ke"`
+	BerlakuMulai  string  `json:"berlaku_mulai" binding:"required"` // format YYYY-MM
+	BerlakuSampai *string `json:"berlaku_sampai"`
+	Keterangan    string  `json:"keterangan"`
+}
+
+type UpdateAturanTarifRequest struct {
+	Nama          *string  `json:"nama"`
+	Jenis         *string  `json:"jenis" binding:"omitempty,oneof=potongan_persen potongan_nominal bebas"`
+	Nilai         *float64 `json:"nilai"`
+	MulaiAnakKe   *int     `json:"mulai_anak_ke"`
+	BerlakuMulai  *string  `json:"berlaku_mulai"`
+	BerlakuSampai *string  `json:"berlaku_sampai"` // isi "" untuk menghapus batas akhir
+	Aktif         *bool    `json:"aktif"`
+	Keterangan    *string  `json:"keterangan"`
+}
+
+// cekTargetAturan memastikan santri atau keluarga yang dituju aturan ada
+func (ctrl *TarifController) cekTargetAturan(aturan models.AturanTarif) error {
+	if aturan.Cakupan == models.CakupanSantri {
+		var santri models.Santri
+		if err := ctrl.db.Select("id_santri").First(&santri, "id_santri = ?", *aturan.IDSantri).Error; err != nil {
+			return errors.New("Santri tidak ditemukan")
+		}
+		return nil
+	}
+	var keluarga models.Keluarga
+	if err := ctrl.db.Select("id_keluarga").First(&keluarga, "id_keluarga = ?", *aturan.IDKeluarga).Error; err != nil {
+		return errors.New("Keluarga tidak ditemukan")
+	}
+	return nil
+}
+
+// GetAllTarifDasar menampilkan riwayat tarif dasar dari yang terbaru
+func (ctrl *TarifController) GetAllTarifDasar(c *gin.Context) {
+	var tarifList []models.TarifDasar
+	if err := ctrl.db.Order("berlaku_mulai DESC").Find(&tarifList).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data tarif dasar: " + err.Error()})
+		return
+	}
+
+	bulan := c.DefaultQuery("bulan", time.Now().Format("2006-01"))
+	nominal, berlaku, err := services.NewTarifService(ctrl.db).TarifDasar(bulan)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil tarif dasar yang berlaku: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": tarifList,
+		"berlaku": gin.H{
+			"bulan":   bulan,
+			"nominal": nominal,
+			"tarif":   berlaku,
+		},
+	})
+}
+
+// CreateTarifDasar menetapkan tarif dasar mulai periode tertentu.
+// Syahriah yang sudah dibuat tidak ikut berubah.
+func (ctrl *TarifController) CreateTarifDasar(c *gin.Context) {
+	var req TarifDasarRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := time.Parse("2006-01", req.BerlakuMulai); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format berlaku_mulai tidak valid. Gunakan format YYYY-MM"})
+		return
+	}
+
+	var existing models.TarifDasar
+	if err := ctrl.db.Where("berlaku_mulai = ?", req.BerlakuMulai).First(&existing).Error; err == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tarif dasar untuk periode ini sudah ada, ubah tarif yang ada"})
+		return
+	}
+
+	tarif := models.TarifDasar{
+		IDTarif:      uuid.New().String(),
+		BerlakuMulai: req.BerlakuMulai,
+		Nominal:      req.Nominal,
+		Keterangan:   req.Keterangan,
+		DibuatOleh:   c.GetString("user_id"),
+	}
+	if err := ctrl.db.Create(&tarif).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat tarif dasar: " + err.Error()})
+		return
+	}
+
+	catatLog(ctrl.db, c, services.AksiCreate, services.TargetTarifDasar, tarif.IDTarif, nil, tarif)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Tarif dasar berhasil dibuat",
+		"data":    tarif,
+	})
+}
+
+// UpdateTarifDasar mengubah nominal atau keterangan tarif dasar
+func (ctrl *TarifController) UpdateTarifDasar(c *gin.Context) {
+	var tarif models.TarifDasar
+	if err := ctrl.db.First(&tarif, "id_tarif = ?", c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tarif dasar tidak ditemukan"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil tarif dasar: " + err.Error()})
+		return
+	}
+
+	var req TarifDasarRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.BerlakuMulai != tarif.BerlakuMulai {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Periode tarif dasar tidak dapat diubah, buat tarif baru untuk periode lain"})
+		return
+	}
+
+	sebelum := tarif
+	tarif.Nominal = req.Nominal
+	tarif.Keterangan = req.Keterangan
+	if err := ctrl.db.Model(&tarif).Updates(map[string]interface{}{
+		"nominal":    tarif.Nominal,
+		"keterangan": tarif.Keterangan,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengupdate tarif dasar: " + err.Error()})
+		return
+	}
+
+	catatLog(ctrl.db, c, services.AksiUpdate, services.TargetTarifDasar, tarif.IDTarif, sebelum, tarif)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Tarif dasar berhasil diupdate",
+		"data":    tarif,
+	})
+}
+
+// DeleteTarifDasar menghapus tarif dasar yang belum pernah dipakai syahriah
+func (ctrl *TarifController) DeleteTarifDasar(c *gin.Context) {
+	var tarif models.TarifDasar
+	if err := ctrl.db.First(&tarif, "id_tarif = ?", c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tarif dasar tidak ditemukan"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil tarif dasar: " + err.Error()})
+		return
+	}
+
+	var dipakai int64
+	if err := ctrl.db.Model(&models.Syahriah{}).Where("id_tarif = ?", tarif.IDTarif).Count(&dipakai).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memeriksa pemakaian tarif: " + err.Error()})
+		return
+	}
+	if dipakai > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Tarif dasar sudah dipakai %d syahriah dan tidak dapat dihapus", dipakai)})
+		return
+	}
+
+	if err := ctrl.db.Delete(&tarif).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghapus tarif dasar: " + err.Error()})
+		return
+	}
+
+	catatLog(ctrl.db, c, services.AksiDelete, services.TargetTarifDasar, tarif.IDTarif, tarif, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tarif dasar berhasil dihapus"})
+}
+
+// GetAllAturanTarif menampilkan aturan tarif dengan filter dan pagination
+func (ctrl *TarifController) GetAllAturanTarif(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	query := ctrl.db.Model(&models.AturanTarif{})
+	if idSantri := c.Query("id_santri"); idSantri != "" {
+		query = query.Where("id_santri = ?", idSantri)
+	}
+	if idKeluarga := c.Query("id_keluarga"); idKeluarga != "" {
+		query = query.Where("id_keluarga = ?", idKeluarga)
+	}
+	if jenis := c.Query("jenis"); jenis != "" {
+		query = query.Where("jenis = ?", jenis)
+	}
+	if aktif := c.Query("aktif"); aktif != "" {
+		query = query.Where("aktif = ?", aktif == "true")
+	}
+	if bulan := c.Query("bulan"); bulan != "" {
+		query = query.Where("berlaku_mulai <= ? AND (berlaku_sampai IS NULL OR berlaku_sampai >= ?)", bulan, bulan)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghitung total data: " + err.Error()})
+		return
+	}
+
+	var aturanList []models.AturanTarif
+	offset := (page - 1) * limit
+	if err := query.Preload("Santri").Preload("Keluarga").
+		Order("dibuat_pada DESC").Offset(offset).Limit(limit).Find(&aturanList).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data aturan tarif: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": aturanList,
+		"meta": gin.H{
+			"page":       page,
+			"limit":      limit,
+			"total":      total,
+			"total_page": (int(total) + limit - 1) / limit,
+		},
+	})
+}
+
+// GetAturanTarifByID menampilkan detail aturan tarif
+func (ctrl *TarifController) GetAturanTarifByID(c *gin.Context) {
+	var aturan models.AturanTarif
+	if err := ctrl.db.Preload("Santri").Preload("Keluarga").First(&aturan, "id_aturan = ?", c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Aturan tarif tidak ditemukan"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil aturan tarif: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": aturan})
+}
+
+// CreateAturanTarif membuat aturan potongan atau pembebasan untuk santri atau keluarga
+func (ctrl *TarifController) CreateAturanTarif(c *gin.Context) {
+	var req CreateAturanTarifRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	aturan := models.AturanTarif{
+		IDAturan:      uuid.New().String(),
+		Nama:          req.Nama,
+		Jenis:         models.JenisAturanTarif(req.Jenis),
+		Nilai:         req.Nilai,
+		Cakupan:       models.CakupanAturanTarif(req.Cakupan),
+		IDSantri:      req.IDSantri,
+		IDKeluarga:    req.IDKeluarga,
+		MulaiAnakKe:   req.MulaiAnakKe,
+		BerlakuMulai:  req.BerlakuMulai,
+		BerlakuSampai: req.BerlakuSampai,
+		Aktif:         true,
+		Keterangan:    req.Keterangan,
+		DibuatOleh:    c.GetString("user_id"),
+	}
+	if err := services.ValidasiAturanTarif(&aturan); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := ctrl.cekTargetAturan(aturan); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ctrl.db.Create(&aturan).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuat aturan tarif: " + err.Error()})
+		return
+	}
+
+	catatLog(ctrl.db, c, services.AksiCreate, services.TargetAturanTarif, aturan.IDAturan, nil, aturan)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Aturan tarif berhasil dibuat",
+		"data":    aturan,
+	})
+}
+
+// UpdateAturanTarif mengubah aturan tarif. Target aturan (santri/keluarga) tidak dapat diubah.
+// Perubahan hanya berlaku untuk syahriah yang dibuat setelahnya.
+func (ctrl *TarifController) UpdateAturanTarif(c *gin.Context) {
+	var aturan models.AturanTarif
+	if err := ctrl.db.First(&aturan, "id_aturan = ?", c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Aturan tarif tidak ditemukan"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil aturan tarif: " + err.Error()})
+		return
+	}
+
+	var req UpdateAturanTarifRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sebelum := aturan
+	if req.Nama != nil {
+		aturan.Nama = *req.Nama
+	}
+	if req.Jenis != nil {
+		aturan.Jenis = models.JenisAturanTarif(*req.Jenis)
+	}
+	if req.Nilai != nil {
+		aturan.Nilai = *req.Nilai
+	}
+	if req.MulaiAnakKe != nil {
+		aturan.MulaiAnakKe = *req.MulaiAnakKe
+	}
+	if req.BerlakuMulai != nil {
+		aturan.BerlakuMulai = *req.BerlakuMulai
+	}
+	if req.BerlakuSampai != nil {
+		aturan.BerlakuSampai = req.BerlakuSampai
+	}
+	if req.Aktif != nil {
+		aturan.Aktif = *req.Aktif
+	}
+	if req.Keterangan != nil {
+		aturan.Keterangan = *req.Keterangan
+	}
+	if err := services.ValidasiAturanTarif(&aturan); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ctrl.db.Model(&aturan).Updates(map[string]interface{}{
+		"nama":           aturan.Nama,
+		"jenis":          aturan.Jenis,
+		"nilai":          aturan.Nilai,
+		"mulai_anak_ke":  aturan.MulaiAnakKe,
+		"berlaku_mulai":  aturan.BerlakuMulai,
+		"berlaku_sampai": aturan.BerlakuSampai,
+		"aktif":          aturan.Aktif,
+		"keterangan":     aturan.Keterangan,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengupdate aturan tarif: " + err.Error()})
+		return
+	}
+
+	catatLog(ctrl.db, c, services.AksiUpdate, services.TargetAturanTarif, aturan.IDAturan, sebelum, aturan)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Aturan tarif berhasil diupdate",
+		"data":    aturan,
+	})
+}
+
+// DeleteAturanTarif menghapus aturan yang belum pernah dipakai. Aturan yang sudah dipakai
+// syahriah dinonaktifkan lewat update agar asal nominalnya tetap dapat ditelusuri.
+func (ctrl *TarifController) DeleteAturanTarif(c *gin.Context) {
+	var aturan models.AturanTarif
+	if err := ctrl.db.First(&aturan, "id_aturan = ?", c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Aturan tarif tidak ditemukan"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil aturan tarif: " + err.Error()})
+		return
+	}
+
+	var dipakai int64
+	if err := ctrl.db.Model(&models.Syahriah{}).Where("id_aturan = ?", aturan.IDAturan).Count(&dipakai).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memeriksa pemakaian aturan: " + err.Error()})
+		return
+	}
+	if dipakai > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Aturan tarif sudah dipakai %d syahriah, nonaktifkan aturan ini sebagai gantinya", dipakai)})
+		return
+	}
+
+	if err := ctrl.db.Delete(&aturan).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghapus aturan tarif: " + err.Error()})
+		return
+	}
+
+	catatLog(ctrl.db, c, services.AksiDelete, services.TargetAturanTarif, aturan.IDAturan, aturan, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Aturan tarif berhasil dihapus"})
+}
+
+// HitungTarif menampilkan simulasi nominal syahriah untuk satu santri atau semua santri aktif
+func (ctrl *TarifController) HitungTarif(c *gin.Context) {
+	bulan := c.DefaultQuery("bulan", time.Now().Format("2006-01"))
+	if _, err := time.Parse("2006-01", bulan); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format bulan tidak valid. Gunakan format YYYY-MM"})
+		return
+	}
+
+	query := ctrl.db.Model(&models.Santri{})
+	if idSantri := c.Query("id_santri"); idSantri != "" {
+		query = query.Where("id_santri = ?", idSantri)
+	} else {
+		query = query.Where("status = ?", models.StatusAktifSantri)
+	}
+	var santriList []models.Santri
+	if err := query.Order("nama_lengkap ASC").Find(&santriList).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data santri: " + err.Error()})
+		return
+	}
+	if len(santriList) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Santri tidak ditemukan"})
+		return
+	}
+
+	hasil, err := services.NewTarifService(ctrl.db).HitungBanyak(santriList, bulan, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghitung tarif: " + err.Error()})
+		return
+	}
+
+	data := make([]gin.H, 0, len(santriList))
+	var total float64
+	for _, santri := range santriList {
+		tarif := hasil[santri.IDSantri]
+		total += tarif.Nominal
+		data = append(data, gin.H{
+			"nama_lengkap": santri.NamaLengkap,
+			"tarif":        tarif,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":          data,
+		"bulan":         bulan,
+		"total_nominal": total,
+	})
+}
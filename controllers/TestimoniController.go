@@ -4,6 +4,7 @@
 		"net/http"
 		"strconv"
 		"tpq_asysyafii/models"
+		"tpq_asysyafii/services"
 
 		"github.com/gin-gonic/gin"
 		"github.com/google/uuid"
@@ -18,16 +19,6 @@
 		return &TestimoniController{db: db}
 	}
 
-	// Helper function untuk check role admin
-	func (ctrl *TestimoniController) isAdmin(c *gin.Context) bool {
-		userRole, exists := c.Get("role")
-		if !exists {
-			return false
-		}
-		role := userRole.(string)
-		return role == "admin" || role == "super_admin"
-	}
-
 	// Helper function untuk get user ID dari context
 	func (ctrl *TestimoniController) getUserID(c *gin.Context) (string, bool) {
 		userID, exists := c.Get("user_id")
@@ -119,6 +110,8 @@
 		// Preload relations untuk response
 		ctrl.db.Preload("Wali").Preload("DiupdateOleh").First(&testimoni, "id_testimoni = ?", testimoni.IDTestimoni)
 
+		catatLog(ctrl.db, c, services.AksiCreate, services.TargetTestimoni, testimoni.IDTestimoni, nil, testimoni)
+
 		c.JSON(http.StatusCreated, gin.H{
 			"message": "Testimoni berhasil dibuat",
 			"data":    testimoni,
@@ -145,7 +138,7 @@
 		}
 
 		// Untuk public access, hanya tampilkan yang status show
-		if !ctrl.isAdmin(c) && testimoni.Status != "show" {
+		if !punyaIzin(c, services.IzinTestimoniModerasi) && testimoni.Status != "show" {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Testimoni tidak ditemukan"})
 			return
 		}
@@ -183,7 +176,7 @@
 		}
 
 		// Cek authorization: hanya admin atau pemilik testimoni yang bisa update
-		if !ctrl.isAdmin(c) && existingTestimoni.IdWali != userID {
+		if !punyaIzin(c, services.IzinTestimoniModerasi) && existingTestimoni.IdWali != userID {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: Anda tidak memiliki akses untuk mengupdate testimoni ini"})
 			return
 		}
@@ -193,6 +186,8 @@
 		ratingStr := c.PostForm("rating")
 		status := c.PostForm("status")
 
+		sebelum := existingTestimoni
+
 		// Update fields
 		if komentar != "" {
 			existingTestimoni.Komentar = komentar
@@ -212,7 +207,7 @@
 		}
 
 		// Hanya admin yang bisa mengubah status
-		if status != "" && ctrl.isAdmin(c) {
+		if status != "" && punyaIzin(c, services.IzinTestimoniModerasi) {
 			// Validasi status
 			switch status {
 			case "show":
@@ -226,7 +221,7 @@
 		}
 
 		// Set diupdate_oleh_id hanya jika admin yang mengupdate
-		if ctrl.isAdmin(c) {
+		if punyaIzin(c, services.IzinTestimoniModerasi) {
 			existingTestimoni.DiupdateOlehID = &userID
 		}
 
@@ -239,6 +234,8 @@
 		// Preload relations untuk response
 		ctrl.db.Preload("Wali").Preload("DiupdateOleh").First(&existingTestimoni, "id_testimoni = ?", existingTestimoni.IDTestimoni)
 
+		catatLog(ctrl.db, c, services.AksiUpdate, services.TargetTestimoni, existingTestimoni.IDTestimoni, sebelum, existingTestimoni)
+
 		c.JSON(http.StatusOK, gin.H{
 			"message": "Testimoni berhasil diupdate",
 			"data":    existingTestimoni,
@@ -273,7 +270,7 @@
 		}
 
 		// Cek authorization: hanya admin atau pemilik testimoni yang bisa hapus
-		if !ctrl.isAdmin(c) && testimoni.IdWali != userID {
+		if !punyaIzin(c, services.IzinTestimoniModerasi) && testimoni.IdWali != userID {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: Anda tidak memiliki akses untuk menghapus testimoni ini"})
 			return
 		}
@@ -284,6 +281,8 @@
 			return
 		}
 
+		catatLog(ctrl.db, c, services.AksiDelete, services.TargetTestimoni, testimoni.IDTestimoni, testimoni, nil)
+
 		c.JSON(http.StatusOK, gin.H{
 			"message": "Testimoni berhasil dihapus",
 		})
@@ -292,7 +291,7 @@
 	// ShowTestimoni mengubah status testimoni menjadi show (hanya admin)
 	func (ctrl *TestimoniController) ShowTestimoni(c *gin.Context) {
 		// Hanya admin yang bisa mengubah status
-		if !ctrl.isAdmin(c) {
+		if !punyaIzin(c, services.IzinTestimoniModerasi) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat mengubah status testimoni"})
 			return
 		}
@@ -322,6 +321,8 @@
 			return
 		}
 
+		sebelum := testimoni
+
 		// Update status menjadi show
 		testimoni.Status = "show"
 		testimoni.DiupdateOlehID = &adminID
@@ -335,6 +336,8 @@
 		// Preload relations untuk response
 		ctrl.db.Preload("Wali").Preload("DiupdateOleh").First(&testimoni, "id_testimoni = ?", testimoni.IDTestimoni)
 
+		catatLog(ctrl.db, c, services.AksiUpdate, services.TargetTestimoni, testimoni.IDTestimoni, sebelum, testimoni)
+
 		c.JSON(http.StatusOK, gin.H{
 			"message": "Testimoni berhasil ditampilkan",
 			"data":    testimoni,
@@ -344,7 +347,7 @@
 	// HideTestimoni mengubah status testimoni menjadi hide (hanya admin)
 	func (ctrl *TestimoniController) HideTestimoni(c *gin.Context) {
 		// Hanya admin yang bisa mengubah status
-		if !ctrl.isAdmin(c) {
+		if !punyaIzin(c, services.IzinTestimoniModerasi) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat mengubah status testimoni"})
 			return
 		}
@@ -374,6 +377,8 @@
 			return
 		}
 
+		sebelum := testimoni
+
 		// Update status menjadi hide
 		testimoni.Status = "hide"
 		testimoni.DiupdateOlehID = &adminID
@@ -387,6 +392,8 @@
 		// Preload relations untuk response
 		ctrl.db.Preload("Wali").Preload("DiupdateOleh").First(&testimoni, "id_testimoni = ?", testimoni.IDTestimoni)
 
+		catatLog(ctrl.db, c, services.AksiUpdate, services.TargetTestimoni, testimoni.IDTestimoni, sebelum, testimoni)
+
 		c.JSON(http.StatusOK, gin.H{
 			"message": "Testimoni berhasil disembunyikan",
 			"data":    testimoni,
@@ -396,7 +403,7 @@
 	// GetAllTestimoni mendapatkan semua testimoni dengan filter (untuk admin)
 	func (ctrl *TestimoniController) GetAllTestimoni(c *gin.Context) {
 		// Hanya admin yang bisa akses semua data
-		if !ctrl.isAdmin(c) {
+		if !punyaIzin(c, services.IzinTestimoniModerasi) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: hanya admin yang dapat mengakses semua testimoni"})
 			return
 		}
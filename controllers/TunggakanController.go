@@ -0,0 +1,251 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type TunggakanController struct {
+	db *gorm.DB
+}
+
+func NewTunggakanController(db *gorm.DB) *TunggakanController {
+	return &TunggakanController{db: db}
+}
+
+// Request structs
+type KirimPengingatRequest struct {
+	Per               string   `json:"per"` // format YYYY-MM, default bulan berjalan
+	IDWali            []string `json:"id_wali"`
+	MinimalBulan      int      `json:"minimal_bulan"`
+	AbaikanMasaTenang bool     `json:"abaikan_masa_tenang"`
+	UjiCoba           bool     `json:"uji_coba"`
+}
+
+type PengaturanPengingatRequest struct {
+	MasaTenangHari int  `json:"masa_tenang_hari" binding:"required,min=1,max=90"`
+	Nonaktif       bool `json:"nonaktif"`
+}
+
+// periodeTunggakan membaca query "per" (YYYY-MM), default bulan berjalan
+func periodeTunggakan(c *gin.Context) (string, bool) {
+	per := c.DefaultQuery("per", time.Now().Format("2006-01"))
+	if _, err := time.Parse("2006-01", per); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format per tidak valid. Gunakan format YYYY-MM"})
+		return "", false
+	}
+	return per, true
+}
+
+// GetLaporanTunggakan menampilkan tunggakan per santri dan keluarga beserta kelompok umurnya (admin)
+func (ctrl *TunggakanController) GetLaporanTunggakan(c *gin.Context) {
+	per, ok := periodeTunggakan(c)
+	if !ok {
+		return
+	}
+
+	laporan, err := services.NewTunggakanService(ctrl.db).Laporan(per, c.Query("id_wali"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menyusun laporan tunggakan: " + err.Error()})
+		return
+	}
+
+	if umur := c.Query("umur"); umur != "" {
+		if umur != services.Umur1Bulan && umur != services.Umur2Sampai3 && umur != services.UmurLebihDari3 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Kelompok umur tidak valid. Gunakan '1', '2-3', atau '>3'"})
+			return
+		}
+		laporan.SaringUmur(umur)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": laporan})
+}
+
+// GetMyTunggakan menampilkan tunggakan santri milik wali yang login
+func (ctrl *TunggakanController) GetMyTunggakan(c *gin.Context) {
+	per, ok := periodeTunggakan(c)
+	if !ok {
+		return
+	}
+
+	laporan, err := services.NewTunggakanService(ctrl.db).Laporan(per, c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menyusun data tunggakan: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"per":             laporan.Per,
+			"total_tunggakan": laporan.TotalTunggakan,
+			"santri":          laporan.Santri,
+		},
+	})
+}
+
+// KirimPengingat mengirim pengingat tunggakan ke wali dengan menghormati masa tenang masing-masing
+func (ctrl *TunggakanController) KirimPengingat(c *gin.Context) {
+	var req KirimPengingatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Per != "" {
+		if _, err := time.Parse("2006-01", req.Per); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Format per tidak valid. Gunakan format YYYY-MM"})
+			return
+		}
+	}
+
+	adminID := c.GetString("user_id")
+	hasil, err := services.NewPengingatService(ctrl.db, services.DefaultNotifier()).Kirim(services.OpsiPengingat{
+		Per:           req.Per,
+		IDWali:        req.IDWali,
+		MinimalBulan:  req.MinimalBulan,
+		AbaikanTenang: req.AbaikanMasaTenang,
+		UjiCoba:       req.UjiCoba,
+		DipicuOleh:    &adminID,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengirim pengingat: " + err.Error()})
+		return
+	}
+
+	message := fmt.Sprintf("%d pengingat terkirim, %d gagal, %d dilewati", len(hasil.Terkirim), len(hasil.Gagal), len(hasil.Dilewati))
+	if req.UjiCoba {
+		message = fmt.Sprintf("Uji coba: %d pengingat akan dikirim, %d dilewati", len(hasil.Terkirim), len(hasil.Dilewati))
+	} else {
+		catatLogKeterangan(ctrl.db, adminID, services.AksiKirimPengingat, services.TargetPengingat, "",
+			fmt.Sprintf("Pengingat tunggakan per %s: %s", hasil.Per, message))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"data":    hasil,
+	})
+}
+
+// GetRiwayatPengingat menampilkan pengingat yang pernah dikirim dengan filter wali dan status
+func (ctrl *TunggakanController) GetRiwayatPengingat(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	query := ctrl.db.Model(&models.PengingatTunggakan{})
+	if idWali := c.Query("id_wali"); idWali != "" {
+		query = query.Where("id_wali = ?", idWali)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghitung total data: " + err.Error()})
+		return
+	}
+
+	var riwayat []models.PengingatTunggakan
+	offset := (page - 1) * limit
+	if err := query.Preload("Wali").Order("dikirim_pada DESC").Offset(offset).Limit(limit).Find(&riwayat).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil riwayat pengingat: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": riwayat,
+		"meta": gin.H{
+			"page":       page,
+			"limit":      limit,
+			"total":      total,
+			"total_page": (int(total) + limit - 1) / limit,
+		},
+	})
+}
+
+// pengaturanPengingat membaca pengaturan pengingat wali, atau nilai bawaan jika belum diatur
+func (ctrl *TunggakanController) pengaturanPengingat(c *gin.Context, idWali string) {
+	hari, nonaktif, err := services.NewPengingatService(ctrl.db, services.DefaultNotifier()).MasaTenang(idWali)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil pengaturan pengingat: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data": models.PengaturanPengingat{IDWali: idWali, MasaTenangHari: hari, Nonaktif: nonaktif},
+	})
+}
+
+// simpanPengaturanPengingat menyimpan masa tenang dan status pengingat untuk satu wali
+func (ctrl *TunggakanController) simpanPengaturanPengingat(c *gin.Context, idWali string) {
+	var req PengaturanPengingatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var wali models.User
+	if err := ctrl.db.Select("id_user").First(&wali, "id_user = ?", idWali).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Wali tidak ditemukan"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data wali: " + err.Error()})
+		return
+	}
+
+	var sebelum *models.PengaturanPengingat
+	var lama models.PengaturanPengingat
+	if err := ctrl.db.First(&lama, "id_wali = ?", idWali).Error; err == nil {
+		sebelum = &lama
+	}
+
+	pengaturan := models.PengaturanPengingat{
+		IDWali:         idWali,
+		MasaTenangHari: req.MasaTenangHari,
+		Nonaktif:       req.Nonaktif,
+	}
+	if err := ctrl.db.Save(&pengaturan).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menyimpan pengaturan pengingat: " + err.Error()})
+		return
+	}
+
+	catatLog(ctrl.db, c, services.AksiUpdate, services.TargetPengingat, idWali, sebelum, pengaturan)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Pengaturan pengingat berhasil disimpan",
+		"data":    pengaturan,
+	})
+}
+
+// GetPengaturanPengingatSaya menampilkan pengaturan pengingat wali yang login
+func (ctrl *TunggakanController) GetPengaturanPengingatSaya(c *gin.Context) {
+	ctrl.pengaturanPengingat(c, c.GetString("user_id"))
+}
+
+// UpdatePengaturanPengingatSaya mengubah masa tenang atau menonaktifkan pengingat untuk wali yang login
+func (ctrl *TunggakanController) UpdatePengaturanPengingatSaya(c *gin.Context) {
+	ctrl.simpanPengaturanPengingat(c, c.GetString("user_id"))
+}
+
+// GetPengaturanPengingatWali menampilkan pengaturan pengingat satu wali (admin)
+func (ctrl *TunggakanController) GetPengaturanPengingatWali(c *gin.Context) {
+	ctrl.pengaturanPengingat(c, c.Param("id_wali"))
+}
+
+// UpdatePengaturanPengingatWali mengubah pengaturan pengingat satu wali (admin)
+func (ctrl *TunggakanController) UpdatePengaturanPengingatWali(c *gin.Context) {
+	ctrl.simpanPengaturanPengingat(c, c.Param("id_wali"))
+}
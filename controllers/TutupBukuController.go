@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type TutupBukuController struct {
+	db *gorm.DB
+}
+
+func NewTutupBukuController(db *gorm.DB) *TutupBukuController {
+	return &TutupBukuController{db: db}
+}
+
+type BukaTutupBukuRequest struct {
+	Alasan string `json:"alasan" binding:"required"`
+}
+
+type KoreksiSaldoRequest struct {
+	PeriodeAcuan string             `json:"periode_acuan" binding:"required"` // periode tutup buku yang dikoreksi
+	Dana         models.DanaKoreksi `json:"dana" binding:"required"`
+	Nominal      float64            `json:"nominal" binding:"required"` // positif menambah saldo, negatif mengurangi
+	Keterangan   string             `json:"keterangan" binding:"required"`
+}
+
+// balasPeriodeDitutup membalas 409 jika err berasal dari perubahan pada periode yang sudah tutup buku
+func balasPeriodeDitutup(c *gin.Context, err error) bool {
+	if errors.Is(err, services.ErrPeriodeDitutup) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return true
+	}
+	return false
+}
+
+// tolakPeriodeDitutup memeriksa sebelum perubahan bahwa tidak ada periode yang sudah tutup buku.
+// Mengembalikan true jika request sudah dibalas.
+func tolakPeriodeDitutup(c *gin.Context, db *gorm.DB, periode ...string) bool {
+	err := services.CekPeriodeTerbuka(db, periode...)
+	if err == nil {
+		return false
+	}
+	if !balasPeriodeDitutup(c, err) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal memeriksa tutup buku: " + err.Error()})
+	}
+	return true
+}
+
+// GetTutupBuku menampilkan periode yang sudah tutup buku, terbaru lebih dulu
+func (ctrl *TutupBukuController) GetTutupBuku(c *gin.Context) {
+	var rekapList []models.RekapSaldo
+	if err := ctrl.db.Where("ditutup = ?", true).Order("periode DESC").Find(&rekapList).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data tutup buku: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": rekapList})
+}
+
+// TutupBuku menutup satu periode sehingga transaksi di dalamnya tidak dapat diubah lagi
+func (ctrl *TutupBukuController) TutupBuku(c *gin.Context) {
+	periode := c.Param("periode")
+	userID := c.GetString("user_id")
+
+	rekap, err := services.NewTutupBukuService(ctrl.db).Tutup(periode, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrPeriodeDitutup), errors.Is(err, services.ErrPeriodeSebelumnyaTerbuka):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrPeriodeBelumBerakhir):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal tutup buku: " + err.Error()})
+		}
+		return
+	}
+
+	catatLogKeterangan(ctrl.db, userID, services.AksiTutupBuku, services.TargetRekapSaldo, rekap.IDSaldo,
+		fmt.Sprintf("Tutup buku periode %s, saldo akhir %s", periode, services.FormatRupiah(rekap.SaldoAkhirTotal)))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Periode " + periode + " berhasil ditutup",
+		"data":    rekap,
+	})
+}
+
+// BukaTutupBuku membuka kembali periode tutup buku terakhir (super_admin), alasan wajib dicatat
+func (ctrl *TutupBukuController) BukaTutupBuku(c *gin.Context) {
+	periode := c.Param("periode")
+
+	var req BukaTutupBukuRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Alasan membuka kembali periode wajib diisi"})
+		return
+	}
+
+	rekap, err := services.NewTutupBukuService(ctrl.db).Buka(periode)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrPeriodeBelumDitutup):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrBukanTutupBukuTerakhir):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membuka tutup buku: " + err.Error()})
+		}
+		return
+	}
+
+	catatLogKeterangan(ctrl.db, c.GetString("user_id"), services.AksiBukaTutupBuku, services.TargetRekapSaldo, rekap.IDSaldo,
+		fmt.Sprintf("Buka kembali tutup buku periode %s: %s", periode, req.Alasan))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Periode " + periode + " dibuka kembali",
+		"data":    rekap,
+	})
+}
+
+// CreateKoreksiSaldo mencatat koreksi atas periode tutup buku di periode berjalan
+func (ctrl *TutupBukuController) CreateKoreksiSaldo(c *gin.Context) {
+	var req KoreksiSaldoRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Dana != models.DanaSyahriah && req.Dana != models.DanaDonasi {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dana tidak valid. Gunakan 'syahriah' atau 'donasi'"})
+		return
+	}
+
+	userID := c.GetString("user_id")
+	koreksi, err := services.NewTutupBukuService(ctrl.db).Koreksi(req.PeriodeAcuan, req.Dana, req.Nominal, req.Keterangan, userID)
+	if err != nil {
+		if errors.Is(err, services.ErrPeriodeBelumDitutup) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mencatat koreksi saldo: " + err.Error()})
+		return
+	}
+
+	catatLog(ctrl.db, c, services.AksiCreate, services.TargetKoreksiSaldo, koreksi.IDKoreksi, nil, koreksi)
+
+	updateRekapMulai(ctrl.db, koreksi.Periode)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Koreksi saldo berhasil dicatat",
+		"data":    koreksi,
+	})
+}
+
+// GetAllKoreksiSaldo menampilkan koreksi saldo, bisa difilter per periode acuan
+func (ctrl *TutupBukuController) GetAllKoreksiSaldo(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	query := ctrl.db.Model(&models.KoreksiSaldo{})
+	if periodeAcuan := c.Query("periode_acuan"); periodeAcuan != "" {
+		query = query.Where("periode_acuan = ?", periodeAcuan)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghitung total data: " + err.Error()})
+		return
+	}
+
+	var koreksiList []models.KoreksiSaldo
+	offset := (page - 1) * limit
+	if err := query.Preload("Admin").Order("dibuat_pada DESC").Offset(offset).Limit(limit).Find(&koreksiList).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal mengambil data koreksi saldo: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": koreksiList,
+		"meta": gin.H{
+			"page":       page,
+			"limit":      limit,
+			"total":      total,
+			"total_page": (int(total) + limit - 1) / limit,
+		},
+	})
+}
@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"tpq_asysyafii/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// konteksUji membuat gin.Context untuk memanggil handler langsung sebagai user yang sudah login,
+// atau sebagai pengunjung jika user nil
+func konteksUji(method, path string, body interface{}, user *models.User) (*gin.Context, *httptest.ResponseRecorder) {
+	var isi bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&isi).Encode(body)
+	}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, path, &isi)
+	c.Request.Header.Set("Content-Type", "application/json")
+	if user != nil {
+		c.Set("user_id", user.IDUser)
+		c.Set("role", string(user.Role))
+	}
+	return c, w
+}
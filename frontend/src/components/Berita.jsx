@@ -214,7 +214,7 @@ const BeritaList = () => {
                     </h3>
                     
                     <p className="text-green-600 mb-4 line-clamp-3">
-                      {item.konten?.substring(0, 120)}...
+                      {item.ringkasan}
                     </p>
                     
                     <div className="flex items-center justify-between text-sm text-green-700 mb-4">
@@ -301,13 +301,11 @@ const BeritaDetail = () => {
 
               {/* Content */}
               <div className="p-8">
-                <div className="prose prose-lg max-w-none text-gray-700 leading-relaxed">
-                  {berita.konten?.split('\n').map((paragraph, index) => (
-                    <p key={index} className="mb-4">
-                      {paragraph}
-                    </p>
-                  ))}
-                </div>
+                {/* konten_html sudah disaring di server */}
+                <div
+                  className="prose prose-lg max-w-none text-gray-700 leading-relaxed"
+                  dangerouslySetInnerHTML={{ __html: berita.konten_html || '' }}
+                />
 
                 {/* Article Footer */}
                 <div className="mt-8 pt-6 border-t border-gray-200">
@@ -72,7 +72,7 @@ const BeritaPage = () => {
   // Filter berita berdasarkan search dan kategori
   const filteredBerita = berita.filter(item => {
     const matchesSearch = item.judul.toLowerCase().includes(searchTerm.toLowerCase()) ||
-                         item.konten.toLowerCase().includes(searchTerm.toLowerCase());
+                         (item.ringkasan || '').toLowerCase().includes(searchTerm.toLowerCase());
     const matchesKategori = kategoriFilter === 'all' || item.kategori === kategoriFilter;
     
     return matchesSearch && matchesKategori;
@@ -311,7 +311,7 @@ const BeritaPage = () => {
                         </h3>
                         
                         <p className="text-green-600 mb-4 line-clamp-3">
-                          {item.konten?.substring(0, 120)}...
+                          {item.ringkasan}
                         </p>
                         
                         <div className="flex items-center justify-between text-sm text-green-700 mb-4">
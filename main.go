@@ -7,13 +7,16 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path"
 	"path/filepath"
 	"strings"
 	"syscall"
 	"time"
 
 	"tpq_asysyafii/config"
+	"tpq_asysyafii/controllers"
 	"tpq_asysyafii/routes"
+	"tpq_asysyafii/services"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -24,6 +27,11 @@ func main() {
 	// Load environment variables
 	_ = godotenv.Load()
 
+	// Subcommand CLI (misalnya cek-integritas) dijalankan tanpa menyalakan server
+	if len(os.Args) > 1 {
+		os.Exit(jalankanPerintah(os.Args[1:]))
+	}
+
 	// ⚡ SET GIN MODE RELEASE untuk performance
 	gin.SetMode(gin.ReleaseMode)
 
@@ -77,21 +85,28 @@ func main() {
 		})
 	})
 
-	// Static files dengan path yang benar
+	// Static files media library (storage lokal), termasuk gambar lama di image/berita dan image/tpq.
+	// Berkas tidak pernah ditimpa (nama berupa hash atau UUID), jadi aman di-cache lama.
 	workDir, _ := os.Getwd()
-	beritaPath := filepath.Join(workDir, "image", "berita")
-	tpqPath := filepath.Join(workDir, "image", "tpq")
+	mediaPath := services.DirMediaLokal()
+	if !filepath.IsAbs(mediaPath) {
+		mediaPath = filepath.Join(workDir, mediaPath)
+	}
 	
 	// Pastikan directory exists atau buat
-	os.MkdirAll(beritaPath, 0755)
-	os.MkdirAll(tpqPath, 0755)
+	os.MkdirAll(mediaPath, 0755)
 	
-	r.Static("/image/berita", beritaPath)
-	r.Static("/image/tpq", tpqPath)
+	media := r.Group("/image", func(c *gin.Context) {
+		// Hanya berkas yang ada yang di-cache lama, supaya 404 tidak ikut tersimpan di browser/CDN
+		berkas := filepath.Join(mediaPath, filepath.FromSlash(path.Clean("/"+c.Param("filepath"))))
+		if info, err := os.Stat(berkas); err == nil && !info.IsDir() {
+			c.Header("Cache-Control", services.CacheControlMedia)
+		}
+	})
+	media.Static("/", mediaPath)
 
 	log.Printf("Working directory: %s", workDir)
-	log.Printf("Berita image path: %s", beritaPath)
-	log.Printf("TPQ image path: %s", tpqPath)
+	log.Printf("Media path: %s", mediaPath)
 
 	// CORS setup
 	allowedOrigins := getOriginsFromEnv()
@@ -115,8 +130,12 @@ func main() {
 		log.Printf("✅ Database connected successfully")
 	}
 
+	// ✅ SCHEDULER JOB RUTIN - hanya instance pemegang kunci yang menjalankan job
+	scheduler := services.NewScheduler(config.GetDB())
+	controllers.DaftarkanJobBawaan(scheduler, config.GetDB())
+
 	// ✅ REGISTER ROUTES - bahkan jika DB gagal
-	routes.SetupRoutes(r)
+	routes.SetupRoutes(r, scheduler)
 
 	// Port setup
 	port := os.Getenv("PORT")
@@ -145,6 +164,11 @@ func main() {
 		}
 	}()
 
+	// SCHEDULER_AKTIF=false mematikan job rutin di instance ini
+	if os.Getenv("SCHEDULER_AKTIF") != "false" {
+		scheduler.Mulai()
+	}
+
 	// Wait for interrupt signal to gracefully shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -158,6 +182,13 @@ func main() {
 	if err := server.Shutdown(ctxShutdown); err != nil {
 		log.Fatalf("❌ Server forced to shutdown: %v", err)
 	}
+
+	// Tunggu job yang sedang berjalan sebelum koneksi DB ditutup
+	if err := scheduler.Berhenti(ctxShutdown); err != nil {
+		log.Printf("⚠️ %v", err)
+	} else {
+		log.Println("✅ Scheduler stopped")
+	}
 	
 	// Close DB connection if exists
 	if config.GetDB() != nil {
@@ -3,6 +3,8 @@ package middlewares
 import (
 	"net/http"
 	"strings"
+	"tpq_asysyafii/config"
+	"tpq_asysyafii/services"
 	"tpq_asysyafii/utils"
 
 	"github.com/gin-gonic/gin"
@@ -31,52 +33,27 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// Simpan ke context
-		if userID, ok := claims["user_id"].(string); ok {
-			c.Set("user_id", userID)
-		}
-		if role, ok := claims["role"].(string); ok {
-			c.Set("role", role)
-		}
-
-		c.Next()
-	}
-}
-
-// Middleware hanya untuk admin
-func AdminMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		role, exists := c.Get("role")
-		if !exists || role != "admin" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Hanya admin yang bisa mengakses"})
+		if config.DB == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database tidak tersedia"})
 			c.Abort()
 			return
 		}
-		c.Next()
-	}
-}
 
-// Middleware hanya untuk superadmin
-func SuperAdminMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		role, exists := c.Get("role")
-		if !exists || role != "super_admin" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Hanya super admin yang bisa mengakses"})
+		// Cek ke server: user aktif, token belum dicabut, dan sesi belum logout
+		user, err := services.NewTokenService(config.DB).ValidasiAkses(claims)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token tidak valid: " + err.Error()})
 			c.Abort()
 			return
 		}
+
+		// Simpan ke context (role diambil dari database agar perubahan role langsung berlaku)
+		c.Set("user_id", user.IDUser)
+		c.Set("role", string(user.Role))
+		if sesiID, ok := claims["sid"].(string); ok && sesiID != "" {
+			c.Set("session_id", sesiID)
+		}
+
 		c.Next()
 	}
 }
-
-func AdminOrSuperAdminMiddleware() gin.HandlerFunc {
-    return func(c *gin.Context) {
-        role, exists := c.Get("role")
-        if !exists || (role != "admin" && role != "super_admin") {
-            c.JSON(http.StatusForbidden, gin.H{"error": "Hanya admin atau super admin yang bisa mengakses"})
-            c.Abort()
-            return
-        }
-        c.Next()
-    }
-}
\ No newline at end of file
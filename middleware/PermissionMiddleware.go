@@ -0,0 +1,24 @@
+package middlewares
+
+import (
+	"net/http"
+	"tpq_asysyafii/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission hanya meneruskan request jika role user memiliki semua izin yang diminta.
+// Harus dipasang setelah AuthMiddleware.
+func RequirePermission(izin ...services.Izin) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+		for _, i := range izin {
+			if !services.PunyaIzin(role, i) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden: tidak memiliki izin " + string(i)})
+				c.Abort()
+				return
+			}
+		}
+		c.Next()
+	}
+}
@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type KategoriBerita string
 
@@ -15,19 +19,36 @@ type StatusBerita string
 const (
 	StatusDraft     StatusBerita = "draft"
 	StatusPublished StatusBerita = "published"
+	StatusScheduled StatusBerita = "scheduled" // terbit otomatis pada JadwalTerbit
 	StatusArsip     StatusBerita = "arsip"
 )
 
+// FormatKonten adalah format sumber konten berita dan pengumuman. Keduanya dirender
+// menjadi HTML yang sudah disaring sebelum disimpan.
+type FormatKonten string
+
+const (
+	FormatMarkdown FormatKonten = "markdown"
+	FormatHTML     FormatKonten = "html"
+)
+
 type Berita struct {
 	IDBerita        string         `json:"id_berita" gorm:"column:id_berita;primaryKey;type:char(36)"`
 	Judul           string         `json:"judul" gorm:"type:varchar(200);not null"`
 	Slug            string         `json:"slug" gorm:"type:varchar(255);not null;unique"`
-	Konten          string         `json:"konten" gorm:"type:text;not null"`
+	Konten          string         `json:"-" gorm:"type:text;not null"` // sumber sesuai FormatKonten, hanya dikirim ke form edit admin
+	FormatKonten    FormatKonten   `json:"format_konten" gorm:"type:enum('markdown','html');default:'markdown'"`
+	KontenHTML      string         `json:"konten_html" gorm:"type:mediumtext"` // hasil render yang aman ditampilkan
+	Ringkasan       string         `json:"ringkasan" gorm:"type:varchar(300)"`
+	WaktuBaca       int            `json:"waktu_baca" gorm:"not null;default:0"` // menit
 	Kategori        KategoriBerita `json:"kategori" gorm:"type:enum('umum','pengumuman','acara');default:'umum'"`
-	Status          StatusBerita   `json:"status" gorm:"type:enum('draft','published','arsip');default:'draft'"`
-	GambarCover     *string        `json:"gambar_cover,omitempty" gorm:"type:varchar(255)"`
+	Status          StatusBerita   `json:"status" gorm:"type:enum('draft','published','scheduled','arsip');default:'draft'"`
+	GambarCover     *string        `json:"gambar_cover,omitempty" gorm:"type:varchar(255)"` // URL dari media IDGambarCover
+	IDGambarCover   *string        `json:"id_gambar_cover,omitempty" gorm:"column:id_gambar_cover;type:char(36);index"`
+	GambarCoverVarian VarianGambar `json:"gambar_cover_varian" gorm:"embedded;embeddedPrefix:gambar_cover_"`
 	PenulisID       string         `json:"penulis_id" gorm:"column:penulis_id;type:char(36);not null"`
 	TanggalPublikasi *time.Time    `json:"tanggal_publikasi,omitempty" gorm:"type:timestamp"`
+	JadwalTerbit    *time.Time     `json:"jadwal_terbit,omitempty" gorm:"type:timestamp;index"`
 	DibuatPada      time.Time      `json:"dibuat_pada" gorm:"autoCreateTime"`
 	DiperbaruiPada  time.Time      `json:"diperbarui_pada" gorm:"autoUpdateTime"`
 	
@@ -36,4 +57,12 @@ type Berita struct {
 
 func (Berita) TableName() string {
 	return "berita"
+}
+
+// AfterFind memastikan response selalu punya URL semua varian gambar cover
+func (b *Berita) AfterFind(tx *gorm.DB) error {
+	if b.GambarCover != nil {
+		lengkapiVarian(&b.GambarCoverVarian, *b.GambarCover)
+	}
+	return nil
 }
\ No newline at end of file
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// BeritaRevisi adalah salinan isi berita setelah setiap perubahan. Nomor berurutan per berita,
+// revisi terbaru selalu sama dengan isi berita saat ini.
+type BeritaRevisi struct {
+	IDRevisi      string         `json:"id_revisi" gorm:"column:id_revisi;primaryKey;type:char(36)"`
+	IDBerita      string         `json:"id_berita" gorm:"column:id_berita;type:char(36);not null;uniqueIndex:idx_berita_revisi_nomor"`
+	Nomor         int            `json:"nomor" gorm:"not null;uniqueIndex:idx_berita_revisi_nomor"`
+	Judul         string         `json:"judul" gorm:"type:varchar(200);not null"`
+	Konten        string         `json:"konten,omitempty" gorm:"type:text;not null"`
+	FormatKonten  FormatKonten   `json:"format_konten" gorm:"type:enum('markdown','html');default:'markdown'"`
+	Kategori      KategoriBerita `json:"kategori" gorm:"type:enum('umum','pengumuman','acara')"`
+	GambarCover   *string        `json:"gambar_cover,omitempty" gorm:"type:varchar(255)"`
+	IDGambarCover *string        `json:"id_gambar_cover,omitempty" gorm:"column:id_gambar_cover;type:char(36)"`
+	Keterangan    string         `json:"keterangan" gorm:"type:varchar(255)"` // misalnya "Dipulihkan dari revisi 3"
+	DiubahOleh    string         `json:"diubah_oleh" gorm:"type:char(36);not null"`
+	DibuatPada    time.Time      `json:"dibuat_pada" gorm:"autoCreateTime"`
+
+	Pengubah User `json:"pengubah,omitempty" gorm:"foreignKey:DiubahOleh;references:IDUser"`
+}
+
+func (BeritaRevisi) TableName() string {
+	return "berita_revisi"
+}
@@ -2,13 +2,23 @@ package models
 
 import "time"
 
+// TampilanNama menentukan bagaimana nama donatur ditampilkan di halaman publik
+type TampilanNama string
+
+const (
+	TampilkanNama    TampilanNama = "nama"    // nama lengkap
+	TampilkanInisial TampilanNama = "inisial" // hanya inisial, misalnya "A. F."
+	TampilkanAnonim  TampilanNama = "anonim"  // ditampilkan sebagai "Hamba Allah"
+)
+
 type Donasi struct {
-	IDDonasi    string    `json:"id_donasi" gorm:"type:char(36);primaryKey"`
-	NamaDonatur string    `json:"nama_donatur" gorm:"type:varchar(100)"`
-	NoTelp      string    `json:"no_telp"`
-	Nominal     float64   `json:"nominal" gorm:"type:decimal(12,2);not null;check:nominal > 0"`
-	DicatatOleh string    `json:"dicatat_oleh" gorm:"type:char(36);not null"`
-	WaktuCatat  time.Time `json:"waktu_catat" gorm:"autoCreateTime"`
+	IDDonasi     string       `json:"id_donasi" gorm:"type:char(36);primaryKey"`
+	NamaDonatur  string       `json:"nama_donatur" gorm:"type:varchar(100)"`
+	NoTelp       string       `json:"no_telp"`
+	TampilanNama TampilanNama `json:"tampilan_nama" gorm:"type:enum('nama','inisial','anonim');not null;default:'anonim'"` // data lama otomatis anonim
+	Nominal      float64      `json:"nominal" gorm:"type:decimal(12,2);not null;check:nominal > 0"`
+	DicatatOleh  string       `json:"dicatat_oleh" gorm:"type:char(36);not null"`
+	WaktuCatat   time.Time    `json:"waktu_catat" gorm:"autoCreateTime"`
 
 	Admin User `json:"admin" gorm:"foreignKey:DicatatOleh;references:IDUser"`
 }
@@ -0,0 +1,24 @@
+package models
+
+type TipeKontenPencarian string
+
+const (
+	PencarianBerita     TipeKontenPencarian = "berita"
+	PencarianPengumuman TipeKontenPencarian = "pengumuman"
+	PencarianProgram    TipeKontenPencarian = "program_unggulan"
+	PencarianFasilitas  TipeKontenPencarian = "fasilitas"
+)
+
+// IndeksPencarian adalah inverted index konten publik: satu baris per kata dasar per konten.
+// Bobot adalah jumlah kemunculan kata, kemunculan di judul dihitung lebih berat.
+// Status dan masa tampil konten tidak disimpan di sini, melainkan dicek dari tabel asal saat mencari.
+type IndeksPencarian struct {
+	Tipe     TipeKontenPencarian `json:"tipe" gorm:"type:varchar(20);primaryKey"`
+	IDKonten string              `json:"id_konten" gorm:"column:id_konten;type:char(36);primaryKey"`
+	Term     string              `json:"term" gorm:"type:varchar(64);primaryKey;index:idx_indeks_pencarian_term"`
+	Bobot    int                 `json:"bobot" gorm:"not null;default:1"`
+}
+
+func (IndeksPencarian) TableName() string {
+	return "indeks_pencarian"
+}
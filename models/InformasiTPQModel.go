@@ -6,7 +6,8 @@ type InformasiTPQ struct {
 	IDTPQ           string     `json:"id_tpq" gorm:"column:id_tpq;primaryKey;type:char(36)"`
 	NamaTPQ         string     `json:"nama_tpq" gorm:"type:varchar(200);not null"`
 	Tempat          *string    `json:"tempat,omitempty" gorm:"type:varchar(200)"`
-	Logo            *string    `json:"logo,omitempty" gorm:"type:varchar(255)"`
+	Logo            *string    `json:"logo,omitempty" gorm:"type:varchar(255)"` // URL dari media IDLogo
+	IDLogo          *string    `json:"id_logo,omitempty" gorm:"column:id_logo;type:char(36);index"`
 	Visi            *string    `json:"visi,omitempty" gorm:"type:text"`
 	Misi            *string    `json:"misi,omitempty" gorm:"type:text"`
 	Deskripsi       *string    `json:"deskripsi,omitempty" gorm:"type:text"`
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+type StatusJob string
+
+const (
+	JobBerjalan StatusJob = "berjalan"
+	JobSukses   StatusJob = "sukses"
+	JobGagal    StatusJob = "gagal"
+	JobDilewati StatusJob = "dilewati" // job yang sama sedang dijalankan instance lain
+)
+
+// JobRun mencatat satu kali eksekusi job terjadwal. Pasangan nama dan jadwal unik
+// sehingga satu jadwal hanya dijalankan sekali walaupun ada beberapa instance.
+type JobRun struct {
+	IDRun       string     `json:"id_run" gorm:"type:char(36);primaryKey"`
+	Nama        string     `json:"nama" gorm:"type:varchar(50);not null;uniqueIndex:idx_job_jadwal"`
+	Jadwal      time.Time  `json:"jadwal" gorm:"not null;uniqueIndex:idx_job_jadwal"` // waktu jadwal, atau waktu diminta untuk run manual
+	Manual      bool       `json:"manual" gorm:"not null;default:false"`
+	DipicuOleh  *string    `json:"dipicu_oleh,omitempty" gorm:"type:char(36)"`
+	Status      StatusJob  `json:"status" gorm:"type:enum('berjalan','sukses','gagal','dilewati');not null;default:'berjalan';index"`
+	Pesan       string     `json:"pesan" gorm:"type:text"`
+	Instance    string     `json:"instance" gorm:"type:varchar(100);not null"`
+	MulaiPada   time.Time  `json:"mulai_pada" gorm:"not null"`
+	SelesaiPada *time.Time `json:"selesai_pada"`
+	DurasiMs    int64      `json:"durasi_ms" gorm:"not null;default:0"`
+}
+
+func (JobRun) TableName() string {
+	return "job_run"
+}
+
+// KunciJob adalah lease antar instance: pemilik memegang kunci sampai BerlakuSampai
+// dan harus memperpanjangnya sebelum habis
+type KunciJob struct {
+	Nama          string    `json:"nama" gorm:"type:varchar(100);primaryKey"`
+	Pemilik       string    `json:"pemilik" gorm:"type:varchar(150);not null"` // instance, ditambah ID run untuk kunci job
+	BerlakuSampai time.Time `json:"berlaku_sampai" gorm:"not null"`
+}
+
+func (KunciJob) TableName() string {
+	return "kunci_job"
+}
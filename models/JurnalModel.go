@@ -0,0 +1,82 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Akun string
+
+const (
+	AkunKasSyahriah        Akun = "kas_syahriah"
+	AkunKasDonasi          Akun = "kas_donasi"
+	AkunPendapatanSyahriah Akun = "pendapatan_syahriah"
+	AkunPendapatanDonasi   Akun = "pendapatan_donasi"
+	AkunBebanOperasional   Akun = "beban_operasional"
+	AkunBebanInvestasi     Akun = "beban_investasi"
+	AkunBebanLainnya       Akun = "beban_lainnya"
+	AkunPenyesuaianSaldo   Akun = "penyesuaian_saldo"
+)
+
+// ErrJurnalImmutable dikembalikan jika ada yang mencoba mengubah atau menghapus jurnal.
+// Koreksi harus dilakukan dengan jurnal pembalik.
+var ErrJurnalImmutable = errors.New("jurnal tidak boleh diubah atau dihapus, gunakan jurnal pembalik")
+
+type Jurnal struct {
+	IDJurnal    string    `json:"id_jurnal" gorm:"type:char(36);primaryKey"`
+	Periode     string    `json:"periode" gorm:"type:varchar(7);not null;index"` // format YYYY-MM
+	Tanggal     time.Time `json:"tanggal" gorm:"not null"`
+	SumberTipe  string    `json:"sumber_tipe" gorm:"type:varchar(50);not null;index:idx_jurnal_sumber"`
+	SumberID    string    `json:"sumber_id" gorm:"type:char(36);not null;index:idx_jurnal_sumber"`
+	Keterangan  string    `json:"keterangan" gorm:"type:text"`
+	DicatatOleh string    `json:"dicatat_oleh" gorm:"type:char(36);not null"`
+	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
+
+	Entri []JurnalEntri `json:"entri" gorm:"foreignKey:IDJurnal;references:IDJurnal"`
+	Admin User          `json:"admin" gorm:"foreignKey:DicatatOleh;references:IDUser"`
+}
+
+func (Jurnal) TableName() string {
+	return "jurnal"
+}
+
+func (Jurnal) BeforeUpdate(tx *gorm.DB) error {
+	return ErrJurnalImmutable
+}
+
+func (Jurnal) BeforeDelete(tx *gorm.DB) error {
+	return ErrJurnalImmutable
+}
+
+type JurnalEntri struct {
+	IDEntri  string  `json:"id_entri" gorm:"type:char(36);primaryKey"`
+	IDJurnal string  `json:"id_jurnal" gorm:"type:char(36);not null;index"`
+	Akun     Akun    `json:"akun" gorm:"type:varchar(50);not null;index"`
+	Debit    float64 `json:"debit" gorm:"type:decimal(14,2);not null;default:0"`
+	Kredit   float64 `json:"kredit" gorm:"type:decimal(14,2);not null;default:0"`
+}
+
+func (JurnalEntri) TableName() string {
+	return "jurnal_entri"
+}
+
+func (JurnalEntri) BeforeUpdate(tx *gorm.DB) error {
+	return ErrJurnalImmutable
+}
+
+func (JurnalEntri) BeforeDelete(tx *gorm.DB) error {
+	return ErrJurnalImmutable
+}
+
+// KunciAkun adalah baris kunci per akun. Transaksi yang membaca lalu mengurangi saldo
+// mengunci baris ini (SELECT ... FOR UPDATE) agar pengecekan saldo tidak balapan.
+type KunciAkun struct {
+	Akun            Akun      `json:"akun" gorm:"type:varchar(50);primaryKey"`
+	TerakhirDikunci time.Time `json:"terakhir_dikunci"`
+}
+
+func (KunciAkun) TableName() string {
+	return "kunci_akun"
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+type DanaKoreksi string
+
+const (
+	DanaSyahriah DanaKoreksi = "syahriah"
+	DanaDonasi   DanaKoreksi = "donasi"
+)
+
+// KoreksiSaldo adalah koreksi atas periode yang sudah tutup buku. Koreksi dicatat di periode berjalan
+// (Periode) dengan menyebut periode yang dikoreksi (PeriodeAcuan), sehingga laporan yang sudah
+// disampaikan tidak berubah.
+type KoreksiSaldo struct {
+	IDKoreksi    string      `json:"id_koreksi" gorm:"type:char(36);primaryKey"`
+	Periode      string      `json:"periode" gorm:"type:varchar(7);not null;index"`
+	PeriodeAcuan string      `json:"periode_acuan" gorm:"type:varchar(7);not null"`
+	Dana         DanaKoreksi `json:"dana" gorm:"type:enum('syahriah','donasi');not null"`
+	Nominal      float64     `json:"nominal" gorm:"type:decimal(14,2);not null"` // positif menambah saldo, negatif mengurangi
+	Keterangan   string      `json:"keterangan" gorm:"type:text;not null"`
+	DicatatOleh  string      `json:"dicatat_oleh" gorm:"type:char(36);not null"`
+	DibuatPada   time.Time   `json:"dibuat_pada" gorm:"autoCreateTime"`
+
+	Admin User `json:"admin" gorm:"foreignKey:DicatatOleh;references:IDUser"`
+}
+
+func (KoreksiSaldo) TableName() string {
+	return "koreksi_saldo"
+}
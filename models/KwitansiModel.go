@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+type JenisKwitansi string
+
+const (
+	KwitansiSyahriah JenisKwitansi = "syahriah" // IDSumber = id_bayar di syahriah_bayar
+	KwitansiDonasi   JenisKwitansi = "donasi"   // IDSumber = id_donasi
+)
+
+type StatusKwitansi string
+
+const (
+	KwitansiBerlaku StatusKwitansi = "berlaku"
+	KwitansiBatal   StatusKwitansi = "batal" // pembayaran dihapus atau diubah sehingga kwitansi diterbitkan ulang
+)
+
+// Kwitansi adalah bukti pembayaran syahriah atau donasi. Isinya disalin saat diterbitkan
+// agar kwitansi tetap sama walaupun data user atau santri berubah kemudian.
+type Kwitansi struct {
+	IDKwitansi     string         `json:"id_kwitansi" gorm:"type:char(36);primaryKey"`
+	Nomor          string         `json:"nomor" gorm:"type:varchar(30);uniqueIndex;not null"`
+	Jenis          JenisKwitansi  `json:"jenis" gorm:"type:enum('syahriah','donasi');not null;index:idx_kwitansi_sumber"`
+	IDSumber       string         `json:"id_sumber" gorm:"type:char(36);not null;index:idx_kwitansi_sumber"`
+	IDWali         *string        `json:"id_wali,omitempty" gorm:"type:char(36);index"`
+	IDSantri       *string        `json:"id_santri,omitempty" gorm:"type:char(36);index"`
+	NamaPembayar   string         `json:"nama_pembayar" gorm:"type:varchar(100);not null"`
+	Nominal        float64        `json:"nominal" gorm:"type:decimal(12,2);not null"`
+	Keterangan     string         `json:"keterangan" gorm:"type:varchar(255);not null"`
+	NamaPenerima   string         `json:"nama_penerima" gorm:"type:varchar(100);not null"`
+	TanggalBayar   time.Time      `json:"tanggal_bayar" gorm:"not null"`
+	KodeVerifikasi string         `json:"kode_verifikasi" gorm:"type:varchar(20);uniqueIndex;not null"`
+	Status         StatusKwitansi `json:"status" gorm:"type:enum('berlaku','batal');not null;default:'berlaku';index"`
+	DibatalkanPada *time.Time     `json:"dibatalkan_pada,omitempty"`
+	DibuatPada     time.Time      `json:"dibuat_pada" gorm:"autoCreateTime"`
+}
+
+func (Kwitansi) TableName() string {
+	return "kwitansi"
+}
@@ -0,0 +1,69 @@
+package models
+
+import "time"
+
+type KategoriMedia string
+
+const (
+	KategoriMediaBerita KategoriMedia = "berita"
+	KategoriMediaLogo   KategoriMedia = "logo"
+	KategoriMediaSantri KategoriMedia = "santri"
+	KategoriMediaSosmed KategoriMedia = "sosmed"
+	KategoriMediaUmum   KategoriMedia = "umum"
+)
+
+// VarianGambar adalah URL setiap ukuran gambar hasil pemrosesan media
+type VarianGambar struct {
+	Thumbnail string `json:"thumbnail" gorm:"type:varchar(255)"`
+	Card      string `json:"card" gorm:"type:varchar(255)"`
+	Full      string `json:"full" gorm:"type:varchar(255)"`
+}
+
+// lengkapiVarian mengisi varian kosong dengan url gambar asli, untuk gambar yang dipasang
+// sebelum ada pemrosesan media
+func lengkapiVarian(v *VarianGambar, url string) {
+	if url == "" || *v != (VarianGambar{}) {
+		return
+	}
+	v.Thumbnail, v.Card, v.Full = url, url, url
+}
+
+// Media adalah berkas yang diunggah ke storage. Konten lain menyimpan IDMedia sekaligus URL-nya
+// agar tampilan publik tidak perlu join ke tabel media.
+// Kunci dan URL menunjuk varian full; nama berkas setiap varian adalah hash isinya.
+type Media struct {
+	IDMedia        string        `json:"id_media" gorm:"column:id_media;primaryKey;type:char(36)"`
+	NamaFile       string        `json:"nama_file" gorm:"type:varchar(255);not null"`    // nama file asli dari pengunggah
+	Kunci          string        `json:"kunci" gorm:"type:varchar(255);not null;unique"` // path objek di storage
+	URL            string        `json:"url" gorm:"type:varchar(255);not null"`
+	KunciCard      string        `json:"kunci_card" gorm:"type:varchar(255)"`
+	URLCard        string        `json:"url_card" gorm:"type:varchar(255)"`
+	KunciThumbnail string        `json:"kunci_thumbnail" gorm:"type:varchar(255)"`
+	URLThumbnail   string        `json:"url_thumbnail" gorm:"type:varchar(255)"`
+	TipeKonten     string        `json:"tipe_konten" gorm:"type:varchar(100);not null"`
+	Ukuran         int64         `json:"ukuran" gorm:"not null"` // byte, varian full
+	Lebar          int           `json:"lebar"`                  // piksel, varian full
+	Tinggi         int           `json:"tinggi"`
+	Kategori       KategoriMedia `json:"kategori" gorm:"type:enum('berita','logo','santri','sosmed','umum');default:'umum';index"`
+	Storage        string        `json:"storage" gorm:"type:varchar(20);not null"` // driver storage saat diunggah: local atau s3
+	DiunggahOleh   string        `json:"diunggah_oleh" gorm:"type:char(36);not null"`
+	DibuatPada     time.Time     `json:"dibuat_pada" gorm:"autoCreateTime"`
+
+	Pengunggah User `json:"pengunggah,omitempty" gorm:"foreignKey:DiunggahOleh;references:IDUser"`
+}
+
+// Varian mengembalikan URL semua varian; media lama tanpa varian memakai URL asli untuk semuanya
+func (m Media) Varian() VarianGambar {
+	v := VarianGambar{Thumbnail: m.URLThumbnail, Card: m.URLCard, Full: m.URL}
+	if v.Card == "" {
+		v.Card = m.URL
+	}
+	if v.Thumbnail == "" {
+		v.Thumbnail = v.Card
+	}
+	return v
+}
+
+func (Media) TableName() string {
+	return "media"
+}
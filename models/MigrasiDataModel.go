@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// MigrasiData menandai migrasi data sekali jalan yang sudah selesai agar tidak diulang pada startup berikutnya
+type MigrasiData struct {
+	Nama        string    `json:"nama" gorm:"type:varchar(100);primaryKey"`
+	SelesaiPada time.Time `json:"selesai_pada" gorm:"not null"`
+}
+
+func (MigrasiData) TableName() string {
+	return "migrasi_data"
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+type PasswordReset struct {
+	IDReset        string     `json:"id_reset" gorm:"type:char(36);primaryKey"`
+	IDUser         string     `json:"id_user" gorm:"type:char(36);not null;index"`
+	KodeHash       string     `json:"-" gorm:"type:char(64);not null"`
+	Kanal          string     `json:"kanal" gorm:"type:varchar(20);not null"`
+	Percobaan      int        `json:"percobaan" gorm:"not null;default:0"`
+	KadaluarsaPada time.Time  `json:"kadaluarsa_pada" gorm:"not null"`
+	DipakaiPada    *time.Time `json:"dipakai_pada" gorm:"null"`
+	IPAddress      string     `json:"ip_address" gorm:"type:varchar(45);index"` // IP peminta, untuk batas kode per IP
+	DibuatPada     time.Time  `json:"dibuat_pada" gorm:"autoCreateTime"`
+}
+
+func (PasswordReset) TableName() string {
+	return "password_reset"
+}
@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+type StatusPembayaran string
+
+const (
+	PembayaranMenunggu   StatusPembayaran = "menunggu"
+	PembayaranDibayar    StatusPembayaran = "dibayar"
+	PembayaranKadaluarsa StatusPembayaran = "kadaluarsa"
+	PembayaranDobel      StatusPembayaran = "dobel" // dana masuk tetapi syahriah sudah lunas, perlu refund
+)
+
+type MetodePembayaran string
+
+const (
+	MetodeQRIS           MetodePembayaran = "qris"
+	MetodeVirtualAccount MetodePembayaran = "va"
+)
+
+// Pembayaran adalah intent pembayaran online untuk satu atau beberapa syahriah
+type Pembayaran struct {
+	IDPembayaran    string           `json:"id_pembayaran" gorm:"type:char(36);primaryKey"`
+	IDWali          string           `json:"id_wali" gorm:"type:char(36);not null;index"`
+	Provider        string           `json:"provider" gorm:"type:varchar(30);not null;uniqueIndex:idx_provider_referensi"`
+	Referensi       string           `json:"referensi" gorm:"type:varchar(100);not null;uniqueIndex:idx_provider_referensi"`
+	Metode          MetodePembayaran `json:"metode" gorm:"type:enum('qris','va');not null"`
+	KodeBayar       string           `json:"kode_bayar" gorm:"type:text;not null"` // string QRIS atau nomor virtual account
+	Nominal         float64          `json:"nominal" gorm:"type:decimal(12,2);not null"`
+	NominalDiterima float64          `json:"nominal_diterima" gorm:"type:decimal(12,2);not null;default:0"`
+	Status          StatusPembayaran `json:"status" gorm:"type:enum('menunggu','dibayar','kadaluarsa','dobel');not null;default:'menunggu';index"`
+	Catatan         string           `json:"catatan" gorm:"type:text"`
+	KadaluarsaPada  time.Time        `json:"kadaluarsa_pada" gorm:"not null;index"`
+	DibayarPada     *time.Time       `json:"dibayar_pada" gorm:"null"`
+	DibuatPada      time.Time        `json:"dibuat_pada" gorm:"autoCreateTime"`
+
+	Wali  User             `json:"wali" gorm:"foreignKey:IDWali;references:IDUser"`
+	Items []PembayaranItem `json:"items" gorm:"foreignKey:IDPembayaran;references:IDPembayaran"`
+}
+
+func (Pembayaran) TableName() string {
+	return "pembayaran"
+}
+
+// PembayaranItem menghubungkan intent pembayaran dengan syahriah yang dibayar
+type PembayaranItem struct {
+	IDItem       string  `json:"id_item" gorm:"type:char(36);primaryKey"`
+	IDPembayaran string  `json:"id_pembayaran" gorm:"type:char(36);not null;index"`
+	IDSyahriah   string  `json:"id_syahriah" gorm:"type:char(36);not null;index"`
+	Nominal      float64 `json:"nominal" gorm:"type:decimal(12,2);not null"` // sisa tagihan saat intent dibuat
+
+	// Tanpa constraint: nama kolom sama di kedua tabel sehingga gorm menganggapnya has-one dan
+	// akan membuat foreign key terbalik (syahriah -> pembayaran_item)
+	Syahriah Syahriah `json:"syahriah" gorm:"foreignKey:IDSyahriah;references:IDSyahriah;constraint:-"`
+}
+
+func (PembayaranItem) TableName() string {
+	return "pembayaran_item"
+}
@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+type StatusPengingat string
+
+const (
+	PengingatTerkirim StatusPengingat = "terkirim"
+	PengingatGagal    StatusPengingat = "gagal"
+	PengingatMenunggu StatusPengingat = "menunggu" // sudah dicatat, pesan sedang dikirim
+)
+
+// PengingatTunggakan mencatat setiap pengingat tunggakan syahriah yang dikirim ke wali.
+// Pengingat terkirim atau yang sedang dikirim dipakai untuk menghitung masa tenang per wali.
+type PengingatTunggakan struct {
+	IDPengingat    string          `json:"id_pengingat" gorm:"type:char(36);primaryKey"`
+	IDWali         string          `json:"id_wali" gorm:"type:char(36);not null;index"`
+	Kanal          string          `json:"kanal" gorm:"type:varchar(20);not null"`
+	Tujuan         string          `json:"tujuan" gorm:"type:varchar(100);not null"`
+	Subjek         string          `json:"subjek" gorm:"type:varchar(255);not null"`
+	Isi            string          `json:"isi" gorm:"type:text;not null"`
+	JumlahBulan    int             `json:"jumlah_bulan" gorm:"not null"`
+	TotalTunggakan float64         `json:"total_tunggakan" gorm:"type:decimal(12,2);not null"`
+	Status         StatusPengingat `json:"status" gorm:"type:enum('terkirim','gagal','menunggu');not null;index"`
+	Galat          string          `json:"galat,omitempty" gorm:"type:text"`
+	DipicuOleh     *string         `json:"dipicu_oleh,omitempty" gorm:"type:char(36)"` // kosong jika dikirim job terjadwal
+	DikirimPada    time.Time       `json:"dikirim_pada" gorm:"not null;index"`
+
+	Wali User `json:"wali" gorm:"foreignKey:IDWali;references:IDUser"`
+}
+
+func (PengingatTunggakan) TableName() string {
+	return "pengingat_tunggakan"
+}
+
+// PengaturanPengingat menyimpan preferensi pengingat per wali. Wali tanpa baris pengaturan
+// memakai masa tenang bawaan.
+type PengaturanPengingat struct {
+	IDWali         string    `json:"id_wali" gorm:"type:char(36);primaryKey"`
+	MasaTenangHari int       `json:"masa_tenang_hari" gorm:"not null"`
+	Nonaktif       bool      `json:"nonaktif" gorm:"not null;default:false"`
+	DiperbaruiPada time.Time `json:"diperbarui_pada" gorm:"autoUpdateTime"`
+}
+
+func (PengaturanPengingat) TableName() string {
+	return "pengaturan_pengingat"
+}
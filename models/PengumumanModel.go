@@ -16,7 +16,11 @@ const (
 type Pengumuman struct {
 	IDPengumuman string            `json:"id_pengumuman" gorm:"type:char(36);primaryKey"`
 	Judul        string            `json:"judul" gorm:"type:varchar(255);not null"`
-	Isi          string            `json:"isi" gorm:"type:text;not null"`
+	Isi          string            `json:"-" gorm:"type:text;not null"` // sumber sesuai FormatIsi, hanya dikirim ke form edit admin
+	FormatIsi    FormatKonten      `json:"format_isi" gorm:"type:enum('markdown','html');default:'markdown'"`
+	IsiHTML      string            `json:"isi_html" gorm:"type:mediumtext"` // hasil render yang aman ditampilkan
+	Ringkasan    string            `json:"ringkasan" gorm:"type:varchar(300)"`
+	WaktuBaca    int               `json:"waktu_baca" gorm:"not null;default:0"` // menit
 	Tipe         TipePengumuman    `json:"tipe" gorm:"type:enum('publik','internal');default:'publik'"`
 	DibuatOleh   string            `json:"dibuat_oleh" gorm:"type:char(36);not null"`
 	TanggalDibuat time.Time        `json:"tanggal_dibuat" gorm:"autoCreateTime"`
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// PercobaanLogin mencatat login gagal per kunci, yaitu "akun:<hash identitas login>" atau "ip:<alamat ip>"
+type PercobaanLogin struct {
+	Kunci          string     `json:"kunci" gorm:"type:varchar(100);primaryKey"`
+	Gagal          int        `json:"gagal" gorm:"not null;default:0"`
+	TerakhirGagal  time.Time  `json:"terakhir_gagal"`
+	TerkunciSampai *time.Time `json:"terkunci_sampai" gorm:"null"`
+}
+
+func (PercobaanLogin) TableName() string {
+	return "percobaan_login"
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+type RefreshToken struct {
+	IDToken        string     `json:"id_token" gorm:"type:char(36);primaryKey"`
+	IDSesi         string     `json:"id_sesi" gorm:"type:char(36);not null;index"` // semua token hasil rotasi dalam satu login
+	IDUser         string     `json:"id_user" gorm:"type:char(36);not null;index"`
+	TokenHash      string     `json:"-" gorm:"type:char(64);not null;uniqueIndex"`
+	KadaluarsaPada time.Time  `json:"kadaluarsa_pada" gorm:"not null"`
+	DicabutPada    *time.Time `json:"dicabut_pada" gorm:"null"`
+	DigantiOleh    *string    `json:"diganti_oleh" gorm:"type:char(36);null"`
+	UserAgent      string     `json:"user_agent" gorm:"type:varchar(255)"`
+	IPAddress      string     `json:"ip_address" gorm:"type:varchar(45)"`
+	DibuatPada     time.Time  `json:"dibuat_pada" gorm:"autoCreateTime"`
+}
+
+func (RefreshToken) TableName() string {
+	return "refresh_token"
+}
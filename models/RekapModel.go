@@ -21,6 +21,11 @@ type RekapSaldo struct {
 	PengeluaranTotal   float64   `json:"pengeluaran_total" gorm:"type:decimal(14,2);default:0"`
 	SaldoAkhirTotal    float64   `json:"saldo_akhir_total" gorm:"type:decimal(14,2);default:0"`
 	
+	// Tutup buku: transaksi yang bertanggal di periode yang ditutup tidak dapat diubah
+	Ditutup            bool       `json:"ditutup" gorm:"default:false"`
+	DitutupPada        *time.Time `json:"ditutup_pada"`
+	DitutupOleh        *string    `json:"ditutup_oleh" gorm:"type:char(36)"`
+	
 	TerakhirUpdate     time.Time `json:"terakhir_update" gorm:"autoUpdateTime"`
 }
 
@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type StatusSantri string
 
@@ -26,7 +30,9 @@ type Santri struct {
 	TempatLahir     string        `json:"tempat_lahir" gorm:"type:varchar(50)"`
 	TanggalLahir    time.Time     `json:"tanggal_lahir" gorm:"type:date"`
 	Alamat          string        `json:"alamat" gorm:"type:text"`
-	Foto            string        `json:"foto" gorm:"type:varchar(255)"`
+	Foto            string        `json:"foto" gorm:"type:varchar(255)"` // URL dari media IDFoto
+	IDFoto          *string       `json:"id_foto,omitempty" gorm:"column:id_foto;type:char(36);index"`
+	FotoVarian      VarianGambar  `json:"foto_varian" gorm:"embedded;embeddedPrefix:foto_"`
 	Status          StatusSantri  `json:"status" gorm:"type:enum('aktif','lulus','pindah','berhenti');default:'aktif'"`
 	TanggalMasuk    time.Time     `json:"tanggal_masuk" gorm:"type:date"`
 	TanggalKeluar   *time.Time    `json:"tanggal_keluar,omitempty" gorm:"type:date"`
@@ -38,4 +44,10 @@ type Santri struct {
 
 func (Santri) TableName() string {
 	return "santri"
+}
+
+// AfterFind memastikan response selalu punya URL semua varian foto
+func (s *Santri) AfterFind(tx *gorm.DB) error {
+	lengkapiVarian(&s.FotoVarian, s.Foto)
+	return nil
 }
\ No newline at end of file
@@ -6,7 +6,8 @@ type SosialMedia struct {
 	IDSosmed       string    `json:"id_sosmed" gorm:"column:id_sosmed;primaryKey;type:char(36)"`
 	NamaSosmed     string    `json:"nama_sosmed" gorm:"type:varchar(100);not null"`
 	Username     string    `json:"username" gorm:"type:varchar(100);not null"`
-	IconSosmed     *string   `json:"icon_sosmed,omitempty" gorm:"type:varchar(255)"`
+	IconSosmed     *string   `json:"icon_sosmed,omitempty" gorm:"type:varchar(255)"` // URL dari media IDIcon
+	IDIcon         *string   `json:"id_icon,omitempty" gorm:"column:id_icon;type:char(36);index"`
 	LinkSosmed     *string   `json:"link_sosmed,omitempty" gorm:"type:varchar(500)"`
 	DiupdateOlehID *string   `json:"diupdate_oleh_id,omitempty" gorm:"column:diupdate_oleh_id;type:char(36)"`
 	DibuatPada     time.Time `json:"dibuat_pada" gorm:"autoCreateTime"`
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+type MetodeBayar string
+
+const (
+	BayarTunai    MetodeBayar = "tunai"
+	BayarTransfer MetodeBayar = "transfer"
+	BayarOnline   MetodeBayar = "online" // lewat payment gateway
+	BayarKredit   MetodeBayar = "kredit" // kelebihan bayar yang dipindahkan antar bulan, bukan uang masuk
+)
+
+// SyahriahBayar adalah satu kali pembayaran (cicilan) untuk sebuah syahriah.
+// Baris kredit berpasangan: nominal negatif di bulan asal dan positif di bulan tujuan.
+type SyahriahBayar struct {
+	IDBayar           string      `json:"id_bayar" gorm:"type:char(36);primaryKey"`
+	IDSyahriah        string      `json:"id_syahriah" gorm:"type:char(36);not null;index"`
+	Nominal           float64     `json:"nominal" gorm:"type:decimal(12,2);not null"`
+	Metode            MetodeBayar `json:"metode" gorm:"type:enum('tunai','transfer','online','kredit');not null"`
+	DiterimaOleh      *string     `json:"diterima_oleh" gorm:"type:char(36);null"` // kosong untuk pembayaran online dan kredit
+	WaktuBayar        time.Time   `json:"waktu_bayar" gorm:"not null;index"`
+	IDPembayaran      *string     `json:"id_pembayaran" gorm:"type:char(36);null;index"`
+	IDSyahriahTerkait *string     `json:"id_syahriah_terkait" gorm:"type:char(36);null;index"` // pasangan baris kredit
+	Keterangan        string      `json:"keterangan" gorm:"type:text"`
+	DibuatPada        time.Time   `json:"dibuat_pada" gorm:"autoCreateTime"`
+
+	Penerima *User `json:"penerima,omitempty" gorm:"foreignKey:DiterimaOleh;references:IDUser"`
+}
+
+func (SyahriahBayar) TableName() string {
+	return "syahriah_bayar"
+}
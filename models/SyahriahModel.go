@@ -4,22 +4,31 @@ import "time"
 
 type StatusSyahriah string
 
+// Status diturunkan dari total pembayaran, bukan diisi manual
 const (
-	StatusBelum StatusSyahriah = "belum"
-	StatusLunas StatusSyahriah = "lunas"
+	StatusBelum    StatusSyahriah = "belum"
+	StatusSebagian StatusSyahriah = "sebagian"
+	StatusLunas    StatusSyahriah = "lunas"
+	StatusLebih    StatusSyahriah = "lebih" // kelebihan belum bisa dipindahkan karena belum ada syahriah bulan berikutnya
 )
 
 type Syahriah struct {
 	IDSyahriah  string         `json:"id_syahriah" gorm:"type:char(36);primaryKey"`
-	ID_Santri    string         `json:"id_santri" gorm:"type:char(36);not null"`
-	Bulan       string         `json:"bulan" gorm:"type:varchar(7);not null"` // format YYYY-MM
-	Nominal     float64        `json:"nominal" gorm:"type:decimal(12,2);not null;default:110000"`
-	Status      StatusSyahriah `json:"status" gorm:"type:enum('belum','lunas');default:'belum'"`
+	ID_Santri    string         `json:"id_santri" gorm:"type:char(36);not null;uniqueIndex:idx_syahriah_santri_bulan"`
+	Bulan       string         `json:"bulan" gorm:"type:varchar(7);not null;uniqueIndex:idx_syahriah_santri_bulan"` // format YYYY-MM, satu syahriah per santri per bulan
+	Nominal     float64        `json:"nominal" gorm:"type:decimal(12,2);not null"`
+	NominalDasar float64       `json:"nominal_dasar" gorm:"type:decimal(12,2);not null;default:0"` // tarif dasar sebelum potongan
+	IDTarif     *string        `json:"id_tarif,omitempty" gorm:"type:char(36)"`
+	IDAturan    *string        `json:"id_aturan,omitempty" gorm:"type:char(36)"` // aturan tarif yang menentukan nominal
+	RincianTarif string        `json:"rincian_tarif" gorm:"type:varchar(255)"`
+	Status      StatusSyahriah `json:"status" gorm:"type:enum('belum','sebagian','lunas','lebih');default:'belum'"`
+	TotalBayar  float64        `json:"total_bayar" gorm:"type:decimal(12,2);not null;default:0"`
 	DicatatOleh string         `json:"dicatat_oleh" gorm:"type:char(36);not null"`
 	WaktuCatat  time.Time      `json:"waktu_catat" gorm:"autoCreateTime"`
 
 	Santri Santri `json:"santri" gorm:"foreignKey:ID_Santri;references:IDSantri"`
 	Admin  User   `json:"admin" gorm:"foreignKey:DicatatOleh;references:IDUser"`
+	Riwayat []SyahriahBayar `json:"riwayat_bayar,omitempty" gorm:"foreignKey:IDSyahriah;references:IDSyahriah"`
 }
 
 func (Syahriah) TableName() string {
@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// TarifDasar adalah nominal syahriah per bulan yang berlaku mulai periode tertentu
+// sampai digantikan tarif dasar dengan periode yang lebih baru
+type TarifDasar struct {
+	IDTarif      string    `json:"id_tarif" gorm:"type:char(36);primaryKey"`
+	BerlakuMulai string    `json:"berlaku_mulai" gorm:"type:varchar(7);not null;uniqueIndex"` // format YYYY-MM
+	Nominal      float64   `json:"nominal" gorm:"type:decimal(12,2);not null"`
+	Keterangan   string    `json:"keterangan" gorm:"type:varchar(255)"`
+	DibuatOleh   string    `json:"dibuat_oleh" gorm:"type:char(36);not null"`
+	DibuatPada   time.Time `json:"dibuat_pada" gorm:"autoCreateTime"`
+}
+
+func (TarifDasar) TableName() string {
+	return "tarif_dasar"
+}
+
+type JenisAturanTarif string
+
+const (
+	AturanPotonganPersen  JenisAturanTarif = "potongan_persen"
+	AturanPotonganNominal JenisAturanTarif = "potongan_nominal"
+	AturanBebas           JenisAturanTarif = "bebas" // dibebaskan penuh, misalnya santri yatim
+)
+
+type CakupanAturanTarif string
+
+const (
+	CakupanSantri   CakupanAturanTarif = "santri"
+	CakupanKeluarga CakupanAturanTarif = "keluarga"
+)
+
+// AturanTarif adalah potongan atau pembebasan syahriah untuk satu santri atau satu keluarga.
+// Untuk cakupan keluarga, MulaiAnakKe membatasi aturan ke anak ke-N dan seterusnya
+// (urut tanggal lahir di antara santri aktif dengan wali yang sama), misalnya potongan saudara.
+type AturanTarif struct {
+	IDAturan      string             `json:"id_aturan" gorm:"type:char(36);primaryKey"`
+	Nama          string             `json:"nama" gorm:"type:varchar(100);not null"`
+	Jenis         JenisAturanTarif   `json:"jenis" gorm:"type:enum('potongan_persen','potongan_nominal','bebas');not null"`
+	Nilai         float64            `json:"nilai" gorm:"type:decimal(12,2);not null;default:0"` // persen atau rupiah, diabaikan untuk jenis bebas
+	Cakupan       CakupanAturanTarif `json:"cakupan" gorm:"type:enum('santri','keluarga');not null"`
+	IDSantri      *string            `json:"id_santri,omitempty" gorm:"type:char(36);index"`
+	IDKeluarga    *string            `json:"id_keluarga,omitempty" gorm:"type:char(36);index"`
+	MulaiAnakKe   int                `json:"mulai_anak_ke" gorm:"not null;default:1"`
+	BerlakuMulai  string             `json:"berlaku_mulai" gorm:"type:varchar(7);not null"`   // format YYYY-MM
+	BerlakuSampai *string            `json:"berlaku_sampai,omitempty" gorm:"type:varchar(7)"` // kosong berarti tanpa batas
+	Aktif         bool               `json:"aktif" gorm:"not null;default:true"`
+	Keterangan    string             `json:"keterangan" gorm:"type:text"`
+	DibuatOleh    string             `json:"dibuat_oleh" gorm:"type:char(36);not null"`
+	DibuatPada    time.Time          `json:"dibuat_pada" gorm:"autoCreateTime"`
+
+	// Nama kolom sama di kedua tabel sehingga gorm menganggapnya has-one dan akan membuat foreign key
+	// terbalik (santri -> aturan_tarif); relasi ini hanya untuk preload, tanpa constraint
+	Santri   *Santri   `json:"santri,omitempty" gorm:"foreignKey:IDSantri;references:IDSantri;constraint:-"`
+	Keluarga *Keluarga `json:"keluarga,omitempty" gorm:"foreignKey:IDKeluarga;references:IDKeluarga;constraint:-"`
+}
+
+func (AturanTarif) TableName() string {
+	return "aturan_tarif"
+}
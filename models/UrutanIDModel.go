@@ -0,0 +1,12 @@
+package models
+
+// UrutanID menyimpan nomor terakhir yang sudah dipakai untuk setiap prefix ID (misalnya "W" untuk wali).
+// Baris dikunci (SELECT ... FOR UPDATE) saat mengambil nomor baru agar tidak ada ID ganda.
+type UrutanID struct {
+	Prefix   string `json:"prefix" gorm:"type:varchar(10);primaryKey"`
+	Terakhir int64  `json:"terakhir" gorm:"not null;default:0"`
+}
+
+func (UrutanID) TableName() string {
+	return "urutan_id"
+}
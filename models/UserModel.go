@@ -8,6 +8,15 @@ const (
 	RoleSuperAdmin UserRole = "super_admin"
 	RoleAdmin      UserRole = "admin"
 	RoleWali       UserRole = "wali"
+	RoleBendahara  UserRole = "bendahara"
+)
+
+type StatusRegistrasi string
+
+const (
+	RegistrasiMenunggu  StatusRegistrasi = "menunggu"
+	RegistrasiDisetujui StatusRegistrasi = "disetujui"
+	RegistrasiDitolak   StatusRegistrasi = "ditolak"
 )
 
 type User struct {
@@ -15,9 +24,15 @@ type User struct {
 	NamaLengkap    string    `json:"nama_lengkap" gorm:"type:varchar(100);not null"`
 	Email          *string   `json:"email,omitempty" gorm:"type:varchar(100);unique"`
 	NoTelp         string    `json:"no_telp,omitempty" gorm:"type:varchar(20)"`
-	Password       string    `json:"password" gorm:"type:varchar(255);not null"`
-	Role           UserRole  `json:"role" gorm:"type:enum('super_admin','admin','wali');default:'wali'"`
+	Password       string    `json:"-" gorm:"type:varchar(255);not null"`
+	Role           UserRole  `json:"role" gorm:"type:varchar(30);default:'wali'"` // daftar role dan izinnya ada di services.RegistryIzin
 	StatusAktif    bool      `json:"status_aktif" gorm:"default:false"`
+	VersiToken     int       `json:"-" gorm:"not null;default:0"` // dinaikkan untuk mencabut semua token user
+	// Akun lama dianggap sudah disetujui; registrasi baru masuk antrean "menunggu"
+	StatusRegistrasi StatusRegistrasi `json:"status_registrasi" gorm:"type:enum('menunggu','disetujui','ditolak');default:'disetujui';index"`
+	AlasanPenolakan  *string          `json:"alasan_penolakan,omitempty" gorm:"type:text"`
+	DiverifikasiOleh *string          `json:"diverifikasi_oleh,omitempty" gorm:"type:char(36)"`
+	DiverifikasiPada *time.Time       `json:"diverifikasi_pada,omitempty"`
 	DibuatPada     time.Time `json:"dibuat_pada" gorm:"autoCreateTime"`
 	DiperbaruiPada time.Time `json:"diperbarui_pada" gorm:"autoUpdateTime"`
 }
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"tpq_asysyafii/config"
+	"tpq_asysyafii/services"
+)
+
+// jalankanPerintah menjalankan subcommand CLI dan mengembalikan exit code.
+// Tanpa subcommand, aplikasi berjalan sebagai server seperti biasa.
+func jalankanPerintah(args []string) int {
+	switch args[0] {
+	case "cek-integritas":
+		return perintahCekIntegritas(args[1:])
+	case "indeks-pencarian":
+		return perintahIndeksPencarian()
+	default:
+		fmt.Fprintf(os.Stderr, "Perintah tidak dikenal: %s\n\n", args[0])
+		fmt.Fprintln(os.Stderr, "Perintah yang tersedia:")
+		fmt.Fprintln(os.Stderr, "  cek-integritas [-perbaiki] [-oleh ID_USER] [-json]   periksa rekap saldo terhadap transaksi sumber")
+		fmt.Fprintln(os.Stderr, "  indeks-pencarian                                    bangun ulang indeks pencarian konten publik")
+		return 2
+	}
+}
+
+// perintahCekIntegritas memeriksa rekap saldo. Exit code 0 jika sesuai (atau berhasil diperbaiki),
+// 1 jika terjadi error, dan 3 jika masih ada temuan.
+func perintahCekIntegritas(args []string) int {
+	fs := flag.NewFlagSet("cek-integritas", flag.ContinueOnError)
+	perbaiki := fs.Bool("perbaiki", false, "perbaiki rekap dalam satu transaksi jika ada temuan")
+	oleh := fs.String("oleh", os.Getenv("SCHEDULER_USER_ID"), "ID user yang tercatat di log aktivitas saat perbaikan")
+	keluaranJSON := fs.Bool("json", false, "tampilkan hasil dalam format JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	config.InitDB()
+	db := config.GetDB()
+	if db == nil {
+		fmt.Fprintln(os.Stderr, "Gagal koneksi database")
+		return 1
+	}
+
+	service := services.NewIntegritasService(db)
+	var hasil, sesudah *services.HasilIntegritas
+	var err error
+	if *perbaiki {
+		if *oleh == "" {
+			err = errors.New("isi -oleh atau SCHEDULER_USER_ID untuk mencatat perbaikan di log aktivitas")
+		} else {
+			hasil, sesudah, err = service.Perbaiki(*oleh)
+		}
+	} else {
+		hasil, err = service.Periksa()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Gagal cek integritas: %v\n", err)
+		return 1
+	}
+
+	if *keluaranJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(map[string]interface{}{"hasil": hasil, "sesudah_perbaikan": sesudah})
+	} else {
+		fmt.Printf("Periode %s s.d. %s (%d periode)\n", hasil.PeriodeAwal, hasil.PeriodeAkhir, hasil.JumlahPeriode)
+		for _, t := range hasil.Temuan {
+			fmt.Printf("  [%s] %s %s: tersimpan %.2f, seharusnya %.2f - %s\n",
+				t.Jenis, t.Periode, t.Kolom, t.Tersimpan, t.Seharusnya, t.Keterangan)
+		}
+		switch {
+		case hasil.Sehat:
+			fmt.Println("Rekap saldo sesuai dengan transaksi sumber")
+		case sesudah != nil:
+			fmt.Printf("%d temuan berhasil diperbaiki\n", len(hasil.Temuan))
+		default:
+			fmt.Printf("%d temuan, jalankan dengan -perbaiki untuk memperbaiki\n", len(hasil.Temuan))
+		}
+	}
+
+	if !hasil.Sehat && sesudah == nil {
+		return 3
+	}
+	return 0
+}
+
+// perintahIndeksPencarian membangun ulang indeks pencarian dari tabel konten
+func perintahIndeksPencarian() int {
+	config.InitDB()
+	db := config.GetDB()
+	if db == nil {
+		fmt.Fprintln(os.Stderr, "Gagal koneksi database")
+		return 1
+	}
+
+	jumlah, err := services.BangunUlangIndeksPencarian(db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Gagal membangun indeks pencarian: %v\n", err)
+		return 1
+	}
+	fmt.Printf("%d konten diindeks\n", jumlah)
+	return 0
+}
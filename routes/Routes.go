@@ -4,15 +4,22 @@ import (
 	"tpq_asysyafii/config"
 	"tpq_asysyafii/controllers"
 	"tpq_asysyafii/middleware"
+	"tpq_asysyafii/services"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRoutes(r *gin.Engine) {
+func SetupRoutes(r *gin.Engine, scheduler *services.Scheduler) {
 	api := r.Group("/api")
 	{
 		api.POST("/register", controllers.RegisterUser)
 		api.POST("/login", controllers.LoginUser)
+		api.POST("/refresh", controllers.RefreshToken)
+		api.POST("/logout", middlewares.AuthMiddleware(), controllers.Logout)
+		api.POST("/logout-all", middlewares.AuthMiddleware(), controllers.LogoutAll)
+		api.POST("/password/change", middlewares.AuthMiddleware(), controllers.ChangePassword)
+		api.POST("/password/forgot", controllers.ForgotPassword)
+		api.POST("/password/reset", controllers.ResetPassword)
 		
 		donasiController := controllers.NewDonasiController(config.GetDB())
 		api.GET("/donasi-public", donasiController.GetDonasiPublic)
@@ -36,6 +43,9 @@ func SetupRoutes(r *gin.Engine) {
 		api.GET("/berita/:slug", beritaController.GetBeritaBySlug)
 		api.GET("/berita/id/:id", beritaController.GetBeritaByID) 
 
+		pencarianController := controllers.NewPencarianController(config.DB)
+		api.GET("/search", pencarianController.Cari)
+
 		fasilitasController := controllers.NewFasilitasController(config.DB)
 		api.GET("/fasilitas", fasilitasController.GetFasilitasPublic)
 		api.GET("/fasilitas/:slug", fasilitasController.GetFasilitasBySlug)
@@ -55,9 +65,18 @@ func SetupRoutes(r *gin.Engine) {
 		api.GET("/testimoni", testimoniController.GetTestimoniPublic)
 		api.GET("/testimoni/:id", testimoniController.GetTestimoniByID)
 
+		// Webhook payment gateway, keaslian dicek lewat tanda tangan HMAC
+		pembayaranPublicController := controllers.NewPembayaranController(config.DB)
+		api.POST("/pembayaran/callback/:provider", pembayaranPublicController.CallbackPembayaran)
+
+		// Verifikasi keaslian kwitansi dari kode yang tercetak di kwitansi
+		kwitansiPublicController := controllers.NewKwitansiController(config.DB)
+		api.GET("/kwitansi/verifikasi/:kode", kwitansiPublicController.VerifikasiKwitansi)
+
 		protected := api.Group("/")
 		protected.Use(middlewares.AuthMiddleware())
 		{
+			protected.GET("/me/permissions", controllers.GetMyPermissions)
 			protected.GET("/users", controllers.GetUsers)
 			protected.GET("/users/:id", controllers.GetUserByID)
 			protected.PUT("/users/:id", controllers.UpdateUser)
@@ -81,6 +100,21 @@ func SetupRoutes(r *gin.Engine) {
 			protected.GET("/syahriah/my", syahriahController.GetMySyahriah)	
 			protected.GET("/syahriah/summary", syahriahController.GetSyahriahSummaryForWali)
 			protected.GET("/syahriah/:id", syahriahController.GetSyahriahByID)
+			protected.GET("/syahriah/:id/pembayaran", syahriahController.GetRiwayatPembayaranSyahriah)
+
+			pembayaranController := controllers.NewPembayaranController(config.DB)
+			protected.POST("/pembayaran", pembayaranController.CreatePembayaran)
+			protected.GET("/pembayaran/my", pembayaranController.GetMyPembayaran)
+			protected.GET("/pembayaran/:id", pembayaranController.GetPembayaranByID)
+
+			kwitansiController := controllers.NewKwitansiController(config.DB)
+			protected.GET("/kwitansi/my", kwitansiController.GetMyKwitansi)
+			protected.GET("/kwitansi/syahriah/:id_bayar", kwitansiController.DownloadKwitansiSyahriah)
+
+			tunggakanController := controllers.NewTunggakanController(config.DB)
+			protected.GET("/tunggakan/my", tunggakanController.GetMyTunggakan)
+			protected.GET("/tunggakan/pengingat/pengaturan", tunggakanController.GetPengaturanPengingatSaya)
+			protected.PUT("/tunggakan/pengingat/pengaturan", tunggakanController.UpdatePengaturanPengingatSaya)
 
 			donasiController := controllers.NewDonasiController(config.GetDB())
 			protected.GET("/donasi", donasiController.GetAllDonasi)
@@ -112,134 +146,207 @@ func SetupRoutes(r *gin.Engine) {
 			protected.DELETE("/testimoni/:id", testimoniController.DeleteTestimoni)
 		}
 
-		// Group untuk admin DAN super-admin
+		// Group untuk pengurus (admin, bendahara, super-admin); akses per route diatur lewat izin
 		admin := api.Group("/admin")
-		admin.Use(middlewares.AuthMiddleware(), middlewares.AdminOrSuperAdminMiddleware())
+		admin.Use(middlewares.AuthMiddleware())
 		{
-			admin.GET("/users", controllers.GetUsers)
-			admin.GET("/wali",controllers.GetWali)
-			admin.POST("/users", controllers.RegisterUser)
+			admin.GET("/users", middlewares.RequirePermission(services.IzinUserRead), controllers.GetUsers)
+			admin.GET("/wali", middlewares.RequirePermission(services.IzinUserRead), controllers.GetWali)
+			admin.POST("/users", middlewares.RequirePermission(services.IzinUserCreate), controllers.RegisterUser)
+
+			registrasiController := controllers.NewRegistrasiController(config.DB)
+			admin.GET("/users/pending", middlewares.RequirePermission(services.IzinUserApprove), registrasiController.GetPendingUsers)
+			admin.PUT("/users/:id/approve", middlewares.RequirePermission(services.IzinUserApprove), registrasiController.ApproveUser)
+			admin.PUT("/users/:id/reject", middlewares.RequirePermission(services.IzinUserApprove), registrasiController.RejectUser)
+			admin.PUT("/users/:id/unlock", middlewares.RequirePermission(services.IzinUserApprove), controllers.UnlockUser)
 
 			santriController := controllers.NewSantriController(config.DB)
-			admin.GET("/santri", santriController.GetAllSantri)
+			admin.GET("/santri", middlewares.RequirePermission(services.IzinSantriRead), santriController.GetAllSantri)
 
 			donasiController := controllers.NewDonasiController(config.GetDB())
-			admin.POST("/donasi", donasiController.CreateDonasi)
-			admin.GET("/donasi", donasiController.GetAllDonasi)
-			admin.GET("/donasi/summary", donasiController.GetDonasiSummary)
-			admin.GET("/donasi/by-date", donasiController.GetDonasiByDateRange)
-			admin.GET("/donasi/:id", donasiController.GetDonasiByID)
-			admin.PUT("/donasi/:id", donasiController.UpdateDonasi)
-			admin.DELETE("/donasi/:id", donasiController.DeleteDonasi)
+			admin.POST("/donasi", middlewares.RequirePermission(services.IzinDonasiWrite), donasiController.CreateDonasi)
+			admin.GET("/donasi", middlewares.RequirePermission(services.IzinDonasiRead), donasiController.GetAllDonasi)
+			admin.GET("/donasi/summary", middlewares.RequirePermission(services.IzinDonasiRead), donasiController.GetDonasiSummary)
+			admin.GET("/donasi/by-date", middlewares.RequirePermission(services.IzinDonasiRead), donasiController.GetDonasiByDateRange)
+			admin.GET("/donasi/:id", middlewares.RequirePermission(services.IzinDonasiRead), donasiController.GetDonasiByID)
+			admin.PUT("/donasi/:id", middlewares.RequirePermission(services.IzinDonasiWrite), donasiController.UpdateDonasi)
+			admin.DELETE("/donasi/:id", middlewares.RequirePermission(services.IzinDonasiWrite), donasiController.DeleteDonasi)
+
+			kwitansiController := controllers.NewKwitansiController(config.DB)
+			admin.GET("/kwitansi/donasi/:id", middlewares.RequirePermission(services.IzinDonasiRead), kwitansiController.DownloadKwitansiDonasi)
+			admin.GET("/kwitansi/syahriah/:id_bayar", middlewares.RequirePermission(services.IzinSyahriahRead), kwitansiController.DownloadKwitansiSyahriah)
 
 			syahriahController := controllers.NewSyahriahController(config.DB)
-			admin.POST("/syahriah", syahriahController.CreateSyahriah)
-			admin.POST("/syahriah/batch", syahriahController.BatchCreateSyahriah)
-        	admin.PUT("/syahriah/:id", syahriahController.UpdateSyahriah)
-        	admin.DELETE("/syahriah/:id", syahriahController.DeleteSyahriah)
-			admin.GET("/syahriah", syahriahController.GetAllSyahriah)
-			admin.GET("/syahriah/my", syahriahController.GetMySyahriah)	
-			admin.GET("/syahriah/summary", syahriahController.GetSyahriahSummary)
-			admin.GET("/syahriah/:id", syahriahController.GetSyahriahByID)
-			admin.PUT("/syahriah/:id/bayar", syahriahController.BayarSyahriah)
+			admin.POST("/syahriah", middlewares.RequirePermission(services.IzinSyahriahWrite), syahriahController.CreateSyahriah)
+			admin.POST("/syahriah/batch", middlewares.RequirePermission(services.IzinSyahriahWrite), syahriahController.BatchCreateSyahriah)
+        	admin.PUT("/syahriah/:id", middlewares.RequirePermission(services.IzinSyahriahWrite), syahriahController.UpdateSyahriah)
+        	admin.DELETE("/syahriah/:id", middlewares.RequirePermission(services.IzinSyahriahWrite), syahriahController.DeleteSyahriah)
+			admin.GET("/syahriah", middlewares.RequirePermission(services.IzinSyahriahRead), syahriahController.GetAllSyahriah)
+			admin.GET("/syahriah/my", middlewares.RequirePermission(services.IzinSyahriahRead), syahriahController.GetMySyahriah)	
+			admin.GET("/syahriah/summary", middlewares.RequirePermission(services.IzinSyahriahRead), syahriahController.GetSyahriahSummary)
+			admin.GET("/syahriah/:id", middlewares.RequirePermission(services.IzinSyahriahRead), syahriahController.GetSyahriahByID)
+			admin.PUT("/syahriah/:id/bayar", middlewares.RequirePermission(services.IzinSyahriahWrite), syahriahController.BayarSyahriah)
+			admin.GET("/syahriah/:id/pembayaran", middlewares.RequirePermission(services.IzinSyahriahRead), syahriahController.GetRiwayatPembayaranSyahriah)
+			admin.POST("/syahriah/:id/pembayaran", middlewares.RequirePermission(services.IzinSyahriahWrite), syahriahController.CatatPembayaranSyahriah)
+			admin.DELETE("/syahriah/pembayaran/:id_bayar", middlewares.RequirePermission(services.IzinSyahriahWrite), syahriahController.DeletePembayaranSyahriah)
+
+			pembayaranController := controllers.NewPembayaranController(config.DB)
+			admin.GET("/pembayaran", middlewares.RequirePermission(services.IzinSyahriahRead), pembayaranController.GetAllPembayaran)
+			admin.GET("/pembayaran/:id", middlewares.RequirePermission(services.IzinSyahriahRead), pembayaranController.GetPembayaranByID)
+			admin.POST("/pembayaran/rekonsiliasi", middlewares.RequirePermission(services.IzinSyahriahWrite), pembayaranController.RekonsiliasiPembayaran)
+			admin.POST("/pembayaran/:id/simulasi", middlewares.RequirePermission(services.IzinSyahriahWrite), pembayaranController.SimulasiPembayaran)
+
+			tarifController := controllers.NewTarifController(config.DB)
+			admin.GET("/tarif/dasar", middlewares.RequirePermission(services.IzinSyahriahRead), tarifController.GetAllTarifDasar)
+			admin.POST("/tarif/dasar", middlewares.RequirePermission(services.IzinSyahriahWrite), tarifController.CreateTarifDasar)
+			admin.PUT("/tarif/dasar/:id", middlewares.RequirePermission(services.IzinSyahriahWrite), tarifController.UpdateTarifDasar)
+			admin.DELETE("/tarif/dasar/:id", middlewares.RequirePermission(services.IzinSyahriahWrite), tarifController.DeleteTarifDasar)
+			admin.GET("/tarif/aturan", middlewares.RequirePermission(services.IzinSyahriahRead), tarifController.GetAllAturanTarif)
+			admin.GET("/tarif/aturan/:id", middlewares.RequirePermission(services.IzinSyahriahRead), tarifController.GetAturanTarifByID)
+			admin.POST("/tarif/aturan", middlewares.RequirePermission(services.IzinSyahriahWrite), tarifController.CreateAturanTarif)
+			admin.PUT("/tarif/aturan/:id", middlewares.RequirePermission(services.IzinSyahriahWrite), tarifController.UpdateAturanTarif)
+			admin.DELETE("/tarif/aturan/:id", middlewares.RequirePermission(services.IzinSyahriahWrite), tarifController.DeleteAturanTarif)
+			admin.GET("/tarif/hitung", middlewares.RequirePermission(services.IzinSyahriahRead), tarifController.HitungTarif)
+
+			tunggakanController := controllers.NewTunggakanController(config.DB)
+			admin.GET("/tunggakan", middlewares.RequirePermission(services.IzinSyahriahRead), tunggakanController.GetLaporanTunggakan)
+			admin.POST("/tunggakan/pengingat", middlewares.RequirePermission(services.IzinSyahriahWrite), tunggakanController.KirimPengingat)
+			admin.GET("/tunggakan/pengingat", middlewares.RequirePermission(services.IzinSyahriahRead), tunggakanController.GetRiwayatPengingat)
+			admin.GET("/tunggakan/pengingat/pengaturan/:id_wali", middlewares.RequirePermission(services.IzinSyahriahRead), tunggakanController.GetPengaturanPengingatWali)
+			admin.PUT("/tunggakan/pengingat/pengaturan/:id_wali", middlewares.RequirePermission(services.IzinSyahriahWrite), tunggakanController.UpdatePengaturanPengingatWali)
+
+			jobController := controllers.NewJobController(config.DB, scheduler)
+			admin.GET("/jobs", middlewares.RequirePermission(services.IzinJobRead), jobController.GetAllJobs)
+			admin.GET("/jobs/runs", middlewares.RequirePermission(services.IzinJobRead), jobController.GetJobRuns)
+			admin.POST("/jobs/:nama/run", middlewares.RequirePermission(services.IzinJobRun), jobController.RunJob)
 
 			pengumumanController := controllers.NewPengumumanController(config.DB)
-			admin.POST("/pengumuman", pengumumanController.CreatePengumuman)
-			admin.PUT("/pengumuman/:id", pengumumanController.UpdatePengumuman)
-			admin.DELETE("/pengumuman/:id", pengumumanController.DeletePengumuman)
-			admin.GET("/pengumuman/summary", pengumumanController.GetPengumumanSummary)
+			admin.POST("/pengumuman", middlewares.RequirePermission(services.IzinPengumumanWrite), pengumumanController.CreatePengumuman)
+			admin.PUT("/pengumuman/:id", middlewares.RequirePermission(services.IzinPengumumanWrite), pengumumanController.UpdatePengumuman)
+			admin.DELETE("/pengumuman/:id", middlewares.RequirePermission(services.IzinPengumumanWrite), pengumumanController.DeletePengumuman)
+			admin.GET("/pengumuman/summary", middlewares.RequirePermission(services.IzinPengumumanWrite), pengumumanController.GetPengumumanSummary)
 
 			logController := controllers.NewLogAktivitasController(config.GetDB())
-			admin.GET("/logs", logController.GetAllLogAktivitas)
-			admin.GET("/logs/summary", logController.GetLogSummary)
-			admin.GET("/logs/:id", logController.GetLogAktivitasByID)
+			admin.GET("/logs", middlewares.RequirePermission(services.IzinLogRead), logController.GetAllLogAktivitas)
+			admin.GET("/logs/summary", middlewares.RequirePermission(services.IzinLogRead), logController.GetLogSummary)
+			admin.GET("/logs/:id", middlewares.RequirePermission(services.IzinLogRead), logController.GetLogAktivitasByID)
 
 			rekapController := controllers.NewRekapController(config.DB)
-			admin.POST("/rekap", rekapController.CreateRekap)
-			admin.PUT("/rekap/:id", rekapController.UpdateRekap)
-			admin.DELETE("/rekap/:id", rekapController.DeleteRekap)
-			admin.POST("/rekap/generate", rekapController.GenerateRekapOtomatis)
-			admin.GET("/rekap", rekapController.GetAllRekap)
-			admin.GET("/rekap/summary", rekapController.GetRekapSummary)
-			admin.GET("/rekap/latest", rekapController.GetLatestRekap)
-			admin.GET("/rekap/period", rekapController.GetRekapByPeriode)
-			admin.GET("/rekap/:id", rekapController.GetRekapByID)
+			admin.POST("/rekap", middlewares.RequirePermission(services.IzinRekapWrite), rekapController.CreateRekap)
+			admin.PUT("/rekap/:id", middlewares.RequirePermission(services.IzinRekapWrite), rekapController.UpdateRekap)
+			admin.DELETE("/rekap/:id", middlewares.RequirePermission(services.IzinRekapWrite), rekapController.DeleteRekap)
+			admin.POST("/rekap/generate", middlewares.RequirePermission(services.IzinRekapWrite), rekapController.GenerateRekapOtomatis)
+			admin.GET("/rekap", middlewares.RequirePermission(services.IzinRekapRead), rekapController.GetAllRekap)
+			admin.GET("/rekap/summary", middlewares.RequirePermission(services.IzinRekapRead), rekapController.GetRekapSummary)
+			admin.GET("/rekap/latest", middlewares.RequirePermission(services.IzinRekapRead), rekapController.GetLatestRekap)
+			admin.GET("/rekap/period", middlewares.RequirePermission(services.IzinRekapRead), rekapController.GetRekapByPeriode)
+			admin.GET("/rekap/:id", middlewares.RequirePermission(services.IzinRekapRead), rekapController.GetRekapByID)
+			admin.GET("/rekap/:id/export", middlewares.RequirePermission(services.IzinRekapRead), rekapController.ExportRekap)
+			admin.POST("/rekap/sync", middlewares.RequirePermission(services.IzinRekapWrite), rekapController.SyncAllRekap)
+			admin.GET("/rekap/integritas", middlewares.RequirePermission(services.IzinRekapRead), rekapController.PeriksaIntegritasRekap)
+			admin.POST("/rekap/integritas/perbaiki", middlewares.RequirePermission(services.IzinRekapWrite), rekapController.PerbaikiIntegritasRekap)
+
+			tutupBukuController := controllers.NewTutupBukuController(config.DB)
+			admin.GET("/tutup-buku", middlewares.RequirePermission(services.IzinRekapRead), tutupBukuController.GetTutupBuku)
+			admin.POST("/tutup-buku/:periode", middlewares.RequirePermission(services.IzinTutupBuku), tutupBukuController.TutupBuku)
+			admin.GET("/koreksi-saldo", middlewares.RequirePermission(services.IzinRekapRead), tutupBukuController.GetAllKoreksiSaldo)
+			admin.POST("/koreksi-saldo", middlewares.RequirePermission(services.IzinRekapWrite), tutupBukuController.CreateKoreksiSaldo)
+
+			jurnalController := controllers.NewJurnalController(config.DB)
+			admin.GET("/jurnal", middlewares.RequirePermission(services.IzinJurnalRead), jurnalController.GetAllJurnal)
+			admin.GET("/jurnal/saldo", middlewares.RequirePermission(services.IzinJurnalRead), jurnalController.GetSaldoAkun)
 
 			pemakaianController := controllers.NewPemakaianSaldoController(config.DB)
-			admin.GET("/pemakaian", pemakaianController.GetAllPemakaian)
-			admin.POST("/pemakaian", pemakaianController.CreatePemakaian)
-			admin.PUT("/pemakaian/:id", pemakaianController.UpdatePemakaian)
-			admin.DELETE("/pemakaian/:id", pemakaianController.DeletePemakaian)
-			admin.GET("/pemakaian/summary", pemakaianController.GetPemakaianSummary)
-			admin.GET("/pemakaian/:id", pemakaianController.GetPemakaianByID)
+			admin.GET("/pemakaian", middlewares.RequirePermission(services.IzinPemakaianRead), pemakaianController.GetAllPemakaian)
+			admin.POST("/pemakaian", middlewares.RequirePermission(services.IzinPemakaianWrite), pemakaianController.CreatePemakaian)
+			admin.PUT("/pemakaian/:id", middlewares.RequirePermission(services.IzinPemakaianWrite), pemakaianController.UpdatePemakaian)
+			admin.DELETE("/pemakaian/:id", middlewares.RequirePermission(services.IzinPemakaianWrite), pemakaianController.DeletePemakaian)
+			admin.GET("/pemakaian/summary", middlewares.RequirePermission(services.IzinPemakaianRead), pemakaianController.GetPemakaianSummary)
+			admin.GET("/pemakaian/:id", middlewares.RequirePermission(services.IzinPemakaianRead), pemakaianController.GetPemakaianByID)
 		}
 
-		// Hanya untuk super-admin
+		// Group pengelolaan master data dan konten; akses per route diatur lewat izin
 		superAdmin := api.Group("/super-admin")
-		superAdmin.Use(middlewares.AuthMiddleware(), middlewares.SuperAdminMiddleware())
+		superAdmin.Use(middlewares.AuthMiddleware())
 		{
-			superAdmin.GET("/users", controllers.GetUsers)
-			superAdmin.GET("/wali",controllers.GetWali)
-			superAdmin.POST("/users", controllers.RegisterUser)
-			superAdmin.DELETE("/users/:id", controllers.DeleteUser)
-			superAdmin.PUT("/users/:id", controllers.UpdateUser)
+			superAdmin.GET("/users", middlewares.RequirePermission(services.IzinUserRead), controllers.GetUsers)
+			superAdmin.GET("/wali", middlewares.RequirePermission(services.IzinUserRead), controllers.GetWali)
+			superAdmin.POST("/users", middlewares.RequirePermission(services.IzinUserCreate), controllers.RegisterUser)
+			superAdmin.DELETE("/users/:id", middlewares.RequirePermission(services.IzinUserDelete), controllers.DeleteUser)
+			superAdmin.PUT("/users/:id", middlewares.RequirePermission(services.IzinUserWrite), controllers.UpdateUser)
 			
 			santriController := controllers.NewSantriController(config.DB)
-			superAdmin.POST("/santri", santriController.CreateSantri)
-			superAdmin.GET("/santri", santriController.GetAllSantri)
-			superAdmin.GET("/santri/wali/:id_wali", santriController.GetSantriByWali)
-			superAdmin.GET("/santri/by-wali/:id", santriController.GetSantriByWaliID)
-			superAdmin.GET("/santri/search", santriController.SearchSantri) 
-			superAdmin.GET("/santri/:id", santriController.GetSantriByID) 
-			superAdmin.PUT("/santri/:id", santriController.UpdateSantri) 
-			superAdmin.DELETE("/santri/:id", santriController.DeleteSantri)
-			superAdmin.PUT("/santri/:id/status", santriController.UpdateStatusSantri)
+			superAdmin.POST("/santri", middlewares.RequirePermission(services.IzinSantriWrite), santriController.CreateSantri)
+			superAdmin.GET("/santri", middlewares.RequirePermission(services.IzinSantriRead), santriController.GetAllSantri)
+			superAdmin.GET("/santri/wali/:id_wali", middlewares.RequirePermission(services.IzinSantriRead), santriController.GetSantriByWali)
+			superAdmin.GET("/santri/by-wali/:id", middlewares.RequirePermission(services.IzinSantriRead), santriController.GetSantriByWaliID)
+			superAdmin.GET("/santri/search", middlewares.RequirePermission(services.IzinSantriRead), santriController.SearchSantri) 
+			superAdmin.GET("/santri/:id", middlewares.RequirePermission(services.IzinSantriRead), santriController.GetSantriByID) 
+			superAdmin.PUT("/santri/:id", middlewares.RequirePermission(services.IzinSantriWrite), santriController.UpdateSantri) 
+			superAdmin.DELETE("/santri/:id", middlewares.RequirePermission(services.IzinSantriWrite), santriController.DeleteSantri)
+			superAdmin.PUT("/santri/:id/status", middlewares.RequirePermission(services.IzinSantriWrite), santriController.UpdateStatusSantri)
 
 			keluargaController := controllers.NewKeluargaController(config.DB)
-			superAdmin.POST("/keluarga", keluargaController.CreateKeluarga)
-			superAdmin.GET("/keluarga", keluargaController.GetAllKeluarga)
-			superAdmin.GET("/keluarga/search", keluargaController.SearchKeluarga)
-			superAdmin.GET("/keluarga/wali/:id_wali", keluargaController.GetKeluargaByWali)
-			superAdmin.GET("/keluarga/:id", keluargaController.GetKeluargaByID)
-			superAdmin.PUT("/keluarga/:id", keluargaController.UpdateKeluarga)
-			superAdmin.DELETE("/keluarga/:id", keluargaController.DeleteKeluarga)
-
-			superAdmin.POST("/berita", beritaController.CreateBerita)
-			superAdmin.GET("/berita/all", beritaController.GetAllBerita)
-			superAdmin.PUT("/berita/:id", beritaController.UpdateBerita)
-			superAdmin.PUT("/berita/:id/publish", beritaController.PublishBerita)
-			superAdmin.DELETE("/berita/:id", beritaController.DeleteBerita)
-
-			superAdmin.POST("/program-unggulan", programUnggulanController.CreateProgramUnggulan)
-			superAdmin.GET("/program-unggulan/all", programUnggulanController.GetAllProgramUnggulan)
-			superAdmin.PUT("/program-unggulan/:id", programUnggulanController.UpdateProgramUnggulan)
-			superAdmin.DELETE("/program-unggulan/:id", programUnggulanController.DeleteProgramUnggulan)
-			superAdmin.PUT("/program-unggulan/:id/aktif", programUnggulanController.AktifkanProgramUnggulan)
-			superAdmin.PUT("/program-unggulan/:id/nonaktif", programUnggulanController.NonaktifkanProgramUnggulan)
-
-			superAdmin.POST("/fasilitas", fasilitasController.CreateFasilitas)
-			superAdmin.GET("/fasilitas/all", fasilitasController.GetAllFasilitas)
-			superAdmin.PUT("/fasilitas/:id", fasilitasController.UpdateFasilitas)
-			superAdmin.DELETE("/fasilitas/:id", fasilitasController.DeleteFasilitas)
-			superAdmin.PUT("/fasilitas/:id/aktif", fasilitasController.AktifkanFasilitas)
-			superAdmin.PUT("/fasilitas/:id/nonaktif", fasilitasController.NonaktifkanFasilitas)
-
-			superAdmin.POST("/informasi-tpq", informasiTPQController.CreateInformasiTPQ)
-			superAdmin.GET("/informasi-tpq/all", informasiTPQController.GetInformasiTPQ)
-			superAdmin.PUT("/informasi-tpq/:id", informasiTPQController.UpdateInformasiTPQ)
-			superAdmin.DELETE("/informasi-tpq/:id", informasiTPQController.DeleteInformasiTPQ)
-
-			superAdmin.POST("/sosial-media", sosialMediaController.CreateSosialMedia)
-			superAdmin.GET("/sosial-media", sosialMediaController.GetAllSosialMedia)
-			superAdmin.GET("/sosial-media/:id", sosialMediaController.GetSosialMediaByID)
-			superAdmin.PUT("/sosial-media/:id", sosialMediaController.UpdateSosialMedia)
-			superAdmin.DELETE("/sosial-media/:id", sosialMediaController.DeleteSosialMedia)
+			superAdmin.POST("/keluarga", middlewares.RequirePermission(services.IzinKeluargaWrite), keluargaController.CreateKeluarga)
+			superAdmin.GET("/keluarga", middlewares.RequirePermission(services.IzinKeluargaRead), keluargaController.GetAllKeluarga)
+			superAdmin.GET("/keluarga/search", middlewares.RequirePermission(services.IzinKeluargaRead), keluargaController.SearchKeluarga)
+			superAdmin.GET("/keluarga/wali/:id_wali", middlewares.RequirePermission(services.IzinKeluargaRead), keluargaController.GetKeluargaByWali)
+			superAdmin.GET("/keluarga/:id", middlewares.RequirePermission(services.IzinKeluargaRead), keluargaController.GetKeluargaByID)
+			superAdmin.PUT("/keluarga/:id", middlewares.RequirePermission(services.IzinKeluargaWrite), keluargaController.UpdateKeluarga)
+			superAdmin.DELETE("/keluarga/:id", middlewares.RequirePermission(services.IzinKeluargaWrite), keluargaController.DeleteKeluarga)
+
+			superAdmin.POST("/berita", middlewares.RequirePermission(services.IzinBeritaWrite), beritaController.CreateBerita)
+			superAdmin.GET("/berita/all", middlewares.RequirePermission(services.IzinBeritaWrite), beritaController.GetAllBerita)
+			superAdmin.PUT("/berita/:id", middlewares.RequirePermission(services.IzinBeritaWrite), beritaController.UpdateBerita)
+			superAdmin.PUT("/berita/:id/publish", middlewares.RequirePermission(services.IzinBeritaPublish), beritaController.PublishBerita)
+			superAdmin.DELETE("/berita/:id", middlewares.RequirePermission(services.IzinBeritaWrite), beritaController.DeleteBerita)
+
+			beritaRevisiController := controllers.NewBeritaRevisiController(config.DB)
+			superAdmin.GET("/berita/:id/revisions", middlewares.RequirePermission(services.IzinBeritaWrite), beritaRevisiController.GetRevisiBerita)
+			superAdmin.GET("/berita/:id/revisions/:nomor", middlewares.RequirePermission(services.IzinBeritaWrite), beritaRevisiController.GetRevisiBeritaByNomor)
+			superAdmin.GET("/berita/:id/revisions/:nomor/diff", middlewares.RequirePermission(services.IzinBeritaWrite), beritaRevisiController.DiffRevisiBerita)
+			superAdmin.POST("/berita/:id/revisions/:nomor/restore", middlewares.RequirePermission(services.IzinBeritaWrite), beritaRevisiController.RestoreRevisiBerita)
+
+			superAdmin.POST("/program-unggulan", middlewares.RequirePermission(services.IzinKontenWrite), programUnggulanController.CreateProgramUnggulan)
+			superAdmin.GET("/program-unggulan/all", middlewares.RequirePermission(services.IzinKontenWrite), programUnggulanController.GetAllProgramUnggulan)
+			superAdmin.PUT("/program-unggulan/:id", middlewares.RequirePermission(services.IzinKontenWrite), programUnggulanController.UpdateProgramUnggulan)
+			superAdmin.DELETE("/program-unggulan/:id", middlewares.RequirePermission(services.IzinKontenWrite), programUnggulanController.DeleteProgramUnggulan)
+			superAdmin.PUT("/program-unggulan/:id/aktif", middlewares.RequirePermission(services.IzinKontenWrite), programUnggulanController.AktifkanProgramUnggulan)
+			superAdmin.PUT("/program-unggulan/:id/nonaktif", middlewares.RequirePermission(services.IzinKontenWrite), programUnggulanController.NonaktifkanProgramUnggulan)
+
+			superAdmin.POST("/fasilitas", middlewares.RequirePermission(services.IzinKontenWrite), fasilitasController.CreateFasilitas)
+			superAdmin.GET("/fasilitas/all", middlewares.RequirePermission(services.IzinKontenWrite), fasilitasController.GetAllFasilitas)
+			superAdmin.PUT("/fasilitas/:id", middlewares.RequirePermission(services.IzinKontenWrite), fasilitasController.UpdateFasilitas)
+			superAdmin.DELETE("/fasilitas/:id", middlewares.RequirePermission(services.IzinKontenWrite), fasilitasController.DeleteFasilitas)
+			superAdmin.PUT("/fasilitas/:id/aktif", middlewares.RequirePermission(services.IzinKontenWrite), fasilitasController.AktifkanFasilitas)
+			superAdmin.PUT("/fasilitas/:id/nonaktif", middlewares.RequirePermission(services.IzinKontenWrite), fasilitasController.NonaktifkanFasilitas)
+
+			superAdmin.POST("/informasi-tpq", middlewares.RequirePermission(services.IzinKontenWrite), informasiTPQController.CreateInformasiTPQ)
+			superAdmin.GET("/informasi-tpq/all", middlewares.RequirePermission(services.IzinKontenWrite), informasiTPQController.GetInformasiTPQ)
+			superAdmin.PUT("/informasi-tpq/:id", middlewares.RequirePermission(services.IzinKontenWrite), informasiTPQController.UpdateInformasiTPQ)
+			superAdmin.DELETE("/informasi-tpq/:id", middlewares.RequirePermission(services.IzinKontenWrite), informasiTPQController.DeleteInformasiTPQ)
+
+			superAdmin.POST("/sosial-media", middlewares.RequirePermission(services.IzinKontenWrite), sosialMediaController.CreateSosialMedia)
+			superAdmin.GET("/sosial-media", middlewares.RequirePermission(services.IzinKontenWrite), sosialMediaController.GetAllSosialMedia)
+			superAdmin.GET("/sosial-media/:id", middlewares.RequirePermission(services.IzinKontenWrite), sosialMediaController.GetSosialMediaByID)
+			superAdmin.PUT("/sosial-media/:id", middlewares.RequirePermission(services.IzinKontenWrite), sosialMediaController.UpdateSosialMedia)
+			superAdmin.DELETE("/sosial-media/:id", middlewares.RequirePermission(services.IzinKontenWrite), sosialMediaController.DeleteSosialMedia)
+
+			mediaController := controllers.NewMediaController(config.DB)
+			superAdmin.POST("/media", middlewares.RequirePermission(services.IzinMediaWrite), mediaController.UploadMedia)
+			superAdmin.GET("/media", middlewares.RequirePermission(services.IzinMediaWrite), mediaController.GetAllMedia)
+			superAdmin.GET("/media/:id", middlewares.RequirePermission(services.IzinMediaWrite), mediaController.GetMediaByID)
+			superAdmin.DELETE("/media/:id", middlewares.RequirePermission(services.IzinMediaWrite), mediaController.DeleteMedia)
 
 			testimoniController := controllers.NewTestimoniController(config.DB)
-			superAdmin.GET("/testimoni", testimoniController.GetAllTestimoni)
-			superAdmin.PUT("/testimoni/:id/show", testimoniController.ShowTestimoni)
-			superAdmin.PUT("/testimoni/:id/hide", testimoniController.HideTestimoni)
-			superAdmin.DELETE("/testimoni/:id", testimoniController.DeleteTestimoni)
+			superAdmin.GET("/testimoni", middlewares.RequirePermission(services.IzinTestimoniModerasi), testimoniController.GetAllTestimoni)
+			superAdmin.PUT("/testimoni/:id/show", middlewares.RequirePermission(services.IzinTestimoniModerasi), testimoniController.ShowTestimoni)
+			superAdmin.PUT("/testimoni/:id/hide", middlewares.RequirePermission(services.IzinTestimoniModerasi), testimoniController.HideTestimoni)
+			superAdmin.DELETE("/testimoni/:id", middlewares.RequirePermission(services.IzinTestimoniModerasi), testimoniController.DeleteTestimoni)
+
+			// Membuka kembali periode tutup buku hanya untuk super_admin dan tercatat di log aktivitas
+			tutupBukuController := controllers.NewTutupBukuController(config.DB)
+			superAdmin.POST("/tutup-buku/:periode/buka", middlewares.RequirePermission(services.IzinBukaTutupBuku), tutupBukuController.BukaTutupBuku)
 		}
 	}
 }
\ No newline at end of file
@@ -0,0 +1,303 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
+	"tpq_asysyafii/ujidb"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// routerUji memasang semua route di atas database test
+func routerUji(t *testing.T) (*gin.Engine, *gorm.DB) {
+	t.Helper()
+	db := ujidb.Buka(t)
+	r := gin.New()
+	SetupRoutes(r, nil)
+	return r, db
+}
+
+// tokenUji membuat sesi login dan mengembalikan access token-nya
+func tokenUji(t *testing.T, db *gorm.DB, user models.User) string {
+	t.Helper()
+	sesi, err := services.NewTokenService(db).BuatSesi(user, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("gagal membuat sesi test: %v", err)
+	}
+	return sesi.AccessToken
+}
+
+func kirim(r *gin.Engine, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	var isi bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&isi).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &isi)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+type routeUji struct {
+	method string
+	path   string
+	body   interface{}
+}
+
+// harusDitolak memeriksa setiap route menjawab salah satu status yang diharapkan
+func harusDitolak(t *testing.T, r *gin.Engine, token string, daftar []routeUji, status ...int) {
+	t.Helper()
+	for _, tc := range daftar {
+		w := kirim(r, tc.method, tc.path, token, tc.body)
+		ditolak := false
+		for _, s := range status {
+			ditolak = ditolak || w.Code == s
+		}
+		if !ditolak {
+			t.Errorf("%s %s: status %d, harapan salah satu dari %v: %s", tc.method, tc.path, w.Code, status, w.Body.String())
+		}
+	}
+}
+
+// dataWali adalah data milik satu wali: keluarga, santri, tagihan syahriah beserta satu pembayaran
+// tunai, dan satu intent pembayaran online
+type dataWali struct {
+	wali       models.User
+	keluarga   models.Keluarga
+	santri     models.Santri
+	syahriah   models.Syahriah
+	bayar      models.SyahriahBayar
+	pembayaran models.Pembayaran
+}
+
+func buatDataWali(t *testing.T, db *gorm.DB, admin models.User) dataWali {
+	t.Helper()
+	d := dataWali{wali: ujidb.BuatUser(t, db, models.RoleWali)}
+	sekarang := time.Now()
+
+	d.keluarga = models.Keluarga{IDKeluarga: uuid.New().String(), IDWali: d.wali.IDUser, Alamat: "Alamat Test"}
+	ujidb.Buat(t, db, &d.keluarga)
+
+	d.santri = models.Santri{
+		IDSantri:     uuid.New().String(),
+		IDWali:       d.wali.IDUser,
+		NamaLengkap:  "Santri Test",
+		JenisKelamin: models.LakiLaki,
+		TanggalLahir: sekarang.AddDate(-8, 0, 0),
+		TanggalMasuk: sekarang,
+	}
+	ujidb.Buat(t, db, &d.santri)
+
+	d.syahriah = models.Syahriah{
+		IDSyahriah:  uuid.New().String(),
+		ID_Santri:   d.santri.IDSantri,
+		Bulan:       sekarang.Format("2006-01"),
+		Nominal:     50000,
+		Status:      models.StatusSebagian,
+		TotalBayar:  20000,
+		DicatatOleh: admin.IDUser,
+	}
+	ujidb.Buat(t, db, &d.syahriah)
+
+	d.bayar = models.SyahriahBayar{
+		IDBayar:      uuid.New().String(),
+		IDSyahriah:   d.syahriah.IDSyahriah,
+		Nominal:      20000,
+		Metode:       models.BayarTunai,
+		DiterimaOleh: &admin.IDUser,
+		WaktuBayar:   sekarang,
+	}
+	ujidb.Buat(t, db, &d.bayar)
+
+	d.pembayaran = models.Pembayaran{
+		IDPembayaran:   uuid.New().String(),
+		IDWali:         d.wali.IDUser,
+		Provider:       "test",
+		Referensi:      uuid.New().String(),
+		Metode:         models.MetodeQRIS,
+		KodeBayar:      "kode-test",
+		Nominal:        30000,
+		KadaluarsaPada: sekarang.Add(time.Hour),
+	}
+	ujidb.Buat(t, db, &d.pembayaran)
+	return d
+}
+
+// Wali hanya boleh membaca dan mengubah data miliknya sendiri: setiap route yang menerima ID
+// milik wali lain harus menolak dengan 403 atau 404, dan daftar milik wali tidak memuat data wali lain.
+func TestWaliTidakBisaMengaksesDataWaliLain(t *testing.T) {
+	r, db := routerUji(t)
+	admin := ujidb.BuatUser(t, db, models.RoleAdmin)
+	a := buatDataWali(t, db, admin)
+	b := buatDataWali(t, db, admin)
+	tokenA := tokenUji(t, db, a.wali)
+	tokenB := tokenUji(t, db, b.wali)
+
+	harusDitolak(t, r, tokenA, []routeUji{
+		{http.MethodGet, "/api/users/" + b.wali.IDUser, nil},
+		{http.MethodPut, "/api/users/" + b.wali.IDUser, gin.H{"nama_lengkap": "Diubah Wali Lain"}},
+		{http.MethodGet, "/api/keluarga/" + b.keluarga.IDKeluarga, nil},
+		{http.MethodPut, "/api/keluarga/" + b.keluarga.IDKeluarga, gin.H{"alamat": "Diubah Wali Lain"}},
+		{http.MethodDelete, "/api/keluarga/" + b.keluarga.IDKeluarga, nil},
+		{http.MethodGet, "/api/keluarga/wali/" + b.wali.IDUser, nil},
+		{http.MethodPost, "/api/keluarga", gin.H{"id_wali": b.wali.IDUser, "alamat": "Dibuat Wali Lain"}},
+		{http.MethodGet, "/api/super-admin/santri/" + b.santri.IDSantri, nil},
+		{http.MethodGet, "/api/syahriah/" + b.syahriah.IDSyahriah, nil},
+		{http.MethodGet, "/api/syahriah/" + b.syahriah.IDSyahriah + "/pembayaran", nil},
+		{http.MethodGet, "/api/kwitansi/syahriah/" + b.bayar.IDBayar, nil},
+		{http.MethodGet, "/api/pembayaran/" + b.pembayaran.IDPembayaran, nil},
+	}, http.StatusForbidden, http.StatusNotFound)
+
+	// Data B tidak berubah atau terhapus oleh request wali A
+	var keluargaB models.Keluarga
+	if err := db.First(&keluargaB, "id_keluarga = ?", b.keluarga.IDKeluarga).Error; err != nil {
+		t.Errorf("keluarga wali B hilang: %v", err)
+	} else if keluargaB.Alamat != b.keluarga.Alamat {
+		t.Errorf("alamat keluarga wali B berubah menjadi %q", keluargaB.Alamat)
+	}
+	var waliB models.User
+	if err := db.First(&waliB, "id_user = ?", b.wali.IDUser).Error; err != nil {
+		t.Fatalf("gagal membaca wali B: %v", err)
+	}
+	if waliB.NamaLengkap != b.wali.NamaLengkap {
+		t.Errorf("nama wali B berubah menjadi %q", waliB.NamaLengkap)
+	}
+	var jumlahKeluargaB int64
+	db.Model(&models.Keluarga{}).Where("id_wali = ?", b.wali.IDUser).Count(&jumlahKeluargaB)
+	if jumlahKeluargaB != 1 {
+		t.Errorf("wali B punya %d keluarga, harapan 1", jumlahKeluargaB)
+	}
+
+	// Daftar milik wali A tidak memuat ID apa pun milik wali B
+	idB := []string{b.wali.IDUser, b.keluarga.IDKeluarga, b.santri.IDSantri, b.syahriah.IDSyahriah, b.bayar.IDBayar, b.pembayaran.IDPembayaran}
+	for _, path := range []string{"/api/users", "/api/keluarga", "/api/keluarga/my", "/api/santri/my", "/api/syahriah/my", "/api/pembayaran/my", "/api/kwitansi/my"} {
+		w := kirim(r, http.MethodGet, path, tokenA, nil)
+		for _, id := range idB {
+			if strings.Contains(w.Body.String(), id) {
+				t.Errorf("GET %s oleh wali A memuat data wali B (%s)", path, id)
+			}
+		}
+	}
+
+	// Pembanding: pemilik sendiri tetap bisa mengakses, jadi penolakan di atas bukan karena data test rusak
+	for _, path := range []string{
+		"/api/users/" + b.wali.IDUser,
+		"/api/keluarga/" + b.keluarga.IDKeluarga,
+		"/api/syahriah/" + b.syahriah.IDSyahriah,
+		"/api/syahriah/" + b.syahriah.IDSyahriah + "/pembayaran",
+		"/api/kwitansi/syahriah/" + b.bayar.IDBayar,
+		"/api/pembayaran/" + b.pembayaran.IDPembayaran,
+	} {
+		if w := kirim(r, http.MethodGet, path, tokenB, nil); w.Code != http.StatusOK {
+			t.Errorf("GET %s oleh pemiliknya: status %d, harapan 200: %s", path, w.Code, w.Body.String())
+		}
+	}
+}
+
+// Donasi dan rekap saldo hanya boleh diubah pengurus: wali ditolak di semua route tulis dan
+// route admin, dan datanya tidak berubah.
+func TestWaliTidakBisaMengubahDonasiDanRekap(t *testing.T) {
+	r, db := routerUji(t)
+	admin := ujidb.BuatUser(t, db, models.RoleAdmin)
+	wali := ujidb.BuatUser(t, db, models.RoleWali)
+	token := tokenUji(t, db, wali)
+
+	donasi := models.Donasi{
+		IDDonasi:    uuid.New().String(),
+		NamaDonatur: "Donatur Test",
+		NoTelp:      "081200000000",
+		Nominal:     25000,
+		DicatatOleh: admin.IDUser,
+		WaktuCatat:  time.Now(),
+	}
+	ujidb.Buat(t, db, &donasi)
+	rekap := models.RekapSaldo{IDSaldo: uuid.New().String(), Periode: "1999-01", SaldoAkhirTotal: 12345}
+	ujidb.Buat(t, db, &rekap)
+
+	harusDitolak(t, r, token, []routeUji{
+		{http.MethodPost, "/api/admin/donasi", gin.H{"nama_donatur": "Dari Wali", "nominal": 1000}},
+		{http.MethodGet, "/api/admin/donasi", nil},
+		{http.MethodGet, "/api/admin/donasi/" + donasi.IDDonasi, nil},
+		{http.MethodPut, "/api/admin/donasi/" + donasi.IDDonasi, gin.H{"nominal": 1}},
+		{http.MethodDelete, "/api/admin/donasi/" + donasi.IDDonasi, nil},
+		{http.MethodPost, "/api/admin/rekap", gin.H{"periode": "1999-02"}},
+		{http.MethodGet, "/api/admin/rekap", nil},
+		{http.MethodPut, "/api/admin/rekap/" + rekap.IDSaldo, gin.H{"saldo_akhir_total": 1}},
+		{http.MethodDelete, "/api/admin/rekap/" + rekap.IDSaldo, nil},
+		{http.MethodPost, "/api/admin/rekap/generate", nil},
+		{http.MethodPost, "/api/admin/rekap/sync", nil},
+	}, http.StatusForbidden)
+
+	var donasiSesudah models.Donasi
+	if err := db.First(&donasiSesudah, "id_donasi = ?", donasi.IDDonasi).Error; err != nil {
+		t.Errorf("donasi hilang: %v", err)
+	} else if donasiSesudah.Nominal != donasi.Nominal {
+		t.Errorf("nominal donasi berubah menjadi %.2f", donasiSesudah.Nominal)
+	}
+	var rekapSesudah models.RekapSaldo
+	if err := db.First(&rekapSesudah, "id_saldo = ?", rekap.IDSaldo).Error; err != nil {
+		t.Errorf("rekap hilang: %v", err)
+	} else if rekapSesudah.SaldoAkhirTotal != rekap.SaldoAkhirTotal {
+		t.Errorf("saldo akhir rekap berubah menjadi %.2f", rekapSesudah.SaldoAkhirTotal)
+	}
+	var rekapBaru int64
+	db.Model(&models.RekapSaldo{}).Where("periode = ?", "1999-02").Count(&rekapBaru)
+	if rekapBaru != 0 {
+		t.Errorf("wali berhasil membuat rekap periode 1999-02")
+	}
+}
+
+// Donasi yang dibaca wali lewat route protected mengikuti pilihan privasi donatur: nama donatur anonim
+// dan nomor telepon tidak pernah ikut terkirim.
+func TestDonasiUntukWaliMengikutiPrivasiDonatur(t *testing.T) {
+	r, db := routerUji(t)
+	admin := ujidb.BuatUser(t, db, models.RoleAdmin)
+	wali := ujidb.BuatUser(t, db, models.RoleWali)
+	token := tokenUji(t, db, wali)
+
+	donasi := models.Donasi{
+		IDDonasi:     uuid.New().String(),
+		NamaDonatur:  "Donatur Rahasia " + uuid.New().String()[:8],
+		NoTelp:       "0812" + time.Now().Format("150405"),
+		TampilanNama: models.TampilkanAnonim,
+		Nominal:      25000,
+		DicatatOleh:  admin.IDUser,
+		WaktuCatat:   time.Now(),
+	}
+	ujidb.Buat(t, db, &donasi)
+
+	hariIni := time.Now().Format("2006-01-02")
+	for _, path := range []string{
+		"/api/donasi?limit=100",
+		"/api/donasi/" + donasi.IDDonasi,
+		"/api/donasi/by-date?start_date=" + hariIni + "&end_date=" + hariIni,
+	} {
+		w := kirim(r, http.MethodGet, path, token, nil)
+		if w.Code != http.StatusOK {
+			t.Errorf("GET %s: status %d, harapan 200: %s", path, w.Code, w.Body.String())
+			continue
+		}
+		for _, rahasia := range []string{donasi.NamaDonatur, donasi.NoTelp} {
+			if strings.Contains(w.Body.String(), rahasia) {
+				t.Errorf("GET %s oleh wali memuat data donatur anonim (%s)", path, rahasia)
+			}
+		}
+	}
+}
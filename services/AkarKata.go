@@ -0,0 +1,204 @@
+package services
+
+import (
+	"strings"
+	"unicode"
+)
+
+// kataUmum adalah stop-word bahasa Indonesia yang tidak diindeks dan diabaikan di kata kunci
+var kataUmum = map[string]bool{}
+
+func init() {
+	for _, k := range strings.Fields(`
+		ada adalah agar akan aku anda antara apa apabila atas atau bagi bahwa baik banyak
+		beberapa begitu belum bisa boleh bukan cukup dalam dan dapat dari daripada demikian
+		dengan di dia hal hampir hanya harus hingga ia ialah ini itu jadi jika juga kalau
+		kami kamu karena ke kecuali kepada ketika kita lagi lain lalu maka masih mereka
+		misalnya mungkin namun nya oleh pada para pula pun sampai saat saja sangat saya
+		se sebab sebagai sebelum sedang sehingga sejak selain semua seperti serta setelah
+		setiap sudah supaya tanpa tapi telah tentang terhadap tersebut tetapi tiap untuk
+		walaupun yaitu yakni yang
+	`) {
+		kataUmum[k] = true
+	}
+}
+
+// Imbuhan yang dilepas oleh AkarKata, dari yang terpanjang agar "meng" dicoba sebelum "me"
+var (
+	akhiranPartikel    = []string{"kah", "lah", "pun"}
+	akhiranKepemilikan = []string{"nya", "ku", "mu"}
+	akhiranTurunan     = []string{"kan", "an", "i"}
+	awalanKedua        = []string{"ber", "per", "pe"}
+)
+
+// awalanPertama memetakan awalan ke kemungkinan huruf awal kata dasar yang luluh karenanya jika
+// sisa katanya diawali vokal. Misalnya "menulis" bisa berasal dari "tulis", sedangkan "menanti"
+// dari "nanti"; karena tanpa kamus tidak bisa dipastikan, keduanya dijadikan kandidat.
+// String kosong berarti tidak ada huruf yang luluh.
+var awalanPertama = []struct {
+	Awalan string
+	Luluh  []string
+}{
+	{"meng", []string{"", "k"}},
+	{"meny", []string{"s", "ny"}},
+	{"men", []string{"t", "n"}},
+	{"mem", []string{"p", "m"}},
+	{"me", []string{""}},
+	{"peng", []string{"", "k"}},
+	{"peny", []string{"s", "ny"}},
+	{"pen", []string{"t", "n"}},
+	{"pem", []string{"p", "m"}},
+	{"di", []string{""}},
+	{"ter", []string{""}},
+	{"ke", []string{""}},
+}
+
+// TokenKata memecah teks menjadi kata huruf kecil, tanpa tanda baca dan stop-word
+func TokenKata(teks string) []string {
+	var hasil []string
+	for _, kata := range strings.FieldsFunc(strings.ToLower(teks), bukanHurufAngka) {
+		if len([]rune(kata)) < 2 || kataUmum[kata] {
+			continue
+		}
+		hasil = append(hasil, kata)
+	}
+	return hasil
+}
+
+func bukanHurufAngka(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// AkarKata melepas imbuhan dasar bahasa Indonesia tanpa kamus: partikel (-lah, -kah),
+// kata ganti milik (-nya, -ku), awalan (me-, di-, ter-, ke-, pe-, ber-, per-) beserta peluluhan
+// huruf awalnya, dan akhiran (-kan, -an, -i). Hasilnya tidak selalu kata dasar yang benar,
+// tetapi konsisten untuk kata di konten maupun di kata kunci sehingga "pengumuman",
+// "diumumkan", dan "mengumumkan" bertemu di kandidat yang sama. Kata dengan peluluhan
+// menghasilkan lebih dari satu kandidat.
+func AkarKata(kata string) []string {
+	if !hurufSaja(kata) || len(kata) <= 4 {
+		return []string{kata}
+	}
+
+	dasar := lepasAkhiran(kata, akhiranPartikel)
+	dasar = lepasAkhiran(dasar, akhiranKepemilikan)
+
+	kandidat := []string{dasar}
+	adaAwalan := false
+	for _, a := range awalanPertama {
+		sisa, ok := strings.CutPrefix(dasar, a.Awalan)
+		if !ok || sisa == "" {
+			continue
+		}
+		luluh := a.Luluh
+		if !vokal(sisa[0]) {
+			// "mendengar", "membaca": tidak ada huruf yang luluh
+			luluh = []string{""}
+		}
+		var calon []string
+		for _, l := range luluh {
+			if c := l + sisa; cukupSuku(c) {
+				calon = append(calon, c)
+			}
+		}
+		if len(calon) > 0 {
+			kandidat, adaAwalan = calon, true
+			break
+		}
+	}
+
+	for i, k := range kandidat {
+		k = lepasAwalanKedua(k)
+		kandidat[i] = lepasAkhiranTurunan(k, adaAwalan)
+	}
+	return unik(kandidat)
+}
+
+// bentukKhusus adalah awalan yang bentuknya berubah di depan kata dasar tertentu. Awalan be-
+// hanya dilepas di sini agar kata seperti "berita" dan "benar" tetap utuh.
+var bentukKhusus = []struct{ Awalan, Dasar string }{
+	{"bel", "ajar"},
+	{"pel", "ajar"},
+	{"be", "kerja"},
+}
+
+func lepasAwalanKedua(kata string) string {
+	for _, b := range bentukKhusus {
+		if strings.HasPrefix(kata, b.Awalan+b.Dasar) {
+			return kata[len(b.Awalan):]
+		}
+	}
+	for _, a := range awalanKedua {
+		if sisa, ok := strings.CutPrefix(kata, a); ok && cukupSuku(sisa) {
+			return sisa
+		}
+	}
+	return kata
+}
+
+// lepasAkhiranTurunan melepas -kan, -an, atau -i. Akhiran -i hanya dilepas jika kata berawalan,
+// karena banyak kata dasar yang berakhiran i (santri, pagi, hari).
+func lepasAkhiranTurunan(kata string, adaAwalan bool) string {
+	for _, a := range akhiranTurunan {
+		if a == "i" && !adaAwalan {
+			continue
+		}
+		if sisa, ok := strings.CutSuffix(kata, a); ok && cukupSuku(sisa) {
+			return sisa
+		}
+	}
+	return kata
+}
+
+func lepasAkhiran(kata string, daftar []string) string {
+	for _, a := range daftar {
+		if sisa, ok := strings.CutSuffix(kata, a); ok && cukupSuku(sisa) {
+			return sisa
+		}
+	}
+	return kata
+}
+
+// cukupSuku memastikan sisa kata masih punya minimal dua vokal dan empat huruf,
+// agar kata seperti "kelas", "makan", atau "berani" tidak terpotong
+func cukupSuku(kata string) bool {
+	if len(kata) < 4 {
+		return false
+	}
+	jumlah := 0
+	for i := 0; i < len(kata); i++ {
+		if vokal(kata[i]) {
+			jumlah++
+		}
+	}
+	return jumlah >= 2
+}
+
+func vokal(b byte) bool {
+	switch b {
+	case 'a', 'i', 'u', 'e', 'o':
+		return true
+	}
+	return false
+}
+
+func hurufSaja(kata string) bool {
+	for i := 0; i < len(kata); i++ {
+		if kata[i] < 'a' || kata[i] > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+func unik(daftar []string) []string {
+	hasil := daftar[:0]
+	ada := make(map[string]bool, len(daftar))
+	for _, s := range daftar {
+		if !ada[s] {
+			ada[s] = true
+			hasil = append(hasil, s)
+		}
+	}
+	return hasil
+}
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"tpq_asysyafii/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var ErrRevisiTidakDitemukan = errors.New("revisi berita tidak ditemukan")
+
+// batasSelDiff membatasi tabel LCS (baris lama x baris baru) agar diff artikel sangat panjang
+// tidak menghabiskan memori; di atas batas ini seluruh konten dianggap diganti
+const batasSelDiff = 4_000_000
+
+type JenisDiff string
+
+const (
+	DiffSama   JenisDiff = "sama"
+	DiffTambah JenisDiff = "tambah"
+	DiffHapus  JenisDiff = "hapus"
+)
+
+// BarisDiff adalah satu baris konten pada diff
+type BarisDiff struct {
+	Jenis JenisDiff `json:"jenis"`
+	Teks  string    `json:"teks"`
+}
+
+// DiffRevisi membandingkan dua revisi berita. Perubahan berisi field selain konten yang berbeda,
+// dengan format yang sama seperti diff di log aktivitas.
+type DiffRevisi struct {
+	Dari      int                       `json:"dari"`
+	Ke        int                       `json:"ke"`
+	Perubahan map[string]PerubahanField `json:"perubahan"`
+	Konten    []BarisDiff               `json:"konten"`
+	Ditambah  int                       `json:"ditambah"`
+	Dihapus   int                       `json:"dihapus"`
+}
+
+// DiffBaris menghitung diff per baris dengan longest common subsequence
+func DiffBaris(lama, baru string) []BarisDiff {
+	a := strings.Split(strings.ReplaceAll(lama, "\r\n", "\n"), "\n")
+	b := strings.Split(strings.ReplaceAll(baru, "\r\n", "\n"), "\n")
+
+	// Baris awal dan akhir yang sama tidak perlu masuk tabel LCS
+	awal := 0
+	for awal < len(a) && awal < len(b) && a[awal] == b[awal] {
+		awal++
+	}
+	akhir := 0
+	for akhir < len(a)-awal && akhir < len(b)-awal && a[len(a)-1-akhir] == b[len(b)-1-akhir] {
+		akhir++
+	}
+
+	hasil := make([]BarisDiff, 0, len(a)+len(b))
+	for _, t := range a[:awal] {
+		hasil = append(hasil, BarisDiff{DiffSama, t})
+	}
+	tengahA, tengahB := a[awal:len(a)-akhir], b[awal:len(b)-akhir]
+	n, m := len(tengahA), len(tengahB)
+
+	if n*m > batasSelDiff {
+		for _, t := range tengahA {
+			hasil = append(hasil, BarisDiff{DiffHapus, t})
+		}
+		for _, t := range tengahB {
+			hasil = append(hasil, BarisDiff{DiffTambah, t})
+		}
+	} else {
+		// lcs[i][j] = panjang LCS tengahA[i:] dan tengahB[j:]
+		lcs := make([][]int32, n+1)
+		for i := range lcs {
+			lcs[i] = make([]int32, m+1)
+		}
+		for i := n - 1; i >= 0; i-- {
+			for j := m - 1; j >= 0; j-- {
+				if tengahA[i] == tengahB[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] >= lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < n && j < m {
+			switch {
+			case tengahA[i] == tengahB[j]:
+				hasil = append(hasil, BarisDiff{DiffSama, tengahA[i]})
+				i, j = i+1, j+1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				hasil = append(hasil, BarisDiff{DiffHapus, tengahA[i]})
+				i++
+			default:
+				hasil = append(hasil, BarisDiff{DiffTambah, tengahB[j]})
+				j++
+			}
+		}
+		for ; i < n; i++ {
+			hasil = append(hasil, BarisDiff{DiffHapus, tengahA[i]})
+		}
+		for ; j < m; j++ {
+			hasil = append(hasil, BarisDiff{DiffTambah, tengahB[j]})
+		}
+	}
+
+	for _, t := range a[len(a)-akhir:] {
+		hasil = append(hasil, BarisDiff{DiffSama, t})
+	}
+	return hasil
+}
+
+// BandingkanRevisi menghasilkan diff dari revisi lama ke revisi baru
+func BandingkanRevisi(lama, baru models.BeritaRevisi) DiffRevisi {
+	diff := DiffRevisi{Dari: lama.Nomor, Ke: baru.Nomor, Perubahan: make(map[string]PerubahanField)}
+	tambah := func(field, a, b string) {
+		if a != b {
+			diff.Perubahan[field] = PerubahanField{Sebelum: a, Sesudah: b}
+		}
+	}
+	tambah("judul", lama.Judul, baru.Judul)
+	tambah("kategori", string(lama.Kategori), string(baru.Kategori))
+	tambah("format_konten", string(lama.FormatKonten), string(baru.FormatKonten))
+	tambah("gambar_cover", nilaiString(lama.GambarCover), nilaiString(baru.GambarCover))
+
+	diff.Konten = DiffBaris(lama.Konten, baru.Konten)
+	for _, b := range diff.Konten {
+		switch b.Jenis {
+		case DiffTambah:
+			diff.Ditambah++
+		case DiffHapus:
+			diff.Dihapus++
+		}
+	}
+	return diff
+}
+
+func nilaiString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// revisiDariBerita menyalin isi berita yang dicatat di riwayat revisi
+func revisiDariBerita(berita models.Berita, oleh, keterangan string) models.BeritaRevisi {
+	return models.BeritaRevisi{
+		IDRevisi:      uuid.New().String(),
+		IDBerita:      berita.IDBerita,
+		Judul:         berita.Judul,
+		Konten:        berita.Konten,
+		FormatKonten:  berita.FormatKonten,
+		Kategori:      berita.Kategori,
+		GambarCover:   berita.GambarCover,
+		IDGambarCover: berita.IDGambarCover,
+		Keterangan:    keterangan,
+		DiubahOleh:    oleh,
+	}
+}
+
+func samaIsi(a, b models.BeritaRevisi) bool {
+	return a.Judul == b.Judul && a.Konten == b.Konten && a.FormatKonten == b.FormatKonten && a.Kategori == b.Kategori &&
+		nilaiString(a.IDGambarCover) == nilaiString(b.IDGambarCover) && nilaiString(a.GambarCover) == nilaiString(b.GambarCover)
+}
+
+// CatatRevisiBerita menyimpan isi berita setelah diubah sebagai revisi baru. Jika berita belum punya
+// revisi (dibuat sebelum riwayat revisi ada), isi sebelumnya dicatat dulu sebagai revisi pertama agar
+// perubahan ini tetap bisa dibandingkan dan dipulihkan. Perubahan yang tidak menyentuh isi (misalnya
+// hanya status) tidak membuat revisi; hasilnya nil.
+func CatatRevisiBerita(db *gorm.DB, sebelum *models.Berita, sesudah models.Berita, oleh, keterangan string) (*models.BeritaRevisi, error) {
+	var terakhir models.BeritaRevisi
+	if err := db.Where("id_berita = ?", sesudah.IDBerita).Order("nomor DESC").Limit(1).Find(&terakhir).Error; err != nil {
+		return nil, err
+	}
+
+	if terakhir.IDRevisi == "" && sebelum != nil {
+		awal := revisiDariBerita(*sebelum, sebelum.PenulisID, "Versi sebelum riwayat revisi dicatat")
+		awal.Nomor = 1
+		awal.DibuatPada = sebelum.DiperbaruiPada
+		if err := db.Create(&awal).Error; err != nil {
+			return nil, fmt.Errorf("gagal mencatat revisi awal: %w", err)
+		}
+		terakhir = awal
+	}
+
+	revisi := revisiDariBerita(sesudah, oleh, keterangan)
+	if terakhir.IDRevisi != "" && samaIsi(terakhir, revisi) {
+		return nil, nil
+	}
+	revisi.Nomor = terakhir.Nomor + 1
+	if err := db.Create(&revisi).Error; err != nil {
+		return nil, err
+	}
+	return &revisi, nil
+}
+
+// AmbilRevisiBerita mengembalikan satu revisi berdasarkan nomornya
+func AmbilRevisiBerita(db *gorm.DB, idBerita string, nomor int) (*models.BeritaRevisi, error) {
+	var revisi models.BeritaRevisi
+	if err := db.Preload("Pengubah").Where("id_berita = ? AND nomor = ?", idBerita, nomor).Limit(1).Find(&revisi).Error; err != nil {
+		return nil, err
+	}
+	if revisi.IDRevisi == "" {
+		return nil, fmt.Errorf("%w: nomor %d", ErrRevisiTidakDitemukan, nomor)
+	}
+	return &revisi, nil
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+var namaBulan = [...]string{
+	"Januari", "Februari", "Maret", "April", "Mei", "Juni",
+	"Juli", "Agustus", "September", "Oktober", "November", "Desember",
+}
+
+// FormatRupiah menulis nominal dengan pemisah ribuan titik, misalnya Rp110.000
+func FormatRupiah(nominal float64) string {
+	sen := keSen(nominal)
+	negatif := sen < 0
+	if negatif {
+		sen = -sen
+	}
+
+	angka := strconv.FormatInt(sen/100, 10)
+	var b strings.Builder
+	for i, r := range angka {
+		if i > 0 && (len(angka)-i)%3 == 0 {
+			b.WriteByte('.')
+		}
+		b.WriteRune(r)
+	}
+	if sisa := sen % 100; sisa != 0 {
+		b.WriteString("," + strconv.FormatInt(sisa+100, 10)[1:])
+	}
+
+	if negatif {
+		return "-Rp" + b.String()
+	}
+	return "Rp" + b.String()
+}
+
+// FormatBulan menulis periode YYYY-MM sebagai nama bulan, misalnya "Oktober 2026"
+func FormatBulan(periode string) string {
+	t, err := time.Parse("2006-01", periode)
+	if err != nil {
+		return periode
+	}
+	return namaBulan[t.Month()-1] + " " + strconv.Itoa(t.Year())
+}
+
+// FormatTanggal menulis tanggal dengan nama bulan, misalnya "18 Oktober 2026"
+func FormatTanggal(t time.Time) string {
+	return strconv.Itoa(t.Day()) + " " + namaBulan[t.Month()-1] + " " + strconv.Itoa(t.Year())
+}
+
+var angkaSatuan = [...]string{
+	"", "satu", "dua", "tiga", "empat", "lima", "enam", "tujuh", "delapan", "sembilan", "sepuluh", "sebelas",
+}
+
+// terbilangBulat menulis bilangan bulat positif dalam kata, misalnya 110000 menjadi "seratus sepuluh ribu"
+func terbilangBulat(n int64) string {
+	switch {
+	case n < 12:
+		return angkaSatuan[n]
+	case n < 20:
+		return terbilangBulat(n-10) + " belas"
+	case n < 100:
+		return terbilangBulat(n/10) + " puluh " + terbilangBulat(n%10)
+	case n < 200:
+		return "seratus " + terbilangBulat(n-100)
+	case n < 1000:
+		return terbilangBulat(n/100) + " ratus " + terbilangBulat(n%100)
+	case n < 2000:
+		return "seribu " + terbilangBulat(n-1000)
+	case n < 1_000_000:
+		return terbilangBulat(n/1000) + " ribu " + terbilangBulat(n%1000)
+	case n < 1_000_000_000:
+		return terbilangBulat(n/1_000_000) + " juta " + terbilangBulat(n%1_000_000)
+	case n < 1_000_000_000_000:
+		return terbilangBulat(n/1_000_000_000) + " miliar " + terbilangBulat(n%1_000_000_000)
+	default:
+		return terbilangBulat(n/1_000_000_000_000) + " triliun " + terbilangBulat(n%1_000_000_000_000)
+	}
+}
+
+// Terbilang menulis nominal rupiah dalam kata untuk kwitansi, misalnya "seratus sepuluh ribu rupiah"
+func Terbilang(nominal float64) string {
+	sen := keSen(nominal)
+	awalan := ""
+	if sen < 0 {
+		awalan, sen = "minus ", -sen
+	}
+
+	kata := "nol"
+	if sen >= 100 {
+		kata = terbilangBulat(sen / 100)
+	}
+	kata += " rupiah"
+	if sisa := sen % 100; sisa != 0 {
+		kata += " " + terbilangBulat(sisa) + " sen"
+	}
+	return awalan + strings.Join(strings.Fields(kata), " ")
+}
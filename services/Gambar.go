@@ -0,0 +1,233 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// batasPikselGambar mencegah decode gambar beresolusi ekstrem (decompression bomb)
+const batasPikselGambar = 40_000_000
+
+// kualitasJPEG dipakai untuk semua varian; cukup tajam untuk foto dengan ukuran berkas kecil
+const kualitasJPEG = 82
+
+var ErrGambarTidakValid = errors.New("berkas gambar rusak atau tidak dapat dibaca")
+
+// Varian gambar yang dihasilkan dari setiap unggahan, dari yang terbesar.
+// Sisi adalah panjang maksimal sisi terpanjang; gambar kecil tidak diperbesar.
+const (
+	VarianFull      = "full"
+	VarianCard      = "card"
+	VarianThumbnail = "thumbnail"
+)
+
+var ukuranVarian = []struct {
+	Nama string
+	Sisi int
+}{
+	{VarianFull, 1600},
+	{VarianCard, 800},
+	{VarianThumbnail, 320},
+}
+
+// BerkasVarian adalah satu varian gambar yang sudah di-encode ulang
+type BerkasVarian struct {
+	Nama       string
+	Isi        []byte
+	TipeKonten string
+	Ekstensi   string
+	Lebar      int
+	Tinggi     int
+}
+
+// ProsesGambar men-decode gambar, memutarnya sesuai orientasi EXIF, lalu meng-encode ulang
+// setiap varian. Karena hanya piksel yang di-encode ulang, semua metadata (EXIF, GPS, profil
+// kamera) ikut terbuang. Gambar dengan transparansi disimpan sebagai PNG, selain itu JPEG.
+// WebP dan GIF diterima sebagai masukan, GIF animasi hanya diambil frame pertamanya.
+func ProsesGambar(isi []byte) ([]BerkasVarian, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(isi))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrGambarTidakValid, err)
+	}
+	if cfg.Width*cfg.Height > batasPikselGambar {
+		return nil, fmt.Errorf("%w: resolusi %dx%d terlalu besar", ErrMediaTerlaluBesar, cfg.Width, cfg.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(isi))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrGambarTidakValid, err)
+	}
+	sumber := keNRGBA(img)
+	sumber = terapkanOrientasi(sumber, orientasiEXIF(isi))
+	transparan := punyaTransparansi(sumber)
+
+	hasil := make([]BerkasVarian, 0, len(ukuranVarian))
+	for _, u := range ukuranVarian {
+		// Varian kecil diperkecil dari varian sebelumnya agar tidak selalu memproses gambar asli
+		sumber = perkecil(sumber, u.Sisi)
+		varian := BerkasVarian{Nama: u.Nama, Lebar: sumber.Bounds().Dx(), Tinggi: sumber.Bounds().Dy()}
+
+		var buf bytes.Buffer
+		if transparan {
+			enc := png.Encoder{CompressionLevel: png.BestCompression}
+			err = enc.Encode(&buf, sumber)
+			varian.TipeKonten, varian.Ekstensi = "image/png", ".png"
+		} else {
+			err = jpeg.Encode(&buf, sumber, &jpeg.Options{Quality: kualitasJPEG})
+			varian.TipeKonten, varian.Ekstensi = "image/jpeg", ".jpg"
+		}
+		if err != nil {
+			return nil, fmt.Errorf("gagal meng-encode varian %s: %w", u.Nama, err)
+		}
+		varian.Isi = buf.Bytes()
+		hasil = append(hasil, varian)
+	}
+	return hasil, nil
+}
+
+func keNRGBA(img image.Image) *image.NRGBA {
+	if n, ok := img.(*image.NRGBA); ok && n.Rect.Min == (image.Point{}) {
+		return n
+	}
+	b := img.Bounds()
+	n := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(n, n.Bounds(), img, b.Min, draw.Src)
+	return n
+}
+
+func punyaTransparansi(img *image.NRGBA) bool {
+	for i := 3; i < len(img.Pix); i += 4 {
+		if img.Pix[i] != 0xff {
+			return true
+		}
+	}
+	return false
+}
+
+// perkecil memperkecil gambar agar sisi terpanjangnya tidak melebihi sisi, dengan rasio tetap
+func perkecil(img *image.NRGBA, sisi int) *image.NRGBA {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if w <= sisi && h <= sisi {
+		return img
+	}
+	nw, nh := sisi, h*sisi/w
+	if h > w {
+		nw, nh = w*sisi/h, sisi
+	}
+	if nw < 1 {
+		nw = 1
+	}
+	if nh < 1 {
+		nh = 1
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, nw, nh))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), xdraw.Src, nil)
+	return dst
+}
+
+// orientasiEXIF membaca tag Orientation (0x0112) dari segmen APP1 Exif di JPEG.
+// Mengembalikan 1 (normal) jika tidak ada atau tidak terbaca.
+func orientasiEXIF(isi []byte) int {
+	if len(isi) < 4 || isi[0] != 0xff || isi[1] != 0xd8 {
+		return 1
+	}
+	p := 2
+	for p+4 <= len(isi) {
+		if isi[p] != 0xff {
+			return 1
+		}
+		marker := isi[p+1]
+		if marker == 0xda || marker == 0xd9 { // awal data gambar, tidak ada EXIF lagi
+			return 1
+		}
+		panjang := int(binary.BigEndian.Uint16(isi[p+2 : p+4]))
+		if panjang < 2 || p+2+panjang > len(isi) {
+			return 1
+		}
+		segmen := isi[p+4 : p+2+panjang]
+		if marker == 0xe1 && len(segmen) > 6 && string(segmen[:6]) == "Exif\x00\x00" {
+			return orientasiTIFF(segmen[6:])
+		}
+		p += 2 + panjang
+	}
+	return 1
+}
+
+func orientasiTIFF(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var bo binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(bo.Uint32(tiff[4:8]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	jumlah := int(bo.Uint16(tiff[ifd : ifd+2]))
+	for i := 0; i < jumlah; i++ {
+		e := ifd + 2 + i*12
+		if e+12 > len(tiff) {
+			return 1
+		}
+		if bo.Uint16(tiff[e:e+2]) == 0x0112 {
+			if o := int(bo.Uint16(tiff[e+8 : e+10])); o >= 1 && o <= 8 {
+				return o
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// terapkanOrientasi memutar/membalik gambar sesuai nilai orientasi EXIF (1-8)
+func terapkanOrientasi(img *image.NRGBA, orientasi int) *image.NRGBA {
+	if orientasi <= 1 || orientasi > 8 {
+		return img
+	}
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	dw, dh := w, h
+	if orientasi >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientasi {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[y*dst.Stride+x*4:y*dst.Stride+x*4+4], img.Pix[sy*img.Stride+sx*4:sy*img.Stride+sx*4+4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,396 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+	"tpq_asysyafii/models"
+
+	"gorm.io/gorm"
+)
+
+type JenisTemuan string
+
+const (
+	TemuanRekapHilang        JenisTemuan = "rekap_hilang"
+	TemuanRekapGanda         JenisTemuan = "rekap_ganda"
+	TemuanSelisihRekap       JenisTemuan = "selisih_rekap"
+	TemuanRantaiPutus        JenisTemuan = "rantai_putus"
+	TemuanJurnalTidakSinkron JenisTemuan = "jurnal_tidak_sinkron"
+)
+
+// TemuanIntegritas adalah satu ketidaksesuaian pada rekap saldo. Tersimpan adalah angka di database,
+// Seharusnya adalah angka yang dihitung ulang dari transaksi sumber.
+type TemuanIntegritas struct {
+	Jenis      JenisTemuan `json:"jenis"`
+	Periode    string      `json:"periode"`
+	Kolom      string      `json:"kolom,omitempty"`
+	Tersimpan  float64     `json:"tersimpan"`
+	Seharusnya float64     `json:"seharusnya"`
+	Keterangan string      `json:"keterangan"`
+}
+
+type HasilIntegritas struct {
+	DiperiksaPada time.Time          `json:"diperiksa_pada"`
+	PeriodeAwal   string             `json:"periode_awal"`
+	PeriodeAkhir  string             `json:"periode_akhir"`
+	JumlahPeriode int                `json:"jumlah_periode"`
+	Sehat         bool               `json:"sehat"`
+	Temuan        []TemuanIntegritas `json:"temuan"`
+}
+
+// IntegritasService memeriksa apakah rekap_saldo masih sesuai dengan syahriah_bayar, donasi, dan
+// pemakaian_saldo. Penyesuaian saldo manual dan koreksi tutup buku (jurnal REKAP_SALDO dan
+// KOREKSI_SALDO) ikut dihitung karena tidak punya transaksi sumber.
+type IntegritasService struct {
+	db *gorm.DB
+}
+
+func NewIntegritasService(db *gorm.DB) *IntegritasService {
+	return &IntegritasService{db: db}
+}
+
+// mutasiDana adalah pergerakan satu periode dalam sen
+type mutasiDana struct {
+	masukSyahriah, masukDonasi   int64
+	keluarSyahriah, keluarDonasi int64
+	sesuaiSyahriah, sesuaiDonasi int64
+}
+
+type kolomNilai struct {
+	nama  string
+	nilai float64
+}
+
+func kolomRingkasan(r RingkasanRekap) []kolomNilai {
+	return []kolomNilai{
+		{"pemasukan_syahriah", r.PemasukanSyahriah},
+		{"pengeluaran_syahriah", r.PengeluaranSyahriah},
+		{"saldo_akhir_syahriah", r.SaldoAkhirSyahriah},
+		{"pemasukan_donasi", r.PemasukanDonasi},
+		{"pengeluaran_donasi", r.PengeluaranDonasi},
+		{"saldo_akhir_donasi", r.SaldoAkhirDonasi},
+		{"pemasukan_total", r.PemasukanTotal},
+		{"pengeluaran_total", r.PengeluaranTotal},
+		{"saldo_akhir_total", r.SaldoAkhirTotal},
+	}
+}
+
+func ringkasanDariRekap(r models.RekapSaldo) RingkasanRekap {
+	return RingkasanRekap{
+		PemasukanSyahriah:   r.PemasukanSyahriah,
+		PengeluaranSyahriah: r.PengeluaranSyahriah,
+		SaldoAkhirSyahriah:  r.SaldoAkhirSyahriah,
+		PemasukanDonasi:     r.PemasukanDonasi,
+		PengeluaranDonasi:   r.PengeluaranDonasi,
+		SaldoAkhirDonasi:    r.SaldoAkhirDonasi,
+		PemasukanTotal:      r.PemasukanTotal,
+		PengeluaranTotal:    r.PengeluaranTotal,
+		SaldoAkhirTotal:     r.SaldoAkhirTotal,
+	}
+}
+
+// bandingkan mencatat satu temuan untuk setiap kolom yang berbeda
+func bandingkan(temuan []TemuanIntegritas, jenis JenisTemuan, periode, keterangan string, tersimpan, seharusnya RingkasanRekap) []TemuanIntegritas {
+	a, b := kolomRingkasan(tersimpan), kolomRingkasan(seharusnya)
+	for i := range a {
+		if keSen(a[i].nilai) != keSen(b[i].nilai) {
+			temuan = append(temuan, TemuanIntegritas{
+				Jenis:      jenis,
+				Periode:    periode,
+				Kolom:      a[i].nama,
+				Tersimpan:  a[i].nilai,
+				Seharusnya: b[i].nilai,
+				Keterangan: keterangan,
+			})
+		}
+	}
+	return temuan
+}
+
+// mutasiSumber menghitung ulang pemasukan, pengeluaran, dan penyesuaian per periode langsung dari tabel sumber
+func (s *IntegritasService) mutasiSumber() (map[string]*mutasiDana, error) {
+	hasil := make(map[string]*mutasiDana)
+	ambil := func(t time.Time) *mutasiDana {
+		periode := t.Format("2006-01")
+		if hasil[periode] == nil {
+			hasil[periode] = &mutasiDana{}
+		}
+		return hasil[periode]
+	}
+
+	var bayarList []models.SyahriahBayar
+	if err := s.db.Select("waktu_bayar", "nominal").Where("metode <> ?", models.BayarKredit).Find(&bayarList).Error; err != nil {
+		return nil, err
+	}
+	for _, b := range bayarList {
+		ambil(b.WaktuBayar).masukSyahriah += keSen(b.Nominal)
+	}
+
+	var donasiList []models.Donasi
+	if err := s.db.Select("waktu_catat", "nominal").Find(&donasiList).Error; err != nil {
+		return nil, err
+	}
+	for _, d := range donasiList {
+		ambil(d.WaktuCatat).masukDonasi += keSen(d.Nominal)
+	}
+
+	var pemakaianList []models.PemakaianSaldo
+	if err := s.db.Select("tanggal_pemakaian", "created_at", "nominal_syahriah", "nominal_donasi").Find(&pemakaianList).Error; err != nil {
+		return nil, err
+	}
+	for _, p := range pemakaianList {
+		// Tanggal sama dengan yang dipakai CatatPemakaian
+		tanggal := p.CreatedAt
+		if p.TanggalPemakaian != nil {
+			tanggal = *p.TanggalPemakaian
+		}
+		m := ambil(tanggal)
+		m.keluarSyahriah += keSen(p.NominalSyahriah)
+		m.keluarDonasi += keSen(p.NominalDonasi)
+	}
+
+	var penyesuaian []saldoBaris
+	if err := s.db.Table("jurnal_entri").
+		Select("jurnal.periode AS periode, jurnal_entri.akun AS akun, COALESCE(SUM(jurnal_entri.debit), 0) AS debit, COALESCE(SUM(jurnal_entri.kredit), 0) AS kredit").
+		Joins("JOIN jurnal ON jurnal.id_jurnal = jurnal_entri.id_jurnal").
+		Where("jurnal.sumber_tipe IN ? AND jurnal_entri.akun IN ?", []string{TargetRekapSaldo, TargetKoreksiSaldo}, []models.Akun{models.AkunKasSyahriah, models.AkunKasDonasi}).
+		Group("jurnal.periode, jurnal_entri.akun").
+		Scan(&penyesuaian).Error; err != nil {
+		return nil, err
+	}
+	for _, p := range penyesuaian {
+		t, err := time.Parse("2006-01", p.Periode)
+		if err != nil {
+			continue
+		}
+		net := keSen(p.Debit) - keSen(p.Kredit)
+		if p.Akun == models.AkunKasSyahriah {
+			ambil(t).sesuaiSyahriah += net
+		} else {
+			ambil(t).sesuaiDonasi += net
+		}
+	}
+	return hasil, nil
+}
+
+// daftarPeriode mengembalikan semua periode YYYY-MM dari awal sampai akhir
+func daftarPeriode(awal, akhir string) []string {
+	mulai, err := time.Parse("2006-01", awal)
+	if err != nil {
+		return nil
+	}
+	var hasil []string
+	for p := mulai; p.Format("2006-01") <= akhir; p = p.AddDate(0, 1, 0) {
+		hasil = append(hasil, p.Format("2006-01"))
+	}
+	return hasil
+}
+
+// Periksa menghitung ulang setiap periode dari transaksi sumber lalu membandingkannya dengan rekap_saldo
+// dan jurnal, serta memeriksa bahwa saldo awal setiap periode sama dengan saldo akhir periode sebelumnya
+func (s *IntegritasService) Periksa() (*HasilIntegritas, error) {
+	hasil := &HasilIntegritas{DiperiksaPada: time.Now(), Temuan: []TemuanIntegritas{}}
+
+	mutasi, err := s.mutasiSumber()
+	if err != nil {
+		return nil, err
+	}
+
+	var rekapList []models.RekapSaldo
+	if err := s.db.Order("periode ASC, terakhir_update DESC").Find(&rekapList).Error; err != nil {
+		return nil, err
+	}
+	tersimpan := make(map[string]models.RekapSaldo)
+	jumlahBaris := make(map[string]int)
+	for _, r := range rekapList {
+		if jumlahBaris[r.Periode] == 0 {
+			tersimpan[r.Periode] = r
+		}
+		jumlahBaris[r.Periode]++
+	}
+
+	periodeJurnal, err := NewLedgerService(s.db).PeriodeJurnal()
+	if err != nil {
+		return nil, err
+	}
+
+	// Rentang pemeriksaan mencakup semua periode yang punya transaksi, jurnal, atau baris rekap
+	var semua []string
+	for p := range mutasi {
+		semua = append(semua, p)
+	}
+	for p := range tersimpan {
+		if _, err := time.Parse("2006-01", p); err == nil {
+			semua = append(semua, p)
+		}
+	}
+	semua = append(semua, periodeJurnal...)
+	if len(semua) == 0 {
+		hasil.Sehat = true
+		return hasil, nil
+	}
+	sort.Strings(semua)
+	hasil.PeriodeAwal, hasil.PeriodeAkhir = semua[0], semua[len(semua)-1]
+	periodeList := daftarPeriode(hasil.PeriodeAwal, hasil.PeriodeAkhir)
+	hasil.JumlahPeriode = len(periodeList)
+
+	ledger := NewLedgerService(s.db)
+	var saldoSyahriah, saldoDonasi int64
+	var sebelumnya *models.RekapSaldo
+	for _, periode := range periodeList {
+		m := mutasi[periode]
+		if m == nil {
+			m = &mutasiDana{}
+		}
+		saldoSyahriah += m.masukSyahriah - m.keluarSyahriah + m.sesuaiSyahriah
+		saldoDonasi += m.masukDonasi - m.keluarDonasi + m.sesuaiDonasi
+		seharusnya := RingkasanRekap{
+			PemasukanSyahriah:   float64(m.masukSyahriah) / 100,
+			PengeluaranSyahriah: float64(m.keluarSyahriah) / 100,
+			SaldoAkhirSyahriah:  float64(saldoSyahriah) / 100,
+			PemasukanDonasi:     float64(m.masukDonasi) / 100,
+			PengeluaranDonasi:   float64(m.keluarDonasi) / 100,
+			SaldoAkhirDonasi:    float64(saldoDonasi) / 100,
+			PemasukanTotal:      float64(m.masukSyahriah+m.masukDonasi) / 100,
+			PengeluaranTotal:    float64(m.keluarSyahriah+m.keluarDonasi) / 100,
+			SaldoAkhirTotal:     float64(saldoSyahriah+saldoDonasi) / 100,
+		}
+
+		jurnal, err := ledger.HitungRekap(periode)
+		if err != nil {
+			return nil, err
+		}
+		hasil.Temuan = bandingkan(hasil.Temuan, TemuanJurnalTidakSinkron, periode,
+			"Jurnal tidak sesuai dengan transaksi sumber", jurnal, seharusnya)
+
+		rekap, ada := tersimpan[periode]
+		if !ada {
+			hasil.Temuan = append(hasil.Temuan, TemuanIntegritas{
+				Jenis:      TemuanRekapHilang,
+				Periode:    periode,
+				Seharusnya: seharusnya.SaldoAkhirTotal,
+				Keterangan: "Rekap saldo periode ini belum ada",
+			})
+			sebelumnya = nil
+			continue
+		}
+		if jumlahBaris[periode] > 1 {
+			hasil.Temuan = append(hasil.Temuan, TemuanIntegritas{
+				Jenis:      TemuanRekapGanda,
+				Periode:    periode,
+				Tersimpan:  float64(jumlahBaris[periode]),
+				Seharusnya: 1,
+				Keterangan: fmt.Sprintf("Terdapat %d baris rekap untuk periode yang sama", jumlahBaris[periode]),
+			})
+		}
+		hasil.Temuan = bandingkan(hasil.Temuan, TemuanSelisihRekap, periode,
+			"Rekap tersimpan tidak sesuai dengan transaksi sumber", ringkasanDariRekap(rekap), seharusnya)
+
+		// Saldo awal (saldo akhir rekap sebelumnya) + mutasi tersimpan + penyesuaian harus sama dengan saldo akhir tersimpan
+		var awalSyahriah, awalDonasi float64
+		if sebelumnya != nil {
+			awalSyahriah, awalDonasi = sebelumnya.SaldoAkhirSyahriah, sebelumnya.SaldoAkhirDonasi
+		}
+		if sebelumnya != nil || periode == hasil.PeriodeAwal {
+			rantai := []struct {
+				kolom                      string
+				awal, masuk, keluar, akhir float64
+				sesuai                     int64
+			}{
+				{"saldo_akhir_syahriah", awalSyahriah, rekap.PemasukanSyahriah, rekap.PengeluaranSyahriah, rekap.SaldoAkhirSyahriah, m.sesuaiSyahriah},
+				{"saldo_akhir_donasi", awalDonasi, rekap.PemasukanDonasi, rekap.PengeluaranDonasi, rekap.SaldoAkhirDonasi, m.sesuaiDonasi},
+			}
+			for _, r := range rantai {
+				harus := keSen(r.awal) + keSen(r.masuk) - keSen(r.keluar) + r.sesuai
+				if harus != keSen(r.akhir) {
+					hasil.Temuan = append(hasil.Temuan, TemuanIntegritas{
+						Jenis:      TemuanRantaiPutus,
+						Periode:    periode,
+						Kolom:      r.kolom,
+						Tersimpan:  r.akhir,
+						Seharusnya: float64(harus) / 100,
+						Keterangan: "Saldo awal + pemasukan - pengeluaran + penyesuaian tidak sama dengan saldo akhir",
+					})
+				}
+			}
+		}
+		salinan := rekap
+		sebelumnya = &salinan
+	}
+
+	hasil.Sehat = len(hasil.Temuan) == 0
+	return hasil, nil
+}
+
+// Perbaiki menyelaraskan jurnal dengan transaksi sumber, menghapus baris rekap ganda, lalu menulis ulang
+// rekap seluruh periode dalam satu transaksi beserta log auditnya. Transaksi dibatalkan jika hasil
+// pemeriksaan ulang masih menemukan selisih.
+func (s *IntegritasService) Perbaiki(dicatatOleh string) (sebelum, sesudah *HasilIntegritas, err error) {
+	sebelum, err = s.Periksa()
+	if err != nil {
+		return nil, nil, err
+	}
+	if sebelum.Sehat {
+		return sebelum, sebelum, nil
+	}
+	if dicatatOleh == "" {
+		return sebelum, nil, errors.New("pengguna pencatat perbaikan wajib diisi")
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		ledger := NewLedgerService(tx)
+		if err := ledger.SinkronSemuaSumber(dicatatOleh); err != nil {
+			return err
+		}
+
+		// Baris ganda dihapus, jurnal penyesuaiannya tetap berlaku sehingga saldo tidak berubah.
+		// Yang dipertahankan adalah baris yang memiliki penyesuaian, atau yang terakhir diperbarui.
+		for _, t := range sebelum.Temuan {
+			if t.Jenis != TemuanRekapGanda {
+				continue
+			}
+			var baris []models.RekapSaldo
+			if err := tx.Where("periode = ?", t.Periode).Order("terakhir_update DESC").Find(&baris).Error; err != nil {
+				return err
+			}
+			simpan := baris[0].IDSaldo
+			for _, b := range baris {
+				var jumlah int64
+				if err := tx.Model(&models.Jurnal{}).Where("sumber_tipe = ? AND sumber_id = ?", TargetRekapSaldo, b.IDSaldo).Count(&jumlah).Error; err != nil {
+					return err
+				}
+				if jumlah > 0 {
+					simpan = b.IDSaldo
+					break
+				}
+			}
+			if err := tx.Where("periode = ? AND id_saldo <> ?", t.Periode, simpan).Delete(&models.RekapSaldo{}).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, periode := range daftarPeriode(sebelum.PeriodeAwal, sebelum.PeriodeAkhir) {
+			if _, err := ledger.MaterialisasiRekap(periode); err != nil {
+				return fmt.Errorf("periode %s: %v", periode, err)
+			}
+		}
+
+		sesudah, err = NewIntegritasService(tx).Periksa()
+		if err != nil {
+			return err
+		}
+		if !sesudah.Sehat {
+			return fmt.Errorf("masih ada %d temuan setelah perbaikan, perubahan dibatalkan", len(sesudah.Temuan))
+		}
+
+		keterangan := fmt.Sprintf("Perbaikan integritas rekap saldo periode %s s.d. %s: %d temuan diperbaiki",
+			sebelum.PeriodeAwal, sebelum.PeriodeAkhir, len(sebelum.Temuan))
+		return NewLogService(tx).LogAktivitas(dicatatOleh, AksiPerbaikiIntegritas, TargetRekapSaldo, "", keterangan)
+	})
+	if err != nil {
+		return sebelum, nil, err
+	}
+	return sebelum, sesudah, nil
+}
@@ -0,0 +1,203 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"tpq_asysyafii/models"
+)
+
+// Izin adalah nama aksi dengan format "<sumber>:<aksi>", misalnya "syahriah:write"
+type Izin string
+
+const (
+	IzinUserRead    Izin = "user:read"
+	IzinUserCreate  Izin = "user:create"
+	IzinUserWrite   Izin = "user:write"
+	IzinUserDelete  Izin = "user:delete"
+	IzinUserApprove Izin = "user:approve"
+
+	IzinSantriRead    Izin = "santri:read"
+	IzinSantriWrite   Izin = "santri:write"
+	IzinKeluargaRead  Izin = "keluarga:read"
+	IzinKeluargaWrite Izin = "keluarga:write"
+
+	IzinSyahriahRead   Izin = "syahriah:read"
+	IzinSyahriahWrite  Izin = "syahriah:write"
+	IzinDonasiRead     Izin = "donasi:read"
+	IzinDonasiWrite    Izin = "donasi:write"
+	IzinPemakaianRead  Izin = "pemakaian:read"
+	IzinPemakaianWrite Izin = "pemakaian:write"
+	IzinRekapRead      Izin = "rekap:read"
+	IzinRekapWrite     Izin = "rekap:write"
+	IzinJurnalRead     Izin = "jurnal:read"
+	IzinTutupBuku      Izin = "tutup_buku:close"
+	IzinBukaTutupBuku  Izin = "tutup_buku:reopen" // hanya super_admin secara default
+
+	IzinLogRead           Izin = "log:read"
+	IzinPengumumanWrite   Izin = "pengumuman:write"
+	IzinBeritaWrite       Izin = "berita:write"
+	IzinBeritaPublish     Izin = "berita:publish"
+	IzinKontenWrite       Izin = "konten:write" // fasilitas, program unggulan, informasi TPQ, sosial media
+	IzinTestimoniModerasi Izin = "testimoni:moderate"
+	IzinMediaWrite        Izin = "media:write" // unggah dan hapus berkas di media library
+	IzinJobRead           Izin = "job:read"
+	IzinJobRun            Izin = "job:run"
+)
+
+// izinDefault dipakai jika role tidak diatur di file izin.
+// "*" berarti semua izin, "syahriah:*" berarti semua aksi pada syahriah.
+var izinDefault = map[models.UserRole][]Izin{
+	models.RoleSuperAdmin: {"*"},
+	models.RoleAdmin: {
+		IzinUserRead, IzinUserCreate, IzinUserApprove,
+		IzinSantriRead, "keluarga:*",
+		"syahriah:*", "donasi:*", "pemakaian:*", "rekap:*", IzinJurnalRead, IzinTutupBuku,
+		IzinLogRead, IzinPengumumanWrite, IzinTestimoniModerasi, IzinJobRead, IzinMediaWrite,
+	},
+	// Bendahara mengelola keuangan tanpa bisa mengelola user
+	models.RoleBendahara: {
+		IzinSantriRead,
+		"syahriah:*", "donasi:*", "pemakaian:*", "rekap:*", IzinJurnalRead, IzinTutupBuku,
+	},
+	models.RoleWali: {},
+}
+
+// tingkatPeran menentukan role yang boleh diberikan seorang user: hanya role dengan tingkat
+// di bawah tingkat role-nya sendiri. Role tambahan dari file izin dianggap setingkat admin.
+var tingkatPeran = map[models.UserRole]int{
+	models.RoleSuperAdmin: 3,
+	models.RoleAdmin:      2,
+	models.RoleBendahara:  1,
+	models.RoleWali:       0,
+}
+
+func tingkat(role string) int {
+	if t, ok := tingkatPeran[models.UserRole(role)]; ok {
+		return t
+	}
+	return tingkatPeran[models.RoleAdmin]
+}
+
+// BolehBeriPeran memeriksa apakah user dengan role pemberi boleh membuat atau menyetujui user dengan role peran
+func BolehBeriPeran(pemberi, peran string) bool {
+	if pemberi == "" {
+		return false
+	}
+	return tingkat(peran) < tingkat(pemberi)
+}
+
+// RegistryIzin memetakan role ke daftar izin
+type RegistryIzin struct {
+	peran map[string]map[Izin]bool
+}
+
+// NewRegistryIzin membuat registry dari peta role -> izin
+func NewRegistryIzin(daftar map[string][]Izin) *RegistryIzin {
+	r := &RegistryIzin{peran: make(map[string]map[Izin]bool, len(daftar))}
+	for role, izinList := range daftar {
+		set := make(map[Izin]bool, len(izinList))
+		for _, izin := range izinList {
+			set[Izin(strings.TrimSpace(string(izin)))] = true
+		}
+		r.peran[role] = set
+	}
+	return r
+}
+
+// MuatRegistryIzin membaca file JSON berbentuk {"bendahara": ["syahriah:*", "donasi:read"], ...}.
+// Role yang ada di file menggantikan izin default role tersebut; role lain tetap memakai default.
+func MuatRegistryIzin(path string) (*RegistryIzin, error) {
+	daftar := make(map[string][]Izin)
+	for role, izinList := range izinDefault {
+		daftar[string(role)] = izinList
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var dariFile map[string][]Izin
+		if err := json.Unmarshal(data, &dariFile); err != nil {
+			return nil, fmt.Errorf("format file izin %s tidak valid: %v", path, err)
+		}
+		for role, izinList := range dariFile {
+			daftar[role] = izinList
+		}
+	}
+	return NewRegistryIzin(daftar), nil
+}
+
+// Punya memeriksa apakah role memiliki izin, termasuk lewat wildcard "*" atau "<sumber>:*"
+func (r *RegistryIzin) Punya(role string, izin Izin) bool {
+	set, ok := r.peran[role]
+	if !ok {
+		return false
+	}
+	if set["*"] || set[izin] {
+		return true
+	}
+	if i := strings.Index(string(izin), ":"); i >= 0 {
+		return set[Izin(string(izin)[:i])+":*"]
+	}
+	return false
+}
+
+// Dikenal memeriksa apakah role terdaftar di registry
+func (r *RegistryIzin) Dikenal(role string) bool {
+	_, ok := r.peran[role]
+	return ok
+}
+
+// DaftarIzin mengembalikan izin milik role (wildcard tidak diuraikan)
+func (r *RegistryIzin) DaftarIzin(role string) []Izin {
+	hasil := make([]Izin, 0, len(r.peran[role]))
+	for izin := range r.peran[role] {
+		hasil = append(hasil, izin)
+	}
+	sort.Slice(hasil, func(i, j int) bool { return hasil[i] < hasil[j] })
+	return hasil
+}
+
+var (
+	registryIzin     *RegistryIzin
+	registryIzinOnce sync.Once
+)
+
+// DefaultRegistryIzin memuat registry sekali dari PERMISSIONS_FILE (default "permissions.json" jika ada).
+// Jika file tidak ada atau rusak, izin default yang dipakai.
+func DefaultRegistryIzin() *RegistryIzin {
+	registryIzinOnce.Do(func() {
+		path := os.Getenv("PERMISSIONS_FILE")
+		if path == "" {
+			if _, err := os.Stat("permissions.json"); err == nil {
+				path = "permissions.json"
+			}
+		}
+
+		r, err := MuatRegistryIzin(path)
+		if err != nil {
+			log.Printf("⚠️ Gagal memuat file izin, memakai izin default: %v", err)
+			r, _ = MuatRegistryIzin("")
+		} else if path != "" {
+			log.Printf("🔐 Izin role dimuat dari %s", path)
+		}
+		registryIzin = r
+	})
+	return registryIzin
+}
+
+// PunyaIzin memeriksa izin role memakai registry default
+func PunyaIzin(role string, izin Izin) bool {
+	return DefaultRegistryIzin().Punya(role, izin)
+}
+
+// PeranDikenal memeriksa apakah role boleh diberikan ke user
+func PeranDikenal(role string) bool {
+	return DefaultRegistryIzin().Dikenal(role)
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"tpq_asysyafii/models"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	gmhtml "github.com/yuin/goldmark/renderer/html"
+	nethtml "golang.org/x/net/html"
+	"gorm.io/gorm"
+)
+
+const (
+	// panjangRingkasan adalah jumlah karakter maksimal ringkasan untuk tampilan daftar
+	panjangRingkasan = 200
+	// kataPerMenit adalah kecepatan baca rata-rata untuk estimasi waktu baca
+	kataPerMenit = 200
+)
+
+// KontenTerender adalah hasil render konten yang siap disimpan
+type KontenTerender struct {
+	HTML      string
+	Ringkasan string
+	WaktuBaca int
+}
+
+var (
+	markdown = goldmark.New(
+		goldmark.WithExtensions(extension.GFM),
+		// HTML di dalam markdown diteruskan ke sanitizer, bukan dibuang, agar subset HTML tetap bisa dipakai.
+		// Baris baru tunggal dipertahankan karena konten lama ditulis sebagai teks biasa per baris.
+		goldmark.WithRendererOptions(gmhtml.WithUnsafe(), gmhtml.WithHardWraps()),
+	)
+
+	kebijakanOnce sync.Once
+	kebijakan     *bluemonday.Policy
+)
+
+// kebijakanKonten adalah allowlist HTML untuk konten berita dan pengumuman: format teks, judul,
+// daftar, kutipan, kode, tabel, tautan http/https/mailto, dan gambar http/https atau dari media
+// library. Atribut style, class (kecuali bahasa kode), event handler, iframe, dan script dibuang.
+func kebijakanKonten() *bluemonday.Policy {
+	kebijakanOnce.Do(func() {
+		p := bluemonday.NewPolicy()
+		p.AllowElements("p", "br", "hr", "strong", "b", "em", "i", "u", "s", "del", "sub", "sup", "mark",
+			"h1", "h2", "h3", "h4", "h5", "h6", "blockquote", "pre", "code")
+		p.AllowLists()
+		p.AllowTables()
+
+		p.AllowURLSchemes("http", "https", "mailto")
+		p.AllowRelativeURLs(true)
+		p.RequireParseableURLs(true)
+		p.AllowAttrs("href", "title").OnElements("a")
+		p.RequireNoFollowOnLinks(true)
+		p.RequireNoReferrerOnFullyQualifiedLinks(true)
+		p.AddTargetBlankToFullyQualifiedLinks(true)
+
+		p.AllowAttrs("src", "alt", "title").OnElements("img")
+		p.AllowAttrs("width", "height").Matching(bluemonday.NumberOrPercent).OnElements("img")
+
+		p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+-]+$`)).OnElements("code")
+		kebijakan = p
+	})
+	return kebijakan
+}
+
+// FormatKontenValid memeriksa format yang dikirim client
+func FormatKontenValid(format models.FormatKonten) bool {
+	return format == models.FormatMarkdown || format == models.FormatHTML
+}
+
+// RenderKonten mengubah sumber Markdown atau HTML menjadi HTML yang sudah disaring dengan
+// allowlist, lalu membuat ringkasan dan estimasi waktu baca dari teksnya
+func RenderKonten(sumber string, format models.FormatKonten) (KontenTerender, error) {
+	var mentah string
+	switch format {
+	case models.FormatMarkdown:
+		var buf bytes.Buffer
+		if err := markdown.Convert([]byte(sumber), &buf); err != nil {
+			return KontenTerender{}, fmt.Errorf("gagal merender markdown: %w", err)
+		}
+		mentah = buf.String()
+	case models.FormatHTML:
+		mentah = sumber
+	default:
+		return KontenTerender{}, fmt.Errorf("format konten tidak dikenal: %s", format)
+	}
+
+	aman := strings.TrimSpace(kebijakanKonten().Sanitize(mentah))
+	teks := TeksPolos(aman)
+	return KontenTerender{
+		HTML:      aman,
+		Ringkasan: potongRingkasan(teks, panjangRingkasan),
+		WaktuBaca: (len(strings.Fields(teks)) + kataPerMenit - 1) / kataPerMenit,
+	}, nil
+}
+
+// elemenBlok dipisahkan dengan spasi saat HTML diubah menjadi teks agar kata tidak menempel
+var elemenBlok = map[string]bool{
+	"p": true, "br": true, "hr": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"li": true, "ul": true, "ol": true, "blockquote": true, "pre": true, "tr": true, "td": true, "th": true,
+	"table": true, "div": true,
+}
+
+// TeksPolos mengambil teks dari HTML tanpa tag, dengan spasi tunggal antar kata
+func TeksPolos(sumberHTML string) string {
+	var sb strings.Builder
+	z := nethtml.NewTokenizer(strings.NewReader(sumberHTML))
+	for {
+		switch z.Next() {
+		case nethtml.ErrorToken:
+			return strings.Join(strings.Fields(sb.String()), " ")
+		case nethtml.TextToken:
+			sb.Write(z.Text())
+		case nethtml.StartTagToken, nethtml.EndTagToken, nethtml.SelfClosingTagToken:
+			if nama, _ := z.TagName(); elemenBlok[string(nama)] {
+				sb.WriteByte(' ')
+			}
+		}
+	}
+}
+
+// potongRingkasan memotong teks di batas kata terdekat sebelum batas karakter
+func potongRingkasan(teks string, batas int) string {
+	r := []rune(teks)
+	if len(r) <= batas {
+		return teks
+	}
+	potong := string(r[:batas])
+	if i := strings.LastIndexByte(potong, ' '); i > batas/2 {
+		potong = potong[:i]
+	}
+	return strings.TrimRight(potong, " ,.;:-") + "…"
+}
+
+// MigrasiKontenHTML merender berita dan pengumuman lama yang belum punya HTML hasil render.
+// Konten lama berupa teks biasa diperlakukan sebagai Markdown sehingga paragraf dan baris
+// barunya tetap, sedangkan HTML yang pernah ditempel ikut disaring.
+func MigrasiKontenHTML(db *gorm.DB) (int, error) {
+	jumlah := 0
+
+	var beritaList []models.Berita
+	if err := db.Select("id_berita", "konten", "format_konten").
+		Where("konten_html IS NULL OR konten_html = ''").Find(&beritaList).Error; err != nil {
+		return jumlah, err
+	}
+	for _, b := range beritaList {
+		if b.FormatKonten == "" {
+			b.FormatKonten = models.FormatMarkdown
+		}
+		hasil, err := RenderKonten(b.Konten, b.FormatKonten)
+		if err != nil {
+			return jumlah, err
+		}
+		// UpdateColumns agar diperbarui_pada tidak berubah
+		if err := db.Model(&models.Berita{}).Where("id_berita = ?", b.IDBerita).UpdateColumns(map[string]interface{}{
+			"format_konten": b.FormatKonten,
+			"konten_html":   hasil.HTML,
+			"ringkasan":     hasil.Ringkasan,
+			"waktu_baca":    hasil.WaktuBaca,
+		}).Error; err != nil {
+			return jumlah, err
+		}
+		jumlah++
+	}
+
+	var pengumumanList []models.Pengumuman
+	if err := db.Select("id_pengumuman", "isi", "format_isi").
+		Where("isi_html IS NULL OR isi_html = ''").Find(&pengumumanList).Error; err != nil {
+		return jumlah, err
+	}
+	for _, p := range pengumumanList {
+		if p.FormatIsi == "" {
+			p.FormatIsi = models.FormatMarkdown
+		}
+		hasil, err := RenderKonten(p.Isi, p.FormatIsi)
+		if err != nil {
+			return jumlah, err
+		}
+		if err := db.Model(&models.Pengumuman{}).Where("id_pengumuman = ?", p.IDPengumuman).UpdateColumns(map[string]interface{}{
+			"format_isi": p.FormatIsi,
+			"isi_html":   hasil.HTML,
+			"ringkasan":  hasil.Ringkasan,
+			"waktu_baca": hasil.WaktuBaca,
+		}).Error; err != nil {
+			return jumlah, err
+		}
+		jumlah++
+	}
+	return jumlah, nil
+}
@@ -0,0 +1,109 @@
+package services_test
+
+import (
+	"strings"
+	"testing"
+	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
+)
+
+// RenderKonten hanya meloloskan HTML dari allowlist, baik konten ditulis sebagai HTML maupun
+// Markdown yang berisi HTML mentah, dan menghitung ringkasan serta waktu baca dari teks yang tersisa.
+func TestRenderKontenMenyaringHTMLBerbahaya(t *testing.T) {
+	panjang := strings.TrimSpace(strings.Repeat("kata ", 250))
+	ringkasanPanjang := strings.TrimSpace(strings.Repeat("kata ", 40)) + "…"
+
+	tests := []struct {
+		nama      string
+		sumber    string
+		format    models.FormatKonten
+		html      string
+		ringkasan string
+		waktuBaca int
+	}{
+		{
+			nama:      "script dibuang",
+			sumber:    "<p>Halo</p><script>alert(1)</script>",
+			format:    models.FormatHTML,
+			html:      "<p>Halo</p>",
+			ringkasan: "Halo",
+			waktuBaca: 1,
+		},
+		{
+			nama:   "event handler onerror dibuang",
+			sumber: `<img src="https://tpq.example/a.png" onerror="alert(1)" alt="Kegiatan">`,
+			format: models.FormatHTML,
+			html:   `<img src="https://tpq.example/a.png" alt="Kegiatan">`,
+		},
+		{
+			nama:      "tautan javascript dibuang, tautan https diberi rel dan target",
+			sumber:    `<a href="javascript:alert(1)">klik</a> <a href="https://tpq.example/info">info</a>`,
+			format:    models.FormatHTML,
+			html:      `klik <a href="https://tpq.example/info" rel="nofollow noreferrer noopener" target="_blank">info</a>`,
+			ringkasan: "klik info",
+			waktuBaca: 1,
+		},
+		{
+			nama:      "atribut style dan class dibuang",
+			sumber:    `<p style="color:red" class="merah">Teks</p>`,
+			format:    models.FormatHTML,
+			html:      "<p>Teks</p>",
+			ringkasan: "Teks",
+			waktuBaca: 1,
+		},
+		{
+			nama:      "class bahasa pada blok kode dipertahankan",
+			sumber:    "```go\nfmt.Println(1)\n```",
+			format:    models.FormatMarkdown,
+			html:      "<pre><code class=\"language-go\">fmt.Println(1)\n</code></pre>",
+			ringkasan: "fmt.Println(1)",
+			waktuBaca: 1,
+		},
+		{
+			nama:      "HTML mentah di dalam markdown ikut disaring",
+			sumber:    "Jadwal **ngaji**\nbaris kedua\n\n<div onclick=\"x()\"><script>alert(1)</script><b>tebal</b></div>",
+			format:    models.FormatMarkdown,
+			html:      "<p>Jadwal <strong>ngaji</strong><br>\nbaris kedua</p>\n<b>tebal</b>",
+			ringkasan: "Jadwal ngaji baris kedua tebal",
+			waktuBaca: 1,
+		},
+		{
+			nama:      "tautan javascript di markdown dibuang",
+			sumber:    "[klik](javascript:alert(1))",
+			format:    models.FormatMarkdown,
+			html:      "<p>klik</p>",
+			ringkasan: "klik",
+			waktuBaca: 1,
+		},
+		{
+			nama:      "ringkasan dipotong di batas kata dan waktu baca dibulatkan ke atas",
+			sumber:    panjang,
+			format:    models.FormatMarkdown,
+			html:      "<p>" + panjang + "</p>",
+			ringkasan: ringkasanPanjang,
+			waktuBaca: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.nama, func(t *testing.T) {
+			hasil, err := services.RenderKonten(tt.sumber, tt.format)
+			if err != nil {
+				t.Fatalf("render gagal: %v", err)
+			}
+			if hasil.HTML != tt.html {
+				t.Errorf("HTML %q, harapan %q", hasil.HTML, tt.html)
+			}
+			if hasil.Ringkasan != tt.ringkasan {
+				t.Errorf("ringkasan %q, harapan %q", hasil.Ringkasan, tt.ringkasan)
+			}
+			if hasil.WaktuBaca != tt.waktuBaca {
+				t.Errorf("waktu baca %d, harapan %d", hasil.WaktuBaca, tt.waktuBaca)
+			}
+		})
+	}
+
+	if _, err := services.RenderKonten("isi", models.FormatKonten("rtf")); err == nil {
+		t.Error("format tidak dikenal harus ditolak")
+	}
+}
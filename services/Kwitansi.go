@@ -0,0 +1,203 @@
+package services
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+	"tpq_asysyafii/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrKwitansiTidakDitemukan       = errors.New("kwitansi tidak ditemukan")
+	ErrSumberKwitansiTidakDitemukan = errors.New("pembayaran untuk kwitansi tidak ditemukan")
+	ErrKwitansiKredit               = errors.New("baris kredit adalah pemindahan lebih bayar, bukan uang masuk, sehingga tidak memiliki kwitansi")
+)
+
+// hurufKode tanpa huruf dan angka yang mudah tertukar (0/O, 1/I)
+const hurufKode = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// KwitansiService menerbitkan kwitansi untuk pembayaran syahriah dan donasi. Penerbitan idempoten:
+// kwitansi yang masih sesuai dengan pembayarannya dipakai ulang, yang sudah tidak sesuai dibatalkan
+// dan diganti kwitansi bernomor baru.
+type KwitansiService struct {
+	db *gorm.DB
+}
+
+func NewKwitansiService(db *gorm.DB) *KwitansiService {
+	return &KwitansiService{db: db}
+}
+
+// Terbitkan mengembalikan kwitansi yang berlaku untuk sebuah pembayaran, menerbitkannya jika belum ada
+func (s *KwitansiService) Terbitkan(jenis models.JenisKwitansi, idSumber string) (*models.Kwitansi, error) {
+	var kwitansi models.Kwitansi
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		draf, err := susunKwitansi(tx, jenis, idSumber)
+		if err != nil {
+			return err
+		}
+
+		var lama models.Kwitansi
+		if err := tx.Where("jenis = ? AND id_sumber = ? AND status = ?", jenis, idSumber, models.KwitansiBerlaku).
+			Order("dibuat_pada DESC").Limit(1).Find(&lama).Error; err != nil {
+			return err
+		}
+		if lama.IDKwitansi != "" {
+			if isiKwitansiSama(lama, draf) {
+				kwitansi = lama
+				return nil
+			}
+			if err := batalkanKwitansi(tx, jenis, idSumber); err != nil {
+				return err
+			}
+		}
+
+		sekarang := time.Now()
+		urut, err := NewUrutanIDService(tx).NomorBerikutnya(fmt.Sprintf("KW%d", sekarang.Year()))
+		if err != nil {
+			return err
+		}
+		kode, err := kodeVerifikasi()
+		if err != nil {
+			return err
+		}
+		draf.IDKwitansi = uuid.New().String()
+		draf.Nomor = fmt.Sprintf("KW/%d/%06d", sekarang.Year(), urut)
+		draf.KodeVerifikasi = kode
+		draf.Status = models.KwitansiBerlaku
+		if err := tx.Create(&draf).Error; err != nil {
+			return err
+		}
+		kwitansi = draf
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &kwitansi, nil
+}
+
+// Batalkan menandai kwitansi sebuah pembayaran batal, misalnya karena pembayarannya dihapus
+func (s *KwitansiService) Batalkan(jenis models.JenisKwitansi, idSumber string) error {
+	return batalkanKwitansi(s.db, jenis, idSumber)
+}
+
+// Verifikasi mencari kwitansi dari kode verifikasi yang tercetak di kwitansi
+func (s *KwitansiService) Verifikasi(kode string) (*models.Kwitansi, error) {
+	var kwitansi models.Kwitansi
+	err := s.db.First(&kwitansi, "kode_verifikasi = ?", strings.ToUpper(strings.TrimSpace(kode))).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrKwitansiTidakDitemukan
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &kwitansi, nil
+}
+
+func batalkanKwitansi(db *gorm.DB, jenis models.JenisKwitansi, idSumber string) error {
+	return db.Model(&models.Kwitansi{}).
+		Where("jenis = ? AND id_sumber = ? AND status = ?", jenis, idSumber, models.KwitansiBerlaku).
+		Updates(map[string]interface{}{"status": models.KwitansiBatal, "dibatalkan_pada": time.Now()}).Error
+}
+
+// susunKwitansi menyalin isi kwitansi dari pembayarannya; baris pembayaran dikunci agar
+// penerbitan bersamaan tidak menghasilkan dua kwitansi
+func susunKwitansi(tx *gorm.DB, jenis models.JenisKwitansi, idSumber string) (models.Kwitansi, error) {
+	kunci := clause.Locking{Strength: "UPDATE"}
+	switch jenis {
+	case models.KwitansiSyahriah:
+		var bayar models.SyahriahBayar
+		if err := tx.Clauses(kunci).Preload("Penerima").First(&bayar, "id_bayar = ?", idSumber).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return models.Kwitansi{}, ErrSumberKwitansiTidakDitemukan
+			}
+			return models.Kwitansi{}, err
+		}
+		if bayar.Metode == models.BayarKredit {
+			return models.Kwitansi{}, ErrKwitansiKredit
+		}
+		var syahriah models.Syahriah
+		if err := tx.Preload("Santri").Preload("Santri.Wali").First(&syahriah, "id_syahriah = ?", bayar.IDSyahriah).Error; err != nil {
+			return models.Kwitansi{}, err
+		}
+
+		pembayar := syahriah.Santri.Wali.NamaLengkap
+		if pembayar == "" {
+			pembayar = syahriah.Santri.NamaLengkap
+		}
+		penerima := "Pembayaran online"
+		if bayar.Penerima != nil {
+			penerima = bayar.Penerima.NamaLengkap
+		}
+		keterangan := fmt.Sprintf("Syahriah %s a.n. %s", FormatBulan(syahriah.Bulan), syahriah.Santri.NamaLengkap)
+		if bayar.Metode != models.BayarTunai {
+			keterangan += fmt.Sprintf(" (%s)", bayar.Metode)
+		}
+		idWali, idSantri := syahriah.Santri.IDWali, syahriah.ID_Santri
+		return models.Kwitansi{
+			Jenis:        jenis,
+			IDSumber:     bayar.IDBayar,
+			IDWali:       &idWali,
+			IDSantri:     &idSantri,
+			NamaPembayar: pembayar,
+			Nominal:      bayar.Nominal,
+			Keterangan:   keterangan,
+			NamaPenerima: penerima,
+			TanggalBayar: bayar.WaktuBayar,
+		}, nil
+
+	case models.KwitansiDonasi:
+		var donasi models.Donasi
+		if err := tx.Clauses(kunci).Preload("Admin").First(&donasi, "id_donasi = ?", idSumber).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return models.Kwitansi{}, ErrSumberKwitansiTidakDitemukan
+			}
+			return models.Kwitansi{}, err
+		}
+		pembayar := strings.TrimSpace(donasi.NamaDonatur)
+		if pembayar == "" {
+			pembayar = "Hamba Allah"
+		}
+		return models.Kwitansi{
+			Jenis:        jenis,
+			IDSumber:     donasi.IDDonasi,
+			NamaPembayar: pembayar,
+			Nominal:      donasi.Nominal,
+			Keterangan:   "Donasi",
+			NamaPenerima: donasi.Admin.NamaLengkap,
+			TanggalBayar: donasi.WaktuCatat,
+		}, nil
+	}
+	return models.Kwitansi{}, fmt.Errorf("jenis kwitansi tidak dikenal: %s", jenis)
+}
+
+func isiKwitansiSama(a, b models.Kwitansi) bool {
+	return a.NamaPembayar == b.NamaPembayar &&
+		keSen(a.Nominal) == keSen(b.Nominal) &&
+		a.Keterangan == b.Keterangan &&
+		a.NamaPenerima == b.NamaPenerima &&
+		a.TanggalBayar.Truncate(time.Second).Equal(b.TanggalBayar.Truncate(time.Second))
+}
+
+// kodeVerifikasi membuat kode acak berbentuk XXXXX-XXXXX untuk dicek di endpoint publik
+func kodeVerifikasi() (string, error) {
+	var b strings.Builder
+	for i := 0; i < 10; i++ {
+		if i == 5 {
+			b.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(hurufKode))))
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(hurufKode[n.Int64()])
+	}
+	return b.String(), nil
+}
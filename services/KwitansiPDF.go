@@ -0,0 +1,84 @@
+package services
+
+import (
+	"io"
+	"strings"
+	"tpq_asysyafii/models"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// TulisPDFKwitansi mencetak kwitansi ukuran A5 mendatar beserta nama dan logo TPQ.
+// urlVerifikasi dicetak di bawah kode verifikasi jika diisi.
+func TulisPDFKwitansi(w io.Writer, kwitansi models.Kwitansi, info models.InformasiTPQ, urlVerifikasi string) error {
+	pdf := gofpdf.New("L", "mm", "A5", "")
+	pdf.SetTitle("Kwitansi "+kwitansi.Nomor, true)
+	pdf.SetMargins(12, 12, 12)
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.AddPage()
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	lebar, tinggi := pdf.GetPageSize()
+	isiLebar := lebar - 24
+
+	tulisKop(pdf, info)
+
+	// Judul dan nomor
+	pdf.SetXY(12, 34)
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.CellFormat(isiLebar, 8, "KWITANSI", "", 2, "C", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.CellFormat(isiLebar, 5, "No. "+kwitansi.Nomor, "", 2, "C", false, 0, "")
+	pdf.Ln(4)
+
+	baris := func(label, isi string, gaya string) {
+		pdf.SetX(12)
+		pdf.SetFont("Helvetica", "", 10)
+		pdf.CellFormat(40, 7, label, "", 0, "L", false, 0, "")
+		pdf.CellFormat(4, 7, ":", "", 0, "L", false, 0, "")
+		pdf.SetFont("Helvetica", gaya, 10)
+		pdf.MultiCell(isiLebar-44, 7, tr(isi), "B", "L", false)
+	}
+	terbilang := Terbilang(kwitansi.Nominal)
+	baris("Telah terima dari", kwitansi.NamaPembayar, "B")
+	baris("Uang sejumlah", strings.ToUpper(terbilang[:1])+terbilang[1:], "I")
+	baris("Untuk pembayaran", kwitansi.Keterangan, "")
+
+	// Nominal dalam angka dan tanda terima
+	yBawah := pdf.GetY() + 8
+	pdf.SetXY(12, yBawah)
+	pdf.SetFont("Helvetica", "B", 14)
+	pdf.CellFormat(70, 12, FormatRupiah(kwitansi.Nominal), "1", 0, "C", false, 0, "")
+
+	tempat := ""
+	if info.Tempat != nil && *info.Tempat != "" {
+		tempat = *info.Tempat + ", "
+	}
+	xTanda := lebar - 12 - 70
+	pdf.SetXY(xTanda, yBawah-2)
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.CellFormat(70, 5, tr(tempat+FormatTanggal(kwitansi.TanggalBayar)), "", 2, "C", false, 0, "")
+	pdf.CellFormat(70, 5, "Penerima,", "", 2, "C", false, 0, "")
+	pdf.SetXY(xTanda, yBawah+18)
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.CellFormat(70, 5, tr(kwitansi.NamaPenerima), "T", 2, "C", false, 0, "")
+
+	// Kode verifikasi
+	pdf.SetXY(12, tinggi-16)
+	pdf.SetFont("Helvetica", "", 8)
+	pdf.SetTextColor(90, 90, 90)
+	pdf.CellFormat(isiLebar, 4, "Kode verifikasi: "+kwitansi.KodeVerifikasi, "", 2, "L", false, 0, "")
+	if urlVerifikasi != "" {
+		pdf.CellFormat(isiLebar, 4, "Periksa keaslian kwitansi di "+urlVerifikasi, "", 2, "L", false, 0, urlVerifikasi)
+	}
+
+	if kwitansi.Status == models.KwitansiBatal {
+		pdf.SetFont("Helvetica", "B", 60)
+		pdf.SetTextColor(200, 30, 30)
+		pdf.TransformBegin()
+		pdf.TransformRotate(20, lebar/2, tinggi/2)
+		pdf.Text(lebar/2-pdf.GetStringWidth("BATAL")/2, tinggi/2+10, "BATAL")
+		pdf.TransformEnd()
+	}
+
+	return pdf.Output(w)
+}
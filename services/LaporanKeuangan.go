@@ -0,0 +1,233 @@
+package services
+
+import (
+	"errors"
+	"time"
+	"tpq_asysyafii/models"
+
+	"gorm.io/gorm"
+)
+
+type JenisLaporan string
+
+const (
+	LaporanBulanan JenisLaporan = "bulanan"
+	LaporanTahunan JenisLaporan = "tahunan"
+)
+
+var ErrPeriodeLaporanTidakValid = errors.New("periode laporan tidak valid, gunakan YYYY-MM untuk bulanan atau YYYY untuk tahunan")
+
+// SaldoDana adalah nominal per dana (kas syahriah dan kas donasi) beserta totalnya
+type SaldoDana struct {
+	Syahriah float64 `json:"syahriah"`
+	Donasi   float64 `json:"donasi"`
+	Total    float64 `json:"total"`
+}
+
+func (s SaldoDana) tambah(syahriah, donasi float64) SaldoDana {
+	s.Syahriah = float64(keSen(s.Syahriah)+keSen(syahriah)) / 100
+	s.Donasi = float64(keSen(s.Donasi)+keSen(donasi)) / 100
+	s.Total = float64(keSen(s.Syahriah)+keSen(s.Donasi)) / 100
+	return s
+}
+
+type PengeluaranPerTipe struct {
+	Tipe models.TipePemakaian `json:"tipe"`
+	SaldoDana
+}
+
+type ItemPemasukan struct {
+	Tanggal    time.Time `json:"tanggal"`
+	Keterangan string    `json:"keterangan"`
+	Metode     string    `json:"metode"`
+	Nominal    float64   `json:"nominal"`
+}
+
+type ItemPengeluaran struct {
+	Tanggal  time.Time            `json:"tanggal"`
+	Judul    string               `json:"judul"`
+	Tipe     models.TipePemakaian `json:"tipe"`
+	Syahriah float64              `json:"syahriah"`
+	Donasi   float64              `json:"donasi"`
+	Total    float64              `json:"total"`
+}
+
+// LaporanKeuangan adalah laporan bulanan atau tahunan untuk pengurus. Angka ringkasan diambil dari
+// rekap_saldo; rincian transaksi dari data sumbernya. Penyesuaian menampung selisih dari jurnal
+// penyesuaian saldo agar saldo awal + pemasukan - pengeluaran selalu sama dengan saldo akhir.
+type LaporanKeuangan struct {
+	Periode            string               `json:"periode"`
+	Jenis              JenisLaporan         `json:"jenis"`
+	Mulai              string               `json:"mulai"`
+	Selesai            string               `json:"selesai"`
+	SaldoAwal          SaldoDana            `json:"saldo_awal"`
+	Pemasukan          SaldoDana            `json:"pemasukan"`
+	Pengeluaran        SaldoDana            `json:"pengeluaran"`
+	PengeluaranPerTipe []PengeluaranPerTipe `json:"pengeluaran_per_tipe"`
+	Penyesuaian        SaldoDana            `json:"penyesuaian"`
+	SaldoAkhir         SaldoDana            `json:"saldo_akhir"`
+	Bulanan            []models.RekapSaldo  `json:"bulanan"`
+	RincianSyahriah    []ItemPemasukan      `json:"rincian_syahriah"`
+	RincianDonasi      []ItemPemasukan      `json:"rincian_donasi"`
+	RincianPengeluaran []ItemPengeluaran    `json:"rincian_pengeluaran"`
+	DibuatPada         time.Time            `json:"dibuat_pada"`
+}
+
+// JudulPeriode menulis periode laporan untuk judul, misalnya "Oktober 2026" atau "Tahun 2026"
+func (l *LaporanKeuangan) JudulPeriode() string {
+	if l.Jenis == LaporanTahunan {
+		return "Tahun " + l.Periode
+	}
+	return FormatBulan(l.Periode)
+}
+
+type LaporanKeuanganService struct {
+	db *gorm.DB
+}
+
+func NewLaporanKeuanganService(db *gorm.DB) *LaporanKeuanganService {
+	return &LaporanKeuanganService{db: db}
+}
+
+// rekapPeriode membaca rekap_saldo satu periode; periode yang belum dimaterialisasi dihitung dari jurnal
+func (s *LaporanKeuanganService) rekapPeriode(periode string) (models.RekapSaldo, error) {
+	var rekap models.RekapSaldo
+	err := s.db.Where("periode = ?", periode).Limit(1).Find(&rekap).Error
+	if err != nil || rekap.IDSaldo != "" {
+		return rekap, err
+	}
+
+	r, err := NewLedgerService(s.db).HitungRekap(periode)
+	if err != nil {
+		return rekap, err
+	}
+	return models.RekapSaldo{
+		Periode:             periode,
+		PemasukanSyahriah:   r.PemasukanSyahriah,
+		PengeluaranSyahriah: r.PengeluaranSyahriah,
+		SaldoAkhirSyahriah:  r.SaldoAkhirSyahriah,
+		PemasukanDonasi:     r.PemasukanDonasi,
+		PengeluaranDonasi:   r.PengeluaranDonasi,
+		SaldoAkhirDonasi:    r.SaldoAkhirDonasi,
+		PemasukanTotal:      r.PemasukanTotal,
+		PengeluaranTotal:    r.PengeluaranTotal,
+		SaldoAkhirTotal:     r.SaldoAkhirTotal,
+	}, nil
+}
+
+// Susun membuat laporan untuk periode YYYY-MM (bulanan) atau YYYY (tahunan)
+func (s *LaporanKeuanganService) Susun(periode string) (*LaporanKeuangan, error) {
+	laporan := &LaporanKeuangan{Periode: periode, DibuatPada: time.Now()}
+	var mulai time.Time
+	var jumlahBulan int
+	if t, err := time.ParseInLocation("2006-01", periode, time.Local); err == nil && len(periode) == 7 {
+		laporan.Jenis, mulai, jumlahBulan = LaporanBulanan, t, 1
+	} else if t, err := time.ParseInLocation("2006", periode, time.Local); err == nil && len(periode) == 4 {
+		laporan.Jenis, mulai, jumlahBulan = LaporanTahunan, t, 12
+	} else {
+		return nil, ErrPeriodeLaporanTidakValid
+	}
+	selesai := mulai.AddDate(0, jumlahBulan, 0)
+	laporan.Mulai = mulai.Format("2006-01")
+	laporan.Selesai = selesai.AddDate(0, -1, 0).Format("2006-01")
+
+	// Ringkasan dari rekap_saldo
+	awal, err := s.rekapPeriode(mulai.AddDate(0, -1, 0).Format("2006-01"))
+	if err != nil {
+		return nil, err
+	}
+	laporan.SaldoAwal = SaldoDana{}.tambah(awal.SaldoAkhirSyahriah, awal.SaldoAkhirDonasi)
+	for i := 0; i < jumlahBulan; i++ {
+		rekap, err := s.rekapPeriode(mulai.AddDate(0, i, 0).Format("2006-01"))
+		if err != nil {
+			return nil, err
+		}
+		laporan.Bulanan = append(laporan.Bulanan, rekap)
+		laporan.Pemasukan = laporan.Pemasukan.tambah(rekap.PemasukanSyahriah, rekap.PemasukanDonasi)
+		laporan.Pengeluaran = laporan.Pengeluaran.tambah(rekap.PengeluaranSyahriah, rekap.PengeluaranDonasi)
+		laporan.SaldoAkhir = SaldoDana{}.tambah(rekap.SaldoAkhirSyahriah, rekap.SaldoAkhirDonasi)
+	}
+	laporan.Penyesuaian = SaldoDana{}.tambah(
+		float64(keSen(laporan.SaldoAkhir.Syahriah)-keSen(laporan.SaldoAwal.Syahriah)-keSen(laporan.Pemasukan.Syahriah)+keSen(laporan.Pengeluaran.Syahriah))/100,
+		float64(keSen(laporan.SaldoAkhir.Donasi)-keSen(laporan.SaldoAwal.Donasi)-keSen(laporan.Pemasukan.Donasi)+keSen(laporan.Pengeluaran.Donasi))/100,
+	)
+
+	if err := s.rincian(laporan, mulai, selesai); err != nil {
+		return nil, err
+	}
+
+	perTipe := make(map[models.TipePemakaian]SaldoDana)
+	for _, item := range laporan.RincianPengeluaran {
+		perTipe[item.Tipe] = perTipe[item.Tipe].tambah(item.Syahriah, item.Donasi)
+	}
+	for _, tipe := range []models.TipePemakaian{models.PemakaianOperasional, models.PemakaianInvestasi, models.PemakaianLainnya} {
+		laporan.PengeluaranPerTipe = append(laporan.PengeluaranPerTipe, PengeluaranPerTipe{Tipe: tipe, SaldoDana: perTipe[tipe]})
+	}
+	return laporan, nil
+}
+
+// rincian mengisi lampiran transaksi dalam rentang [mulai, selesai)
+func (s *LaporanKeuanganService) rincian(laporan *LaporanKeuangan, mulai, selesai time.Time) error {
+	var bayarList []struct {
+		WaktuBayar  time.Time
+		Nominal     float64
+		Metode      string
+		Bulan       string
+		NamaLengkap string
+	}
+	if err := s.db.Table("syahriah_bayar").
+		Select("syahriah_bayar.waktu_bayar, syahriah_bayar.nominal, syahriah_bayar.metode, syahriah.bulan, santri.nama_lengkap").
+		Joins("JOIN syahriah ON syahriah.id_syahriah = syahriah_bayar.id_syahriah").
+		Joins("JOIN santri ON santri.id_santri = syahriah.id_santri").
+		Where("syahriah_bayar.metode <> ? AND syahriah_bayar.waktu_bayar >= ? AND syahriah_bayar.waktu_bayar < ?", models.BayarKredit, mulai, selesai).
+		Order("syahriah_bayar.waktu_bayar ASC").
+		Scan(&bayarList).Error; err != nil {
+		return err
+	}
+	laporan.RincianSyahriah = make([]ItemPemasukan, 0, len(bayarList))
+	for _, b := range bayarList {
+		laporan.RincianSyahriah = append(laporan.RincianSyahriah, ItemPemasukan{
+			Tanggal:    b.WaktuBayar,
+			Keterangan: "Syahriah " + FormatBulan(b.Bulan) + " - " + b.NamaLengkap,
+			Metode:     b.Metode,
+			Nominal:    b.Nominal,
+		})
+	}
+
+	var donasiList []models.Donasi
+	if err := s.db.Where("waktu_catat >= ? AND waktu_catat < ?", mulai, selesai).
+		Order("waktu_catat ASC").Find(&donasiList).Error; err != nil {
+		return err
+	}
+	laporan.RincianDonasi = make([]ItemPemasukan, 0, len(donasiList))
+	for _, d := range donasiList {
+		laporan.RincianDonasi = append(laporan.RincianDonasi, ItemPemasukan{
+			Tanggal:    d.WaktuCatat,
+			Keterangan: "Donasi dari " + d.NamaDonatur,
+			Nominal:    d.Nominal,
+		})
+	}
+
+	// Tanggal pemakaian sama dengan yang dipakai jurnal: tanggal_pemakaian, atau waktu dibuat jika kosong
+	var pemakaianList []models.PemakaianSaldo
+	if err := s.db.Where("COALESCE(tanggal_pemakaian, created_at) >= ? AND COALESCE(tanggal_pemakaian, created_at) < ?", mulai, selesai).
+		Order("COALESCE(tanggal_pemakaian, created_at) ASC").Find(&pemakaianList).Error; err != nil {
+		return err
+	}
+	laporan.RincianPengeluaran = make([]ItemPengeluaran, 0, len(pemakaianList))
+	for _, p := range pemakaianList {
+		tanggal := p.CreatedAt
+		if p.TanggalPemakaian != nil {
+			tanggal = *p.TanggalPemakaian
+		}
+		laporan.RincianPengeluaran = append(laporan.RincianPengeluaran, ItemPengeluaran{
+			Tanggal:  tanggal,
+			Judul:    p.JudulPemakaian,
+			Tipe:     p.TipePemakaian,
+			Syahriah: p.NominalSyahriah,
+			Donasi:   p.NominalDonasi,
+			Total:    p.NominalTotal,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,317 @@
+package services
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+	"tpq_asysyafii/models"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/xuri/excelize/v2"
+)
+
+// tabelLaporan adalah satu bagian laporan yang dicetak sama di CSV, XLSX, dan PDF.
+// Nilai sel berupa string, float64 (nominal), atau time.Time (tanggal).
+type tabelLaporan struct {
+	Judul string
+	Sheet string
+	Kolom []string
+	Bobot []float64 // perbandingan lebar kolom di PDF
+	Baris [][]interface{}
+	Tebal []bool
+}
+
+func (t *tabelLaporan) tambah(tebal bool, sel ...interface{}) {
+	t.Baris = append(t.Baris, sel)
+	t.Tebal = append(t.Tebal, tebal)
+}
+
+var labelTipePemakaian = map[models.TipePemakaian]string{
+	models.PemakaianOperasional: "Pengeluaran operasional",
+	models.PemakaianInvestasi:   "Pengeluaran investasi",
+	models.PemakaianLainnya:     "Pengeluaran lainnya",
+}
+
+// tabel menyusun ringkasan per dana, rekap bulanan (laporan tahunan), dan lampiran transaksi
+func (l *LaporanKeuangan) tabel() []tabelLaporan {
+	ringkasan := tabelLaporan{
+		Judul: "Ringkasan per dana",
+		Sheet: "Ringkasan",
+		Kolom: []string{"Uraian", "Dana syahriah", "Dana donasi", "Total"},
+		Bobot: []float64{2.2, 1, 1, 1},
+	}
+	ringkasan.tambah(true, "Saldo awal", l.SaldoAwal.Syahriah, l.SaldoAwal.Donasi, l.SaldoAwal.Total)
+	ringkasan.tambah(false, "Pemasukan syahriah", l.Pemasukan.Syahriah, 0.0, l.Pemasukan.Syahriah)
+	ringkasan.tambah(false, "Pemasukan donasi", 0.0, l.Pemasukan.Donasi, l.Pemasukan.Donasi)
+	for _, p := range l.PengeluaranPerTipe {
+		ringkasan.tambah(false, labelTipePemakaian[p.Tipe], -p.Syahriah, -p.Donasi, -p.Total)
+	}
+	if keSen(l.Penyesuaian.Syahriah) != 0 || keSen(l.Penyesuaian.Donasi) != 0 {
+		ringkasan.tambah(false, "Penyesuaian saldo", l.Penyesuaian.Syahriah, l.Penyesuaian.Donasi, l.Penyesuaian.Total)
+	}
+	ringkasan.tambah(true, "Saldo akhir", l.SaldoAkhir.Syahriah, l.SaldoAkhir.Donasi, l.SaldoAkhir.Total)
+	daftar := []tabelLaporan{ringkasan}
+
+	if l.Jenis == LaporanTahunan {
+		bulanan := tabelLaporan{
+			Judul: "Rekap bulanan",
+			Sheet: "Bulanan",
+			Kolom: []string{"Periode", "Masuk syahriah", "Masuk donasi", "Keluar syahriah", "Keluar donasi", "Saldo syahriah", "Saldo donasi", "Saldo total"},
+			Bobot: []float64{1.3, 1, 1, 1, 1, 1, 1, 1},
+		}
+		for _, r := range l.Bulanan {
+			bulanan.tambah(false, FormatBulan(r.Periode), r.PemasukanSyahriah, r.PemasukanDonasi,
+				r.PengeluaranSyahriah, r.PengeluaranDonasi, r.SaldoAkhirSyahriah, r.SaldoAkhirDonasi, r.SaldoAkhirTotal)
+		}
+		daftar = append(daftar, bulanan)
+	}
+
+	pemasukan := func(judul, sheet string, items []ItemPemasukan) tabelLaporan {
+		t := tabelLaporan{
+			Judul: judul,
+			Sheet: sheet,
+			Kolom: []string{"Tanggal", "Keterangan", "Metode", "Nominal"},
+			Bobot: []float64{0.9, 3, 0.8, 1},
+		}
+		var total SaldoDana
+		for _, item := range items {
+			t.tambah(false, item.Tanggal, item.Keterangan, item.Metode, item.Nominal)
+			total = total.tambah(item.Nominal, 0)
+		}
+		t.tambah(true, "Total", fmt.Sprintf("%d transaksi", len(items)), "", total.Total)
+		return t
+	}
+	daftar = append(daftar,
+		pemasukan("Lampiran: pemasukan syahriah", "Pemasukan Syahriah", l.RincianSyahriah),
+		pemasukan("Lampiran: pemasukan donasi", "Pemasukan Donasi", l.RincianDonasi))
+
+	pengeluaran := tabelLaporan{
+		Judul: "Lampiran: pengeluaran",
+		Sheet: "Pengeluaran",
+		Kolom: []string{"Tanggal", "Judul", "Tipe", "Dana syahriah", "Dana donasi", "Total"},
+		Bobot: []float64{0.9, 2.4, 1, 1, 1, 1},
+	}
+	var total SaldoDana
+	for _, item := range l.RincianPengeluaran {
+		pengeluaran.tambah(false, item.Tanggal, item.Judul, string(item.Tipe), item.Syahriah, item.Donasi, item.Total)
+		total = total.tambah(item.Syahriah, item.Donasi)
+	}
+	pengeluaran.tambah(true, "Total", fmt.Sprintf("%d transaksi", len(l.RincianPengeluaran)), "", total.Syahriah, total.Donasi, total.Total)
+	return append(daftar, pengeluaran)
+}
+
+func teksSel(sel interface{}) string {
+	switch v := sel.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', 2, 64)
+	case time.Time:
+		return v.Format("2006-01-02")
+	case string:
+		return v
+	}
+	return fmt.Sprint(sel)
+}
+
+// TulisCSVLaporan menulis laporan sebagai satu file CSV dengan bagian-bagian yang dipisah baris kosong
+func TulisCSVLaporan(w io.Writer, laporan *LaporanKeuangan, namaTPQ string) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"Laporan Keuangan " + namaTPQ})
+	cw.Write([]string{"Periode", laporan.JudulPeriode()})
+	cw.Write([]string{"Dibuat", laporan.DibuatPada.Format("2006-01-02 15:04")})
+	for _, t := range laporan.tabel() {
+		cw.Write([]string{})
+		cw.Write([]string{t.Judul})
+		cw.Write(t.Kolom)
+		for _, baris := range t.Baris {
+			teks := make([]string, len(baris))
+			for i, sel := range baris {
+				teks[i] = teksSel(sel)
+			}
+			cw.Write(teks)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// TulisXLSXLaporan menulis laporan sebagai workbook dengan satu sheet per bagian
+func TulisXLSXLaporan(w io.Writer, laporan *LaporanKeuangan, namaTPQ string) error {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	formatUang, formatTanggal := "#,##0.00;-#,##0.00", "dd-mm-yyyy"
+	gayaJudul, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true, Size: 13}})
+	if err != nil {
+		return err
+	}
+	gayaKolom, err := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{Bold: true},
+		Fill: excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"D9E2D0"}},
+	})
+	if err != nil {
+		return err
+	}
+	gayaUang, err := f.NewStyle(&excelize.Style{CustomNumFmt: &formatUang})
+	if err != nil {
+		return err
+	}
+	gayaUangTebal, err := f.NewStyle(&excelize.Style{CustomNumFmt: &formatUang, Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return err
+	}
+	gayaTanggal, err := f.NewStyle(&excelize.Style{CustomNumFmt: &formatTanggal})
+	if err != nil {
+		return err
+	}
+	gayaTebal, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return err
+	}
+
+	for i, t := range laporan.tabel() {
+		if i == 0 {
+			if err := f.SetSheetName("Sheet1", t.Sheet); err != nil {
+				return err
+			}
+		} else if _, err := f.NewSheet(t.Sheet); err != nil {
+			return err
+		}
+
+		f.SetCellValue(t.Sheet, "A1", "Laporan Keuangan "+namaTPQ+" - "+laporan.JudulPeriode())
+		f.SetCellStyle(t.Sheet, "A1", "A1", gayaJudul)
+		f.SetCellValue(t.Sheet, "A2", t.Judul)
+
+		const barisKolom = 4
+		kiri, _ := excelize.CoordinatesToCellName(1, barisKolom)
+		kanan, _ := excelize.CoordinatesToCellName(len(t.Kolom), barisKolom)
+		if err := f.SetSheetRow(t.Sheet, kiri, &t.Kolom); err != nil {
+			return err
+		}
+		f.SetCellStyle(t.Sheet, kiri, kanan, gayaKolom)
+
+		for r, baris := range t.Baris {
+			for c, sel := range baris {
+				alamat, _ := excelize.CoordinatesToCellName(c+1, barisKolom+1+r)
+				if err := f.SetCellValue(t.Sheet, alamat, sel); err != nil {
+					return err
+				}
+				switch sel.(type) {
+				case float64:
+					if t.Tebal[r] {
+						f.SetCellStyle(t.Sheet, alamat, alamat, gayaUangTebal)
+					} else {
+						f.SetCellStyle(t.Sheet, alamat, alamat, gayaUang)
+					}
+				case time.Time:
+					f.SetCellStyle(t.Sheet, alamat, alamat, gayaTanggal)
+				default:
+					if t.Tebal[r] {
+						f.SetCellStyle(t.Sheet, alamat, alamat, gayaTebal)
+					}
+				}
+			}
+		}
+
+		for c, bobot := range t.Bobot {
+			kolom, _ := excelize.ColumnNumberToName(c + 1)
+			f.SetColWidth(t.Sheet, kolom, kolom, 14*bobot)
+		}
+	}
+	return f.Write(w)
+}
+
+// TulisPDFLaporan mencetak laporan A4 tegak dengan kop TPQ, ringkasan, dan lampiran transaksi
+func TulisPDFLaporan(w io.Writer, laporan *LaporanKeuangan, info models.InformasiTPQ) error {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle("Laporan Keuangan "+laporan.JudulPeriode(), true)
+	pdf.SetMargins(12, 12, 12)
+	pdf.SetAutoPageBreak(true, 15)
+	pdf.AliasNbPages("")
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-12)
+		pdf.SetFont("Helvetica", "I", 7.5)
+		pdf.SetTextColor(110, 110, 110)
+		pdf.CellFormat(0, 5, "Dibuat "+FormatTanggal(laporan.DibuatPada)+laporan.DibuatPada.Format(" 15:04"), "", 0, "L", false, 0, "")
+		pdf.CellFormat(0, 5, fmt.Sprintf("Halaman %d/{nb}", pdf.PageNo()), "", 0, "R", false, 0, "")
+		pdf.SetTextColor(0, 0, 0)
+	})
+	pdf.AddPage()
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	lebar, tinggi := pdf.GetPageSize()
+	isiLebar := lebar - 24
+
+	tulisKop(pdf, info)
+	pdf.SetXY(12, 35)
+	pdf.SetFont("Helvetica", "B", 14)
+	pdf.CellFormat(isiLebar, 7, "LAPORAN KEUANGAN", "", 2, "C", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.CellFormat(isiLebar, 5, tr(laporan.JudulPeriode()), "", 2, "C", false, 0, "")
+	pdf.Ln(4)
+
+	for _, t := range laporan.tabel() {
+		var totalBobot float64
+		for _, b := range t.Bobot {
+			totalBobot += b
+		}
+		lebarKolom := make([]float64, len(t.Bobot))
+		for i, b := range t.Bobot {
+			lebarKolom[i] = isiLebar * b / totalBobot
+		}
+		ukuran := 9.0
+		if len(t.Kolom) > 6 {
+			ukuran = 7.5
+		}
+
+		kepala := func() {
+			pdf.SetFont("Helvetica", "B", ukuran)
+			pdf.SetFillColor(217, 226, 208)
+			for i, kolom := range t.Kolom {
+				pdf.CellFormat(lebarKolom[i], 6, kolom, "1", 0, "C", true, 0, "")
+			}
+			pdf.Ln(-1)
+		}
+
+		if pdf.GetY()+20 > tinggi-15 {
+			pdf.AddPage()
+		}
+		pdf.Ln(3)
+		pdf.SetFont("Helvetica", "B", 10.5)
+		pdf.CellFormat(isiLebar, 7, t.Judul, "", 1, "L", false, 0, "")
+		kepala()
+
+		for r, baris := range t.Baris {
+			if pdf.GetY()+6 > tinggi-15 {
+				pdf.AddPage()
+				kepala()
+			}
+			gaya := ""
+			if t.Tebal[r] {
+				gaya = "B"
+			}
+			pdf.SetFont("Helvetica", gaya, ukuran)
+			for c, sel := range baris {
+				teks, rata := "", "L"
+				switch v := sel.(type) {
+				case float64:
+					teks, rata = FormatRupiah(v), "R"
+				case time.Time:
+					teks = v.Format("02-01-2006")
+				default:
+					// Potong teks yang lebih panjang dari kolomnya
+					asli := []rune(teksSel(sel))
+					teks = tr(string(asli))
+					for len(asli) > 1 && pdf.GetStringWidth(teks) > lebarKolom[c]-2 {
+						asli = asli[:len(asli)-1]
+						teks = tr(string(asli) + "…")
+					}
+				}
+				pdf.CellFormat(lebarKolom[c], 6, teks, "1", 0, rata, false, 0, "")
+			}
+			pdf.Ln(-1)
+		}
+	}
+
+	return pdf.Output(w)
+}
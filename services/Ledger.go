@@ -0,0 +1,527 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+	"tpq_asysyafii/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LedgerService mengelola jurnal double-entry. Semua saldo dan rekap diturunkan dari jurnal,
+// jurnal yang sudah diposting tidak pernah diubah (koreksi memakai jurnal pembalik).
+type LedgerService struct {
+	db *gorm.DB
+}
+
+func NewLedgerService(db *gorm.DB) *LedgerService {
+	return &LedgerService{db: db}
+}
+
+// EntriBaru adalah satu baris debit/kredit yang akan diposting
+type EntriBaru struct {
+	Akun   models.Akun
+	Debit  float64
+	Kredit float64
+}
+
+// RingkasanRekap adalah angka rekap satu periode yang dihitung dari jurnal
+type RingkasanRekap struct {
+	PemasukanSyahriah   float64
+	PengeluaranSyahriah float64
+	SaldoAkhirSyahriah  float64
+	PemasukanDonasi     float64
+	PengeluaranDonasi   float64
+	SaldoAkhirDonasi    float64
+	PemasukanTotal      float64
+	PengeluaranTotal    float64
+	SaldoAkhirTotal     float64
+}
+
+type saldoBaris struct {
+	SumberTipe string
+	Periode    string
+	Akun       models.Akun
+	Debit      float64
+	Kredit     float64
+}
+
+// AkunBeban memetakan tipe pemakaian ke akun beban
+func AkunBeban(tipe models.TipePemakaian) models.Akun {
+	switch tipe {
+	case models.PemakaianOperasional:
+		return models.AkunBebanOperasional
+	case models.PemakaianInvestasi:
+		return models.AkunBebanInvestasi
+	default:
+		return models.AkunBebanLainnya
+	}
+}
+
+// keSen membulatkan nominal ke satuan sen agar perbandingan float aman
+func keSen(nominal float64) int64 {
+	return int64(math.Round(nominal * 100))
+}
+
+// PostJurnal memposting satu jurnal seimbang beserta entrinya. Periode yang sudah tutup buku ditolak,
+// sehingga perubahan transaksi yang menyentuh periode tersebut ikut dibatalkan bersama transaksinya.
+func (s *LedgerService) PostJurnal(periode string, tanggal time.Time, sumberTipe, sumberID, keterangan, dicatatOleh string, entri []EntriBaru) (*models.Jurnal, error) {
+	if _, err := time.Parse("2006-01", periode); err != nil {
+		return nil, fmt.Errorf("periode jurnal tidak valid: %s", periode)
+	}
+	if err := CekPeriodeTerbuka(s.db, periode); err != nil {
+		return nil, err
+	}
+	if len(entri) < 2 {
+		return nil, fmt.Errorf("jurnal minimal memiliki dua entri")
+	}
+
+	var totalDebit, totalKredit int64
+	for _, e := range entri {
+		if e.Debit < 0 || e.Kredit < 0 {
+			return nil, fmt.Errorf("nominal debit/kredit tidak boleh negatif")
+		}
+		totalDebit += keSen(e.Debit)
+		totalKredit += keSen(e.Kredit)
+	}
+	if totalDebit != totalKredit {
+		return nil, fmt.Errorf("jurnal tidak seimbang: debit %.2f, kredit %.2f", float64(totalDebit)/100, float64(totalKredit)/100)
+	}
+	if totalDebit == 0 {
+		return nil, fmt.Errorf("jurnal tidak boleh bernilai 0")
+	}
+
+	jurnal := models.Jurnal{
+		IDJurnal:    uuid.New().String(),
+		Periode:     periode,
+		Tanggal:     tanggal,
+		SumberTipe:  sumberTipe,
+		SumberID:    sumberID,
+		Keterangan:  keterangan,
+		DicatatOleh: dicatatOleh,
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Create(&jurnal).Error; err != nil {
+			return err
+		}
+		for _, e := range entri {
+			if keSen(e.Debit) == 0 && keSen(e.Kredit) == 0 {
+				continue
+			}
+			baris := models.JurnalEntri{
+				IDEntri:  uuid.New().String(),
+				IDJurnal: jurnal.IDJurnal,
+				Akun:     e.Akun,
+				Debit:    float64(keSen(e.Debit)) / 100,
+				Kredit:   float64(keSen(e.Kredit)) / 100,
+			}
+			if err := tx.Create(&baris).Error; err != nil {
+				return err
+			}
+			jurnal.Entri = append(jurnal.Entri, baris)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &jurnal, nil
+}
+
+// KunciAkun mengunci baris kunci_akun untuk akun-akun yang diberikan sampai transaksi selesai.
+// Harus dipanggil dari dalam transaksi dan sebelum membaca saldo, agar pembacaan saldo
+// setelahnya melihat data terbaru yang sudah di-commit transaksi lain.
+func (s *LedgerService) KunciAkun(akunList ...models.Akun) error {
+	// Urutkan agar semua transaksi mengunci dengan urutan yang sama (hindari deadlock)
+	urut := append([]models.Akun(nil), akunList...)
+	sort.Slice(urut, func(i, j int) bool { return urut[i] < urut[j] })
+
+	for _, akun := range urut {
+		kunci := models.KunciAkun{Akun: akun, TerakhirDikunci: time.Now()}
+		if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&kunci).Error; err != nil {
+			return err
+		}
+		if err := s.db.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("akun = ?", akun).
+			First(&kunci).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saldoSumber menghitung saldo bersih (debit - kredit, dalam sen) per periode dan akun untuk satu dokumen sumber
+func (s *LedgerService) saldoSumber(sumberTipe, sumberID string) (map[string]map[models.Akun]int64, error) {
+	var rows []saldoBaris
+	err := s.db.Table("jurnal_entri").
+		Select("jurnal.periode AS periode, jurnal_entri.akun AS akun, COALESCE(SUM(jurnal_entri.debit), 0) AS debit, COALESCE(SUM(jurnal_entri.kredit), 0) AS kredit").
+		Joins("JOIN jurnal ON jurnal.id_jurnal = jurnal_entri.id_jurnal").
+		Where("jurnal.sumber_tipe = ? AND jurnal.sumber_id = ?", sumberTipe, sumberID).
+		Group("jurnal.periode, jurnal_entri.akun").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	hasil := make(map[string]map[models.Akun]int64)
+	for _, r := range rows {
+		net := keSen(r.Debit) - keSen(r.Kredit)
+		if net == 0 {
+			continue
+		}
+		if hasil[r.Periode] == nil {
+			hasil[r.Periode] = make(map[models.Akun]int64)
+		}
+		hasil[r.Periode][r.Akun] = net
+	}
+	return hasil, nil
+}
+
+// BatalkanSumber memposting jurnal pembalik untuk semua efek dokumen sumber yang masih berlaku.
+// Mengembalikan daftar periode yang terpengaruh.
+func (s *LedgerService) BatalkanSumber(sumberTipe, sumberID, dicatatOleh string) ([]string, error) {
+	saldo, err := s.saldoSumber(sumberTipe, sumberID)
+	if err != nil {
+		return nil, err
+	}
+
+	var periodeList []string
+	for periode := range saldo {
+		periodeList = append(periodeList, periode)
+	}
+	sort.Strings(periodeList)
+
+	for _, periode := range periodeList {
+		var entri []EntriBaru
+		for akun, net := range saldo[periode] {
+			if net > 0 {
+				entri = append(entri, EntriBaru{Akun: akun, Kredit: float64(net) / 100})
+			} else {
+				entri = append(entri, EntriBaru{Akun: akun, Debit: float64(-net) / 100})
+			}
+		}
+		keterangan := fmt.Sprintf("Jurnal pembalik %s %s", sumberTipe, sumberID)
+		if _, err := s.PostJurnal(periode, time.Now(), sumberTipe, sumberID, keterangan, dicatatOleh, entri); err != nil {
+			return nil, err
+		}
+	}
+	return periodeList, nil
+}
+
+// sinkronSumber memastikan efek dokumen sumber di jurnal sama dengan entri yang diinginkan.
+// Jika berbeda, efek lama dibalik lalu jurnal baru diposting. Entri kosong berarti dokumen tidak lagi berefek.
+func (s *LedgerService) sinkronSumber(periode string, tanggal time.Time, sumberTipe, sumberID, keterangan, dicatatOleh string, entri []EntriBaru) error {
+	saldo, err := s.saldoSumber(sumberTipe, sumberID)
+	if err != nil {
+		return err
+	}
+
+	diinginkan := make(map[models.Akun]int64)
+	for _, e := range entri {
+		diinginkan[e.Akun] += keSen(e.Debit) - keSen(e.Kredit)
+	}
+	for akun, net := range diinginkan {
+		if net == 0 {
+			delete(diinginkan, akun)
+		}
+	}
+
+	if samaSaldo(saldo, periode, diinginkan) {
+		return nil
+	}
+
+	if _, err := s.BatalkanSumber(sumberTipe, sumberID, dicatatOleh); err != nil {
+		return err
+	}
+	if len(diinginkan) == 0 {
+		return nil
+	}
+	_, err = s.PostJurnal(periode, tanggal, sumberTipe, sumberID, keterangan, dicatatOleh, entri)
+	return err
+}
+
+func samaSaldo(saldo map[string]map[models.Akun]int64, periode string, diinginkan map[models.Akun]int64) bool {
+	if len(diinginkan) == 0 {
+		return len(saldo) == 0
+	}
+	if len(saldo) != 1 || len(saldo[periode]) != len(diinginkan) {
+		return false
+	}
+	for akun, net := range diinginkan {
+		if saldo[periode][akun] != net {
+			return false
+		}
+	}
+	return true
+}
+
+// CatatSyahriah menyelaraskan jurnal dengan pembayaran sebuah syahriah. Pemasukan diakui per pembayaran
+// pada bulan uang diterima; jurnal lama yang diposting per syahriah lunas dibalik.
+// Pastikan pembayaran lama sudah dimigrasi (MigrasiBayarLama) sebelum memanggil fungsi ini.
+func (s *LedgerService) CatatSyahriah(syahriah models.Syahriah, dicatatOleh string) error {
+	if err := s.sinkronSumber(syahriah.Bulan, syahriah.WaktuCatat, TargetSyahriah, syahriah.IDSyahriah, "", dicatatOleh, nil); err != nil {
+		return err
+	}
+
+	var daftar []models.SyahriahBayar
+	if err := s.db.Where("id_syahriah = ?", syahriah.IDSyahriah).Find(&daftar).Error; err != nil {
+		return err
+	}
+	for _, bayar := range daftar {
+		if err := s.CatatBayarSyahriah(bayar, syahriah.Bulan, dicatatOleh); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CatatBayarSyahriah menyelaraskan jurnal dengan satu pembayaran syahriah. Baris kredit tidak berefek ke kas.
+func (s *LedgerService) CatatBayarSyahriah(bayar models.SyahriahBayar, bulan, dicatatOleh string) error {
+	var entri []EntriBaru
+	if bayar.Metode != models.BayarKredit {
+		entri = []EntriBaru{
+			{Akun: models.AkunKasSyahriah, Debit: bayar.Nominal},
+			{Akun: models.AkunPendapatanSyahriah, Kredit: bayar.Nominal},
+		}
+	}
+	keterangan := fmt.Sprintf("Pembayaran syahriah bulan %s (%s)", bulan, bayar.Metode)
+	return s.sinkronSumber(bayar.WaktuBayar.Format("2006-01"), bayar.WaktuBayar, TargetSyahriahBayar, bayar.IDBayar, keterangan, dicatatOleh, entri)
+}
+
+// CatatDonasi menyelaraskan jurnal dengan data donasi
+func (s *LedgerService) CatatDonasi(donasi models.Donasi, dicatatOleh string) error {
+	entri := []EntriBaru{
+		{Akun: models.AkunKasDonasi, Debit: donasi.Nominal},
+		{Akun: models.AkunPendapatanDonasi, Kredit: donasi.Nominal},
+	}
+	keterangan := fmt.Sprintf("Donasi dari %s", donasi.NamaDonatur)
+	return s.sinkronSumber(donasi.WaktuCatat.Format("2006-01"), donasi.WaktuCatat, TargetDonasi, donasi.IDDonasi, keterangan, dicatatOleh, entri)
+}
+
+// CatatPemakaian menyelaraskan jurnal dengan data pemakaian saldo
+func (s *LedgerService) CatatPemakaian(pemakaian models.PemakaianSaldo, dicatatOleh string) error {
+	tanggal := pemakaian.CreatedAt
+	if pemakaian.TanggalPemakaian != nil {
+		tanggal = *pemakaian.TanggalPemakaian
+	}
+	if tanggal.IsZero() {
+		tanggal = time.Now()
+	}
+
+	entri := []EntriBaru{
+		{Akun: AkunBeban(pemakaian.TipePemakaian), Debit: pemakaian.NominalTotal},
+		{Akun: models.AkunKasSyahriah, Kredit: pemakaian.NominalSyahriah},
+		{Akun: models.AkunKasDonasi, Kredit: pemakaian.NominalDonasi},
+	}
+	keterangan := fmt.Sprintf("Pemakaian saldo: %s", pemakaian.JudulPemakaian)
+	return s.sinkronSumber(tanggal.Format("2006-01"), tanggal, TargetPemakaianSaldo, pemakaian.IDPemakaian, keterangan, dicatatOleh, entri)
+}
+
+// CatatPenyesuaian mengatur jurnal penyesuaian agar saldo akhir kas pada periode tertentu sama dengan target
+func (s *LedgerService) CatatPenyesuaian(periode, sumberID string, targetSyahriah, targetDonasi float64, dicatatOleh string) error {
+	// Hitung saldo tanpa penyesuaian lama dari sumber yang sama
+	if _, err := s.BatalkanSumber(TargetRekapSaldo, sumberID, dicatatOleh); err != nil {
+		return err
+	}
+	ringkasan, err := s.HitungRekap(periode)
+	if err != nil {
+		return err
+	}
+
+	var entri []EntriBaru
+	tambahSelisih := func(akun models.Akun, selisih int64) {
+		if selisih > 0 {
+			entri = append(entri,
+				EntriBaru{Akun: akun, Debit: float64(selisih) / 100},
+				EntriBaru{Akun: models.AkunPenyesuaianSaldo, Kredit: float64(selisih) / 100})
+		} else if selisih < 0 {
+			entri = append(entri,
+				EntriBaru{Akun: akun, Kredit: float64(-selisih) / 100},
+				EntriBaru{Akun: models.AkunPenyesuaianSaldo, Debit: float64(-selisih) / 100})
+		}
+	}
+	tambahSelisih(models.AkunKasSyahriah, keSen(targetSyahriah)-keSen(ringkasan.SaldoAkhirSyahriah))
+	tambahSelisih(models.AkunKasDonasi, keSen(targetDonasi)-keSen(ringkasan.SaldoAkhirDonasi))
+
+	if len(entri) == 0 {
+		return nil
+	}
+	keterangan := fmt.Sprintf("Penyesuaian saldo periode %s", periode)
+	_, err = s.PostJurnal(periode, time.Now(), TargetRekapSaldo, sumberID, keterangan, dicatatOleh, entri)
+	return err
+}
+
+// saldoPerAkun menjumlahkan debit/kredit per sumber dan akun untuk kondisi periode tertentu
+func (s *LedgerService) saldoPerAkun(kondisiPeriode string, periode string) ([]saldoBaris, error) {
+	var rows []saldoBaris
+	err := s.db.Table("jurnal_entri").
+		Select("jurnal.sumber_tipe AS sumber_tipe, jurnal_entri.akun AS akun, COALESCE(SUM(jurnal_entri.debit), 0) AS debit, COALESCE(SUM(jurnal_entri.kredit), 0) AS kredit").
+		Joins("JOIN jurnal ON jurnal.id_jurnal = jurnal_entri.id_jurnal").
+		Where("jurnal.periode "+kondisiPeriode+" ?", periode).
+		Group("jurnal.sumber_tipe, jurnal_entri.akun").
+		Scan(&rows).Error
+	return rows, err
+}
+
+// SaldoAkun mengembalikan saldo bersih (debit - kredit) sebuah akun dari seluruh jurnal
+func (s *LedgerService) SaldoAkun(akun models.Akun) (float64, error) {
+	var hasil struct {
+		Debit  float64
+		Kredit float64
+	}
+	err := s.db.Model(&models.JurnalEntri{}).
+		Select("COALESCE(SUM(debit), 0) AS debit, COALESCE(SUM(kredit), 0) AS kredit").
+		Where("akun = ?", akun).
+		Scan(&hasil).Error
+	if err != nil {
+		return 0, err
+	}
+	return float64(keSen(hasil.Debit)-keSen(hasil.Kredit)) / 100, nil
+}
+
+// HitungRekap menghitung angka rekap satu periode langsung dari jurnal
+func (s *LedgerService) HitungRekap(periode string) (RingkasanRekap, error) {
+	var r RingkasanRekap
+
+	mutasi, err := s.saldoPerAkun("=", periode)
+	if err != nil {
+		return r, err
+	}
+	var pemasukanSyahriah, pemasukanDonasi, pengeluaranSyahriah, pengeluaranDonasi int64
+	for _, m := range mutasi {
+		net := keSen(m.Kredit) - keSen(m.Debit)
+		switch {
+		case m.Akun == models.AkunPendapatanSyahriah:
+			pemasukanSyahriah += net
+		case m.Akun == models.AkunPendapatanDonasi:
+			pemasukanDonasi += net
+		case m.Akun == models.AkunKasSyahriah && m.SumberTipe == TargetPemakaianSaldo:
+			pengeluaranSyahriah += net
+		case m.Akun == models.AkunKasDonasi && m.SumberTipe == TargetPemakaianSaldo:
+			pengeluaranDonasi += net
+		}
+	}
+
+	kumulatif, err := s.saldoPerAkun("<=", periode)
+	if err != nil {
+		return r, err
+	}
+	var saldoSyahriah, saldoDonasi int64
+	for _, k := range kumulatif {
+		net := keSen(k.Debit) - keSen(k.Kredit)
+		switch k.Akun {
+		case models.AkunKasSyahriah:
+			saldoSyahriah += net
+		case models.AkunKasDonasi:
+			saldoDonasi += net
+		}
+	}
+
+	r.PemasukanSyahriah = float64(pemasukanSyahriah) / 100
+	r.PengeluaranSyahriah = float64(pengeluaranSyahriah) / 100
+	r.SaldoAkhirSyahriah = float64(saldoSyahriah) / 100
+	r.PemasukanDonasi = float64(pemasukanDonasi) / 100
+	r.PengeluaranDonasi = float64(pengeluaranDonasi) / 100
+	r.SaldoAkhirDonasi = float64(saldoDonasi) / 100
+	r.PemasukanTotal = float64(pemasukanSyahriah+pemasukanDonasi) / 100
+	r.PengeluaranTotal = float64(pengeluaranSyahriah+pengeluaranDonasi) / 100
+	r.SaldoAkhirTotal = float64(saldoSyahriah+saldoDonasi) / 100
+	return r, nil
+}
+
+// MaterialisasiRekap menulis ulang baris rekap_saldo suatu periode dari hasil HitungRekap
+func (s *LedgerService) MaterialisasiRekap(periode string) (*models.RekapSaldo, error) {
+	ringkasan, err := s.HitungRekap(periode)
+	if err != nil {
+		return nil, err
+	}
+
+	var rekap models.RekapSaldo
+	err = s.db.Where("periode = ?", periode).First(&rekap).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	if err == gorm.ErrRecordNotFound {
+		rekap = models.RekapSaldo{
+			IDSaldo: uuid.New().String(),
+			Periode: periode,
+		}
+	}
+
+	rekap.PemasukanSyahriah = ringkasan.PemasukanSyahriah
+	rekap.PengeluaranSyahriah = ringkasan.PengeluaranSyahriah
+	rekap.SaldoAkhirSyahriah = ringkasan.SaldoAkhirSyahriah
+	rekap.PemasukanDonasi = ringkasan.PemasukanDonasi
+	rekap.PengeluaranDonasi = ringkasan.PengeluaranDonasi
+	rekap.SaldoAkhirDonasi = ringkasan.SaldoAkhirDonasi
+	rekap.PemasukanTotal = ringkasan.PemasukanTotal
+	rekap.PengeluaranTotal = ringkasan.PengeluaranTotal
+	rekap.SaldoAkhirTotal = ringkasan.SaldoAkhirTotal
+	rekap.TerakhirUpdate = time.Now()
+
+	if err := s.db.Save(&rekap).Error; err != nil {
+		return nil, err
+	}
+	return &rekap, nil
+}
+
+// PeriodeJurnal mengembalikan semua periode yang memiliki jurnal, terurut kronologis
+func (s *LedgerService) PeriodeJurnal() ([]string, error) {
+	var periods []string
+	err := s.db.Model(&models.Jurnal{}).
+		Distinct("periode").
+		Order("periode ASC").
+		Pluck("periode", &periods).Error
+	return periods, err
+}
+
+// SinkronSemuaSumber memposting ulang jurnal untuk seluruh syahriah, donasi, dan pemakaian saldo.
+// Aman dijalankan berkali-kali karena dokumen yang sudah sesuai tidak diposting ulang.
+func (s *LedgerService) SinkronSemuaSumber(dicatatOleh string) error {
+	if _, err := NewSyahriahBayarService(s.db).MigrasiBayarLama(); err != nil {
+		return fmt.Errorf("migrasi pembayaran syahriah: %v", err)
+	}
+
+	var syahriahList []models.Syahriah
+	if err := s.db.Find(&syahriahList).Error; err != nil {
+		return err
+	}
+	for _, syahriah := range syahriahList {
+		if err := s.CatatSyahriah(syahriah, pencatat(dicatatOleh, syahriah.DicatatOleh)); err != nil {
+			return fmt.Errorf("syahriah %s: %v", syahriah.IDSyahriah, err)
+		}
+	}
+
+	var donasiList []models.Donasi
+	if err := s.db.Find(&donasiList).Error; err != nil {
+		return err
+	}
+	for _, donasi := range donasiList {
+		if err := s.CatatDonasi(donasi, pencatat(dicatatOleh, donasi.DicatatOleh)); err != nil {
+			return fmt.Errorf("donasi %s: %v", donasi.IDDonasi, err)
+		}
+	}
+
+	var pemakaianList []models.PemakaianSaldo
+	if err := s.db.Find(&pemakaianList).Error; err != nil {
+		return err
+	}
+	for _, pemakaian := range pemakaianList {
+		if err := s.CatatPemakaian(pemakaian, pencatat(dicatatOleh, pemakaian.DiajukanOleh)); err != nil {
+			return fmt.Errorf("pemakaian %s: %v", pemakaian.IDPemakaian, err)
+		}
+	}
+	return nil
+}
+
+func pencatat(utama, cadangan string) string {
+	if utama != "" {
+		return utama
+	}
+	return cadangan
+}
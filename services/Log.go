@@ -1,6 +1,8 @@
 package services
 
 import (
+	"encoding/json"
+	"reflect"
 	"tpq_asysyafii/models"
 
 	"github.com/google/uuid"
@@ -31,17 +33,132 @@ func (s *LogService) LogAktivitas(adminID, aksi, tipeTarget, idTarget, keteranga
 	return s.db.Create(&logAktivitas).Error
 }
 
+// LogPerubahan membuat log aktivitas dengan keterangan berisi diff data sebelum dan sesudah aksi
+func (s *LogService) LogPerubahan(adminID, aksi, tipeTarget, idTarget string, sebelum, sesudah interface{}) error {
+	keterangan, err := BuatDiff(sebelum, sesudah)
+	if err != nil {
+		return err
+	}
+	return s.LogAktivitas(adminID, aksi, tipeTarget, idTarget, keterangan)
+}
+
+// PerubahanField menyimpan nilai satu field sebelum dan sesudah aksi
+type PerubahanField struct {
+	Sebelum interface{} `json:"sebelum"`
+	Sesudah interface{} `json:"sesudah"`
+}
+
+// Field yang tidak boleh ikut tercatat di log
+var fieldRahasia = map[string]bool{
+	"password": true,
+}
+
+// BuatDiff menghasilkan JSON berisi field yang berubah antara sebelum dan sesudah.
+// Nilai nil berarti data belum ada (create) atau sudah tidak ada (delete).
+func BuatDiff(sebelum, sesudah interface{}) (string, error) {
+	mapSebelum, err := toFieldMap(sebelum)
+	if err != nil {
+		return "", err
+	}
+	mapSesudah, err := toFieldMap(sesudah)
+	if err != nil {
+		return "", err
+	}
+
+	diff := make(map[string]PerubahanField)
+	for field, nilai := range mapSebelum {
+		if !reflect.DeepEqual(nilai, mapSesudah[field]) {
+			diff[field] = PerubahanField{Sebelum: nilai, Sesudah: mapSesudah[field]}
+		}
+	}
+	for field, nilai := range mapSesudah {
+		if _, ada := mapSebelum[field]; !ada && nilai != nil {
+			diff[field] = PerubahanField{Sebelum: nil, Sesudah: nilai}
+		}
+	}
+
+	hasil, err := json.Marshal(diff)
+	if err != nil {
+		return "", err
+	}
+	return string(hasil), nil
+}
+
+// toFieldMap mengubah model menjadi map field JSON tanpa relasi dan field rahasia
+func toFieldMap(data interface{}) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+	if data == nil {
+		return fields, nil
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+
+	for field, nilai := range fields {
+		switch nilai.(type) {
+		case map[string]interface{}, []interface{}:
+			// Relasi (Admin, Wali, Santri, dll) tidak perlu dicatat
+			delete(fields, field)
+		}
+		if fieldRahasia[field] {
+			delete(fields, field)
+		}
+	}
+	return fields, nil
+}
+
 // Constants untuk aksi-aksi standar
 const (
 	AksiCreate = "CREATE"
-	AksiUpdate = "UPDATE" 
+	AksiUpdate = "UPDATE"
 	AksiDelete = "DELETE"
 	AksiLogin  = "LOGIN"
+
+	AksiUbahPassword       = "UBAH_PASSWORD"
+	AksiMintaResetPassword = "MINTA_RESET_PASSWORD"
+	AksiResetPassword      = "RESET_PASSWORD"
+
+	AksiSetujuiRegistrasi = "SETUJUI_REGISTRASI"
+	AksiTolakRegistrasi   = "TOLAK_REGISTRASI"
+	AksiBukaKunciLogin    = "BUKA_KUNCI_LOGIN"
+
+	AksiBayarOnline            = "BAYAR_ONLINE"
+	AksiRekonsiliasiPembayaran = "REKONSILIASI_PEMBAYARAN"
+	AksiKirimPengingat         = "KIRIM_PENGINGAT"
+	AksiPerbaikiIntegritas     = "PERBAIKI_INTEGRITAS"
+	AksiTutupBuku              = "TUTUP_BUKU"
+	AksiBukaTutupBuku          = "BUKA_TUTUP_BUKU"
+
+	AksiTerbitkanBerita = "TERBITKAN_BERITA"
+	AksiPulihkanRevisi  = "PULIHKAN_REVISI"
 )
 
 // Constants untuk tipe target
 const (
-	TargetDonasi   = "DONASI"
-	TargetUser     = "USER"
-	TargetSyahriah = "SYAHRIAH"
-)	
\ No newline at end of file
+	TargetDonasi          = "DONASI"
+	TargetUser            = "USER"
+	TargetSyahriah        = "SYAHRIAH"
+	TargetSyahriahBayar   = "SYAHRIAH_BAYAR"
+	TargetPemakaianSaldo  = "PEMAKAIAN_SALDO"
+	TargetRekapSaldo      = "REKAP_SALDO"
+	TargetSantri          = "SANTRI"
+	TargetKeluarga        = "KELUARGA"
+	TargetBerita          = "BERITA"
+	TargetFasilitas       = "FASILITAS"
+	TargetProgramUnggulan = "PROGRAM_UNGGULAN"
+	TargetPengumuman      = "PENGUMUMAN"
+	TargetTestimoni       = "TESTIMONI"
+	TargetSosialMedia     = "SOSIAL_MEDIA"
+	TargetInformasiTPQ    = "INFORMASI_TPQ"
+	TargetPembayaran      = "PEMBAYARAN"
+	TargetTarifDasar      = "TARIF_DASAR"
+	TargetAturanTarif     = "ATURAN_TARIF"
+	TargetPengingat       = "PENGINGAT_TUNGGAKAN"
+	TargetKoreksiSaldo    = "KOREKSI_SALDO"
+	TargetMedia           = "MEDIA"
+)
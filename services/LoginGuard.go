@@ -0,0 +1,174 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"time"
+	"tpq_asysyafii/models"
+	"tpq_asysyafii/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	MaksGagalPerAkun = 5                // akun dikunci setelah sekian kali gagal berturut-turut
+	MaksGagalPerIP   = 20               // IP dikunci setelah sekian kali gagal (ke akun mana pun)
+	LamaKunciLogin   = 15 * time.Minute // lama penguncian sementara
+	JendelaGagal     = 15 * time.Minute // gagal yang lebih lama dari ini tidak dihitung lagi
+	jedaMaksimal     = 30 * time.Second
+	gagalTanpaJeda   = 2 // jeda bertahap baru berlaku setelah sekian kali gagal
+)
+
+var (
+	ErrLoginTerkunci     = errors.New("terlalu banyak percobaan login gagal, coba lagi nanti")
+	ErrLoginTerlaluCepat = errors.New("tunggu sebentar sebelum mencoba login lagi")
+)
+
+// ErrLoginDitahan membawa lama waktu tunggu sebelum login boleh dicoba lagi
+type ErrLoginDitahan struct {
+	Err    error
+	Tunggu time.Duration
+}
+
+func (e *ErrLoginDitahan) Error() string { return e.Err.Error() }
+func (e *ErrLoginDitahan) Unwrap() error { return e.Err }
+
+// LoginGuard membatasi percobaan login per identitas akun dan per IP:
+// jeda yang makin lama setiap kali gagal, lalu penguncian sementara.
+// Hitungan akun memakai identitas yang diketik (bukan id user), sehingga identitas yang tidak
+// terdaftar dikunci dengan cara yang sama dan respon tidak membocorkan akun mana yang ada.
+type LoginGuard struct {
+	db *gorm.DB
+}
+
+func NewLoginGuard(db *gorm.DB) *LoginGuard {
+	return &LoginGuard{db: db}
+}
+
+// Jenis identitas yang bisa dipakai untuk login
+const (
+	IdentitasEmail = "email"
+	IdentitasNama  = "nama"
+	IdentitasTelp  = "telp"
+)
+
+// KunciIdentitasLogin menormalkan identitas login (huruf kecil, spasi dirapikan) lalu meng-hash-nya
+// agar panjang kunci tetap dan identitas tidak tersimpan apa adanya
+func KunciIdentitasLogin(jenis, nilai string) string {
+	nilai = strings.ToLower(strings.Join(strings.Fields(nilai), " "))
+	return "akun:" + utils.HashToken(jenis+":"+nilai)
+}
+
+func kunciIPLogin(ip string) string { return "ip:" + ip }
+
+// kunciIdentitasUser mengembalikan kunci semua identitas yang bisa dipakai user untuk login
+func kunciIdentitasUser(user models.User) []string {
+	kunci := []string{KunciIdentitasLogin(IdentitasNama, user.NamaLengkap)}
+	if user.Email != nil && *user.Email != "" {
+		kunci = append(kunci, KunciIdentitasLogin(IdentitasEmail, *user.Email))
+	}
+	if user.NoTelp != "" {
+		kunci = append(kunci, KunciIdentitasLogin(IdentitasTelp, user.NoTelp))
+	}
+	return kunci
+}
+
+// jedaSetelah menghitung jeda bertahap: 1s, 2s, 4s, ... sampai jedaMaksimal
+func jedaSetelah(gagal int) time.Duration {
+	if gagal <= gagalTanpaJeda {
+		return 0
+	}
+	jeda := time.Second * time.Duration(math.Pow(2, float64(gagal-gagalTanpaJeda-1)))
+	if jeda > jedaMaksimal {
+		return jedaMaksimal
+	}
+	return jeda
+}
+
+// Periksa menolak login jika identitas atau IP sedang dikunci atau belum melewati jeda.
+// kunciAkun berasal dari KunciIdentitasLogin dan diperiksa sama saja meskipun user tidak ditemukan.
+func (g *LoginGuard) Periksa(kunciAkun, ip string) error {
+	kunci := []string{kunciIPLogin(ip), kunciAkun}
+
+	var daftar []models.PercobaanLogin
+	if err := g.db.Where("kunci IN ?", kunci).Find(&daftar).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var terlama *ErrLoginDitahan
+	for _, p := range daftar {
+		var ditahan *ErrLoginDitahan
+		if p.TerkunciSampai != nil && now.Before(*p.TerkunciSampai) {
+			ditahan = &ErrLoginDitahan{Err: ErrLoginTerkunci, Tunggu: p.TerkunciSampai.Sub(now)}
+		} else if now.Sub(p.TerakhirGagal) < JendelaGagal {
+			if sisa := p.TerakhirGagal.Add(jedaSetelah(p.Gagal)).Sub(now); sisa > 0 {
+				ditahan = &ErrLoginDitahan{Err: ErrLoginTerlaluCepat, Tunggu: sisa}
+			}
+		}
+		if ditahan != nil && (terlama == nil || ditahan.Tunggu > terlama.Tunggu) {
+			terlama = ditahan
+		}
+	}
+	if terlama != nil {
+		return terlama
+	}
+	return nil
+}
+
+// CatatGagal menambah hitungan gagal untuk IP dan identitas akun, dan mengunci jika melewati batas
+func (g *LoginGuard) CatatGagal(kunciAkun, ip string) error {
+	return g.db.Transaction(func(tx *gorm.DB) error {
+		if err := g.tambahGagal(tx, kunciIPLogin(ip), MaksGagalPerIP); err != nil {
+			return err
+		}
+		return g.tambahGagal(tx, kunciAkun, MaksGagalPerAkun)
+	})
+}
+
+func (g *LoginGuard) tambahGagal(tx *gorm.DB, kunci string, maks int) error {
+	now := time.Now()
+	baris := models.PercobaanLogin{Kunci: kunci, TerakhirGagal: now}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&baris).Error; err != nil {
+		return err
+	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("kunci = ?", kunci).First(&baris).Error; err != nil {
+		return err
+	}
+
+	// Mulai hitungan baru jika gagal terakhir sudah di luar jendela atau kunci sebelumnya sudah habis
+	if now.Sub(baris.TerakhirGagal) >= JendelaGagal || (baris.TerkunciSampai != nil && now.After(*baris.TerkunciSampai)) {
+		baris.Gagal = 0
+		baris.TerkunciSampai = nil
+	}
+	baris.Gagal++
+	baris.TerakhirGagal = now
+	if baris.Gagal >= maks {
+		sampai := now.Add(LamaKunciLogin)
+		baris.TerkunciSampai = &sampai
+	}
+
+	return tx.Model(&models.PercobaanLogin{}).Where("kunci = ?", kunci).Updates(map[string]interface{}{
+		"gagal":           baris.Gagal,
+		"terakhir_gagal":  baris.TerakhirGagal,
+		"terkunci_sampai": baris.TerkunciSampai,
+	}).Error
+}
+
+// CatatBerhasil menghapus hitungan gagal semua identitas akun setelah login berhasil.
+// Hitungan IP tidak direset agar satu akun valid tidak bisa dipakai untuk menebak akun lain.
+func (g *LoginGuard) CatatBerhasil(user models.User) error {
+	return g.BukaKunci(user)
+}
+
+// BukaKunci menghapus penguncian dan hitungan gagal semua identitas (email, nama, no telp) sebuah akun
+func (g *LoginGuard) BukaKunci(user models.User) error {
+	return g.db.Where("kunci IN ?", kunciIdentitasUser(user)).Delete(&models.PercobaanLogin{}).Error
+}
+
+// BukaKunciIP menghapus penguncian dan hitungan gagal sebuah alamat IP
+func (g *LoginGuard) BukaKunciIP(ip string) error {
+	return g.db.Where("kunci = ?", kunciIPLogin(ip)).Delete(&models.PercobaanLogin{}).Error
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"tpq_asysyafii/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrMediaTidakDitemukan    = errors.New("media tidak ditemukan")
+	ErrMediaTerlaluBesar      = errors.New("ukuran berkas melebihi batas")
+	ErrTipeMediaTidakDidukung = errors.New("tipe berkas tidak didukung, gunakan JPEG, PNG, WebP, atau GIF")
+	ErrMediaDipakai           = errors.New("media masih dipakai")
+)
+
+// tipeMediaDidukung adalah tipe konten yang dapat di-decode oleh ProsesGambar
+var tipeMediaDidukung = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/webp": true,
+	"image/gif":  true,
+}
+
+// folderMedia memetakan kategori ke folder di storage; logo tetap di "tpq" seperti folder lama
+var folderMedia = map[models.KategoriMedia]string{
+	models.KategoriMediaBerita: "berita",
+	models.KategoriMediaLogo:   "tpq",
+	models.KategoriMediaSantri: "santri",
+	models.KategoriMediaSosmed: "sosmed",
+	models.KategoriMediaUmum:   "umum",
+}
+
+// pemakaianMedia adalah kolom konten yang menyimpan ID media
+var pemakaianMedia = []struct {
+	Tabel, Kolom, Nama string
+}{
+	{"berita", "id_gambar_cover", "cover berita"},
+	{"informasi_tpq", "id_logo", "logo TPQ"},
+	{"santri", "id_foto", "foto santri"},
+	{"sosial_media", "id_icon", "icon sosial media"},
+}
+
+// BatasUkuranMedia adalah ukuran maksimal berkas dalam byte (MEDIA_MAX_MB, default 5)
+func BatasUkuranMedia() int64 {
+	if mb, err := strconv.Atoi(os.Getenv("MEDIA_MAX_MB")); err == nil && mb > 0 {
+		return int64(mb) << 20
+	}
+	return 5 << 20
+}
+
+// KategoriMediaValid memeriksa kategori yang dikirim client
+func KategoriMediaValid(kategori models.KategoriMedia) bool {
+	_, ok := folderMedia[kategori]
+	return ok
+}
+
+// MediaService mengelola media library: validasi, penyimpanan ke Storage, dan pencatatan di tabel media
+type MediaService struct {
+	db      *gorm.DB
+	storage Storage
+}
+
+func NewMediaService(db *gorm.DB) *MediaService {
+	return &MediaService{db: db, storage: DefaultStorage()}
+}
+
+// Unggah memvalidasi ukuran dan tipe berkas dari isinya (bukan dari nama file atau header client),
+// memprosesnya menjadi varian full, card, dan thumbnail tanpa metadata, menyimpan setiap varian
+// dengan nama berupa hash isinya, lalu mencatatnya di media library. Gambar yang sama persis
+// pada kategori yang sama tidak diunggah ulang; media yang sudah ada dikembalikan.
+func (s *MediaService) Unggah(ctx context.Context, namaFile string, berkas io.Reader, kategori models.KategoriMedia, oleh string) (*models.Media, error) {
+	if !KategoriMediaValid(kategori) {
+		return nil, fmt.Errorf("kategori media tidak valid: %s", kategori)
+	}
+
+	batas := BatasUkuranMedia()
+	isi, err := io.ReadAll(io.LimitReader(berkas, batas+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(isi)) > batas {
+		return nil, fmt.Errorf("%w (%d MB)", ErrMediaTerlaluBesar, batas>>20)
+	}
+	if len(isi) == 0 {
+		return nil, errors.New("berkas kosong")
+	}
+
+	if tipeKonten := http.DetectContentType(isi); !tipeMediaDidukung[tipeKonten] {
+		return nil, fmt.Errorf("%w (terdeteksi %s)", ErrTipeMediaTidakDidukung, tipeKonten)
+	}
+
+	daftarVarian, err := ProsesGambar(isi)
+	if err != nil {
+		return nil, err
+	}
+	kunci := make(map[string]string, len(daftarVarian))
+	for _, v := range daftarVarian {
+		hash := sha256.Sum256(v.Isi)
+		h := hex.EncodeToString(hash[:])
+		kunci[v.Nama] = fmt.Sprintf("%s/%s/%s%s", folderMedia[kategori], h[:2], h[:32], v.Ekstensi)
+	}
+
+	var ada models.Media
+	if err := s.db.Where("kunci = ?", kunci[VarianFull]).Limit(1).Find(&ada).Error; err != nil {
+		return nil, err
+	}
+	if ada.IDMedia != "" {
+		return &ada, nil
+	}
+
+	media := models.Media{
+		IDMedia:        uuid.New().String(),
+		NamaFile:       namaFile,
+		Kunci:          kunci[VarianFull],
+		KunciCard:      kunci[VarianCard],
+		KunciThumbnail: kunci[VarianThumbnail],
+		Kategori:       kategori,
+		Storage:        s.storage.Driver(),
+		DiunggahOleh:   oleh,
+	}
+	if len(media.NamaFile) > 255 {
+		media.NamaFile = media.NamaFile[:255]
+	}
+
+	var tersimpan []string
+	hapusTersimpan := func() {
+		for _, k := range tersimpan {
+			if errHapus := s.storage.Hapus(ctx, k); errHapus != nil {
+				fmt.Printf("Gagal menghapus berkas yatim %s: %v\n", k, errHapus)
+			}
+		}
+	}
+	for _, v := range daftarVarian {
+		url, err := s.storage.Simpan(ctx, kunci[v.Nama], v.TipeKonten, v.Isi)
+		if err != nil {
+			hapusTersimpan()
+			return nil, fmt.Errorf("gagal menyimpan berkas: %w", err)
+		}
+		tersimpan = append(tersimpan, kunci[v.Nama])
+
+		switch v.Nama {
+		case VarianFull:
+			media.URL, media.TipeKonten, media.Ukuran = url, v.TipeKonten, int64(len(v.Isi))
+			media.Lebar, media.Tinggi = v.Lebar, v.Tinggi
+		case VarianCard:
+			media.URLCard = url
+		case VarianThumbnail:
+			media.URLThumbnail = url
+		}
+	}
+
+	if err := s.db.Create(&media).Error; err != nil {
+		hapusTersimpan()
+		return nil, err
+	}
+	return &media, nil
+}
+
+// Ambil mengembalikan media berdasarkan ID
+func (s *MediaService) Ambil(id string) (*models.Media, error) {
+	var media models.Media
+	if err := s.db.Where("id_media = ?", id).Limit(1).Find(&media).Error; err != nil {
+		return nil, err
+	}
+	if media.IDMedia == "" {
+		return nil, ErrMediaTidakDitemukan
+	}
+	return &media, nil
+}
+
+// Hapus menghapus media yang tidak lagi dipakai konten mana pun, beserta berkasnya di storage
+func (s *MediaService) Hapus(ctx context.Context, id string) (*models.Media, error) {
+	media, err := s.Ambil(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var dipakai []string
+	for _, p := range pemakaianMedia {
+		var jumlah int64
+		if err := s.db.Table(p.Tabel).Where(p.Kolom+" = ?", id).Count(&jumlah).Error; err != nil {
+			return nil, err
+		}
+		if jumlah > 0 {
+			dipakai = append(dipakai, fmt.Sprintf("%s (%d)", p.Nama, jumlah))
+		}
+	}
+	if len(dipakai) > 0 {
+		return nil, fmt.Errorf("%w sebagai %s", ErrMediaDipakai, strings.Join(dipakai, ", "))
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.Media{}, "id_media = ?", id).Error; err != nil {
+			return err
+		}
+		if media.Storage != s.storage.Driver() {
+			// Berkas ada di backend lain (driver diganti setelah diunggah), cukup hapus catatannya
+			fmt.Printf("Berkas %s tersimpan di storage %s, tidak dihapus dari %s\n", media.Kunci, media.Storage, s.storage.Driver())
+			return nil
+		}
+		for _, kunci := range []string{media.Kunci, media.KunciCard, media.KunciThumbnail} {
+			if kunci == "" {
+				continue
+			}
+			if err := s.storage.Hapus(ctx, kunci); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return media, nil
+}
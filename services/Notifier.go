@@ -0,0 +1,161 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"tpq_asysyafii/models"
+)
+
+type KanalNotifikasi string
+
+const (
+	KanalEmail    KanalNotifikasi = "email"
+	KanalWhatsApp KanalNotifikasi = "whatsapp"
+)
+
+// Pesan adalah notifikasi yang akan dikirim ke user
+type Pesan struct {
+	Kanal  KanalNotifikasi
+	Tujuan string // alamat email atau nomor telepon
+	Subjek string
+	Isi    string
+}
+
+// ErrTujuanNotifikasiKosong dikembalikan jika user tidak punya email maupun nomor telepon
+var ErrTujuanNotifikasiKosong = errors.New("user tidak memiliki email atau nomor telepon untuk menerima notifikasi")
+
+// PesanUntukUser menyusun pesan ke user: email jika ada, selain itu WhatsApp ke nomor telepon
+func PesanUntukUser(user models.User, subjek, isi string) (Pesan, error) {
+	pesan := Pesan{Subjek: subjek, Isi: isi}
+	switch {
+	case user.Email != nil && *user.Email != "":
+		pesan.Kanal, pesan.Tujuan = KanalEmail, *user.Email
+	case user.NoTelp != "":
+		pesan.Kanal, pesan.Tujuan = KanalWhatsApp, user.NoTelp
+	default:
+		return Pesan{}, ErrTujuanNotifikasiKosong
+	}
+	return pesan, nil
+}
+
+// Notifier adalah pengirim notifikasi (email, WhatsApp, atau stand-in lokal)
+type Notifier interface {
+	Kirim(pesan Pesan) error
+}
+
+// FileNotifier menulis notifikasi ke file lokal, dipakai saat belum ada gateway email/WhatsApp
+type FileNotifier struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{Path: path}
+}
+
+func (n *FileNotifier) Kirim(pesan Pesan) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	f, err := os.OpenFile(n.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "[%s] %s -> %s | %s\n%s\n\n",
+		time.Now().Format(time.RFC3339), pesan.Kanal, pesan.Tujuan, pesan.Subjek, pesan.Isi)
+	return err
+}
+
+// SMTPNotifier mengirim notifikasi kanal email lewat server SMTP
+type SMTPNotifier struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	Dari     string
+}
+
+func (n *SMTPNotifier) Kirim(pesan Pesan) error {
+	if pesan.Kanal != KanalEmail {
+		return fmt.Errorf("SMTP notifier tidak mendukung kanal %s", pesan.Kanal)
+	}
+
+	auth := smtp.PlainAuth("", n.Username, n.Password, n.Host)
+	body := strings.Join([]string{
+		"From: " + n.Dari,
+		"To: " + pesan.Tujuan,
+		"Subject: " + pesan.Subjek,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		pesan.Isi,
+	}, "\r\n")
+	return smtp.SendMail(n.Host+":"+n.Port, auth, n.Dari, []string{pesan.Tujuan}, []byte(body))
+}
+
+// MultiNotifier memilih notifier berdasarkan kanal, dengan fallback jika kanal belum dikonfigurasi
+type MultiNotifier struct {
+	PerKanal map[KanalNotifikasi]Notifier
+	Fallback Notifier
+}
+
+func (n *MultiNotifier) Kirim(pesan Pesan) error {
+	if notifier, ok := n.PerKanal[pesan.Kanal]; ok {
+		return notifier.Kirim(pesan)
+	}
+	if n.Fallback == nil {
+		return fmt.Errorf("tidak ada notifier untuk kanal %s", pesan.Kanal)
+	}
+	return n.Fallback.Kirim(pesan)
+}
+
+var (
+	notifierDefault     Notifier
+	notifierDefaultOnce sync.Once
+)
+
+// DefaultNotifier membangun notifier dari .env: SMTP_HOST dkk untuk email, sisanya ditulis ke NOTIFIER_FILE
+func DefaultNotifier() Notifier {
+	notifierDefaultOnce.Do(func() {
+		path := os.Getenv("NOTIFIER_FILE")
+		if path == "" {
+			path = "notifikasi.log"
+		}
+		multi := &MultiNotifier{
+			PerKanal: make(map[KanalNotifikasi]Notifier),
+			Fallback: NewFileNotifier(path),
+		}
+
+		if host := os.Getenv("SMTP_HOST"); host != "" {
+			port := os.Getenv("SMTP_PORT")
+			if port == "" {
+				port = "587"
+			}
+			multi.PerKanal[KanalEmail] = &SMTPNotifier{
+				Host:     host,
+				Port:     port,
+				Username: os.Getenv("SMTP_USER"),
+				Password: os.Getenv("SMTP_PASS"),
+				Dari:     os.Getenv("SMTP_FROM"),
+			}
+		}
+
+		log.Printf("📨 Notifier aktif (fallback file: %s)", path)
+		notifierDefault = multi
+	})
+	return notifierDefault
+}
+
+// SetDefaultNotifier mengganti notifier default (misalnya dengan gateway WhatsApp)
+func SetDefaultNotifier(n Notifier) {
+	notifierDefaultOnce.Do(func() {})
+	notifierDefault = n
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"tpq_asysyafii/models"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// batasUkuranLogo mencegah logo yang sangat besar ikut dimuat ke setiap kwitansi
+const batasUkuranLogo = 2 << 20
+
+var klienLogo = &http.Client{Timeout: 5 * time.Second}
+
+// unduhLogo mengambil logo TPQ dari URL-nya, atau langsung dari disk jika logo ada di storage lokal.
+// Hanya PNG dan JPEG yang didukung; logo yang gagal diambil dilewati agar kwitansi tetap bisa dicetak.
+func unduhLogo(url string) ([]byte, string) {
+	var isi []byte
+	if lokal := strings.TrimSuffix(URLMediaLokal(), "/") + "/"; strings.HasPrefix(url, lokal) {
+		kunci, err := bersihkanKunci(strings.TrimPrefix(url, lokal))
+		if err != nil {
+			return nil, ""
+		}
+		f, err := os.Open(filepath.Join(DirMediaLokal(), filepath.FromSlash(kunci)))
+		if err != nil {
+			fmt.Printf("Gagal mengambil logo TPQ: %v\n", err)
+			return nil, ""
+		}
+		defer f.Close()
+		if isi, err = io.ReadAll(io.LimitReader(f, batasUkuranLogo)); err != nil {
+			fmt.Printf("Gagal mengambil logo TPQ: %v\n", err)
+			return nil, ""
+		}
+	} else {
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			return nil, ""
+		}
+		resp, err := klienLogo.Get(url)
+		if err != nil {
+			fmt.Printf("Gagal mengambil logo TPQ: %v\n", err)
+			return nil, ""
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			fmt.Printf("Gagal mengambil logo TPQ: status %d\n", resp.StatusCode)
+			return nil, ""
+		}
+		if isi, err = io.ReadAll(io.LimitReader(resp.Body, batasUkuranLogo)); err != nil {
+			fmt.Printf("Gagal mengambil logo TPQ: %v\n", err)
+			return nil, ""
+		}
+	}
+	switch http.DetectContentType(isi) {
+	case "image/png":
+		return isi, "PNG"
+	case "image/jpeg":
+		return isi, "JPG"
+	}
+	return nil, ""
+}
+
+// tulisKop mencetak logo, nama, dan alamat TPQ di bagian atas halaman lalu menutupnya dengan garis.
+// Margin kiri dan kanan halaman dianggap 12 mm.
+func tulisKop(pdf *gofpdf.Fpdf, info models.InformasiTPQ) {
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	lebar, _ := pdf.GetPageSize()
+	xKop := 12.0
+	if info.Logo != nil {
+		if gambar, tipe := unduhLogo(*info.Logo); gambar != nil {
+			opsi := gofpdf.ImageOptions{ImageType: tipe}
+			pdf.RegisterImageOptionsReader("logo", opsi, bytes.NewReader(gambar))
+			if pdf.Ok() {
+				pdf.ImageOptions("logo", 12, 10, 0, 18, false, opsi, 0, "")
+				xKop = 34
+			} else {
+				pdf.ClearError()
+			}
+		}
+	}
+	pdf.SetXY(xKop, 11)
+	pdf.SetFont("Helvetica", "B", 14)
+	pdf.CellFormat(0, 7, tr(info.NamaTPQ), "", 2, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 8.5)
+	var kontak []string
+	if info.Alamat != nil && *info.Alamat != "" {
+		kontak = append(kontak, *info.Alamat)
+	}
+	if info.NoTelp != nil && *info.NoTelp != "" {
+		kontak = append(kontak, "Telp. "+*info.NoTelp)
+	}
+	if len(kontak) > 0 {
+		pdf.MultiCell(lebar-12-xKop, 4, tr(strings.Join(kontak, " | ")), "", "L", false)
+	}
+	pdf.SetLineWidth(0.6)
+	pdf.Line(12, 31, lebar-12, 31)
+	pdf.SetLineWidth(0.2)
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+	"tpq_asysyafii/models"
+	"tpq_asysyafii/utils"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	MasaBerlakuKodeReset = 15 * time.Minute
+	MaksPercobaanReset   = 5
+	panjangKodeReset     = 6
+
+	// Pembatasan pembuatan kode agar kode tidak bisa ditebak dengan terus meminta kode baru
+	JedaKodeReset        = time.Minute // jeda minimal antar kode untuk akun yang sama
+	JendelaKodeReset     = time.Hour
+	MaksKodeResetPerAkun = 3  // kode per akun dalam JendelaKodeReset
+	MaksKodeResetPerIP   = 10 // kode dari satu IP (ke akun mana pun) dalam JendelaKodeReset
+)
+
+var (
+	ErrKodeResetTidakValid = errors.New("kode reset tidak valid atau sudah kadaluarsa")
+	ErrResetTerlaluSering  = errors.New("permintaan kode reset terlalu sering")
+)
+
+// PasswordService mengelola ganti password dan reset password dengan kode sekali pakai
+type PasswordService struct {
+	db       *gorm.DB
+	notifier Notifier
+}
+
+func NewPasswordService(db *gorm.DB, notifier Notifier) *PasswordService {
+	return &PasswordService{db: db, notifier: notifier}
+}
+
+func hashKodeReset(idReset, kode string) string {
+	return utils.HashToken(idReset + ":" + kode)
+}
+
+func buatKodeAngka(panjang int) (string, error) {
+	kode := make([]byte, panjang)
+	for i := range kode {
+		n, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		kode[i] = byte('0' + n.Int64())
+	}
+	return string(kode), nil
+}
+
+// MintaReset membuat kode reset baru (kode lama otomatis tidak berlaku) dan mengirimkannya lewat notifier.
+// Mengembalikan kanal pengiriman, atau ErrResetTerlaluSering jika akun atau IP sudah melewati batas
+// pembuatan kode.
+func (s *PasswordService) MintaReset(user models.User, ip string) (KanalNotifikasi, error) {
+	pesan, err := PesanUntukUser(user, "Kode reset password TPQ Asy-Syafii", "")
+	if err != nil {
+		return "", err
+	}
+
+	kode, err := buatKodeAngka(panjangKodeReset)
+	if err != nil {
+		return "", err
+	}
+
+	reset := models.PasswordReset{
+		IDReset:        uuid.New().String(),
+		IDUser:         user.IDUser,
+		Kanal:          string(pesan.Kanal),
+		IPAddress:      ip,
+		KadaluarsaPada: time.Now().Add(MasaBerlakuKodeReset),
+	}
+	reset.KodeHash = hashKodeReset(reset.IDReset, kode)
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Kunci baris user agar permintaan bersamaan untuk akun yang sama dihitung berurutan
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id_user").
+			Where("id_user = ?", user.IDUser).First(&models.User{}).Error; err != nil {
+			return err
+		}
+		if err := cekBatasKodeReset(tx, user.IDUser, ip); err != nil {
+			return err
+		}
+
+		// Hanya kode terakhir yang berlaku
+		if err := tx.Model(&models.PasswordReset{}).
+			Where("id_user = ? AND dipakai_pada IS NULL AND kadaluarsa_pada > ?", user.IDUser, time.Now()).
+			Update("kadaluarsa_pada", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Omit(clause.Associations).Create(&reset).Error
+	})
+	if err != nil {
+		return "", err
+	}
+
+	pesan.Isi = fmt.Sprintf("Assalamu'alaikum %s,\n\nKode reset password Anda: %s\nKode berlaku %d menit dan hanya bisa dipakai sekali. Abaikan pesan ini jika Anda tidak meminta reset password.",
+		user.NamaLengkap, kode, int(MasaBerlakuKodeReset.Minutes()))
+	if err := s.notifier.Kirim(pesan); err != nil {
+		return "", fmt.Errorf("gagal mengirim kode reset: %v", err)
+	}
+	return pesan.Kanal, nil
+}
+
+// cekBatasKodeReset menolak kode baru jika kode terakhir akun belum melewati JedaKodeReset,
+// atau akun maupun IP sudah mencapai batas jumlah kode dalam JendelaKodeReset
+func cekBatasKodeReset(tx *gorm.DB, idUser, ip string) error {
+	sejak := time.Now().Add(-JendelaKodeReset)
+
+	var akun struct {
+		Jumlah   int64
+		Terakhir *time.Time
+	}
+	if err := tx.Model(&models.PasswordReset{}).
+		Select("COUNT(*) AS jumlah, MAX(dibuat_pada) AS terakhir").
+		Where("id_user = ? AND dibuat_pada > ?", idUser, sejak).
+		Scan(&akun).Error; err != nil {
+		return err
+	}
+	if akun.Jumlah >= MaksKodeResetPerAkun || (akun.Terakhir != nil && time.Since(*akun.Terakhir) < JedaKodeReset) {
+		return ErrResetTerlaluSering
+	}
+
+	if ip == "" {
+		return nil
+	}
+	var dariIP int64
+	if err := tx.Model(&models.PasswordReset{}).
+		Where("ip_address = ? AND dibuat_pada > ?", ip, sejak).
+		Count(&dariIP).Error; err != nil {
+		return err
+	}
+	if dariIP >= MaksKodeResetPerIP {
+		return ErrResetTerlaluSering
+	}
+	return nil
+}
+
+// ResetDenganKode memverifikasi kode reset lalu mengganti password. Kode hanya bisa dipakai sekali
+// dan hangus setelah MaksPercobaanReset kali salah.
+func (s *PasswordService) ResetDenganKode(user models.User, kode, passwordBaru string) error {
+	var errVerifikasi error
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var reset models.PasswordReset
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id_user = ? AND dipakai_pada IS NULL AND kadaluarsa_pada > ? AND percobaan < ?", user.IDUser, time.Now(), MaksPercobaanReset).
+			Order("dibuat_pada DESC").
+			First(&reset).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrKodeResetTidakValid
+			}
+			return err
+		}
+
+		if subtle.ConstantTimeCompare([]byte(hashKodeReset(reset.IDReset, kode)), []byte(reset.KodeHash)) != 1 {
+			// Percobaan salah tetap disimpan, jadi transaksi tidak di-rollback
+			errVerifikasi = ErrKodeResetTidakValid
+			return tx.Model(&models.PasswordReset{}).
+				Where("id_reset = ?", reset.IDReset).
+				UpdateColumn("percobaan", gorm.Expr("percobaan + 1")).Error
+		}
+
+		if err := tx.Model(&models.PasswordReset{}).
+			Where("id_reset = ?", reset.IDReset).
+			Update("dipakai_pada", time.Now()).Error; err != nil {
+			return err
+		}
+		return simpanPassword(tx, user.IDUser, passwordBaru)
+	})
+	if err != nil {
+		return err
+	}
+	if errVerifikasi != nil {
+		return errVerifikasi
+	}
+
+	// Semua sesi lama dicabut karena password sudah berubah
+	return NewTokenService(s.db).CabutSemua(user.IDUser)
+}
+
+// GantiPassword mengganti password setelah password lama diverifikasi oleh pemanggil
+func (s *PasswordService) GantiPassword(user models.User, passwordBaru string) error {
+	if err := simpanPassword(s.db, user.IDUser, passwordBaru); err != nil {
+		return err
+	}
+	return NewTokenService(s.db).CabutSemua(user.IDUser)
+}
+
+func simpanPassword(tx *gorm.DB, idUser, passwordBaru string) error {
+	hashedPass, err := bcrypt.GenerateFromPassword([]byte(passwordBaru), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return tx.Model(&models.User{}).
+		Where("id_user = ?", idUser).
+		Updates(map[string]interface{}{"password": string(hashedPass), "diperbarui_pada": time.Now()}).Error
+}
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"tpq_asysyafii/models"
+
+	"github.com/google/uuid"
+)
+
+// HeaderTandaTangan adalah header berisi HMAC-SHA256 (hex) dari body callback
+const HeaderTandaTangan = "X-Callback-Signature"
+
+type StatusTransaksi string
+
+const (
+	TransaksiMenunggu   StatusTransaksi = "pending"
+	TransaksiDibayar    StatusTransaksi = "paid"
+	TransaksiKadaluarsa StatusTransaksi = "expired"
+)
+
+var (
+	ErrTandaTanganTidakValid = errors.New("tanda tangan callback tidak valid")
+	ErrReferensiTidakDikenal = errors.New("referensi pembayaran tidak dikenal oleh provider")
+	ErrProviderTidakDikenal  = errors.New("payment provider tidak dikenal")
+)
+
+// Tagihan adalah permintaan kode bayar (QRIS / virtual account) ke provider
+type Tagihan struct {
+	IDPembayaran   string
+	Metode         models.MetodePembayaran
+	Nominal        float64
+	KadaluarsaPada time.Time
+	Keterangan     string
+}
+
+// HasilTagihan adalah kode bayar yang diterbitkan provider
+type HasilTagihan struct {
+	Referensi string
+	KodeBayar string
+}
+
+// NotifikasiPembayaran adalah status transaksi dari provider (lewat callback atau cek status)
+type NotifikasiPembayaran struct {
+	Referensi   string          `json:"referensi"`
+	Status      StatusTransaksi `json:"status"`
+	Nominal     float64         `json:"nominal"`
+	DibayarPada *time.Time      `json:"dibayar_pada"`
+}
+
+// PaymentProvider adalah gateway pembayaran online
+type PaymentProvider interface {
+	Nama() string
+	BuatTagihan(tagihan Tagihan) (HasilTagihan, error)
+	// VerifikasiCallback memeriksa tanda tangan lalu membaca isi callback
+	VerifikasiCallback(body []byte, header http.Header) (NotifikasiPembayaran, error)
+	CekStatus(referensi string) (NotifikasiPembayaran, error)
+}
+
+// SimulatorPembayaran dimiliki provider lokal untuk membuat callback "dibayar" tanpa gateway sungguhan
+type SimulatorPembayaran interface {
+	SimulasikanBayar(referensi string, nominal float64) (body []byte, header http.Header, err error)
+}
+
+// TandaTanganCallback menghitung HMAC-SHA256 body callback dalam bentuk hex
+func TandaTanganCallback(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func cocokTandaTangan(secret, body []byte, tandaTangan string) bool {
+	diharapkan := TandaTanganCallback(secret, body)
+	return hmac.Equal([]byte(diharapkan), []byte(strings.ToLower(strings.TrimSpace(tandaTangan))))
+}
+
+// MockProvider adalah provider lokal untuk pengembangan. Status transaksi hanya disimpan di memori.
+type MockProvider struct {
+	Secret []byte
+
+	mu        sync.Mutex
+	transaksi map[string]*transaksiMock
+}
+
+type transaksiMock struct {
+	nominal        float64
+	kadaluarsaPada time.Time
+	dibayarPada    *time.Time
+}
+
+func NewMockProvider(secret []byte) *MockProvider {
+	return &MockProvider{Secret: secret, transaksi: make(map[string]*transaksiMock)}
+}
+
+func (p *MockProvider) Nama() string {
+	return "mock"
+}
+
+func (p *MockProvider) BuatTagihan(tagihan Tagihan) (HasilTagihan, error) {
+	referensi := "MOCK-" + strings.ToUpper(strings.ReplaceAll(uuid.New().String(), "-", "")[:16])
+
+	var kode string
+	switch tagihan.Metode {
+	case models.MetodeQRIS:
+		kode = fmt.Sprintf("MOCKQRIS|%s|%.0f", referensi, tagihan.Nominal)
+	case models.MetodeVirtualAccount:
+		nomor, err := buatKodeAngka(12)
+		if err != nil {
+			return HasilTagihan{}, err
+		}
+		kode = "8808" + nomor
+	default:
+		return HasilTagihan{}, fmt.Errorf("metode pembayaran %s tidak didukung", tagihan.Metode)
+	}
+
+	p.mu.Lock()
+	p.transaksi[referensi] = &transaksiMock{nominal: tagihan.Nominal, kadaluarsaPada: tagihan.KadaluarsaPada}
+	p.mu.Unlock()
+
+	return HasilTagihan{Referensi: referensi, KodeBayar: kode}, nil
+}
+
+func (p *MockProvider) VerifikasiCallback(body []byte, header http.Header) (NotifikasiPembayaran, error) {
+	if !cocokTandaTangan(p.Secret, body, header.Get(HeaderTandaTangan)) {
+		return NotifikasiPembayaran{}, ErrTandaTanganTidakValid
+	}
+	var notif NotifikasiPembayaran
+	if err := json.Unmarshal(body, &notif); err != nil {
+		return NotifikasiPembayaran{}, fmt.Errorf("format callback tidak valid: %v", err)
+	}
+	return notif, nil
+}
+
+func (p *MockProvider) CekStatus(referensi string) (NotifikasiPembayaran, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	trx, ok := p.transaksi[referensi]
+	if !ok {
+		return NotifikasiPembayaran{}, ErrReferensiTidakDikenal
+	}
+	notif := NotifikasiPembayaran{Referensi: referensi, Status: TransaksiMenunggu, Nominal: trx.nominal}
+	switch {
+	case trx.dibayarPada != nil:
+		notif.Status, notif.DibayarPada = TransaksiDibayar, trx.dibayarPada
+	case time.Now().After(trx.kadaluarsaPada):
+		notif.Status = TransaksiKadaluarsa
+	}
+	return notif, nil
+}
+
+// SimulasikanBayar menandai transaksi dibayar dan menyusun callback bertanda tangan seperti dari gateway
+func (p *MockProvider) SimulasikanBayar(referensi string, nominal float64) ([]byte, http.Header, error) {
+	sekarang := time.Now()
+
+	p.mu.Lock()
+	trx, ok := p.transaksi[referensi]
+	if !ok {
+		// Transaksi dibuat sebelum server restart
+		trx = &transaksiMock{nominal: nominal, kadaluarsaPada: sekarang}
+		p.transaksi[referensi] = trx
+	}
+	trx.dibayarPada = &sekarang
+	p.mu.Unlock()
+
+	body, err := json.Marshal(NotifikasiPembayaran{
+		Referensi:   referensi,
+		Status:      TransaksiDibayar,
+		Nominal:     nominal,
+		DibayarPada: &sekarang,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	header := http.Header{}
+	header.Set(HeaderTandaTangan, TandaTanganCallback(p.Secret, body))
+	return body, header, nil
+}
+
+var (
+	providerTerdaftar     map[string]PaymentProvider
+	providerAktif         string
+	providerTerdaftarOnce sync.Once
+)
+
+// inisialisasiProvider mendaftarkan provider bawaan. PAYMENT_PROVIDER memilih provider aktif (default "mock"),
+// PAYMENT_WEBHOOK_SECRET adalah kunci tanda tangan callback.
+func inisialisasiProvider() {
+	providerTerdaftarOnce.Do(func() {
+		secret := []byte(os.Getenv("PAYMENT_WEBHOOK_SECRET"))
+		if len(secret) == 0 {
+			secret = make([]byte, 32)
+			if _, err := rand.Read(secret); err != nil {
+				log.Fatalf("Gagal membuat secret webhook pembayaran: %v", err)
+			}
+			log.Println("⚠️ PAYMENT_WEBHOOK_SECRET kosong, memakai secret acak (callback dari luar akan ditolak)")
+		}
+
+		providerTerdaftar = map[string]PaymentProvider{}
+		mock := NewMockProvider(secret)
+		providerTerdaftar[mock.Nama()] = mock
+
+		providerAktif = os.Getenv("PAYMENT_PROVIDER")
+		if providerAktif == "" {
+			providerAktif = mock.Nama()
+		}
+		if _, ok := providerTerdaftar[providerAktif]; !ok {
+			log.Printf("⚠️ PAYMENT_PROVIDER %q tidak dikenal, memakai %q", providerAktif, mock.Nama())
+			providerAktif = mock.Nama()
+		}
+	})
+}
+
+// DaftarkanPaymentProvider menambahkan provider (misalnya gateway sungguhan) ke registry
+func DaftarkanPaymentProvider(provider PaymentProvider) {
+	inisialisasiProvider()
+	providerTerdaftar[provider.Nama()] = provider
+	if os.Getenv("PAYMENT_PROVIDER") == provider.Nama() {
+		providerAktif = provider.Nama()
+	}
+}
+
+// PaymentProviderByNama mencari provider untuk callback /pembayaran/callback/:provider
+func PaymentProviderByNama(nama string) (PaymentProvider, error) {
+	inisialisasiProvider()
+	provider, ok := providerTerdaftar[nama]
+	if !ok {
+		return nil, ErrProviderTidakDikenal
+	}
+	return provider, nil
+}
+
+// DefaultPaymentProvider mengembalikan provider yang dipakai untuk membuat tagihan baru
+func DefaultPaymentProvider() PaymentProvider {
+	inisialisasiProvider()
+	return providerTerdaftar[providerAktif]
+}
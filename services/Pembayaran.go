@@ -0,0 +1,324 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"tpq_asysyafii/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const MasaBerlakuPembayaran = 24 * time.Hour
+
+var (
+	ErrSyahriahTidakDapatDibayar = errors.New("syahriah tidak ditemukan atau bukan milik santri Anda")
+	ErrSyahriahSudahLunas        = errors.New("syahriah sudah lunas")
+	ErrSyahriahSedangDibayar     = errors.New("syahriah masih dalam pembayaran lain yang belum kadaluarsa")
+	ErrPembayaranTidakDitemukan  = errors.New("pembayaran tidak ditemukan")
+)
+
+// PembayaranService mengelola intent pembayaran online syahriah
+type PembayaranService struct {
+	db       *gorm.DB
+	provider PaymentProvider
+}
+
+func NewPembayaranService(db *gorm.DB, provider PaymentProvider) *PembayaranService {
+	return &PembayaranService{db: db, provider: provider}
+}
+
+// HasilNotifikasi adalah ringkasan pemrosesan satu notifikasi dari provider
+type HasilNotifikasi struct {
+	Pembayaran models.Pembayaran
+	Bayar      []models.SyahriahBayar // pembayaran syahriah yang dicatat dari notifikasi ini
+	Terdampak  []models.Syahriah      // syahriah yang statusnya berubah, termasuk penerima kredit lebih bayar
+	Duplikat   bool                   // notifikasi "dibayar" sudah pernah diproses
+}
+
+// HasilRekonsiliasi adalah ringkasan rekonsiliasi intent pembayaran
+type HasilRekonsiliasi struct {
+	Diperiksa  int                    `json:"diperiksa"`
+	Kadaluarsa []string               `json:"kadaluarsa"`
+	Dibayar    []string               `json:"dibayar"` // dibayar di provider tetapi callback tidak pernah diterima
+	Dobel      []string               `json:"dobel"`   // dana masuk untuk syahriah yang sudah lunas, perlu refund
+	Bayar      []models.SyahriahBayar `json:"-"`
+	Terdampak  []models.Syahriah      `json:"-"`
+}
+
+// BuatPembayaran membuat intent pembayaran untuk syahriah milik santri wali dan meminta kode bayar ke provider
+func (s *PembayaranService) BuatPembayaran(idWali string, idSyahriah []string, metode models.MetodePembayaran) (*models.Pembayaran, error) {
+	unik := make([]string, 0, len(idSyahriah))
+	sudah := make(map[string]bool, len(idSyahriah))
+	for _, id := range idSyahriah {
+		if id != "" && !sudah[id] {
+			sudah[id] = true
+			unik = append(unik, id)
+		}
+	}
+	if len(unik) == 0 {
+		return nil, ErrSyahriahTidakDapatDibayar
+	}
+
+	var pembayaran models.Pembayaran
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Kunci syahriah agar dua intent tidak dibuat bersamaan untuk tagihan yang sama
+		var daftar []models.Syahriah
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id_syahriah IN ?", unik).
+			Where("id_santri IN (?)", tx.Model(&models.Santri{}).Select("id_santri").Where("id_wali = ?", idWali)).
+			Order("bulan ASC").
+			Find(&daftar).Error; err != nil {
+			return err
+		}
+		if len(daftar) != len(unik) {
+			return ErrSyahriahTidakDapatDibayar
+		}
+
+		var total float64
+		for _, syahriah := range daftar {
+			if SisaTagihan(syahriah) <= 0 {
+				return fmt.Errorf("%w: bulan %s", ErrSyahriahSudahLunas, syahriah.Bulan)
+			}
+			total += SisaTagihan(syahriah)
+		}
+
+		var aktif int64
+		if err := tx.Model(&models.PembayaranItem{}).
+			Joins("JOIN pembayaran ON pembayaran.id_pembayaran = pembayaran_item.id_pembayaran").
+			Where("pembayaran_item.id_syahriah IN ?", unik).
+			Where("pembayaran.status = ? AND pembayaran.kadaluarsa_pada > ?", models.PembayaranMenunggu, time.Now()).
+			Count(&aktif).Error; err != nil {
+			return err
+		}
+		if aktif > 0 {
+			return ErrSyahriahSedangDibayar
+		}
+
+		pembayaran = models.Pembayaran{
+			IDPembayaran:   uuid.New().String(),
+			IDWali:         idWali,
+			Provider:       s.provider.Nama(),
+			Metode:         metode,
+			Nominal:        total,
+			Status:         models.PembayaranMenunggu,
+			KadaluarsaPada: time.Now().Add(MasaBerlakuPembayaran),
+		}
+		for _, syahriah := range daftar {
+			pembayaran.Items = append(pembayaran.Items, models.PembayaranItem{
+				IDItem:       uuid.New().String(),
+				IDPembayaran: pembayaran.IDPembayaran,
+				IDSyahriah:   syahriah.IDSyahriah,
+				Nominal:      SisaTagihan(syahriah),
+			})
+		}
+
+		hasil, err := s.provider.BuatTagihan(Tagihan{
+			IDPembayaran:   pembayaran.IDPembayaran,
+			Metode:         metode,
+			Nominal:        total,
+			KadaluarsaPada: pembayaran.KadaluarsaPada,
+			Keterangan:     fmt.Sprintf("Syahriah %d bulan", len(daftar)),
+		})
+		if err != nil {
+			return fmt.Errorf("gagal membuat tagihan di provider: %v", err)
+		}
+		pembayaran.Referensi, pembayaran.KodeBayar = hasil.Referensi, hasil.KodeBayar
+
+		if err := tx.Omit(clause.Associations).Create(&pembayaran).Error; err != nil {
+			return err
+		}
+		return tx.Omit(clause.Associations).Create(&pembayaran.Items).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &pembayaran, nil
+}
+
+// ProsesNotifikasi menerapkan status transaksi dari provider ke intent pembayaran.
+// Aman dipanggil berulang: notifikasi "dibayar" yang sama hanya diproses sekali.
+func (s *PembayaranService) ProsesNotifikasi(namaProvider string, notif NotifikasiPembayaran) (*HasilNotifikasi, error) {
+	hasil := &HasilNotifikasi{}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		pembayaran := &hasil.Pembayaran
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Preload("Items").
+			First(pembayaran, "provider = ? AND referensi = ?", namaProvider, notif.Referensi).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrPembayaranTidakDitemukan
+			}
+			return err
+		}
+
+		switch notif.Status {
+		case TransaksiKadaluarsa:
+			if pembayaran.Status != models.PembayaranMenunggu {
+				return nil
+			}
+			pembayaran.Status = models.PembayaranKadaluarsa
+			return tx.Model(pembayaran).Update("status", pembayaran.Status).Error
+
+		case TransaksiDibayar:
+			if pembayaran.Status == models.PembayaranDibayar || pembayaran.Status == models.PembayaranDobel {
+				hasil.Duplikat = true
+				return nil
+			}
+			return s.terapkanBayar(tx, hasil, notif)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hasil, nil
+}
+
+// terapkanBayar mencatat dana yang diterima sebagai pembayaran syahriah, berurutan dari bulan paling awal.
+// Bulan terakhir menampung sisa dana sehingga lebih bayar menjadi kredit bulan berikutnya.
+// Syahriah yang sudah lunas lewat jalur lain tidak dibayar ulang; bagiannya ditandai dobel untuk dikembalikan.
+func (s *PembayaranService) terapkanBayar(tx *gorm.DB, hasil *HasilNotifikasi, notif NotifikasiPembayaran) error {
+	pembayaran := &hasil.Pembayaran
+	dibayarPada := time.Now()
+	if notif.DibayarPada != nil {
+		dibayarPada = *notif.DibayarPada
+	}
+	pembayaran.NominalDiterima = notif.Nominal
+
+	nominalItem := make(map[string]int64, len(pembayaran.Items))
+	idSyahriah := make([]string, 0, len(pembayaran.Items))
+	for _, item := range pembayaran.Items {
+		nominalItem[item.IDSyahriah] = keSen(item.Nominal)
+		idSyahriah = append(idSyahriah, item.IDSyahriah)
+	}
+	var daftar []models.Syahriah
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id_syahriah IN ?", idSyahriah).
+		Order("bulan ASC").
+		Find(&daftar).Error; err != nil {
+		return err
+	}
+
+	dana := keSen(notif.Nominal)
+	var terbuka []models.Syahriah
+	var sudahLunas []string
+	var kelebihan int64
+	for _, syahriah := range daftar {
+		if syahriah.Status == models.StatusLunas || syahriah.Status == models.StatusLebih {
+			sudahLunas = append(sudahLunas, syahriah.Bulan)
+			kelebihan += nominalItem[syahriah.IDSyahriah]
+			dana -= nominalItem[syahriah.IDSyahriah]
+			continue
+		}
+		terbuka = append(terbuka, syahriah)
+	}
+	if dana < 0 {
+		kelebihan += dana
+		dana = 0
+	}
+	if len(terbuka) == 0 {
+		kelebihan += dana
+		dana = 0
+	}
+
+	bayarService := NewSyahriahBayarService(tx)
+	keterangan := fmt.Sprintf("Pembayaran online %s (%s)", pembayaran.Provider, pembayaran.Referensi)
+	for i, syahriah := range terbuka {
+		porsi := nominalItem[syahriah.IDSyahriah]
+		if porsi > dana || i == len(terbuka)-1 {
+			porsi = dana
+		}
+		if porsi <= 0 {
+			break
+		}
+		dana -= porsi
+
+		proses, err := bayarService.Bayar(syahriah.IDSyahriah, BayarBaru{
+			Nominal:      float64(porsi) / 100,
+			Metode:       models.BayarOnline,
+			WaktuBayar:   dibayarPada,
+			IDPembayaran: pembayaran.IDPembayaran,
+			Keterangan:   keterangan,
+		}, pembayaran.IDWali)
+		if err != nil {
+			return err
+		}
+		hasil.Bayar = append(hasil.Bayar, proses.Bayar)
+		hasil.Terdampak = append(hasil.Terdampak, proses.Terdampak...)
+	}
+	hasil.Terdampak = unikSyahriah(hasil.Terdampak)
+
+	pembayaran.Status = models.PembayaranDibayar
+	pembayaran.DibayarPada = &dibayarPada
+	var catatan []string
+	if keSen(notif.Nominal) < keSen(pembayaran.Nominal) {
+		catatan = append(catatan, fmt.Sprintf("Nominal diterima Rp%.0f kurang dari tagihan Rp%.0f, syahriah tercatat sebagian",
+			notif.Nominal, pembayaran.Nominal))
+	}
+	if len(sudahLunas) > 0 {
+		pembayaran.Status = models.PembayaranDobel
+		catatan = append(catatan, fmt.Sprintf("Syahriah bulan %s sudah lunas sebelum pembayaran ini diterima; kelebihan Rp%.0f perlu dikembalikan",
+			strings.Join(sudahLunas, ", "), float64(kelebihan)/100))
+	}
+	pembayaran.Catatan = strings.Join(catatan, ". ")
+	return tx.Model(pembayaran).Updates(map[string]interface{}{
+		"status":           pembayaran.Status,
+		"dibayar_pada":     pembayaran.DibayarPada,
+		"nominal_diterima": pembayaran.NominalDiterima,
+		"catatan":          pembayaran.Catatan,
+	}).Error
+}
+
+// Rekonsiliasi mencocokkan intent yang sudah lewat masa berlaku dengan status di provider:
+// yang ternyata dibayar diproses, sisanya ditandai kadaluarsa. Intent dobel ikut dilaporkan.
+func (s *PembayaranService) Rekonsiliasi() (*HasilRekonsiliasi, error) {
+	var kedaluwarsa []models.Pembayaran
+	if err := s.db.Where("status = ? AND kadaluarsa_pada <= ?", models.PembayaranMenunggu, time.Now()).
+		Find(&kedaluwarsa).Error; err != nil {
+		return nil, err
+	}
+
+	hasil := &HasilRekonsiliasi{Diperiksa: len(kedaluwarsa), Kadaluarsa: []string{}, Dibayar: []string{}, Dobel: []string{}}
+	for _, pembayaran := range kedaluwarsa {
+		provider, err := PaymentProviderByNama(pembayaran.Provider)
+		if err != nil {
+			fmt.Printf("Gagal rekonsiliasi pembayaran %s: %v\n", pembayaran.IDPembayaran, err)
+			continue
+		}
+
+		notif, err := provider.CekStatus(pembayaran.Referensi)
+		switch {
+		case errors.Is(err, ErrReferensiTidakDikenal):
+			notif = NotifikasiPembayaran{Referensi: pembayaran.Referensi, Status: TransaksiKadaluarsa}
+		case err != nil:
+			fmt.Printf("Gagal cek status pembayaran %s: %v\n", pembayaran.IDPembayaran, err)
+			continue
+		case notif.Status != TransaksiDibayar:
+			notif.Status = TransaksiKadaluarsa
+		}
+
+		proses, err := s.ProsesNotifikasi(pembayaran.Provider, notif)
+		if err != nil {
+			fmt.Printf("Gagal memproses pembayaran %s: %v\n", pembayaran.IDPembayaran, err)
+			continue
+		}
+		switch proses.Pembayaran.Status {
+		case models.PembayaranKadaluarsa:
+			hasil.Kadaluarsa = append(hasil.Kadaluarsa, pembayaran.IDPembayaran)
+		case models.PembayaranDibayar, models.PembayaranDobel:
+			hasil.Dibayar = append(hasil.Dibayar, pembayaran.IDPembayaran)
+		}
+		hasil.Bayar = append(hasil.Bayar, proses.Bayar...)
+		hasil.Terdampak = append(hasil.Terdampak, proses.Terdampak...)
+	}
+
+	if err := s.db.Model(&models.Pembayaran{}).
+		Where("status = ?", models.PembayaranDobel).
+		Pluck("id_pembayaran", &hasil.Dobel).Error; err != nil {
+		return nil, err
+	}
+	return hasil, nil
+}
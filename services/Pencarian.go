@@ -0,0 +1,485 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"tpq_asysyafii/models"
+
+	"gorm.io/gorm"
+)
+
+var ErrKataKunciKosong = errors.New("kata kunci kosong atau hanya berisi kata umum")
+
+const (
+	// bobotJudul membuat kata di judul lebih menentukan peringkat daripada kata di isi
+	bobotJudul = 3
+	// Batas kata kunci dan panjang term agar query tetap ringan
+	maksKataKunci   = 10
+	maksPanjangTerm = 64
+	// k1 pada rumus BM25: seberapa cepat bobot kata yang berulang mencapai jenuh
+	bm25K1 = 1.2
+	// panjangCuplikan adalah jumlah kata pada cuplikan hasil pencarian
+	panjangCuplikan = 30
+)
+
+// sumberPencarian menjelaskan cara membaca konten dari tabel asalnya dan aturan tampil publiknya.
+// Kolom memilih id, judul, isi (dipakai untuk cuplikan), tambahan (ikut diindeks tetapi tidak
+// ditampilkan), slug, dan tanggal. IsiHTML menandakan isi berupa HTML hasil render yang perlu
+// diambil teksnya.
+type sumberPencarian struct {
+	Tipe    models.TipeKontenPencarian
+	Tabel   string
+	KolomID string
+	Kolom   string
+	IsiHTML bool
+	Publik  func(db *gorm.DB, sekarang time.Time) *gorm.DB
+}
+
+// baca mengambil dokumen dari tabel asal sesuai kondisi di q
+func (s sumberPencarian) baca(q *gorm.DB) ([]dokumenPencarian, error) {
+	var dokumen []dokumenPencarian
+	if err := q.Table(s.Tabel).Select(s.Kolom).Scan(&dokumen).Error; err != nil {
+		return nil, err
+	}
+	if s.IsiHTML {
+		for i := range dokumen {
+			dokumen[i].Isi = TeksPolos(dokumen[i].Isi)
+		}
+	}
+	return dokumen, nil
+}
+
+// sumberPencarianList mengikuti aturan endpoint publik masing-masing konten
+var sumberPencarianList = []sumberPencarian{
+	{
+		Tipe:    models.PencarianBerita,
+		Tabel:   "berita",
+		KolomID: "id_berita",
+		Kolom:   "id_berita AS id, judul, COALESCE(NULLIF(konten_html, ''), konten) AS isi, kategori AS tambahan, slug, tanggal_publikasi AS tanggal",
+		IsiHTML: true,
+		Publik: func(db *gorm.DB, sekarang time.Time) *gorm.DB {
+			return db.Where("status = ?", models.StatusPublished)
+		},
+	},
+	{
+		Tipe:    models.PencarianPengumuman,
+		Tabel:   "pengumuman",
+		KolomID: "id_pengumuman",
+		Kolom:   "id_pengumuman AS id, judul, COALESCE(NULLIF(isi_html, ''), isi) AS isi, '' AS tambahan, '' AS slug, tanggal_dibuat AS tanggal",
+		IsiHTML: true,
+		Publik: func(db *gorm.DB, sekarang time.Time) *gorm.DB {
+			return db.Where("tipe = ? AND status = ?", models.PengumumanPublik, models.StatusAktif).
+				Where("(tanggal_mulai IS NULL OR tanggal_mulai <= ?) AND (tanggal_selesai IS NULL OR tanggal_selesai >= ?)", sekarang, sekarang)
+		},
+	},
+	{
+		Tipe:    models.PencarianProgram,
+		Tabel:   "program_unggulan",
+		KolomID: "id_program",
+		Kolom:   "id_program AS id, nama_program AS judul, deskripsi AS isi, fitur AS tambahan, slug, diperbarui_pada AS tanggal",
+		Publik: func(db *gorm.DB, sekarang time.Time) *gorm.DB {
+			return db.Where("status = ?", "aktif")
+		},
+	},
+	{
+		Tipe:    models.PencarianFasilitas,
+		Tabel:   "fasilitas",
+		KolomID: "id_fasilitas",
+		Kolom:   "id_fasilitas AS id, judul, deskripsi AS isi, '' AS tambahan, '' AS slug, diperbarui_pada AS tanggal",
+		Publik: func(db *gorm.DB, sekarang time.Time) *gorm.DB {
+			return db.Where("status = ?", "aktif")
+		},
+	},
+}
+
+func cariSumber(tipe models.TipeKontenPencarian) (sumberPencarian, bool) {
+	for _, s := range sumberPencarianList {
+		if s.Tipe == tipe {
+			return s, true
+		}
+	}
+	return sumberPencarian{}, false
+}
+
+// TipePencarianValid memeriksa tipe konten yang dikirim client
+func TipePencarianValid(tipe models.TipeKontenPencarian) bool {
+	_, ok := cariSumber(tipe)
+	return ok
+}
+
+type dokumenPencarian struct {
+	ID       string
+	Judul    string
+	Isi      string
+	Tambahan string
+	Slug     string
+	Tanggal  *time.Time
+}
+
+// termDokumen menghitung bobot setiap kata dasar di dokumen
+func termDokumen(d dokumenPencarian) map[string]int {
+	term := make(map[string]int)
+	tambah := func(teks string, bobot int) {
+		for _, kata := range TokenKata(teks) {
+			for _, akar := range AkarKata(kata) {
+				if len(akar) <= maksPanjangTerm {
+					term[akar] += bobot
+				}
+			}
+		}
+	}
+	tambah(d.Judul, bobotJudul)
+	tambah(d.Isi, 1)
+	tambah(d.Tambahan, 1)
+	return term
+}
+
+func barisIndeks(tipe models.TipeKontenPencarian, d dokumenPencarian) []models.IndeksPencarian {
+	term := termDokumen(d)
+	baris := make([]models.IndeksPencarian, 0, len(term))
+	for t, bobot := range term {
+		baris = append(baris, models.IndeksPencarian{Tipe: tipe, IDKonten: d.ID, Term: t, Bobot: bobot})
+	}
+	return baris
+}
+
+// PerbaruiIndeksPencarian mengindeks ulang satu konten dari tabel asalnya.
+// Konten yang sudah dihapus dikeluarkan dari indeks.
+func PerbaruiIndeksPencarian(db *gorm.DB, tipe models.TipeKontenPencarian, id string) error {
+	sumber, ok := cariSumber(tipe)
+	if !ok {
+		return fmt.Errorf("tipe konten pencarian tidak dikenal: %s", tipe)
+	}
+
+	dokumen, err := sumber.baca(db.Where(sumber.KolomID+" = ?", id))
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("tipe = ? AND id_konten = ?", tipe, id).Delete(&models.IndeksPencarian{}).Error; err != nil {
+			return err
+		}
+		if len(dokumen) == 0 {
+			return nil
+		}
+		if baris := barisIndeks(tipe, dokumen[0]); len(baris) > 0 {
+			return tx.CreateInBatches(baris, 500).Error
+		}
+		return nil
+	})
+}
+
+// BangunUlangIndeksPencarian mengosongkan lalu mengisi ulang seluruh indeks dalam satu transaksi,
+// untuk pertama kali dipakai atau jika indeks tertinggal dari tabel asal. Mengembalikan jumlah konten.
+func BangunUlangIndeksPencarian(db *gorm.DB) (int, error) {
+	jumlah := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&models.IndeksPencarian{}).Error; err != nil {
+			return err
+		}
+		for _, sumber := range sumberPencarianList {
+			dokumen, err := sumber.baca(tx)
+			if err != nil {
+				return fmt.Errorf("gagal membaca %s: %w", sumber.Tabel, err)
+			}
+			for _, d := range dokumen {
+				if baris := barisIndeks(sumber.Tipe, d); len(baris) > 0 {
+					if err := tx.CreateInBatches(baris, 500).Error; err != nil {
+						return err
+					}
+				}
+			}
+			jumlah += len(dokumen)
+		}
+		return nil
+	})
+	return jumlah, err
+}
+
+// ItemPencarian adalah satu konten pada hasil pencarian
+type ItemPencarian struct {
+	Tipe     models.TipeKontenPencarian `json:"tipe"`
+	ID       string                     `json:"id"`
+	Judul    string                     `json:"judul"`
+	Slug     string                     `json:"slug,omitempty"`
+	Cuplikan string                     `json:"cuplikan"` // HTML: teks sudah di-escape, kata yang cocok dibungkus <mark>
+	Skor     float64                    `json:"skor"`
+	Tanggal  *time.Time                 `json:"tanggal,omitempty"`
+}
+
+type HasilPencarian struct {
+	Item    []ItemPencarian
+	Total   int
+	PerTipe map[models.TipeKontenPencarian]int
+}
+
+type kandidatPencarian struct {
+	Tipe  models.TipeKontenPencarian
+	ID    string
+	Skor  float64
+	Cocok int
+}
+
+// CariKonten mencari konten publik yang boleh tampil. Setiap kata kunci dicocokkan lewat kata
+// dasarnya, diberi skor BM25 (tanpa normalisasi panjang dokumen), lalu dikalikan dengan proporsi
+// kata kunci yang ditemukan agar konten yang memuat semua kata berada di atas.
+// tipe kosong berarti semua tipe konten.
+func CariKonten(db *gorm.DB, kataKunci string, tipe []models.TipeKontenPencarian, page, limit int) (*HasilPencarian, error) {
+	kata := unik(TokenKata(kataKunci))
+	if len(kata) == 0 {
+		return nil, ErrKataKunciKosong
+	}
+	if len(kata) > maksKataKunci {
+		kata = kata[:maksKataKunci]
+	}
+	akarKata := make([][]string, len(kata))
+	semuaTerm := make(map[string]bool)
+	for i, k := range kata {
+		akarKata[i] = AkarKata(k)
+		for _, t := range akarKata[i] {
+			semuaTerm[t] = true
+		}
+	}
+	daftarTerm := make([]string, 0, len(semuaTerm))
+	for t := range semuaTerm {
+		daftarTerm = append(daftarTerm, t)
+	}
+
+	filterTipe := func(q *gorm.DB) *gorm.DB {
+		if len(tipe) > 0 {
+			return q.Where("tipe IN ?", tipe)
+		}
+		return q
+	}
+
+	var jumlahDokumen int64
+	if err := filterTipe(db.Table("indeks_pencarian")).Select("COUNT(DISTINCT tipe, id_konten)").Scan(&jumlahDokumen).Error; err != nil {
+		return nil, err
+	}
+	var baris []models.IndeksPencarian
+	if err := filterTipe(db.Where("term IN ?", daftarTerm)).Find(&baris).Error; err != nil {
+		return nil, err
+	}
+
+	// tf[dokumen][term] dan df[term]
+	type kunciDokumen struct {
+		Tipe models.TipeKontenPencarian
+		ID   string
+	}
+	tf := make(map[kunciDokumen]map[string]int)
+	df := make(map[string]int)
+	for _, b := range baris {
+		k := kunciDokumen{b.Tipe, b.IDKonten}
+		if tf[k] == nil {
+			tf[k] = make(map[string]int)
+		}
+		tf[k][b.Term] = b.Bobot
+		df[b.Term]++
+	}
+
+	kandidat := make([]kandidatPencarian, 0, len(tf))
+	for k, termDok := range tf {
+		c := kandidatPencarian{Tipe: k.Tipe, ID: k.ID}
+		for _, akar := range akarKata {
+			// Kata dengan beberapa kandidat kata dasar dihitung sekali, dari kandidat terbaik
+			terbaik := 0.0
+			for _, t := range akar {
+				f := float64(termDok[t])
+				if f == 0 {
+					continue
+				}
+				n := float64(df[t])
+				idf := math.Log(1 + (float64(jumlahDokumen)-n+0.5)/(n+0.5))
+				terbaik = math.Max(terbaik, idf*f*(bm25K1+1)/(f+bm25K1))
+			}
+			if terbaik > 0 {
+				c.Skor += terbaik
+				c.Cocok++
+			}
+		}
+		c.Skor *= float64(c.Cocok) / float64(len(kata))
+		kandidat = append(kandidat, c)
+	}
+
+	kandidat, err := saringPublik(db, kandidat, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(kandidat, func(i, j int) bool {
+		if kandidat[i].Skor != kandidat[j].Skor {
+			return kandidat[i].Skor > kandidat[j].Skor
+		}
+		if kandidat[i].Tipe != kandidat[j].Tipe {
+			return kandidat[i].Tipe < kandidat[j].Tipe
+		}
+		return kandidat[i].ID < kandidat[j].ID
+	})
+
+	hasil := &HasilPencarian{Item: []ItemPencarian{}, Total: len(kandidat), PerTipe: make(map[models.TipeKontenPencarian]int)}
+	for _, c := range kandidat {
+		hasil.PerTipe[c.Tipe]++
+	}
+
+	awal := (page - 1) * limit
+	if awal >= len(kandidat) {
+		return hasil, nil
+	}
+	halaman := kandidat[awal:min(awal+limit, len(kandidat))]
+
+	dokumen, err := ambilDokumen(db, halaman)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range halaman {
+		d, ok := dokumen[string(c.Tipe)+"/"+c.ID]
+		if !ok {
+			continue
+		}
+		hasil.Item = append(hasil.Item, ItemPencarian{
+			Tipe:     c.Tipe,
+			ID:       c.ID,
+			Judul:    d.Judul,
+			Slug:     d.Slug,
+			Cuplikan: buatCuplikan(d.Isi, semuaTerm),
+			Skor:     math.Round(c.Skor*1000) / 1000,
+			Tanggal:  d.Tanggal,
+		})
+	}
+	return hasil, nil
+}
+
+// kelompokkanID mengelompokkan ID kandidat per tipe konten
+func kelompokkanID(kandidat []kandidatPencarian) map[models.TipeKontenPencarian][]string {
+	id := make(map[models.TipeKontenPencarian][]string)
+	for _, c := range kandidat {
+		id[c.Tipe] = append(id[c.Tipe], c.ID)
+	}
+	return id
+}
+
+// saringPublik membuang kandidat yang tidak boleh tampil di situs publik saat ini
+// (berita belum terbit, pengumuman internal atau di luar masa tampil, konten nonaktif)
+func saringPublik(db *gorm.DB, kandidat []kandidatPencarian, sekarang time.Time) ([]kandidatPencarian, error) {
+	tampil := make(map[string]bool)
+	for tipe, daftarID := range kelompokkanID(kandidat) {
+		sumber, ok := cariSumber(tipe)
+		if !ok {
+			continue
+		}
+		for awal := 0; awal < len(daftarID); awal += 1000 {
+			var idPublik []string
+			q := sumber.Publik(db.Table(sumber.Tabel), sekarang).Where(sumber.KolomID+" IN ?", daftarID[awal:min(awal+1000, len(daftarID))])
+			if err := q.Pluck(sumber.KolomID, &idPublik).Error; err != nil {
+				return nil, err
+			}
+			for _, id := range idPublik {
+				tampil[string(tipe)+"/"+id] = true
+			}
+		}
+	}
+
+	hasil := kandidat[:0]
+	for _, c := range kandidat {
+		if tampil[string(c.Tipe)+"/"+c.ID] {
+			hasil = append(hasil, c)
+		}
+	}
+	return hasil, nil
+}
+
+func ambilDokumen(db *gorm.DB, kandidat []kandidatPencarian) (map[string]dokumenPencarian, error) {
+	dokumen := make(map[string]dokumenPencarian, len(kandidat))
+	for tipe, daftarID := range kelompokkanID(kandidat) {
+		sumber, _ := cariSumber(tipe)
+		daftar, err := sumber.baca(db.Where(sumber.KolomID+" IN ?", daftarID))
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range daftar {
+			dokumen[string(tipe)+"/"+d.ID] = d
+		}
+	}
+	return dokumen, nil
+}
+
+var polaSpasi = regexp.MustCompile(`\s+`)
+
+// buatCuplikan mengambil potongan teks sepanjang panjangCuplikan kata yang paling banyak memuat
+// kata kunci, meng-escape HTML-nya, lalu menandai kata yang cocok dengan <mark>
+func buatCuplikan(teks string, term map[string]bool) string {
+	// Posisi byte setiap kata di teks
+	type posisiKata struct {
+		Awal, Akhir int
+		Cocok       bool
+	}
+	var daftar []posisiKata
+	awal := -1
+	for i, r := range teks + " " {
+		if !bukanHurufAngka(r) {
+			if awal < 0 {
+				awal = i
+			}
+			continue
+		}
+		if awal >= 0 {
+			kata := strings.ToLower(teks[awal:i])
+			cocok := false
+			if !kataUmum[kata] {
+				for _, akar := range AkarKata(kata) {
+					cocok = cocok || term[akar]
+				}
+			}
+			daftar = append(daftar, posisiKata{awal, i, cocok})
+			awal = -1
+		}
+	}
+	if len(daftar) == 0 {
+		return ""
+	}
+
+	// Jendela dimulai beberapa kata sebelum kata yang cocok agar konteksnya terbaca
+	mulai, terbanyak := 0, 0
+	for i, k := range daftar {
+		if !k.Cocok {
+			continue
+		}
+		m := max(0, i-6)
+		jumlah := 0
+		for _, kj := range daftar[m:min(m+panjangCuplikan, len(daftar))] {
+			if kj.Cocok {
+				jumlah++
+			}
+		}
+		if jumlah > terbanyak {
+			mulai, terbanyak = m, jumlah
+		}
+	}
+	selesai := min(mulai+panjangCuplikan, len(daftar))
+
+	var sb strings.Builder
+	if mulai > 0 {
+		sb.WriteString("… ")
+	}
+	for i := mulai; i < selesai; i++ {
+		k := daftar[i]
+		if i > mulai {
+			sb.WriteString(html.EscapeString(polaSpasi.ReplaceAllString(teks[daftar[i-1].Akhir:k.Awal], " ")))
+		}
+		if k.Cocok {
+			sb.WriteString("<mark>" + html.EscapeString(teks[k.Awal:k.Akhir]) + "</mark>")
+		} else {
+			sb.WriteString(html.EscapeString(teks[k.Awal:k.Akhir]))
+		}
+	}
+	if selesai < len(daftar) {
+		sb.WriteString(" …")
+	}
+	return sb.String()
+}
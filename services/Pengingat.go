@@ -0,0 +1,269 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"tpq_asysyafii/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MasaTenangBawaan adalah jeda minimal antar pengingat untuk wali yang tidak punya pengaturan sendiri
+const MasaTenangBawaan = 7
+
+// templatPengingatBawaan dipakai jika PENGINGAT_TEMPLATE tidak diisi
+const templatPengingatBawaan = `Assalamu'alaikum {{.NamaWali}},
+
+Kami mengingatkan bahwa syahriah santri berikut belum lunas sampai {{.Per}}:
+{{range .Santri}}
+{{.NamaSantri}} ({{.JumlahBulan}} bulan, {{rupiah .TotalTunggakan}}){{range .Rincian}}
+  - {{bulan .Bulan}}: {{rupiah .Sisa}}{{end}}
+{{end}}
+Total tunggakan: {{rupiah .TotalTunggakan}}
+
+Pembayaran dapat dilakukan langsung ke pengurus atau secara online melalui aplikasi.
+Abaikan pesan ini jika sudah membayar.
+
+{{.NamaTPQ}}`
+
+var ErrPengingatDinonaktifkan = errors.New("wali menonaktifkan pengingat tunggakan")
+
+// DataPengingat adalah isi yang tersedia di template pengingat
+type DataPengingat struct {
+	NamaTPQ        string
+	NamaWali       string
+	Per            string
+	JumlahBulan    int
+	TotalTunggakan float64
+	Santri         []TunggakanSantri
+}
+
+// PengingatDilewati adalah wali yang tidak dikirimi pengingat beserta alasannya
+type PengingatDilewati struct {
+	IDWali   string `json:"id_wali"`
+	NamaWali string `json:"nama_wali"`
+	Alasan   string `json:"alasan"`
+}
+
+type HasilPengingat struct {
+	Per      string                      `json:"per"`
+	Terkirim []models.PengingatTunggakan `json:"terkirim"`
+	Gagal    []models.PengingatTunggakan `json:"gagal"`
+	Dilewati []PengingatDilewati         `json:"dilewati"`
+}
+
+// OpsiPengingat mengatur pengiriman pengingat
+type OpsiPengingat struct {
+	Per           string   // default bulan berjalan
+	IDWali        []string // kosong berarti semua wali yang menunggak
+	MinimalBulan  int      // hanya wali dengan tunggakan minimal sekian bulan, default 1
+	AbaikanTenang bool     // kirim walaupun masih dalam masa tenang
+	UjiCoba       bool     // susun pesan tanpa mengirim atau mencatat
+	DipicuOleh    *string
+}
+
+type PengingatService struct {
+	db       *gorm.DB
+	notifier Notifier
+	templat  *template.Template
+}
+
+// NewPengingatService membuat engine pengingat. Template dapat diganti dengan file di PENGINGAT_TEMPLATE.
+func NewPengingatService(db *gorm.DB, notifier Notifier) *PengingatService {
+	fungsi := template.FuncMap{"rupiah": FormatRupiah, "bulan": FormatBulan}
+	templat := template.Must(template.New("pengingat").Funcs(fungsi).Parse(templatPengingatBawaan))
+	if path := os.Getenv("PENGINGAT_TEMPLATE"); path != "" {
+		if isi, err := os.ReadFile(path); err != nil {
+			log.Printf("⚠️ Gagal membaca template pengingat %s: %v", path, err)
+		} else if t, err := template.New("pengingat").Funcs(fungsi).Parse(string(isi)); err != nil {
+			log.Printf("⚠️ Template pengingat %s tidak valid: %v", path, err)
+		} else {
+			templat = t
+		}
+	}
+	return &PengingatService{db: db, notifier: notifier, templat: templat}
+}
+
+// MasaTenang mengembalikan jeda hari antar pengingat untuk wali
+func (s *PengingatService) MasaTenang(idWali string) (int, bool, error) {
+	hari := MasaTenangBawaan
+	if env, err := strconv.Atoi(os.Getenv("PENGINGAT_MASA_TENANG_HARI")); err == nil && env > 0 {
+		hari = env
+	}
+	var pengaturan models.PengaturanPengingat
+	err := s.db.First(&pengaturan, "id_wali = ?", idWali).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return hari, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return pengaturan.MasaTenangHari, pengaturan.Nonaktif, nil
+}
+
+// masihTenang memeriksa apakah wali sudah menerima, atau sedang dikirimi, pengingat dalam masa tenangnya
+func masihTenang(db *gorm.DB, idWali string, hari int, sekarang time.Time) (*time.Time, error) {
+	var terakhir models.PengingatTunggakan
+	err := db.Where("id_wali = ? AND status IN ? AND dikirim_pada > ?", idWali,
+		[]models.StatusPengingat{models.PengingatTerkirim, models.PengingatMenunggu}, sekarang.AddDate(0, 0, -hari)).
+		Order("dikirim_pada DESC").First(&terakhir).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &terakhir.DikirimPada, nil
+}
+
+// Kirim mengirim pengingat tunggakan ke wali, satu pesan per wali untuk semua santrinya
+func (s *PengingatService) Kirim(opsi OpsiPengingat) (*HasilPengingat, error) {
+	if opsi.MinimalBulan < 1 {
+		opsi.MinimalBulan = 1
+	}
+	laporan, err := NewTunggakanService(s.db).Laporan(opsi.Per, "")
+	if err != nil {
+		return nil, err
+	}
+
+	dipilih := make(map[string]bool, len(opsi.IDWali))
+	for _, id := range opsi.IDWali {
+		dipilih[id] = true
+	}
+
+	namaTPQ := "TPQ Asy-Syafii"
+	var info models.InformasiTPQ
+	if err := s.db.Select("nama_tpq").First(&info).Error; err == nil && info.NamaTPQ != "" {
+		namaTPQ = info.NamaTPQ
+	}
+
+	hasil := &HasilPengingat{
+		Per:      laporan.Per,
+		Terkirim: []models.PengingatTunggakan{},
+		Gagal:    []models.PengingatTunggakan{},
+		Dilewati: []PengingatDilewati{},
+	}
+	sekarang := time.Now()
+	for _, keluarga := range laporan.Keluarga {
+		if len(dipilih) > 0 && !dipilih[keluarga.IDWali] {
+			continue
+		}
+		lewati := func(alasan string) {
+			hasil.Dilewati = append(hasil.Dilewati, PengingatDilewati{IDWali: keluarga.IDWali, NamaWali: keluarga.NamaWali, Alasan: alasan})
+		}
+		if keluarga.JumlahBulan < opsi.MinimalBulan {
+			lewati(fmt.Sprintf("Tunggakan %d bulan, kurang dari minimal %d bulan", keluarga.JumlahBulan, opsi.MinimalBulan))
+			continue
+		}
+
+		hari, nonaktif, err := s.MasaTenang(keluarga.IDWali)
+		if err != nil {
+			return nil, err
+		}
+		if nonaktif {
+			lewati(ErrPengingatDinonaktifkan.Error())
+			continue
+		}
+		if !opsi.AbaikanTenang {
+			terakhir, err := masihTenang(s.db, keluarga.IDWali, hari, sekarang)
+			if err != nil {
+				return nil, err
+			}
+			if terakhir != nil {
+				lewati(fmt.Sprintf("Masih dalam masa tenang %d hari (pengingat terakhir %s)", hari, terakhir.Format("02-01-2006 15:04")))
+				continue
+			}
+		}
+
+		var isi bytes.Buffer
+		if err := s.templat.Execute(&isi, DataPengingat{
+			NamaTPQ:        namaTPQ,
+			NamaWali:       keluarga.NamaWali,
+			Per:            FormatBulan(laporan.Per),
+			JumlahBulan:    keluarga.JumlahBulan,
+			TotalTunggakan: keluarga.TotalTunggakan,
+			Santri:         keluarga.Santri,
+		}); err != nil {
+			return nil, fmt.Errorf("gagal menyusun pesan pengingat: %v", err)
+		}
+		subjek := "Pengingat syahriah " + namaTPQ
+		pesan, err := PesanUntukUser(models.User{Email: keluarga.Email, NoTelp: keluarga.NoTelp}, subjek, strings.TrimSpace(isi.String()))
+		if err != nil {
+			lewati(err.Error())
+			continue
+		}
+
+		catatan := models.PengingatTunggakan{
+			IDPengingat:    uuid.New().String(),
+			IDWali:         keluarga.IDWali,
+			Kanal:          string(pesan.Kanal),
+			Tujuan:         pesan.Tujuan,
+			Subjek:         pesan.Subjek,
+			Isi:            pesan.Isi,
+			JumlahBulan:    keluarga.JumlahBulan,
+			TotalTunggakan: keluarga.TotalTunggakan,
+			Status:         models.PengingatTerkirim,
+			DipicuOleh:     opsi.DipicuOleh,
+			DikirimPada:    sekarang,
+		}
+		if opsi.UjiCoba {
+			hasil.Terkirim = append(hasil.Terkirim, catatan)
+			continue
+		}
+
+		// Catat dulu sebagai menunggu; pengiriman lain untuk wali yang sama menunggu kunci lalu melihat catatan ini
+		catatan.Status = models.PengingatMenunggu
+		terakhir, err := s.cadangkan(&catatan, hari, opsi.AbaikanTenang)
+		if err != nil {
+			return nil, err
+		}
+		if terakhir != nil {
+			lewati(fmt.Sprintf("Masih dalam masa tenang %d hari (pengingat terakhir %s)", hari, terakhir.Format("02-01-2006 15:04")))
+			continue
+		}
+
+		catatan.Status = models.PengingatTerkirim
+		if err := s.notifier.Kirim(pesan); err != nil {
+			catatan.Status, catatan.Galat = models.PengingatGagal, err.Error()
+		}
+		if err := s.db.Model(&catatan).Updates(map[string]interface{}{"status": catatan.Status, "galat": catatan.Galat}).Error; err != nil {
+			fmt.Printf("Gagal mencatat pengingat untuk wali %s: %v\n", keluarga.IDWali, err)
+		}
+		if catatan.Status == models.PengingatGagal {
+			hasil.Gagal = append(hasil.Gagal, catatan)
+		} else {
+			hasil.Terkirim = append(hasil.Terkirim, catatan)
+		}
+	}
+	return hasil, nil
+}
+
+// cadangkan menyimpan catatan pengingat berstatus menunggu sebelum pesan dikirim. Baris user wali dikunci
+// selama masa tenang diperiksa ulang, sehingga dua pengiriman bersamaan untuk wali yang sama tidak bisa
+// sama-sama lolos. Mengembalikan waktu pengingat terakhir jika wali ternyata masih dalam masa tenang.
+func (s *PengingatService) cadangkan(catatan *models.PengingatTunggakan, hari int, abaikanTenang bool) (*time.Time, error) {
+	var terakhir *time.Time
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var wali models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id_user").First(&wali, "id_user = ?", catatan.IDWali).Error; err != nil {
+			return err
+		}
+		if !abaikanTenang {
+			var err error
+			if terakhir, err = masihTenang(tx, catatan.IDWali, hari, catatan.DikirimPada); err != nil || terakhir != nil {
+				return err
+			}
+		}
+		return tx.Create(catatan).Error
+	})
+	return terakhir, err
+}
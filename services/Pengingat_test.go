@@ -0,0 +1,144 @@
+package services_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
+	"tpq_asysyafii/ujidb"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// notifierHitung mencatat setiap pesan yang dikirim tanpa benar-benar mengirimnya
+type notifierHitung struct {
+	mu    sync.Mutex
+	pesan []services.Pesan
+}
+
+func (n *notifierHitung) Kirim(pesan services.Pesan) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.pesan = append(n.pesan, pesan)
+	return nil
+}
+
+func (n *notifierHitung) jumlah() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.pesan)
+}
+
+// waliMenunggakUji membuat wali dengan satu santri yang menunggak syahriah Desember 1991
+func waliMenunggakUji(t *testing.T, db *gorm.DB) models.User {
+	t.Helper()
+	admin := ujidb.BuatUser(t, db, models.RoleAdmin)
+	wali := ujidb.BuatUser(t, db, models.RoleWali)
+	if err := db.Model(&wali).Update("no_telp", "081234567890").Error; err != nil {
+		t.Fatalf("gagal mengisi nomor wali: %v", err)
+	}
+	santri := models.Santri{
+		IDSantri:     uuid.New().String(),
+		IDWali:       wali.IDUser,
+		NamaLengkap:  "Santri Pengingat",
+		JenisKelamin: models.LakiLaki,
+		TanggalLahir: time.Now().AddDate(-8, 0, 0),
+		TanggalMasuk: time.Now(),
+	}
+	ujidb.Buat(t, db, &santri)
+	ujidb.Buat(t, db, &models.Syahriah{
+		IDSyahriah:  uuid.New().String(),
+		ID_Santri:   santri.IDSantri,
+		Bulan:       "1991-12",
+		Nominal:     50000,
+		Status:      models.StatusBelum,
+		DicatatOleh: admin.IDUser,
+		WaktuCatat:  time.Now(),
+	})
+	return wali
+}
+
+func pengingatWali(t *testing.T, db *gorm.DB, idWali string) []models.PengingatTunggakan {
+	t.Helper()
+	var daftar []models.PengingatTunggakan
+	if err := db.Where("id_wali = ?", idWali).Find(&daftar).Error; err != nil {
+		t.Fatalf("gagal membaca catatan pengingat: %v", err)
+	}
+	return daftar
+}
+
+// Pengingat yang masih tercatat menunggu (sedang dikirim proses lain) ikut dihitung dalam masa tenang,
+// dan pengingat yang sudah terkirim tercatat dengan status terkirim.
+func TestKirimPengingatMenghormatiPengingatYangSedangDikirim(t *testing.T) {
+	db := ujidb.Buka(t)
+	notifier := &notifierHitung{}
+	service := services.NewPengingatService(db, notifier)
+	opsi := services.OpsiPengingat{Per: "1992-01"}
+
+	sedangDikirim := waliMenunggakUji(t, db)
+	ujidb.Buat(t, db, &models.PengingatTunggakan{
+		IDPengingat: uuid.New().String(),
+		IDWali:      sedangDikirim.IDUser,
+		Kanal:       string(services.KanalWhatsApp),
+		Tujuan:      "081234567890",
+		Isi:         "-",
+		Status:      models.PengingatMenunggu,
+		DikirimPada: time.Now(),
+	})
+	opsi.IDWali = []string{sedangDikirim.IDUser}
+	hasil, err := service.Kirim(opsi)
+	if err != nil {
+		t.Fatalf("kirim gagal: %v", err)
+	}
+	if len(hasil.Terkirim) != 0 || len(hasil.Dilewati) != 1 || notifier.jumlah() != 0 {
+		t.Errorf("wali yang sedang dikirimi pengingat harus dilewati: terkirim %d, dilewati %d, pesan %d",
+			len(hasil.Terkirim), len(hasil.Dilewati), notifier.jumlah())
+	}
+
+	baru := waliMenunggakUji(t, db)
+	opsi.IDWali = []string{baru.IDUser}
+	if hasil, err = service.Kirim(opsi); err != nil {
+		t.Fatalf("kirim gagal: %v", err)
+	}
+	if len(hasil.Terkirim) != 1 || notifier.jumlah() != 1 {
+		t.Fatalf("terkirim %d, pesan %d, harapan 1", len(hasil.Terkirim), notifier.jumlah())
+	}
+	if daftar := pengingatWali(t, db, baru.IDUser); len(daftar) != 1 || daftar[0].Status != models.PengingatTerkirim {
+		t.Errorf("catatan pengingat %+v, harapan satu berstatus terkirim", daftar)
+	}
+}
+
+// Dua pengiriman bersamaan untuk wali yang sama hanya boleh mengirim satu pesan
+func TestKirimPengingatParalelHanyaSekaliPerWali(t *testing.T) {
+	db := ujidb.Buka(t)
+	ujidb.ButuhKunciBaris(t)
+	notifier := &notifierHitung{}
+	service := services.NewPengingatService(db, notifier)
+	wali := waliMenunggakUji(t, db)
+
+	const jumlahRun = 5
+	var wg sync.WaitGroup
+	galat := make([]error, jumlahRun)
+	for i := 0; i < jumlahRun; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, galat[i] = service.Kirim(services.OpsiPengingat{Per: "1992-01", IDWali: []string{wali.IDUser}})
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range galat {
+		if err != nil {
+			t.Errorf("run %d gagal: %v", i, err)
+		}
+	}
+	if notifier.jumlah() != 1 {
+		t.Errorf("wali menerima %d pesan, harapan 1", notifier.jumlah())
+	}
+	if daftar := pengingatWali(t, db, wali.IDUser); len(daftar) != 1 {
+		t.Errorf("tercatat %d pengingat, harapan 1", len(daftar))
+	}
+}
@@ -0,0 +1,439 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+	"tpq_asysyafii/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	kunciPemimpin = "scheduler"
+	// MasaKunciPemimpin harus lebih lama dari interval tick agar lease tidak lepas saat diperpanjang
+	MasaKunciPemimpin = 2 * time.Minute
+	// masaKunciJob diperpanjang selama job berjalan, jadi cukup pendek agar kunci run yang mati cepat lepas
+	masaKunciJob = 5 * time.Minute
+	intervalTick = time.Minute
+)
+
+var (
+	ErrJobTidakDikenal     = errors.New("job tidak dikenal")
+	ErrSchedulerTanpaDB    = errors.New("scheduler tidak memiliki koneksi database")
+	ErrJobSedangDijalankan = errors.New("job sedang dijalankan")
+)
+
+// Jadwal menentukan kapan job dijalankan
+type Jadwal interface {
+	// Terakhir mengembalikan waktu jadwal paling akhir yang tidak lebih dari t
+	Terakhir(t time.Time) time.Time
+	// Berikutnya mengembalikan waktu jadwal pertama setelah t
+	Berikutnya(t time.Time) time.Time
+	String() string
+}
+
+// JadwalBulanan berjalan setiap bulan pada tanggal dan jam tertentu (tanggal 1-28)
+type JadwalBulanan struct {
+	Tanggal, Jam, Menit int
+}
+
+func (j JadwalBulanan) pada(tahun int, bulan time.Month, loc *time.Location) time.Time {
+	return time.Date(tahun, bulan, j.Tanggal, j.Jam, j.Menit, 0, 0, loc)
+}
+
+func (j JadwalBulanan) Terakhir(t time.Time) time.Time {
+	jadwal := j.pada(t.Year(), t.Month(), t.Location())
+	if jadwal.After(t) {
+		jadwal = j.pada(t.Year(), t.Month()-1, t.Location())
+	}
+	return jadwal
+}
+
+func (j JadwalBulanan) Berikutnya(t time.Time) time.Time {
+	jadwal := j.pada(t.Year(), t.Month(), t.Location())
+	if !jadwal.After(t) {
+		jadwal = j.pada(t.Year(), t.Month()+1, t.Location())
+	}
+	return jadwal
+}
+
+func (j JadwalBulanan) String() string {
+	return fmt.Sprintf("setiap tanggal %d pukul %02d:%02d", j.Tanggal, j.Jam, j.Menit)
+}
+
+// JadwalHarian berjalan setiap hari pada jam tertentu
+type JadwalHarian struct {
+	Jam, Menit int
+}
+
+func (j JadwalHarian) pada(t time.Time, hari int) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day()+hari, j.Jam, j.Menit, 0, 0, t.Location())
+}
+
+func (j JadwalHarian) Terakhir(t time.Time) time.Time {
+	if jadwal := j.pada(t, 0); !jadwal.After(t) {
+		return jadwal
+	}
+	return j.pada(t, -1)
+}
+
+func (j JadwalHarian) Berikutnya(t time.Time) time.Time {
+	if jadwal := j.pada(t, 0); jadwal.After(t) {
+		return jadwal
+	}
+	return j.pada(t, 1)
+}
+
+func (j JadwalHarian) String() string {
+	return fmt.Sprintf("setiap hari pukul %02d:%02d", j.Jam, j.Menit)
+}
+
+// JadwalInterval berjalan setiap selang waktu tetap
+type JadwalInterval struct {
+	Setiap time.Duration
+}
+
+func (j JadwalInterval) Terakhir(t time.Time) time.Time {
+	return t.Truncate(j.Setiap)
+}
+
+func (j JadwalInterval) Berikutnya(t time.Time) time.Time {
+	return t.Truncate(j.Setiap).Add(j.Setiap)
+}
+
+func (j JadwalInterval) String() string {
+	return "setiap " + j.Setiap.String()
+}
+
+// FungsiJob menjalankan job untuk satu jadwal dan mengembalikan ringkasan hasilnya
+type FungsiJob func(ctx context.Context, jadwal time.Time) (string, error)
+
+type Job struct {
+	Nama      string
+	Deskripsi string
+	Jadwal    Jadwal
+	Jalankan  FungsiJob
+}
+
+// Scheduler menjalankan job terdaftar di dalam proses. Hanya instance yang memegang
+// kunci pemimpin yang menjalankan job terjadwal; run manual tetap dikunci per job.
+type Scheduler struct {
+	db       *gorm.DB
+	instance string
+
+	mu       sync.Mutex
+	jobs     []Job
+	pemimpin bool
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	berjalan sync.WaitGroup
+}
+
+func NewScheduler(db *gorm.DB) *Scheduler {
+	host, _ := os.Hostname()
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		db:       db,
+		instance: fmt.Sprintf("%s-%d-%s", host, os.Getpid(), uuid.New().String()[:8]),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Daftarkan menambahkan job; nama job harus unik
+func (s *Scheduler) Daftarkan(job Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.jobs {
+		if s.jobs[i].Nama == job.Nama {
+			s.jobs[i] = job
+			return
+		}
+	}
+	s.jobs = append(s.jobs, job)
+}
+
+// Jobs mengembalikan salinan daftar job terdaftar
+func (s *Scheduler) Jobs() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Job(nil), s.jobs...)
+}
+
+func (s *Scheduler) Job(nama string) (Job, bool) {
+	for _, job := range s.Jobs() {
+		if job.Nama == nama {
+			return job, true
+		}
+	}
+	return Job{}, false
+}
+
+func (s *Scheduler) Instance() string {
+	return s.instance
+}
+
+// Pemimpin menandakan apakah instance ini sedang memegang kunci pemimpin
+func (s *Scheduler) Pemimpin() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pemimpin
+}
+
+// Mulai menjalankan loop scheduler di goroutine terpisah
+func (s *Scheduler) Mulai() {
+	if s.db == nil {
+		log.Println("⚠️ Scheduler tidak dijalankan karena database belum terhubung")
+		return
+	}
+	s.berjalan.Add(1)
+	go func() {
+		defer s.berjalan.Done()
+		ticker := time.NewTicker(intervalTick)
+		defer ticker.Stop()
+
+		s.tick()
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C:
+				s.tick()
+			}
+		}
+	}()
+	log.Printf("⏰ Scheduler berjalan sebagai instance %s dengan %d job", s.instance, len(s.Jobs()))
+}
+
+// Berhenti menghentikan loop, menunggu job yang sedang berjalan, lalu melepas kunci pemimpin
+func (s *Scheduler) Berhenti(ctx context.Context) error {
+	s.cancel()
+
+	selesai := make(chan struct{})
+	go func() {
+		s.berjalan.Wait()
+		close(selesai)
+	}()
+
+	var err error
+	select {
+	case <-selesai:
+	case <-ctx.Done():
+		err = fmt.Errorf("job masih berjalan saat scheduler dihentikan: %w", ctx.Err())
+	}
+
+	if s.db != nil {
+		s.lepasKunci(kunciPemimpin, s.instance)
+	}
+	return err
+}
+
+func (s *Scheduler) tick() {
+	sekarang := time.Now()
+	pemimpin, err := s.ambilKunci(kunciPemimpin, s.instance, MasaKunciPemimpin)
+	if err != nil {
+		fmt.Printf("Gagal mengambil kunci scheduler: %v\n", err)
+	}
+	s.mu.Lock()
+	s.pemimpin = pemimpin
+	s.mu.Unlock()
+	if !pemimpin {
+		return
+	}
+
+	for _, job := range s.Jobs() {
+		if s.ctx.Err() != nil {
+			return
+		}
+		jadwal := job.Jadwal.Terakhir(sekarang).Truncate(time.Second)
+		var ada int64
+		if err := s.db.Model(&models.JobRun{}).Where("nama = ? AND jadwal = ?", job.Nama, jadwal).Count(&ada).Error; err != nil {
+			fmt.Printf("Gagal memeriksa riwayat job %s: %v\n", job.Nama, err)
+			continue
+		}
+		if ada > 0 {
+			continue
+		}
+		// Jadwal yang kuncinya masih dipegang run lain belum dicatat, jadi dicoba lagi pada tick berikutnya
+		_, err := s.jalankan(job, jadwal, nil)
+		if err != nil && !errors.Is(err, gorm.ErrDuplicatedKey) && !errors.Is(err, ErrJobSedangDijalankan) {
+			fmt.Printf("Gagal menjalankan job %s: %v\n", job.Nama, err)
+		}
+	}
+}
+
+// JalankanSekarang menjalankan job di luar jadwal tanpa menunggu selesai
+func (s *Scheduler) JalankanSekarang(nama, dipicuOleh string) (models.JobRun, error) {
+	if s.db == nil {
+		return models.JobRun{}, ErrSchedulerTanpaDB
+	}
+	job, ok := s.Job(nama)
+	if !ok {
+		return models.JobRun{}, ErrJobTidakDikenal
+	}
+
+	run, err := s.mulaiRun(job, time.Now(), &dipicuOleh)
+	if err != nil {
+		return run, err
+	}
+	s.berjalan.Add(1)
+	go func() {
+		defer s.berjalan.Done()
+		s.eksekusi(job, &run)
+	}()
+	return run, nil
+}
+
+func (s *Scheduler) jalankan(job Job, jadwal time.Time, dipicuOleh *string) (models.JobRun, error) {
+	run, err := s.mulaiRun(job, jadwal, dipicuOleh)
+	if err != nil {
+		return run, err
+	}
+	s.berjalan.Add(1)
+	defer s.berjalan.Done()
+	s.eksekusi(job, &run)
+	return run, nil
+}
+
+// mulaiRun mengambil kunci job atas nama run baru lalu mencatat run tersebut. Jika kunci masih dipegang
+// run lain, jadwal tidak dicatat agar bisa dicoba lagi; run manual dicatat dilewati sebagai riwayat.
+// Keduanya mengembalikan ErrJobSedangDijalankan.
+func (s *Scheduler) mulaiRun(job Job, jadwal time.Time, dipicuOleh *string) (models.JobRun, error) {
+	run := models.JobRun{
+		IDRun:      uuid.New().String(),
+		Nama:       job.Nama,
+		Jadwal:     jadwal,
+		Manual:     dipicuOleh != nil,
+		DipicuOleh: dipicuOleh,
+		Status:     models.JobBerjalan,
+		Instance:   s.instance,
+		MulaiPada:  time.Now(),
+	}
+
+	dapat, err := s.ambilKunci(kunciJob(job.Nama), s.pemilikRun(run), masaKunciJob)
+	if err != nil {
+		return run, fmt.Errorf("gagal mengambil kunci job: %w", err)
+	}
+	if !dapat {
+		if run.Manual {
+			selesai := time.Now()
+			run.Status, run.Pesan = models.JobDilewati, "Job yang sama sedang dijalankan"
+			run.SelesaiPada = &selesai
+			if err := s.db.Create(&run).Error; err != nil {
+				fmt.Printf("Gagal mencatat run job %s yang dilewati: %v\n", run.Nama, err)
+			}
+		}
+		return run, ErrJobSedangDijalankan
+	}
+
+	// Instance lain sudah mencatat jadwal yang sama
+	hasil := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&run)
+	if hasil.Error == nil && hasil.RowsAffected == 0 {
+		hasil.Error = gorm.ErrDuplicatedKey
+	}
+	if hasil.Error != nil {
+		s.lepasKunci(kunciJob(job.Nama), s.pemilikRun(run))
+		return run, hasil.Error
+	}
+	return run, nil
+}
+
+func (s *Scheduler) eksekusi(job Job, run *models.JobRun) {
+	selesai := make(chan struct{})
+	go s.perpanjangKunci(kunciJob(job.Nama), s.pemilikRun(*run), masaKunciJob, selesai)
+	defer s.lepasKunci(kunciJob(job.Nama), s.pemilikRun(*run))
+	defer close(selesai)
+	defer func() {
+		if r := recover(); r != nil {
+			run.Status, run.Pesan = models.JobGagal, fmt.Sprintf("panic: %v", r)
+			s.selesaikanRun(run)
+		}
+	}()
+
+	pesan, err := job.Jalankan(s.ctx, run.Jadwal)
+	run.Status, run.Pesan = models.JobSukses, pesan
+	if err != nil {
+		run.Status, run.Pesan = models.JobGagal, err.Error()
+		log.Printf("❌ Job %s gagal: %v", job.Nama, err)
+	}
+	s.selesaikanRun(run)
+}
+
+func (s *Scheduler) selesaikanRun(run *models.JobRun) {
+	selesai := time.Now()
+	run.SelesaiPada = &selesai
+	run.DurasiMs = selesai.Sub(run.MulaiPada).Milliseconds()
+	if err := s.db.Model(&models.JobRun{}).Where("id_run = ?", run.IDRun).Updates(map[string]interface{}{
+		"status":       run.Status,
+		"pesan":        run.Pesan,
+		"selesai_pada": run.SelesaiPada,
+		"durasi_ms":    run.DurasiMs,
+	}).Error; err != nil {
+		fmt.Printf("Gagal menyimpan hasil job %s: %v\n", run.Nama, err)
+	}
+}
+
+func kunciJob(nama string) string {
+	return "job:" + nama
+}
+
+// pemilikRun adalah pemilik kunci job untuk satu run. Setiap run punya pemilik sendiri, sehingga run kedua
+// dari instance yang sama tidak bisa mengambil atau melepas kunci run pertama.
+func (s *Scheduler) pemilikRun(run models.JobRun) string {
+	return s.instance + "/" + run.IDRun
+}
+
+// ambilKunci mengambil atau memperpanjang lease bernama atas nama pemilik. Lease yang sudah habis boleh diambil alih.
+func (s *Scheduler) ambilKunci(nama, pemilik string, masa time.Duration) (bool, error) {
+	sekarang := time.Now()
+	hasil := s.db.Model(&models.KunciJob{}).
+		Where("nama = ? AND (pemilik = ? OR berlaku_sampai < ?)", nama, pemilik, sekarang).
+		Updates(map[string]interface{}{"pemilik": pemilik, "berlaku_sampai": sekarang.Add(masa)})
+	if hasil.Error != nil {
+		return false, hasil.Error
+	}
+	if hasil.RowsAffected > 0 {
+		return true, nil
+	}
+
+	hasil = s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.KunciJob{
+		Nama:          nama,
+		Pemilik:       pemilik,
+		BerlakuSampai: sekarang.Add(masa),
+	})
+	return hasil.RowsAffected > 0, hasil.Error
+}
+
+// perpanjangKunci memperpanjang lease secara berkala sampai selesai ditutup, agar job yang berjalan
+// lebih lama dari masa lease tidak kehilangan kuncinya
+func (s *Scheduler) perpanjangKunci(nama, pemilik string, masa time.Duration, selesai <-chan struct{}) {
+	ticker := time.NewTicker(masa / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-selesai:
+			return
+		case <-ticker.C:
+			dapat, err := s.ambilKunci(nama, pemilik, masa)
+			if err != nil {
+				fmt.Printf("Gagal memperpanjang kunci %s: %v\n", nama, err)
+			} else if !dapat {
+				fmt.Printf("Kunci %s sudah diambil alih saat job masih berjalan\n", nama)
+			}
+		}
+	}
+}
+
+func (s *Scheduler) lepasKunci(nama, pemilik string) {
+	if err := s.db.Where("nama = ? AND pemilik = ?", nama, pemilik).Delete(&models.KunciJob{}).Error; err != nil {
+		fmt.Printf("Gagal melepas kunci %s: %v\n", nama, err)
+	}
+}
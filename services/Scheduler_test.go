@@ -0,0 +1,70 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
+	"tpq_asysyafii/ujidb"
+
+	"github.com/google/uuid"
+)
+
+// Run manual kedua dari instance yang sama harus ditolak selama run pertama berjalan,
+// dan penolakan itu tidak boleh melepas kunci milik run pertama.
+func TestJalankanSekarangMenolakRunKeduaSelamaRunPertamaBerjalan(t *testing.T) {
+	db := ujidb.Buka(t)
+	admin := ujidb.BuatUser(t, db, models.RoleAdmin)
+
+	nama := "uji-" + uuid.New().String()[:8]
+	mulai := make(chan struct{}, 3)
+	lanjut := make(chan struct{})
+	s := services.NewScheduler(db)
+	s.Daftarkan(services.Job{
+		Nama:   nama,
+		Jadwal: services.JadwalHarian{Jam: 1},
+		Jalankan: func(ctx context.Context, jadwal time.Time) (string, error) {
+			mulai <- struct{}{}
+			<-lanjut
+			return "selesai", nil
+		},
+	})
+	defer s.Berhenti(context.Background())
+
+	pertama, err := s.JalankanSekarang(nama, admin.IDUser)
+	if err != nil {
+		t.Fatalf("run pertama gagal dimulai: %v", err)
+	}
+	<-mulai
+
+	for i := 0; i < 2; i++ {
+		run, err := s.JalankanSekarang(nama, admin.IDUser)
+		if !errors.Is(err, services.ErrJobSedangDijalankan) {
+			t.Errorf("run ke-%d saat run pertama berjalan: error %v, harapan ErrJobSedangDijalankan", i+2, err)
+		} else if run.Status != models.JobDilewati {
+			t.Errorf("run ke-%d berstatus %q, harapan %q", i+2, run.Status, models.JobDilewati)
+		}
+	}
+	close(lanjut)
+	if err := s.Berhenti(context.Background()); err != nil {
+		t.Fatalf("gagal menghentikan scheduler: %v", err)
+	}
+	if len(mulai) != 0 {
+		t.Errorf("job dijalankan %d kali lagi saat run pertama belum selesai", len(mulai))
+	}
+
+	var tersimpan models.JobRun
+	if err := db.First(&tersimpan, "id_run = ?", pertama.IDRun).Error; err != nil {
+		t.Fatalf("gagal membaca run pertama: %v", err)
+	}
+	if tersimpan.Status != models.JobSukses {
+		t.Errorf("run pertama berstatus %q, harapan %q", tersimpan.Status, models.JobSukses)
+	}
+	var kunci int64
+	db.Model(&models.KunciJob{}).Where("nama = ?", "job:"+nama).Count(&kunci)
+	if kunci != 0 {
+		t.Errorf("kunci job masih tersimpan setelah run selesai")
+	}
+}
@@ -0,0 +1,311 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Storage menyimpan berkas media. Kunci berupa path relatif dengan pemisah "/",
+// misalnya "<folder>/<h[:2]>/<h[:32]>.<ext>" dengan h hash SHA-256 isi berkas (lihat MediaService.Unggah).
+type Storage interface {
+	// Driver adalah nama backend yang dicatat di tabel media (local atau s3)
+	Driver() string
+	// Simpan menulis isi berkas dan mengembalikan URL publiknya
+	Simpan(ctx context.Context, kunci, tipeKonten string, isi []byte) (string, error)
+	// Hapus menghapus berkas, tidak error jika berkas sudah tidak ada
+	Hapus(ctx context.Context, kunci string) error
+}
+
+var ErrKunciStorageTidakValid = errors.New("kunci storage tidak valid")
+
+// CacheControlMedia dikirim untuk berkas media. Nama berkas adalah hash isinya sehingga
+// isinya tidak pernah berubah dan boleh disimpan browser/CDN selama setahun.
+const CacheControlMedia = "public, max-age=31536000, immutable"
+
+// bersihkanKunci menolak kunci absolut atau yang keluar dari root storage
+func bersihkanKunci(kunci string) (string, error) {
+	bersih := strings.TrimPrefix(filepath.ToSlash(filepath.Clean("/"+kunci)), "/")
+	if bersih == "" || bersih != kunci {
+		return "", fmt.Errorf("%w: %s", ErrKunciStorageTidakValid, kunci)
+	}
+	return bersih, nil
+}
+
+// StorageLokal menyimpan berkas di disk server. Dir disajikan oleh router di URLDasar.
+type StorageLokal struct {
+	Dir      string
+	URLDasar string
+}
+
+func NewStorageLokal(dir, urlDasar string) *StorageLokal {
+	return &StorageLokal{Dir: dir, URLDasar: strings.TrimSuffix(urlDasar, "/")}
+}
+
+func (s *StorageLokal) Driver() string {
+	return "local"
+}
+
+func (s *StorageLokal) Simpan(ctx context.Context, kunci, tipeKonten string, isi []byte) (string, error) {
+	kunci, err := bersihkanKunci(kunci)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(s.Dir, filepath.FromSlash(kunci))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+
+	// Tulis ke file sementara lalu rename agar berkas tidak pernah terbaca setengah jadi
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, isi, 0644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return s.URLDasar + "/" + kunci, nil
+}
+
+func (s *StorageLokal) Hapus(ctx context.Context, kunci string) error {
+	kunci, err := bersihkanKunci(kunci)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(filepath.Join(s.Dir, filepath.FromSlash(kunci)))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// StorageS3 menyimpan berkas di object storage yang kompatibel dengan S3 (AWS S3, MinIO,
+// Cloudflare R2, dsb). Request ditandatangani dengan AWS Signature Version 4.
+type StorageS3 struct {
+	Endpoint  string // contoh: https://s3.ap-southeast-1.amazonaws.com
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	URLPublik string // opsional, misalnya domain CDN; default URL objek di endpoint
+	PathStyle bool   // true untuk MinIO dan sebagian besar layanan non-AWS
+	Client    *http.Client
+}
+
+func (s *StorageS3) Driver() string {
+	return "s3"
+}
+
+// urlObjek menyusun URL objek sesuai gaya path atau virtual-host
+func (s *StorageS3) urlObjek(kunci string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSuffix(s.Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	segmen := strings.Split(kunci, "/")
+	for i, sg := range segmen {
+		segmen[i] = url.PathEscape(sg)
+	}
+	if s.PathStyle {
+		u.Path = "/" + s.Bucket + "/" + strings.Join(segmen, "/")
+	} else {
+		u.Host = s.Bucket + "." + u.Host
+		u.Path = "/" + strings.Join(segmen, "/")
+	}
+	u.RawPath = u.Path
+	return u, nil
+}
+
+func (s *StorageS3) Simpan(ctx context.Context, kunci, tipeKonten string, isi []byte) (string, error) {
+	kunci, err := bersihkanKunci(kunci)
+	if err != nil {
+		return "", err
+	}
+	u, err := s.urlObjek(kunci)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewReader(isi))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", tipeKonten)
+	req.Header.Set("Cache-Control", CacheControlMedia)
+	if err := s.kirim(req, isi); err != nil {
+		return "", err
+	}
+
+	if s.URLPublik != "" {
+		return strings.TrimSuffix(s.URLPublik, "/") + "/" + kunci, nil
+	}
+	return u.String(), nil
+}
+
+func (s *StorageS3) Hapus(ctx context.Context, kunci string) error {
+	kunci, err := bersihkanKunci(kunci)
+	if err != nil {
+		return err
+	}
+	u, err := s.urlObjek(kunci)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	// S3 membalas 204 juga untuk objek yang tidak ada
+	return s.kirim(req, nil)
+}
+
+// kirim menandatangani dan mengirim request, error jika status bukan 2xx
+func (s *StorageS3) kirim(req *http.Request, isi []byte) error {
+	s.tandatangani(req, isi, time.Now().UTC())
+
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 60 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		pesan, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("storage S3 membalas %s: %s", resp.Status, strings.TrimSpace(string(pesan)))
+	}
+	return nil
+}
+
+// tandatangani menambahkan header Authorization AWS Signature Version 4
+func (s *StorageS3) tandatangani(req *http.Request, isi []byte, waktu time.Time) {
+	hashIsi := sha256.Sum256(isi)
+	payload := hex.EncodeToString(hashIsi[:])
+	amzDate := waktu.Format("20060102T150405Z")
+	tanggal := waktu.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+
+	headerDitandatangani := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if req.Header.Get("Content-Type") != "" {
+		headerDitandatangani = []string{"content-type", "host", "x-amz-content-sha256", "x-amz-date"}
+	}
+	var kanonHeader strings.Builder
+	for _, h := range headerDitandatangani {
+		nilai := req.Header.Get(h)
+		if h == "host" {
+			nilai = req.URL.Host
+		}
+		kanonHeader.WriteString(h + ":" + strings.TrimSpace(nilai) + "\n")
+	}
+	daftarHeader := strings.Join(headerDitandatangani, ";")
+
+	kanonRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		kanonHeader.String(),
+		daftarHeader,
+		payload,
+	}, "\n")
+	hashKanon := sha256.Sum256([]byte(kanonRequest))
+
+	cakupan := tanggal + "/" + s.Region + "/s3/aws4_request"
+	stringDitandatangani := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		cakupan,
+		hex.EncodeToString(hashKanon[:]),
+	}, "\n")
+
+	kunci := hmacSHA256([]byte("AWS4"+s.SecretKey), tanggal)
+	kunci = hmacSHA256(kunci, s.Region)
+	kunci = hmacSHA256(kunci, "s3")
+	kunci = hmacSHA256(kunci, "aws4_request")
+	tandaTangan := hex.EncodeToString(hmacSHA256(kunci, stringDitandatangani))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, cakupan, daftarHeader, tandaTangan))
+}
+
+func hmacSHA256(kunci []byte, data string) []byte {
+	h := hmac.New(sha256.New, kunci)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+var (
+	storageDefault     Storage
+	storageDefaultOnce sync.Once
+)
+
+// DirMediaLokal adalah folder storage lokal (MEDIA_DIR, default "image") yang disajikan di URLMediaLokal
+func DirMediaLokal() string {
+	if dir := os.Getenv("MEDIA_DIR"); dir != "" {
+		return dir
+	}
+	return "image"
+}
+
+// URLMediaLokal adalah URL dasar berkas storage lokal (MEDIA_URL, default "/image"). Router selalu
+// menyajikan folder media di /image, jadi MEDIA_URL cukup diisi domain API jika frontend di domain lain,
+// misalnya https://api.contoh.id/image.
+func URLMediaLokal() string {
+	if u := os.Getenv("MEDIA_URL"); u != "" {
+		return u
+	}
+	return "/image"
+}
+
+// DefaultStorage membangun storage dari .env: STORAGE_DRIVER=s3 memakai S3_*, selain itu disk lokal
+func DefaultStorage() Storage {
+	storageDefaultOnce.Do(func() {
+		if os.Getenv("STORAGE_DRIVER") == "s3" {
+			region := os.Getenv("S3_REGION")
+			if region == "" {
+				region = "us-east-1"
+			}
+			endpoint := os.Getenv("S3_ENDPOINT")
+			if endpoint == "" {
+				endpoint = "https://s3." + region + ".amazonaws.com"
+			}
+			storageDefault = &StorageS3{
+				Endpoint:  endpoint,
+				Region:    region,
+				Bucket:    os.Getenv("S3_BUCKET"),
+				AccessKey: os.Getenv("S3_ACCESS_KEY"),
+				SecretKey: os.Getenv("S3_SECRET_KEY"),
+				URLPublik: os.Getenv("S3_PUBLIC_URL"),
+				PathStyle: os.Getenv("S3_PATH_STYLE") == "true",
+			}
+			log.Printf("🗂️ Storage media: S3 bucket %s di %s", os.Getenv("S3_BUCKET"), endpoint)
+			return
+		}
+
+		storageDefault = NewStorageLokal(DirMediaLokal(), URLMediaLokal())
+		log.Printf("🗂️ Storage media: disk lokal %s", DirMediaLokal())
+	})
+	return storageDefault
+}
+
+// SetDefaultStorage mengganti storage default
+func SetDefaultStorage(s Storage) {
+	storageDefaultOnce.Do(func() {})
+	storageDefault = s
+}
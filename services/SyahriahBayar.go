@@ -0,0 +1,400 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"tpq_asysyafii/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrSyahriahTidakDitemukan      = errors.New("data syahriah tidak ditemukan")
+	ErrBayarTidakDitemukan         = errors.New("data pembayaran syahriah tidak ditemukan")
+	ErrNominalBayarTidakValid      = errors.New("nominal pembayaran harus lebih dari 0")
+	ErrBayarKreditTidakDapatDiubah = errors.New("baris kredit dikelola otomatis dari kelebihan bayar dan tidak dapat diubah manual")
+)
+
+// SyahriahBayarService mencatat cicilan syahriah, menurunkan statusnya dari total pembayaran,
+// dan memindahkan kelebihan bayar ke bulan berikutnya. Panggil di dalam transaksi.
+type SyahriahBayarService struct {
+	db *gorm.DB
+}
+
+func NewSyahriahBayarService(db *gorm.DB) *SyahriahBayarService {
+	return &SyahriahBayarService{db: db}
+}
+
+// BayarBaru adalah pembayaran yang akan dicatat
+type BayarBaru struct {
+	Nominal      float64
+	Metode       models.MetodeBayar
+	DiterimaOleh string // kosong untuk pembayaran online
+	WaktuBayar   time.Time
+	IDPembayaran string
+	Keterangan   string
+}
+
+// HasilBayar berisi pembayaran yang dicatat dan semua syahriah yang statusnya dihitung ulang,
+// termasuk syahriah bulan berikutnya yang menerima kredit
+type HasilBayar struct {
+	Bayar     models.SyahriahBayar
+	Syahriah  models.Syahriah
+	Terdampak []models.Syahriah
+}
+
+// StatusDariBayar menurunkan status syahriah dari nominal tagihan dan total yang sudah dibayar.
+// Tagihan bernilai 0 (santri dibebaskan) langsung lunas.
+func StatusDariBayar(nominal, dibayar float64) models.StatusSyahriah {
+	tagihan, bayar := keSen(nominal), keSen(dibayar)
+	switch {
+	case tagihan <= 0 && bayar == 0:
+		return models.StatusLunas
+	case bayar <= 0:
+		return models.StatusBelum
+	case bayar < tagihan:
+		return models.StatusSebagian
+	case bayar == tagihan:
+		return models.StatusLunas
+	default:
+		return models.StatusLebih
+	}
+}
+
+// SisaTagihan mengembalikan nominal yang belum dibayar (0 jika sudah lunas atau lebih)
+func SisaTagihan(syahriah models.Syahriah) float64 {
+	sisa := keSen(syahriah.Nominal) - keSen(syahriah.TotalBayar)
+	if sisa < 0 {
+		return 0
+	}
+	return float64(sisa) / 100
+}
+
+func (s *SyahriahBayarService) ambilTerkunci(idSyahriah string) (models.Syahriah, error) {
+	var syahriah models.Syahriah
+	err := s.db.Clauses(clause.Locking{Strength: "UPDATE"}).First(&syahriah, "id_syahriah = ?", idSyahriah).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return syahriah, ErrSyahriahTidakDitemukan
+	}
+	return syahriah, err
+}
+
+// Bayar mencatat satu pembayaran untuk syahriah beserta jurnalnya
+func (s *SyahriahBayarService) Bayar(idSyahriah string, baru BayarBaru, dicatatOleh string) (*HasilBayar, error) {
+	if keSen(baru.Nominal) <= 0 {
+		return nil, ErrNominalBayarTidakValid
+	}
+	if baru.Metode == models.BayarKredit {
+		return nil, ErrBayarKreditTidakDapatDiubah
+	}
+
+	syahriah, err := s.ambilTerkunci(idSyahriah)
+	if err != nil {
+		return nil, err
+	}
+
+	bayar := models.SyahriahBayar{
+		IDBayar:    uuid.New().String(),
+		IDSyahriah: syahriah.IDSyahriah,
+		Nominal:    baru.Nominal,
+		Metode:     baru.Metode,
+		WaktuBayar: baru.WaktuBayar,
+		Keterangan: baru.Keterangan,
+	}
+	if bayar.WaktuBayar.IsZero() {
+		bayar.WaktuBayar = time.Now()
+	}
+	if baru.DiterimaOleh != "" {
+		diterimaOleh := baru.DiterimaOleh
+		bayar.DiterimaOleh = &diterimaOleh
+	}
+	if baru.IDPembayaran != "" {
+		idPembayaran := baru.IDPembayaran
+		bayar.IDPembayaran = &idPembayaran
+	}
+
+	if err := s.db.Create(&bayar).Error; err != nil {
+		return nil, err
+	}
+	if err := NewLedgerService(s.db).CatatBayarSyahriah(bayar, syahriah.Bulan, dicatatOleh); err != nil {
+		return nil, err
+	}
+
+	var terdampak []models.Syahriah
+	if err := s.selaraskan(&syahriah, &terdampak); err != nil {
+		return nil, err
+	}
+	return &HasilBayar{Bayar: bayar, Syahriah: syahriah, Terdampak: unikSyahriah(terdampak)}, nil
+}
+
+// LunasiSisa mencatat pembayaran sebesar sisa tagihan sehingga syahriah menjadi lunas
+func (s *SyahriahBayarService) LunasiSisa(idSyahriah string, baru BayarBaru, dicatatOleh string) (*HasilBayar, error) {
+	syahriah, err := s.ambilTerkunci(idSyahriah)
+	if err != nil {
+		return nil, err
+	}
+	baru.Nominal = SisaTagihan(syahriah)
+	if baru.Nominal <= 0 {
+		return nil, ErrSyahriahSudahLunas
+	}
+	return s.Bayar(idSyahriah, baru, dicatatOleh)
+}
+
+// HapusBayar membatalkan satu pembayaran (misalnya salah input) dan membalik jurnalnya
+func (s *SyahriahBayarService) HapusBayar(idBayar, dicatatOleh string) (*HasilBayar, error) {
+	var bayar models.SyahriahBayar
+	if err := s.db.Clauses(clause.Locking{Strength: "UPDATE"}).First(&bayar, "id_bayar = ?", idBayar).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBayarTidakDitemukan
+		}
+		return nil, err
+	}
+	if bayar.Metode == models.BayarKredit {
+		return nil, ErrBayarKreditTidakDapatDiubah
+	}
+
+	syahriah, err := s.ambilTerkunci(bayar.IDSyahriah)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.Delete(&bayar).Error; err != nil {
+		return nil, err
+	}
+	if _, err := NewLedgerService(s.db).BatalkanSumber(TargetSyahriahBayar, bayar.IDBayar, dicatatOleh); err != nil {
+		return nil, err
+	}
+
+	var terdampak []models.Syahriah
+	if err := s.selaraskan(&syahriah, &terdampak); err != nil {
+		return nil, err
+	}
+	return &HasilBayar{Bayar: bayar, Syahriah: syahriah, Terdampak: unikSyahriah(terdampak)}, nil
+}
+
+// Selaraskan menghitung ulang status syahriah, misalnya setelah nominal tagihan diubah
+func (s *SyahriahBayarService) Selaraskan(idSyahriah string) ([]models.Syahriah, error) {
+	syahriah, err := s.ambilTerkunci(idSyahriah)
+	if err != nil {
+		return nil, err
+	}
+	var terdampak []models.Syahriah
+	if err := s.selaraskan(&syahriah, &terdampak); err != nil {
+		return nil, err
+	}
+	return unikSyahriah(terdampak), nil
+}
+
+// TerapkanKreditTertunda memindahkan kelebihan bayar santri yang tertahan karena syahriah bulan berikutnya
+// belum ada. Panggil setelah syahriah baru dibuat.
+func (s *SyahriahBayarService) TerapkanKreditTertunda(idSantri string) ([]models.Syahriah, error) {
+	var daftar []models.Syahriah
+	if err := s.db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id_santri = ? AND status = ?", idSantri, models.StatusLebih).
+		Order("bulan ASC").
+		Find(&daftar).Error; err != nil {
+		return nil, err
+	}
+
+	var terdampak []models.Syahriah
+	for i := range daftar {
+		if err := s.selaraskan(&daftar[i], &terdampak); err != nil {
+			return nil, err
+		}
+	}
+	return unikSyahriah(terdampak), nil
+}
+
+func (s *SyahriahBayarService) totalBayar(idSyahriah string) (int64, error) {
+	var total float64
+	err := s.db.Model(&models.SyahriahBayar{}).
+		Where("id_syahriah = ?", idSyahriah).
+		Select("COALESCE(SUM(nominal), 0)").
+		Scan(&total).Error
+	return keSen(total), err
+}
+
+// selaraskan menarik kembali kredit yang pernah dipindahkan dari syahriah ini, menghitung ulang total,
+// lalu memindahkan kelebihan (jika ada) ke syahriah bulan berikutnya milik santri yang sama.
+func (s *SyahriahBayarService) selaraskan(syahriah *models.Syahriah, terdampak *[]models.Syahriah) error {
+	var keluar []models.SyahriahBayar
+	if err := s.db.Where("id_syahriah = ? AND metode = ? AND nominal < 0", syahriah.IDSyahriah, models.BayarKredit).
+		Find(&keluar).Error; err != nil {
+		return err
+	}
+	for _, kredit := range keluar {
+		if err := s.db.Delete(&kredit).Error; err != nil {
+			return err
+		}
+		if kredit.IDSyahriahTerkait == nil {
+			continue
+		}
+		tujuan, err := s.ambilTerkunci(*kredit.IDSyahriahTerkait)
+		if errors.Is(err, ErrSyahriahTidakDitemukan) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.db.Where("id_syahriah = ? AND metode = ? AND id_syahriah_terkait = ?",
+			tujuan.IDSyahriah, models.BayarKredit, syahriah.IDSyahriah).
+			Delete(&models.SyahriahBayar{}).Error; err != nil {
+			return err
+		}
+		if err := s.selaraskan(&tujuan, terdampak); err != nil {
+			return err
+		}
+	}
+
+	total, err := s.totalBayar(syahriah.IDSyahriah)
+	if err != nil {
+		return err
+	}
+
+	if lebih := total - keSen(syahriah.Nominal); lebih > 0 {
+		var tujuan models.Syahriah
+		err := s.db.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id_santri = ? AND bulan > ?", syahriah.ID_Santri, syahriah.Bulan).
+			Order("bulan ASC").
+			First(&tujuan).Error
+		switch {
+		case err == nil:
+			if err := s.pindahkanKredit(*syahriah, tujuan, float64(lebih)/100); err != nil {
+				return err
+			}
+			total -= lebih
+			if err := s.selaraskan(&tujuan, terdampak); err != nil {
+				return err
+			}
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+	}
+
+	syahriah.TotalBayar = float64(total) / 100
+	syahriah.Status = StatusDariBayar(syahriah.Nominal, syahriah.TotalBayar)
+	if err := s.db.Model(&models.Syahriah{}).
+		Where("id_syahriah = ?", syahriah.IDSyahriah).
+		Updates(map[string]interface{}{"total_bayar": syahriah.TotalBayar, "status": syahriah.Status}).Error; err != nil {
+		return err
+	}
+	*terdampak = append(*terdampak, *syahriah)
+	return nil
+}
+
+func (s *SyahriahBayarService) pindahkanKredit(asal, tujuan models.Syahriah, nominal float64) error {
+	sekarang := time.Now()
+	idAsal, idTujuan := asal.IDSyahriah, tujuan.IDSyahriah
+	pasangan := []models.SyahriahBayar{
+		{
+			IDBayar:           uuid.New().String(),
+			IDSyahriah:        asal.IDSyahriah,
+			Nominal:           -nominal,
+			Metode:            models.BayarKredit,
+			WaktuBayar:        sekarang,
+			IDSyahriahTerkait: &idTujuan,
+			Keterangan:        "Kelebihan bayar dipindahkan ke bulan " + tujuan.Bulan,
+		},
+		{
+			IDBayar:           uuid.New().String(),
+			IDSyahriah:        tujuan.IDSyahriah,
+			Nominal:           nominal,
+			Metode:            models.BayarKredit,
+			WaktuBayar:        sekarang,
+			IDSyahriahTerkait: &idAsal,
+			Keterangan:        "Kelebihan bayar dari bulan " + asal.Bulan,
+		},
+	}
+	return s.db.Create(&pasangan).Error
+}
+
+// unikSyahriah membuang duplikat dan menyimpan keadaan terakhir tiap syahriah
+func unikSyahriah(daftar []models.Syahriah) []models.Syahriah {
+	posisi := make(map[string]int, len(daftar))
+	var hasil []models.Syahriah
+	for _, syahriah := range daftar {
+		if i, ok := posisi[syahriah.IDSyahriah]; ok {
+			hasil[i] = syahriah
+			continue
+		}
+		posisi[syahriah.IDSyahriah] = len(hasil)
+		hasil = append(hasil, syahriah)
+	}
+	return hasil
+}
+
+const (
+	migrasiBayarLama    = "bayar_syahriah_lama"
+	keteranganBayarLama = "Dicatat lunas sebelum ada pencatatan cicilan"
+)
+
+// MigrasiBayarLama membuat baris pembayaran untuk syahriah berbayar yang ditandai lunas sebelum ada pencatatan cicilan,
+// lalu memindahkan jurnalnya dari per-syahriah ke per-pembayaran. Migrasi hanya berjalan sekali dan ditandai di
+// tabel migrasi_data. Syahriah yang jurnalnya jatuh di periode tutup buku dilewati agar periode itu tidak berubah.
+func (s *SyahriahBayarService) MigrasiBayarLama() (int, error) {
+	var selesai int64
+	if err := s.db.Model(&models.MigrasiData{}).Where("nama = ?", migrasiBayarLama).Count(&selesai).Error; err != nil {
+		return 0, err
+	}
+	if selesai > 0 {
+		return 0, nil
+	}
+
+	// Syahriah yang dibebaskan (nominal 0) tidak menerima uang; buang pembayaran Rp0 yang sempat dibuat untuknya.
+	// Pembayaran Rp0 tidak pernah punya jurnal, jadi cukup dihapus barisnya.
+	if err := s.db.Where("nominal = 0 AND metode = ? AND keterangan = ?", models.BayarTunai, keteranganBayarLama).
+		Delete(&models.SyahriahBayar{}).Error; err != nil {
+		return 0, err
+	}
+
+	var daftar []models.Syahriah
+	if err := s.db.Where("status = ? AND nominal > 0 AND total_bayar = 0", models.StatusLunas).
+		Where("NOT EXISTS (SELECT 1 FROM syahriah_bayar WHERE syahriah_bayar.id_syahriah = syahriah.id_syahriah)").
+		Find(&daftar).Error; err != nil {
+		return 0, err
+	}
+
+	jumlah := 0
+	for _, syahriah := range daftar {
+		if err := CekPeriodeTerbuka(s.db, syahriah.Bulan, syahriah.WaktuCatat.Format("2006-01")); err != nil {
+			if errors.Is(err, ErrPeriodeDitutup) {
+				fmt.Printf("Syahriah %s tidak dimigrasi: %v\n", syahriah.IDSyahriah, err)
+				continue
+			}
+			return jumlah, err
+		}
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			diterimaOleh := syahriah.DicatatOleh
+			bayar := models.SyahriahBayar{
+				IDBayar:      uuid.New().String(),
+				IDSyahriah:   syahriah.IDSyahriah,
+				Nominal:      syahriah.Nominal,
+				Metode:       models.BayarTunai,
+				DiterimaOleh: &diterimaOleh,
+				WaktuBayar:   syahriah.WaktuCatat,
+				Keterangan:   keteranganBayarLama,
+			}
+			if err := tx.Create(&bayar).Error; err != nil {
+				return err
+			}
+			syahriah.TotalBayar = syahriah.Nominal
+			if err := tx.Model(&models.Syahriah{}).
+				Where("id_syahriah = ?", syahriah.IDSyahriah).
+				Update("total_bayar", syahriah.TotalBayar).Error; err != nil {
+				return err
+			}
+			return NewLedgerService(tx).CatatSyahriah(syahriah, syahriah.DicatatOleh)
+		})
+		if err != nil {
+			return jumlah, err
+		}
+		jumlah++
+	}
+
+	if err := s.db.Create(&models.MigrasiData{Nama: migrasiBayarLama, SelesaiPada: time.Now()}).Error; err != nil {
+		return jumlah, err
+	}
+	return jumlah, nil
+}
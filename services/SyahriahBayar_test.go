@@ -0,0 +1,101 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
+	"tpq_asysyafii/ujidb"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Migrasi pembayaran lama hanya memindahkan syahriah berbayar di periode terbuka, membuang pembayaran Rp0
+// yang sempat dibuat untuk syahriah bebas, dan tidak berjalan lagi setelah ditandai selesai.
+func TestMigrasiBayarLamaHanyaSekaliDanMelewatiSyahriahBebasSertaPeriodeTutup(t *testing.T) {
+	db := ujidb.Buka(t)
+	admin := ujidb.BuatUser(t, db, models.RoleAdmin)
+	wali := ujidb.BuatUser(t, db, models.RoleWali)
+	santri := models.Santri{
+		IDSantri:     uuid.New().String(),
+		IDWali:       wali.IDUser,
+		NamaLengkap:  "Santri Migrasi",
+		JenisKelamin: models.LakiLaki,
+		TanggalLahir: time.Now().AddDate(-8, 0, 0),
+		TanggalMasuk: time.Now(),
+	}
+	ujidb.Buat(t, db, &santri)
+
+	ditutup := models.RekapSaldo{IDSaldo: uuid.New().String(), Periode: "1991-05", Ditutup: true}
+	if err := db.Where("periode = ?", ditutup.Periode).Attrs(ditutup).FirstOrCreate(&ditutup).Error; err != nil {
+		t.Fatalf("gagal membuat rekap tutup buku: %v", err)
+	}
+	db.Model(&ditutup).Update("ditutup", true)
+
+	lunasLama := func(bulan string, nominal float64) models.Syahriah {
+		waktu, _ := time.Parse("2006-01", bulan)
+		syahriah := models.Syahriah{
+			IDSyahriah:  uuid.New().String(),
+			ID_Santri:   santri.IDSantri,
+			Bulan:       bulan,
+			Nominal:     nominal,
+			Status:      models.StatusLunas,
+			DicatatOleh: admin.IDUser,
+			WaktuCatat:  waktu.AddDate(0, 0, 9),
+		}
+		ujidb.Buat(t, db, &syahriah)
+		return syahriah
+	}
+	berbayar := lunasLama("1991-03", 50000)
+	bebas := lunasLama("1991-04", 0)
+	periodeTutup := lunasLama("1991-05", 50000)
+
+	// Pembayaran Rp0 seperti yang dibuat migrasi sebelum syahriah bebas dikecualikan
+	ujidb.Buat(t, db, &models.SyahriahBayar{
+		IDBayar:      uuid.New().String(),
+		IDSyahriah:   bebas.IDSyahriah,
+		Metode:       models.BayarTunai,
+		DiterimaOleh: &admin.IDUser,
+		WaktuBayar:   bebas.WaktuCatat,
+		Keterangan:   "Dicatat lunas sebelum ada pencatatan cicilan",
+	})
+
+	// Tanda selesai dari run test sebelumnya di database yang sama dibuang agar migrasi berjalan
+	db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&models.MigrasiData{})
+
+	service := services.NewSyahriahBayarService(db)
+	jumlah, err := service.MigrasiBayarLama()
+	if err != nil {
+		t.Fatalf("migrasi gagal: %v", err)
+	}
+	if jumlah < 1 {
+		t.Errorf("migrasi memindahkan %d syahriah, harapan minimal 1", jumlah)
+	}
+
+	bayarDari := func(syahriah models.Syahriah) []models.SyahriahBayar {
+		var daftar []models.SyahriahBayar
+		if err := db.Where("id_syahriah = ?", syahriah.IDSyahriah).Find(&daftar).Error; err != nil {
+			t.Fatalf("gagal membaca pembayaran: %v", err)
+		}
+		return daftar
+	}
+	if daftar := bayarDari(berbayar); len(daftar) != 1 || daftar[0].Nominal != berbayar.Nominal {
+		t.Errorf("syahriah berbayar punya pembayaran %+v, harapan satu pembayaran Rp%.0f", daftar, berbayar.Nominal)
+	}
+	if daftar := bayarDari(bebas); len(daftar) != 0 {
+		t.Errorf("syahriah bebas masih punya %d pembayaran", len(daftar))
+	}
+	if daftar := bayarDari(periodeTutup); len(daftar) != 0 {
+		t.Errorf("syahriah di periode tutup buku dimigrasi: %+v", daftar)
+	}
+
+	// Run berikutnya tidak memproses syahriah lunas lama yang muncul setelah migrasi selesai
+	baru := lunasLama("1991-06", 50000)
+	if jumlah, err := service.MigrasiBayarLama(); err != nil || jumlah != 0 {
+		t.Errorf("migrasi kedua: jumlah %d, error %v, harapan 0 tanpa error", jumlah, err)
+	}
+	if daftar := bayarDari(baru); len(daftar) != 0 {
+		t.Errorf("migrasi kedua tetap membuat pembayaran: %+v", daftar)
+	}
+}
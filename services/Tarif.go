@@ -0,0 +1,282 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"tpq_asysyafii/models"
+
+	"gorm.io/gorm"
+)
+
+// TarifDasarBawaan dipakai jika belum ada tarif dasar yang berlaku untuk suatu bulan
+const TarifDasarBawaan = 110000.0
+
+var ErrAturanTarifTidakValid = errors.New("aturan tarif tidak valid")
+
+// HasilTarif adalah nominal syahriah satu santri beserta asal perhitungannya
+type HasilTarif struct {
+	IDSantri     string  `json:"id_santri"`
+	Bulan        string  `json:"bulan"`
+	NominalDasar float64 `json:"nominal_dasar"`
+	Nominal      float64 `json:"nominal"`
+	IDTarif      *string `json:"id_tarif"`  // nil jika memakai tarif bawaan atau nominal manual
+	IDAturan     *string `json:"id_aturan"` // nil jika tidak ada aturan yang berlaku
+	AnakKe       int     `json:"anak_ke"`
+	Rincian      string  `json:"rincian"`
+}
+
+// Terapkan mengisi nominal syahriah dan catatan asal tarifnya
+func (h HasilTarif) Terapkan(syahriah *models.Syahriah) {
+	syahriah.Nominal = h.Nominal
+	syahriah.NominalDasar = h.NominalDasar
+	syahriah.IDTarif = h.IDTarif
+	syahriah.IDAturan = h.IDAturan
+	syahriah.RincianTarif = h.Rincian
+}
+
+type TarifService struct {
+	db *gorm.DB
+}
+
+func NewTarifService(db *gorm.DB) *TarifService {
+	return &TarifService{db: db}
+}
+
+// ValidasiAturanTarif memeriksa kelengkapan aturan sebelum disimpan
+func ValidasiAturanTarif(aturan *models.AturanTarif) error {
+	tidakValid := func(pesan string) error {
+		return fmt.Errorf("%w: %s", ErrAturanTarifTidakValid, pesan)
+	}
+
+	switch aturan.Jenis {
+	case models.AturanPotonganPersen:
+		if aturan.Nilai <= 0 || aturan.Nilai > 100 {
+			return tidakValid("potongan persen harus di antara 0 dan 100")
+		}
+	case models.AturanPotonganNominal:
+		if aturan.Nilai <= 0 {
+			return tidakValid("potongan nominal harus lebih dari 0")
+		}
+	case models.AturanBebas:
+		aturan.Nilai = 0
+	default:
+		return tidakValid("jenis harus potongan_persen, potongan_nominal, atau bebas")
+	}
+
+	switch aturan.Cakupan {
+	case models.CakupanSantri:
+		if aturan.IDSantri == nil || *aturan.IDSantri == "" {
+			return tidakValid("id_santri wajib diisi untuk cakupan santri")
+		}
+		aturan.IDKeluarga = nil
+		aturan.MulaiAnakKe = 1
+	case models.CakupanKeluarga:
+		if aturan.IDKeluarga == nil || *aturan.IDKeluarga == "" {
+			return tidakValid("id_keluarga wajib diisi untuk cakupan keluarga")
+		}
+		aturan.IDSantri = nil
+		if aturan.MulaiAnakKe < 1 {
+			aturan.MulaiAnakKe = 1
+		}
+	default:
+		return tidakValid("cakupan harus santri atau keluarga")
+	}
+
+	if _, err := time.Parse("2006-01", aturan.BerlakuMulai); err != nil {
+		return tidakValid("format berlaku_mulai harus YYYY-MM")
+	}
+	if aturan.BerlakuSampai != nil && *aturan.BerlakuSampai == "" {
+		aturan.BerlakuSampai = nil
+	}
+	if aturan.BerlakuSampai != nil {
+		if _, err := time.Parse("2006-01", *aturan.BerlakuSampai); err != nil {
+			return tidakValid("format berlaku_sampai harus YYYY-MM")
+		}
+		if *aturan.BerlakuSampai < aturan.BerlakuMulai {
+			return tidakValid("berlaku_sampai tidak boleh sebelum berlaku_mulai")
+		}
+	}
+	return nil
+}
+
+// TarifDasar mengembalikan tarif dasar terbaru yang berlaku mulai bulan tersebut atau sebelumnya.
+// Tarif bernilai nil berarti belum ada tarif yang diatur dan TarifDasarBawaan dipakai.
+func (s *TarifService) TarifDasar(bulan string) (float64, *models.TarifDasar, error) {
+	var tarif models.TarifDasar
+	err := s.db.Where("berlaku_mulai <= ?", bulan).Order("berlaku_mulai DESC").First(&tarif).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return TarifDasarBawaan, nil, nil
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	return tarif.Nominal, &tarif, nil
+}
+
+// Hitung menghitung nominal syahriah satu santri untuk bulan tertentu
+func (s *TarifService) Hitung(santri models.Santri, bulan string) (HasilTarif, error) {
+	hasil, err := s.HitungBanyak([]models.Santri{santri}, bulan, nil)
+	if err != nil {
+		return HasilTarif{}, err
+	}
+	return hasil[santri.IDSantri], nil
+}
+
+// HitungBanyak menghitung nominal syahriah untuk banyak santri sekaligus.
+// nominalDasar menggantikan tarif dasar periode jika diisi; aturan potongan tetap diterapkan.
+// Jika beberapa aturan berlaku, dipakai aturan yang menghasilkan nominal terkecil (potongan tidak ditumpuk).
+func (s *TarifService) HitungBanyak(santriList []models.Santri, bulan string, nominalDasar *float64) (map[string]HasilTarif, error) {
+	hasil := make(map[string]HasilTarif, len(santriList))
+	if len(santriList) == 0 {
+		return hasil, nil
+	}
+
+	dasar := TarifDasarBawaan
+	var idTarif *string
+	rincianDasar := fmt.Sprintf("Tarif dasar bawaan Rp%.0f", dasar)
+	if nominalDasar != nil {
+		dasar = *nominalDasar
+		rincianDasar = fmt.Sprintf("Tarif dasar Rp%.0f (diisi manual)", dasar)
+	} else {
+		nominal, tarif, err := s.TarifDasar(bulan)
+		if err != nil {
+			return nil, err
+		}
+		if tarif != nil {
+			dasar, idTarif = nominal, &tarif.IDTarif
+			rincianDasar = fmt.Sprintf("Tarif dasar Rp%.0f (berlaku mulai %s)", dasar, tarif.BerlakuMulai)
+		}
+	}
+
+	var aturanList []models.AturanTarif
+	if err := s.db.Where("aktif = ? AND berlaku_mulai <= ? AND (berlaku_sampai IS NULL OR berlaku_sampai >= ?)", true, bulan, bulan).
+		Order("dibuat_pada ASC").Find(&aturanList).Error; err != nil {
+		return nil, err
+	}
+
+	// Keluarga dikenali lewat wali; urutan anak dihitung dari santri aktif dengan wali yang sama
+	waliKeluarga := make(map[string]string)
+	var idKeluarga []string
+	for _, aturan := range aturanList {
+		if aturan.IDKeluarga != nil {
+			idKeluarga = append(idKeluarga, *aturan.IDKeluarga)
+		}
+	}
+	if len(idKeluarga) > 0 {
+		var keluargaList []models.Keluarga
+		if err := s.db.Where("id_keluarga IN ?", idKeluarga).Find(&keluargaList).Error; err != nil {
+			return nil, err
+		}
+		for _, keluarga := range keluargaList {
+			waliKeluarga[keluarga.IDKeluarga] = keluarga.IDWali
+		}
+	}
+
+	anakKe, err := s.urutanAnak(santriList)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, santri := range santriList {
+		h := HasilTarif{
+			IDSantri:     santri.IDSantri,
+			Bulan:        bulan,
+			NominalDasar: dasar,
+			Nominal:      dasar,
+			IDTarif:      idTarif,
+			AnakKe:       anakKe[santri.IDSantri],
+			Rincian:      rincianDasar,
+		}
+		for i := range aturanList {
+			aturan := aturanList[i]
+			if !aturanBerlakuUntuk(aturan, santri, h.AnakKe, waliKeluarga) {
+				continue
+			}
+			if nominal := nominalSetelahAturan(aturan, dasar); nominal < h.Nominal {
+				h.Nominal = nominal
+				h.IDAturan = &aturanList[i].IDAturan
+				h.Rincian = rincianDasar + "; " + rincianAturan(aturan)
+			}
+		}
+		hasil[santri.IDSantri] = h
+	}
+	return hasil, nil
+}
+
+// urutanAnak mengurutkan santri aktif per wali dari yang tertua. Santri yang tidak aktif
+// dianggap anak setelah semua saudaranya yang aktif.
+func (s *TarifService) urutanAnak(santriList []models.Santri) (map[string]int, error) {
+	var idWali []string
+	for _, santri := range santriList {
+		idWali = append(idWali, santri.IDWali)
+	}
+
+	var saudara []models.Santri
+	if err := s.db.Select("id_santri", "id_wali").
+		Where("id_wali IN ? AND status = ?", idWali, models.StatusAktifSantri).
+		Order("tanggal_lahir ASC, id_santri ASC").Find(&saudara).Error; err != nil {
+		return nil, err
+	}
+
+	urutan := make(map[string]int, len(saudara))
+	jumlah := make(map[string]int)
+	for _, santri := range saudara {
+		jumlah[santri.IDWali]++
+		urutan[santri.IDSantri] = jumlah[santri.IDWali]
+	}
+	for _, santri := range santriList {
+		if _, ok := urutan[santri.IDSantri]; !ok {
+			urutan[santri.IDSantri] = jumlah[santri.IDWali] + 1
+		}
+	}
+	return urutan, nil
+}
+
+func aturanBerlakuUntuk(aturan models.AturanTarif, santri models.Santri, anakKe int, waliKeluarga map[string]string) bool {
+	switch aturan.Cakupan {
+	case models.CakupanSantri:
+		return aturan.IDSantri != nil && *aturan.IDSantri == santri.IDSantri
+	case models.CakupanKeluarga:
+		if aturan.IDKeluarga == nil {
+			return false
+		}
+		wali, ok := waliKeluarga[*aturan.IDKeluarga]
+		return ok && wali == santri.IDWali && anakKe >= aturan.MulaiAnakKe
+	}
+	return false
+}
+
+func nominalSetelahAturan(aturan models.AturanTarif, dasar float64) float64 {
+	var nominal int64
+	switch aturan.Jenis {
+	case models.AturanBebas:
+		return 0
+	case models.AturanPotonganPersen:
+		nominal = keSen(dasar * (100 - aturan.Nilai) / 100)
+	case models.AturanPotonganNominal:
+		nominal = keSen(dasar) - keSen(aturan.Nilai)
+	default:
+		return dasar
+	}
+	if nominal < 0 {
+		nominal = 0
+	}
+	return float64(nominal) / 100
+}
+
+func rincianAturan(aturan models.AturanTarif) string {
+	var potongan string
+	switch aturan.Jenis {
+	case models.AturanBebas:
+		potongan = "dibebaskan"
+	case models.AturanPotonganPersen:
+		potongan = fmt.Sprintf("potongan %g%%", aturan.Nilai)
+	case models.AturanPotonganNominal:
+		potongan = fmt.Sprintf("potongan Rp%.0f", aturan.Nilai)
+	}
+	if aturan.Cakupan == models.CakupanKeluarga && aturan.MulaiAnakKe > 1 {
+		potongan += fmt.Sprintf(" mulai anak ke-%d", aturan.MulaiAnakKe)
+	}
+	return fmt.Sprintf("%s: %s", aturan.Nama, potongan)
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"errors"
+	"time"
+	"tpq_asysyafii/models"
+	"tpq_asysyafii/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrRefreshTokenTidakValid   = errors.New("refresh token tidak valid")
+	ErrRefreshTokenKadaluarsa   = errors.New("refresh token sudah kadaluarsa")
+	ErrRefreshTokenDipakaiUlang = errors.New("refresh token sudah pernah dipakai, semua token sesi ini dicabut")
+	ErrTokenDicabut             = errors.New("token sudah dicabut")
+	ErrUserTidakAktif           = errors.New("akun tidak aktif")
+)
+
+// TokenService mengelola access token (JWT berumur pendek) dan refresh token yang disimpan di server
+type TokenService struct {
+	db *gorm.DB
+}
+
+func NewTokenService(db *gorm.DB) *TokenService {
+	return &TokenService{db: db}
+}
+
+// PasanganToken adalah hasil login atau refresh
+type PasanganToken struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // detik
+}
+
+// buatRefreshToken menyimpan refresh token baru (hanya hash) untuk sesi tertentu
+func (s *TokenService) buatRefreshToken(tx *gorm.DB, user models.User, idSesi, userAgent, ip string) (models.RefreshToken, string, error) {
+	plain, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return models.RefreshToken{}, "", err
+	}
+
+	token := models.RefreshToken{
+		IDToken:        uuid.New().String(),
+		IDSesi:         idSesi,
+		IDUser:         user.IDUser,
+		TokenHash:      utils.HashToken(plain),
+		KadaluarsaPada: time.Now().Add(utils.RefreshTokenTTL),
+		UserAgent:      potong(userAgent, 255),
+		IPAddress:      potong(ip, 45),
+	}
+	if err := tx.Omit(clause.Associations).Create(&token).Error; err != nil {
+		return models.RefreshToken{}, "", err
+	}
+	return token, plain, nil
+}
+
+func (s *TokenService) buatPasangan(user models.User, idSesi, refreshPlain string) (*PasanganToken, error) {
+	access, err := utils.GenerateJWT(user.IDUser, string(user.Role), idSesi, user.VersiToken)
+	if err != nil {
+		return nil, err
+	}
+	return &PasanganToken{
+		AccessToken:  access,
+		RefreshToken: refreshPlain,
+		ExpiresIn:    int64(utils.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// BuatSesi membuat sesi login baru dan mengembalikan access token + refresh token
+func (s *TokenService) BuatSesi(user models.User, userAgent, ip string) (*PasanganToken, error) {
+	idSesi := uuid.New().String()
+	_, plain, err := s.buatRefreshToken(s.db, user, idSesi, userAgent, ip)
+	if err != nil {
+		return nil, err
+	}
+	return s.buatPasangan(user, idSesi, plain)
+}
+
+// Rotasi menukar refresh token dengan pasangan token baru. Refresh token lama langsung dicabut;
+// jika token yang sudah dicabut dipakai lagi, seluruh sesi dianggap bocor dan ikut dicabut.
+func (s *TokenService) Rotasi(refreshPlain, userAgent, ip string) (*PasanganToken, error) {
+	var hasil *PasanganToken
+	var errDipakaiUlang error
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var lama models.RefreshToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", utils.HashToken(refreshPlain)).
+			First(&lama).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRefreshTokenTidakValid
+			}
+			return err
+		}
+
+		if lama.DicabutPada != nil {
+			// Pencabutan sesi harus tetap tersimpan, jadi dilakukan di luar transaksi yang di-rollback
+			errDipakaiUlang = ErrRefreshTokenDipakaiUlang
+			return nil
+		}
+		if time.Now().After(lama.KadaluarsaPada) {
+			return ErrRefreshTokenKadaluarsa
+		}
+
+		var user models.User
+		if err := tx.First(&user, "id_user = ?", lama.IDUser).Error; err != nil {
+			return ErrRefreshTokenTidakValid
+		}
+		if !user.StatusAktif {
+			return ErrUserTidakAktif
+		}
+
+		baru, plain, err := s.buatRefreshToken(tx, user, lama.IDSesi, userAgent, ip)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if err := tx.Model(&models.RefreshToken{}).
+			Where("id_token = ?", lama.IDToken).
+			Updates(map[string]interface{}{"dicabut_pada": now, "diganti_oleh": baru.IDToken}).Error; err != nil {
+			return err
+		}
+
+		hasil, err = s.buatPasangan(user, lama.IDSesi, plain)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if errDipakaiUlang != nil {
+		var lama models.RefreshToken
+		if err := s.db.Where("token_hash = ?", utils.HashToken(refreshPlain)).First(&lama).Error; err == nil {
+			s.CabutSesi(lama.IDSesi)
+		}
+		return nil, errDipakaiUlang
+	}
+	return hasil, nil
+}
+
+// CabutSesi mencabut semua refresh token dalam satu sesi (logout perangkat ini)
+func (s *TokenService) CabutSesi(idSesi string) error {
+	return s.db.Model(&models.RefreshToken{}).
+		Where("id_sesi = ? AND dicabut_pada IS NULL", idSesi).
+		Update("dicabut_pada", time.Now()).Error
+}
+
+// CabutSemua mencabut semua refresh token user dan menaikkan versi token
+// sehingga access token yang masih berlaku ikut ditolak (logout semua perangkat)
+func (s *TokenService) CabutSemua(idUser string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.RefreshToken{}).
+			Where("id_user = ? AND dicabut_pada IS NULL", idUser).
+			Update("dicabut_pada", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).
+			Where("id_user = ?", idUser).
+			UpdateColumn("versi_token", gorm.Expr("versi_token + 1")).Error
+	})
+}
+
+// ValidasiAkses memeriksa access token terhadap kondisi terbaru di server:
+// user masih ada dan aktif, versi token belum dicabut, dan sesinya belum logout.
+func (s *TokenService) ValidasiAkses(claims jwt.MapClaims) (*models.User, error) {
+	userID, _ := claims["user_id"].(string)
+	if userID == "" {
+		return nil, ErrTokenDicabut
+	}
+
+	var user models.User
+	if err := s.db.First(&user, "id_user = ?", userID).Error; err != nil {
+		return nil, ErrTokenDicabut
+	}
+	if !user.StatusAktif {
+		return nil, ErrUserTidakAktif
+	}
+
+	// Token tanpa ver atau sid diterbitkan sebelum ada pencabutan per sesi, jadi tidak diterima lagi
+	versi, ok := claims["ver"].(float64)
+	if !ok || int(versi) != user.VersiToken {
+		return nil, ErrTokenDicabut
+	}
+
+	idSesi, _ := claims["sid"].(string)
+	if idSesi == "" {
+		return nil, ErrTokenDicabut
+	}
+	var aktif int64
+	if err := s.db.Model(&models.RefreshToken{}).
+		Where("id_sesi = ? AND dicabut_pada IS NULL", idSesi).
+		Count(&aktif).Error; err != nil {
+		return nil, err
+	}
+	if aktif == 0 {
+		return nil, ErrTokenDicabut
+	}
+
+	return &user, nil
+}
+
+func potong(teks string, maks int) string {
+	if len(teks) > maks {
+		return teks[:maks]
+	}
+	return teks
+}
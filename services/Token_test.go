@@ -0,0 +1,54 @@
+package services_test
+
+import (
+	"errors"
+	"testing"
+	"tpq_asysyafii/models"
+	"tpq_asysyafii/services"
+	"tpq_asysyafii/ujidb"
+	"tpq_asysyafii/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Access token wajib membawa sid dan ver; token lama tanpa keduanya tidak bisa dicabut per sesi
+// sehingga ditolak, baik saat diverifikasi maupun saat dicocokkan ke server.
+func TestAksesTokenTanpaSesiAtauVersiDitolak(t *testing.T) {
+	db := ujidb.Buka(t)
+	user := ujidb.BuatUser(t, db, models.RoleWali)
+	service := services.NewTokenService(db)
+
+	pasangan, err := service.BuatSesi(user, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("gagal membuat sesi: %v", err)
+	}
+	claims, err := utils.VerifyToken(pasangan.AccessToken)
+	if err != nil {
+		t.Fatalf("token sesi baru ditolak: %v", err)
+	}
+	if _, err := service.ValidasiAkses(claims); err != nil {
+		t.Fatalf("token sesi baru ditolak server: %v", err)
+	}
+
+	tanpaSesi, err := utils.GenerateJWT(user.IDUser, string(user.Role), "", user.VersiToken)
+	if err != nil {
+		t.Fatalf("gagal membuat token: %v", err)
+	}
+	if _, err := utils.VerifyToken(tanpaSesi); err == nil {
+		t.Error("token tanpa sid harus ditolak VerifyToken")
+	}
+
+	tests := []struct {
+		nama   string
+		claims jwt.MapClaims
+	}{
+		{"tanpa ver", jwt.MapClaims{"user_id": user.IDUser, "sid": claims["sid"]}},
+		{"tanpa sid", jwt.MapClaims{"user_id": user.IDUser, "ver": claims["ver"]}},
+		{"tanpa keduanya", jwt.MapClaims{"user_id": user.IDUser}},
+	}
+	for _, tt := range tests {
+		if _, err := service.ValidasiAkses(tt.claims); !errors.Is(err, services.ErrTokenDicabut) {
+			t.Errorf("%s: galat %v, harapan %v", tt.nama, err, services.ErrTokenDicabut)
+		}
+	}
+}
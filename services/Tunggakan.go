@@ -0,0 +1,231 @@
+package services
+
+import (
+	"sort"
+	"time"
+	"tpq_asysyafii/models"
+
+	"gorm.io/gorm"
+)
+
+// Kelompok umur tunggakan berdasarkan jumlah bulan yang belum lunas
+const (
+	Umur1Bulan     = "1"
+	Umur2Sampai3   = "2-3"
+	UmurLebihDari3 = ">3"
+)
+
+// KelompokUmurTunggakan menentukan kelompok umur dari jumlah bulan tertunggak
+func KelompokUmurTunggakan(jumlahBulan int) string {
+	switch {
+	case jumlahBulan <= 1:
+		return Umur1Bulan
+	case jumlahBulan <= 3:
+		return Umur2Sampai3
+	default:
+		return UmurLebihDari3
+	}
+}
+
+type BulanTertunggak struct {
+	IDSyahriah string                `json:"id_syahriah"`
+	Bulan      string                `json:"bulan"`
+	Nominal    float64               `json:"nominal"`
+	TotalBayar float64               `json:"total_bayar"`
+	Sisa       float64               `json:"sisa"`
+	Status     models.StatusSyahriah `json:"status"`
+}
+
+type TunggakanSantri struct {
+	IDSantri       string            `json:"id_santri"`
+	NamaSantri     string            `json:"nama_santri"`
+	StatusSantri   string            `json:"status_santri"`
+	IDWali         string            `json:"id_wali"`
+	NamaWali       string            `json:"nama_wali"`
+	JumlahBulan    int               `json:"jumlah_bulan"`
+	TotalTunggakan float64           `json:"total_tunggakan"`
+	BulanTertua    string            `json:"bulan_tertua"`
+	KelompokUmur   string            `json:"kelompok_umur"`
+	Rincian        []BulanTertunggak `json:"rincian"`
+}
+
+// TunggakanKeluarga menggabungkan tunggakan semua santri dengan wali yang sama
+type TunggakanKeluarga struct {
+	IDWali         string            `json:"id_wali"`
+	NamaWali       string            `json:"nama_wali"`
+	NoTelp         string            `json:"no_telp"`
+	Email          *string           `json:"email,omitempty"`
+	IDKeluarga     *string           `json:"id_keluarga,omitempty"`
+	Alamat         string            `json:"alamat"`
+	JumlahSantri   int               `json:"jumlah_santri"`
+	JumlahBulan    int               `json:"jumlah_bulan"` // bulan tertunggak terbanyak di antara santrinya
+	TotalTunggakan float64           `json:"total_tunggakan"`
+	KelompokUmur   string            `json:"kelompok_umur"`
+	Santri         []TunggakanSantri `json:"santri"`
+}
+
+type RingkasanUmur struct {
+	KelompokUmur   string  `json:"kelompok_umur"`
+	JumlahSantri   int     `json:"jumlah_santri"`
+	TotalTunggakan float64 `json:"total_tunggakan"`
+}
+
+// LaporanTunggakan adalah syahriah yang belum lunas dari bulan-bulan sebelum periode Per
+type LaporanTunggakan struct {
+	Per            string              `json:"per"`
+	JumlahSantri   int                 `json:"jumlah_santri"`
+	JumlahKeluarga int                 `json:"jumlah_keluarga"`
+	TotalTunggakan float64             `json:"total_tunggakan"`
+	Umur           []RingkasanUmur     `json:"umur"`
+	Santri         []TunggakanSantri   `json:"santri"`
+	Keluarga       []TunggakanKeluarga `json:"keluarga"`
+}
+
+type TunggakanService struct {
+	db *gorm.DB
+}
+
+func NewTunggakanService(db *gorm.DB) *TunggakanService {
+	return &TunggakanService{db: db}
+}
+
+// Laporan menyusun tunggakan per santri dan per keluarga. Syahriah dianggap tertunggak jika
+// belum lunas dan bulannya sudah lewat (bulan < per). idWali membatasi laporan ke satu wali.
+func (s *TunggakanService) Laporan(per, idWali string) (*LaporanTunggakan, error) {
+	if per == "" {
+		per = time.Now().Format("2006-01")
+	}
+
+	query := s.db.Preload("Santri").Preload("Santri.Wali").
+		Joins("JOIN santri ON santri.id_santri = syahriah.id_santri").
+		Where("syahriah.status IN ? AND syahriah.bulan < ?", []models.StatusSyahriah{models.StatusBelum, models.StatusSebagian}, per)
+	if idWali != "" {
+		query = query.Where("santri.id_wali = ?", idWali)
+	}
+	var syahriahList []models.Syahriah
+	if err := query.Order("syahriah.bulan ASC").Find(&syahriahList).Error; err != nil {
+		return nil, err
+	}
+
+	perSantri := make(map[string]*TunggakanSantri)
+	var urutanSantri []string
+	for _, syahriah := range syahriahList {
+		sisa := SisaTagihan(syahriah)
+		if sisa <= 0 {
+			continue
+		}
+		t, ok := perSantri[syahriah.ID_Santri]
+		if !ok {
+			t = &TunggakanSantri{
+				IDSantri:     syahriah.ID_Santri,
+				NamaSantri:   syahriah.Santri.NamaLengkap,
+				StatusSantri: string(syahriah.Santri.Status),
+				IDWali:       syahriah.Santri.IDWali,
+				NamaWali:     syahriah.Santri.Wali.NamaLengkap,
+				BulanTertua:  syahriah.Bulan,
+			}
+			perSantri[syahriah.ID_Santri] = t
+			urutanSantri = append(urutanSantri, syahriah.ID_Santri)
+		}
+		t.JumlahBulan++
+		t.TotalTunggakan = float64(keSen(t.TotalTunggakan)+keSen(sisa)) / 100
+		t.Rincian = append(t.Rincian, BulanTertunggak{
+			IDSyahriah: syahriah.IDSyahriah,
+			Bulan:      syahriah.Bulan,
+			Nominal:    syahriah.Nominal,
+			TotalBayar: syahriah.TotalBayar,
+			Sisa:       sisa,
+			Status:     syahriah.Status,
+		})
+	}
+
+	laporan := &LaporanTunggakan{Per: per, Santri: []TunggakanSantri{}, Keluarga: []TunggakanKeluarga{}}
+	umur := map[string]*RingkasanUmur{
+		Umur1Bulan:     {KelompokUmur: Umur1Bulan},
+		Umur2Sampai3:   {KelompokUmur: Umur2Sampai3},
+		UmurLebihDari3: {KelompokUmur: UmurLebihDari3},
+	}
+	perWali := make(map[string]*TunggakanKeluarga)
+	var urutanWali []string
+	for _, id := range urutanSantri {
+		t := perSantri[id]
+		t.KelompokUmur = KelompokUmurTunggakan(t.JumlahBulan)
+		laporan.Santri = append(laporan.Santri, *t)
+		laporan.TotalTunggakan = float64(keSen(laporan.TotalTunggakan)+keSen(t.TotalTunggakan)) / 100
+
+		u := umur[t.KelompokUmur]
+		u.JumlahSantri++
+		u.TotalTunggakan = float64(keSen(u.TotalTunggakan)+keSen(t.TotalTunggakan)) / 100
+
+		k, ok := perWali[t.IDWali]
+		if !ok {
+			k = &TunggakanKeluarga{IDWali: t.IDWali, NamaWali: t.NamaWali}
+			perWali[t.IDWali] = k
+			urutanWali = append(urutanWali, t.IDWali)
+		}
+		k.JumlahSantri++
+		k.TotalTunggakan = float64(keSen(k.TotalTunggakan)+keSen(t.TotalTunggakan)) / 100
+		if t.JumlahBulan > k.JumlahBulan {
+			k.JumlahBulan = t.JumlahBulan
+		}
+		k.Santri = append(k.Santri, *t)
+	}
+
+	if len(urutanWali) > 0 {
+		var waliList []models.User
+		if err := s.db.Where("id_user IN ?", urutanWali).Find(&waliList).Error; err != nil {
+			return nil, err
+		}
+		var keluargaList []models.Keluarga
+		if err := s.db.Where("id_wali IN ?", urutanWali).Find(&keluargaList).Error; err != nil {
+			return nil, err
+		}
+		for _, wali := range waliList {
+			perWali[wali.IDUser].NoTelp = wali.NoTelp
+			perWali[wali.IDUser].Email = wali.Email
+		}
+		for i := range keluargaList {
+			if k := perWali[keluargaList[i].IDWali]; k.IDKeluarga == nil {
+				k.IDKeluarga = &keluargaList[i].IDKeluarga
+				k.Alamat = keluargaList[i].Alamat
+			}
+		}
+	}
+	for _, id := range urutanWali {
+		k := perWali[id]
+		k.KelompokUmur = KelompokUmurTunggakan(k.JumlahBulan)
+		laporan.Keluarga = append(laporan.Keluarga, *k)
+	}
+
+	// Tunggakan terbesar lebih dulu
+	sort.SliceStable(laporan.Santri, func(i, j int) bool {
+		return laporan.Santri[i].TotalTunggakan > laporan.Santri[j].TotalTunggakan
+	})
+	sort.SliceStable(laporan.Keluarga, func(i, j int) bool {
+		return laporan.Keluarga[i].TotalTunggakan > laporan.Keluarga[j].TotalTunggakan
+	})
+
+	laporan.JumlahSantri = len(laporan.Santri)
+	laporan.JumlahKeluarga = len(laporan.Keluarga)
+	for _, kelompok := range []string{Umur1Bulan, Umur2Sampai3, UmurLebihDari3} {
+		laporan.Umur = append(laporan.Umur, *umur[kelompok])
+	}
+	return laporan, nil
+}
+
+// SaringUmur menyisakan santri dan keluarga pada kelompok umur tertentu
+func (l *LaporanTunggakan) SaringUmur(kelompok string) {
+	santri := l.Santri[:0]
+	for _, t := range l.Santri {
+		if t.KelompokUmur == kelompok {
+			santri = append(santri, t)
+		}
+	}
+	keluarga := l.Keluarga[:0]
+	for _, k := range l.Keluarga {
+		if k.KelompokUmur == kelompok {
+			keluarga = append(keluarga, k)
+		}
+	}
+	l.Santri, l.Keluarga = santri, keluarga
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"tpq_asysyafii/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPeriodeDitutup           = errors.New("periode sudah tutup buku")
+	ErrPeriodeBelumDitutup      = errors.New("periode belum tutup buku")
+	ErrPeriodeBelumBerakhir     = errors.New("hanya periode yang sudah berakhir yang dapat ditutup")
+	ErrPeriodeSebelumnyaTerbuka = errors.New("periode sebelumnya belum tutup buku")
+	ErrBukanTutupBukuTerakhir   = errors.New("hanya periode tutup buku terakhir yang dapat dibuka kembali")
+)
+
+// CekPeriodeTerbuka mengembalikan ErrPeriodeDitutup jika salah satu periode sudah tutup buku
+func CekPeriodeTerbuka(db *gorm.DB, periode ...string) error {
+	if len(periode) == 0 {
+		return nil
+	}
+	var ditutup []string
+	if err := db.Model(&models.RekapSaldo{}).
+		Where("periode IN ? AND ditutup = ?", periode, true).
+		Distinct("periode").
+		Order("periode ASC").
+		Pluck("periode", &ditutup).Error; err != nil {
+		return err
+	}
+	if len(ditutup) > 0 {
+		return fmt.Errorf("%w: %s, catat koreksi di periode berjalan", ErrPeriodeDitutup, strings.Join(ditutup, ", "))
+	}
+	return nil
+}
+
+// TutupBukuService menutup periode yang laporannya sudah final. Penutupan berurutan dari periode
+// paling awal dan pembukaan kembali dari periode terakhir, karena saldo akhir setiap periode
+// terbawa ke periode berikutnya.
+type TutupBukuService struct {
+	db *gorm.DB
+}
+
+func NewTutupBukuService(db *gorm.DB) *TutupBukuService {
+	return &TutupBukuService{db: db}
+}
+
+// Tutup menghitung ulang rekap periode dari jurnal lalu menandainya ditutup
+func (s *TutupBukuService) Tutup(periode, oleh string) (*models.RekapSaldo, error) {
+	if _, err := time.Parse("2006-01", periode); err != nil {
+		return nil, fmt.Errorf("format periode tidak valid: %s", periode)
+	}
+	if periode >= time.Now().Format("2006-01") {
+		return nil, ErrPeriodeBelumBerakhir
+	}
+
+	var rekap *models.RekapSaldo
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := CekPeriodeTerbuka(tx, periode); err != nil {
+			return err
+		}
+
+		var terbuka []string
+		if err := tx.Model(&models.Jurnal{}).
+			Where("periode < ?", periode).
+			Where("periode NOT IN (?)", tx.Model(&models.RekapSaldo{}).Select("periode").Where("ditutup = ?", true)).
+			Distinct("periode").
+			Order("periode ASC").
+			Pluck("periode", &terbuka).Error; err != nil {
+			return err
+		}
+		if len(terbuka) > 0 {
+			return fmt.Errorf("%w: %s", ErrPeriodeSebelumnyaTerbuka, strings.Join(terbuka, ", "))
+		}
+
+		var err error
+		if rekap, err = NewLedgerService(tx).MaterialisasiRekap(periode); err != nil {
+			return err
+		}
+		sekarang := time.Now()
+		rekap.Ditutup, rekap.DitutupPada, rekap.DitutupOleh = true, &sekarang, &oleh
+		return tx.Model(&models.RekapSaldo{}).Where("periode = ?", periode).
+			Updates(map[string]interface{}{"ditutup": true, "ditutup_pada": sekarang, "ditutup_oleh": oleh}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rekap, nil
+}
+
+// Buka membuka kembali periode tutup buku terakhir agar transaksinya dapat diubah
+func (s *TutupBukuService) Buka(periode string) (*models.RekapSaldo, error) {
+	var rekap models.RekapSaldo
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("periode = ? AND ditutup = ?", periode, true).Limit(1).Find(&rekap).Error; err != nil {
+			return err
+		}
+		if rekap.IDSaldo == "" {
+			return ErrPeriodeBelumDitutup
+		}
+
+		var setelahnya int64
+		if err := tx.Model(&models.RekapSaldo{}).Where("periode > ? AND ditutup = ?", periode, true).Count(&setelahnya).Error; err != nil {
+			return err
+		}
+		if setelahnya > 0 {
+			return ErrBukanTutupBukuTerakhir
+		}
+
+		rekap.Ditutup, rekap.DitutupPada, rekap.DitutupOleh = false, nil, nil
+		return tx.Model(&models.RekapSaldo{}).Where("periode = ?", periode).
+			Updates(map[string]interface{}{"ditutup": false, "ditutup_pada": nil, "ditutup_oleh": nil}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &rekap, nil
+}
+
+// Koreksi mencatat koreksi atas periode yang sudah ditutup sebagai jurnal penyesuaian di periode berjalan
+func (s *TutupBukuService) Koreksi(periodeAcuan string, dana models.DanaKoreksi, nominal float64, keterangan, oleh string) (*models.KoreksiSaldo, error) {
+	var akun models.Akun
+	switch dana {
+	case models.DanaSyahriah:
+		akun = models.AkunKasSyahriah
+	case models.DanaDonasi:
+		akun = models.AkunKasDonasi
+	default:
+		return nil, fmt.Errorf("dana koreksi tidak valid: %s", dana)
+	}
+	sen := keSen(nominal)
+	if sen == 0 {
+		return nil, errors.New("nominal koreksi tidak boleh 0")
+	}
+
+	sekarang := time.Now()
+	koreksi := models.KoreksiSaldo{
+		IDKoreksi:    uuid.New().String(),
+		Periode:      sekarang.Format("2006-01"),
+		PeriodeAcuan: periodeAcuan,
+		Dana:         dana,
+		Nominal:      float64(sen) / 100,
+		Keterangan:   keterangan,
+		DicatatOleh:  oleh,
+	}
+
+	entri := []EntriBaru{
+		{Akun: akun, Debit: float64(sen) / 100},
+		{Akun: models.AkunPenyesuaianSaldo, Kredit: float64(sen) / 100},
+	}
+	if sen < 0 {
+		entri = []EntriBaru{
+			{Akun: akun, Kredit: float64(-sen) / 100},
+			{Akun: models.AkunPenyesuaianSaldo, Debit: float64(-sen) / 100},
+		}
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var acuan int64
+		if err := tx.Model(&models.RekapSaldo{}).Where("periode = ? AND ditutup = ?", periodeAcuan, true).Count(&acuan).Error; err != nil {
+			return err
+		}
+		if acuan == 0 {
+			return fmt.Errorf("%w: %s, ubah transaksinya secara langsung", ErrPeriodeBelumDitutup, periodeAcuan)
+		}
+		if err := tx.Create(&koreksi).Error; err != nil {
+			return err
+		}
+		ket := fmt.Sprintf("Koreksi saldo %s atas periode %s: %s", dana, periodeAcuan, keterangan)
+		_, err := NewLedgerService(tx).PostJurnal(koreksi.Periode, sekarang, TargetKoreksiSaldo, koreksi.IDKoreksi, ket, oleh, entri)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &koreksi, nil
+}
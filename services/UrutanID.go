@@ -0,0 +1,136 @@
+package services
+
+import (
+	"fmt"
+	"tpq_asysyafii/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// formatIDUser menentukan prefix dan lebar minimal nomor ID per role.
+// Lebar hanya batas minimal: setelah W999 berikutnya W1000, bukan tabrakan.
+var formatIDUser = map[models.UserRole]struct {
+	Prefix string
+	Lebar  int
+}{
+	models.RoleSuperAdmin: {"SA", 2},
+	models.RoleAdmin:      {"A", 3},
+	models.RoleWali:       {"W", 3},
+	models.RoleBendahara:  {"B", 3},
+}
+
+// formatIDLain dipakai untuk role tambahan yang didefinisikan lewat file izin
+var formatIDLain = struct {
+	Prefix string
+	Lebar  int
+}{"U", 3}
+
+// UrutanIDService membagikan nomor urut ID dari tabel counter, aman dipakai bersamaan
+type UrutanIDService struct {
+	db *gorm.DB
+}
+
+func NewUrutanIDService(db *gorm.DB) *UrutanIDService {
+	return &UrutanIDService{db: db}
+}
+
+// AlokasiIDUser mengambil ID user berikutnya untuk role tertentu (SA01, A001, W001, ...)
+func (s *UrutanIDService) AlokasiIDUser(role models.UserRole) (string, error) {
+	format, ok := formatIDUser[role]
+	if !ok {
+		if !PeranDikenal(string(role)) {
+			return "", fmt.Errorf("role tidak valid")
+		}
+		format = formatIDLain
+	}
+
+	var id string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		urutan, err := s.kunciUrutan(tx, format.Prefix, s.nomorTerbesar)
+		if err != nil {
+			return err
+		}
+
+		// Lewati nomor yang ternyata sudah dipakai (misalnya user yang dibuat manual di database)
+		for {
+			urutan.Terakhir++
+			id = fmt.Sprintf("%s%0*d", format.Prefix, format.Lebar, urutan.Terakhir)
+
+			var jumlah int64
+			if err := tx.Model(&models.User{}).Where("id_user = ?", id).Count(&jumlah).Error; err != nil {
+				return err
+			}
+			if jumlah == 0 {
+				break
+			}
+		}
+
+		return tx.Model(&models.UrutanID{}).
+			Where("prefix = ?", format.Prefix).
+			Update("terakhir", urutan.Terakhir).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// NomorBerikutnya mengambil nomor urut berikutnya untuk nomor dokumen (misalnya kwitansi).
+// Counter baru dimulai dari 1. Panggil di dalam transaksi yang menyimpan dokumennya agar
+// nomor yang gagal disimpan ikut dibatalkan dan tidak ada nomor yang terlewat.
+func (s *UrutanIDService) NomorBerikutnya(prefix string) (int64, error) {
+	var nomor int64
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		urutan, err := s.kunciUrutan(tx, prefix, func(*gorm.DB, string) (int64, error) { return 0, nil })
+		if err != nil {
+			return err
+		}
+		nomor = urutan.Terakhir + 1
+		return tx.Model(&models.UrutanID{}).
+			Where("prefix = ?", prefix).
+			Update("terakhir", nomor).Error
+	})
+	return nomor, err
+}
+
+// kunciUrutan membuat baris counter jika belum ada (diisi dari nomor terbesar yang sudah dipakai),
+// lalu mengunci baris tersebut sampai transaksi selesai. Nilai counter dibaca ulang setelah terkunci.
+func (s *UrutanIDService) kunciUrutan(tx *gorm.DB, prefix string, terbesar func(*gorm.DB, string) (int64, error)) (*models.UrutanID, error) {
+	// Cek keberadaan baris tanpa kunci: SELECT ... FOR UPDATE pada baris yang belum ada memasang
+	// gap lock, sehingga dua transaksi pertama yang sama-sama membuat baris akan saling deadlock
+	var urutan models.UrutanID
+	err := tx.Where("prefix = ?", prefix).
+		Limit(1).
+		Find(&urutan).Error
+	if err != nil {
+		return nil, err
+	}
+	if urutan.Prefix == "" {
+		terakhir, err := terbesar(tx, prefix)
+		if err != nil {
+			return nil, err
+		}
+		awal := models.UrutanID{Prefix: prefix, Terakhir: terakhir}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&awal).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("prefix = ?", prefix).
+		First(&urutan).Error; err != nil {
+		return nil, err
+	}
+	return &urutan, nil
+}
+
+// nomorTerbesar mencari nomor terbesar dari ID yang sudah ada secara numerik (bukan urutan string)
+func (s *UrutanIDService) nomorTerbesar(tx *gorm.DB, prefix string) (int64, error) {
+	var terbesar int64
+	err := tx.Model(&models.User{}).
+		Select("COALESCE(MAX(CAST(SUBSTRING(id_user, ?) AS UNSIGNED)), 0)", len(prefix)+1).
+		Where("id_user LIKE ? AND SUBSTRING(id_user, ?) REGEXP '^[0-9]+$'", prefix+"%", len(prefix)+1).
+		Scan(&terbesar).Error
+	return terbesar, err
+}
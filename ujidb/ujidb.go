@@ -0,0 +1,112 @@
+// Package ujidb menyiapkan database MySQL untuk test yang memanggil controller atau route
+package ujidb
+
+import (
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"tpq_asysyafii/config"
+	"tpq_asysyafii/models"
+
+	sqle "github.com/dolthub/go-mysql-server"
+	"github.com/dolthub/go-mysql-server/memory"
+	"github.com/dolthub/go-mysql-server/server"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var (
+	sekali   sync.Once
+	dbUji    *gorm.DB
+	errBuka  error
+	tertanam bool
+)
+
+// Buka membuka database MySQL khusus test dari TEST_DB_DSN, misalnya
+// "root:rahasia@tcp(127.0.0.1:3306)/tpq_test?parseTime=true&loc=Local", memigrasi semua tabel sekali
+// per proses test, lalu mengarahkan config.DB ke database tersebut karena sebagian handler memakainya.
+// Jika TEST_DB_DSN kosong, test memakai server MySQL tertanam di memori yang hilang saat proses selesai.
+// Jangan arahkan TEST_DB_DSN ke database produksi: test menambah data.
+func Buka(t *testing.T) *gorm.DB {
+	t.Helper()
+	sekali.Do(func() {
+		cfg := &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)}
+		dsn := os.Getenv("TEST_DB_DSN")
+		if dsn == "" {
+			tertanam = true
+			// Server tertanam tidak mendukung SAVEPOINT, jadi transaksi bertingkat memakai transaksi induknya
+			cfg.DisableNestedTransaction = true
+			dsn, errBuka = jalankanServerTertanam()
+			if errBuka != nil {
+				return
+			}
+		}
+		dbUji, errBuka = gorm.Open(mysql.Open(dsn), cfg)
+		if errBuka == nil {
+			errBuka = config.Migrasi(dbUji)
+		}
+	})
+	if errBuka != nil {
+		t.Fatalf("gagal menyiapkan database test: %v", errBuka)
+	}
+	config.DB = dbUji
+	return dbUji
+}
+
+// ButuhKunciBaris melewati test yang menguji request paralel bila database test adalah server tertanam,
+// karena server itu tidak benar-benar mengunci baris pada SELECT ... FOR UPDATE.
+// Jalankan test seperti ini dengan TEST_DB_DSN yang menunjuk ke MySQL sungguhan.
+func ButuhKunciBaris(t *testing.T) {
+	t.Helper()
+	if tertanam {
+		t.Skip("server MySQL tertanam tidak mengunci baris, isi TEST_DB_DSN untuk menjalankan test ini")
+	}
+}
+
+// jalankanServerTertanam menyalakan server MySQL di memori pada port acak dan mengembalikan DSN-nya
+func jalankanServerTertanam() (string, error) {
+	db := memory.NewDatabase("tpq_test")
+	db.BaseDatabase.EnablePrimaryKeyIndexes()
+	pro := memory.NewDBProvider(db)
+	// Log koneksi server tertanam hanya memenuhi keluaran test
+	logrus.SetLevel(logrus.ErrorLevel)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	s, err := server.NewServer(server.Config{Protocol: "tcp", Listener: l}, sqle.NewDefault(pro), sql.NewContext, memory.NewSessionBuilder(pro), nil)
+	if err != nil {
+		l.Close()
+		return "", err
+	}
+	go s.Start()
+	return "root:@tcp(" + l.Addr().String() + ")/tpq_test?parseTime=true&loc=Local", nil
+}
+
+// Buat menyimpan data test dan menghentikan test jika gagal
+func Buat(t *testing.T, db *gorm.DB, data interface{}) {
+	t.Helper()
+	if err := db.Create(data).Error; err != nil {
+		t.Fatalf("gagal membuat data test %T: %v", data, err)
+	}
+}
+
+// BuatUser membuat user aktif dengan role tertentu
+func BuatUser(t *testing.T, db *gorm.DB, role models.UserRole) models.User {
+	t.Helper()
+	user := models.User{
+		IDUser:      uuid.New().String(),
+		NamaLengkap: "User Test " + string(role),
+		Password:    "-",
+		Role:        role,
+		StatusAktif: true,
+	}
+	Buat(t, db, &user)
+	return user
+}
@@ -1,8 +1,12 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -11,6 +15,12 @@ import (
 // Ambil JWT_SECRET dari .env atau default untuk dev
 var jwtKey = []byte(getJWTSecret())
 
+// Masa berlaku token, bisa diatur lewat .env (dalam menit / jam)
+var (
+	AccessTokenTTL  = getDurasiEnv("JWT_ACCESS_TTL_MENIT", 15, time.Minute)
+	RefreshTokenTTL = getDurasiEnv("JWT_REFRESH_TTL_JAM", 30*24, time.Hour)
+)
+
 func getJWTSecret() string {
 	secret := os.Getenv("JWT_SECRET")
 	if secret == "" {
@@ -19,21 +29,49 @@ func getJWTSecret() string {
 	return secret
 }
 
-// Generate JWT Token
-func GenerateJWT(userID string, role string) (string, error) {
+func getDurasiEnv(key string, fallback int, satuan time.Duration) time.Duration {
+	if nilai, err := strconv.Atoi(os.Getenv(key)); err == nil && nilai > 0 {
+		return time.Duration(nilai) * satuan
+	}
+	return time.Duration(fallback) * satuan
+}
+
+// Generate JWT access token berumur pendek.
+// sesiID mengikat token ke sesi refresh token, versiToken harus sama dengan users.versi_token.
+func GenerateJWT(userID string, role string, sesiID string, versiToken int) (string, error) {
 	claims := jwt.MapClaims{
 		"user_id": userID,
 		"role":    role,
-		"exp":     time.Now().Add(72 * time.Hour).Unix(), // expired 3 hari
-		"iat":     time.Now().Unix(),                     // issued at
+		"sid":     sesiID,
+		"ver":     versiToken,
+		"exp":     time.Now().Add(AccessTokenTTL).Unix(),
+		"iat":     time.Now().Unix(), // issued at
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(jwtKey)
 }
 
+// GenerateRefreshToken membuat token acak (opaque) untuk refresh, yang disimpan di server hanya hash-nya
+func GenerateRefreshToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// HashToken menghasilkan hash SHA-256 dari token untuk disimpan di database
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 // Parse token (return claims)
 func ParseToken(tokenStr string) (jwt.MapClaims, error) {
 	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("metode signing tidak valid: %v", token.Header["alg"])
+		}
 		return jwtKey, nil
 	})
 
@@ -49,7 +87,18 @@ func ParseToken(tokenStr string) (jwt.MapClaims, error) {
 	return claims, nil
 }
 
-// Verify token (lebih strict)
+// Verify token (lebih strict): access token wajib membawa sid dan ver.
+// Token lama tanpa keduanya tidak bisa dicabut per sesi sehingga ditolak dan user harus login ulang.
 func VerifyToken(tokenStr string) (jwt.MapClaims, error) {
-	return ParseToken(tokenStr)
+	claims, err := ParseToken(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	if sid, ok := claims["sid"].(string); !ok || sid == "" {
+		return nil, fmt.Errorf("token tidak memiliki sesi")
+	}
+	if _, ok := claims["ver"].(float64); !ok {
+		return nil, fmt.Errorf("token tidak memiliki versi")
+	}
+	return claims, nil
 }